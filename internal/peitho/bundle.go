@@ -0,0 +1,186 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package peitho
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/internal/peitho/config"
+	"github.com/tianrandailove/peitho/internal/peitho/options"
+	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/app"
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/bundle"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+	"github.com/tianrandailove/peitho/pkg/signature"
+	"github.com/tianrandailove/peitho/pkg/token"
+)
+
+// newBundleCommand create the air-gapped bundle commands, they read the same configuration as the server.
+func newBundleCommand() *app.Command {
+	exportOpts := options.NewOptions()
+	importOpts := options.NewOptions()
+
+	cmd := app.NewCommand("bundle", "Export and import air-gapped bundles")
+	cmd.AddCommands(
+		app.NewCommand("export OUTPUT [IMAGE...]",
+			"Export chaincode images, base images and the puller image into a signed bundle",
+			app.WithCommandOptions(exportOpts),
+			app.WithCommandRunFunc(exportBundle(exportOpts)),
+		),
+		app.NewCommand("import BUNDLE",
+			"Import a bundle into the artifact store or the registries",
+			app.WithCommandOptions(importOpts),
+			app.WithCommandRunFunc(importBundle(importOpts)),
+		),
+	)
+
+	return cmd
+}
+
+func exportBundle(opts *options.Options) app.RunCommandFunc {
+	return func(args []string) error {
+		if len(args) == 0 {
+			return errors.New("bundle output file is required")
+		}
+
+		log.Init(opts.Log)
+		defer log.Flush()
+
+		cfg, err := config.CreateConfigFromOptions(opts)
+		if err != nil {
+			return err
+		}
+
+		bundleSrv, err := newBundleService(cfg)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Create(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		manifest, err := bundleSrv.Export(context.Background(), args[1:], file)
+		if err != nil {
+			os.Remove(args[0])
+
+			return err
+		}
+
+		printBundle(manifest)
+
+		return nil
+	}
+}
+
+func importBundle(opts *options.Options) app.RunCommandFunc {
+	return func(args []string) error {
+		if len(args) != 1 {
+			return errors.New("one bundle file is required")
+		}
+
+		log.Init(opts.Log)
+		defer log.Flush()
+
+		cfg, err := config.CreateConfigFromOptions(opts)
+		if err != nil {
+			return err
+		}
+
+		bundleSrv, err := newBundleService(cfg)
+		if err != nil {
+			return err
+		}
+
+		file, err := os.Open(args[0])
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+
+		manifest, err := bundleSrv.Import(context.Background(), file)
+		if err != nil {
+			return err
+		}
+
+		printBundle(manifest)
+
+		return nil
+	}
+}
+
+// newBundleService create the services the bundle commands need, the base image keeper is not started.
+func newBundleService(cfg *config.Config) (service.BundleSrv, error) {
+	k8sService, err := k8s.NewK8sService(cfg.K8sOption)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerService, err := docker.NewDockerService(cfg.DockerOption, cfg.PeithoOption)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := watchRegistryCredentials(context.Background(), cfg.DockerOption, dockerService, k8sService); err != nil {
+		return nil, err
+	}
+
+	baseImages, err := baseimage.NewPeithoBaseImages(dockerService, cfg.BaseImageOption)
+	if err != nil {
+		return nil, err
+	}
+
+	signer, err := token.NewSigner(cfg.PeithoOption)
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := artifact.NewStore(cfg.PeithoOption.ArtifactDir)
+	if err != nil {
+		return nil, err
+	}
+
+	client := distribution.NewClient(distribution.Options{
+		Credentials: dockerService.BasicAuth,
+		PlainHTTP:   dockerService.IsInsecure,
+	})
+
+	cosigner, err := signature.NewSigner(cfg.SigningOption)
+	if err != nil {
+		return nil, err
+	}
+
+	return service.NewService(
+		dockerService,
+		k8sService,
+		signer,
+		store,
+		client,
+		cosigner,
+		sbom.NewScanner(cfg.ScannerOption),
+		baseImages,
+		builder.NewBuilder(cfg.BuilderOption, dockerService, store, client),
+		cfg.ChaincodeCRDOption,
+	).Bundle(), nil
+}
+
+func printBundle(manifest *bundle.Manifest) {
+	for _, image := range manifest.Images {
+		fmt.Printf("%-10s %s %s\n", image.Role, image.Digest, image.Name)
+	}
+}
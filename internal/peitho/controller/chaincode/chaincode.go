@@ -0,0 +1,17 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import "github.com/tianrandailove/peitho/internal/peitho/service"
+
+type ChaincodeController struct {
+	srv service.Service
+}
+
+func NewChaincodeController(srv service.Service) *ChaincodeController {
+	return &ChaincodeController{
+		srv: srv,
+	}
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// Get get the chaincode container by its container id or deployment name.
+func (cc *ChaincodeController) Get(c *gin.Context) {
+	log.L(c).Info("get chaincode function called.")
+
+	id := c.Param("id")
+
+	chaincode, err := cc.srv.Chaincodes().Get(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNoSuchChaincode) {
+			c.JSON(404, gin.H{
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(200, chaincode)
+}
@@ -0,0 +1,29 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// List list the inventory of the chaincode containers.
+func (cc *ChaincodeController) List(c *gin.Context) {
+	log.L(c).Info("list chaincode function called.")
+
+	chaincodes, err := cc.srv.Chaincodes().List(context.Background())
+	if err != nil {
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(200, chaincodes)
+}
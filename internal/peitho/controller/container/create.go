@@ -12,6 +12,8 @@ import (
 
 	"github.com/tianrandailove/peitho/internal/peitho/service"
 	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+	"github.com/tianrandailove/peitho/pkg/signature"
 )
 
 func (cc *ContainerController) Create(c *gin.Context) {
@@ -33,6 +35,11 @@ func (cc *ContainerController) Create(c *gin.Context) {
 			c.JSON(404, gin.H{
 				"message": err.Error(),
 			})
+		} else if errors.Is(err, signature.ErrUnsigned) || errors.Is(err, signature.ErrInvalidSignature) ||
+			errors.Is(err, sbom.ErrBlocked) {
+			c.JSON(403, gin.H{
+				"message": err.Error(),
+			})
 		} else {
 			c.JSON(500, gin.H{
 				"message": err.Error(),
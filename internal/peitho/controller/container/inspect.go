@@ -0,0 +1,40 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package container
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+func (cc *ContainerController) Inspect(c *gin.Context) {
+	log.L(c).Info("inspect container function called.")
+
+	id := c.Param("id")
+
+	value, err := cc.srv.Containers().Inspect(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, service.ErrNoSuchContainer) {
+			c.JSON(404, gin.H{
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.JSON(200, value)
+}
@@ -0,0 +1,23 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package health
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Check report the base images, it responds 503 until every one is ready.
+func (hc *HealthController) Check(c *gin.Context) {
+	health := hc.srv.Health().Check(context.Background())
+	if !health.Healthy {
+		c.JSON(503, health)
+
+		return
+	}
+
+	c.JSON(200, health)
+}
@@ -0,0 +1,17 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package health
+
+import "github.com/tianrandailove/peitho/internal/peitho/service"
+
+type HealthController struct {
+	srv service.Service
+}
+
+func NewHealthController(srv service.Service) *HealthController {
+	return &HealthController{
+		srv: srv,
+	}
+}
@@ -5,12 +5,17 @@
 package image
 
 import (
+	"context"
 	"fmt"
-	"os"
+	"io"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"github.com/marmotedu/errors"
 
+	"github.com/tianrandailove/peitho/pkg/compress"
 	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/token"
 )
 
 func (ic *ImageController) Download(c *gin.Context) {
@@ -22,15 +27,41 @@ func (ic *ImageController) Download(c *gin.Context) {
 
 		return
 	}
-	fileName := fmt.Sprintf("%s.tar", imageID)
-	if _, err := os.Stat(fileName); err != nil {
-		log.Errorf("file not exists:%v", err)
+
+	downloadToken := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+
+	reader, encoding, err := ic.srv.Images().
+		Download(context.Background(), imageID, downloadToken, c.GetHeader("Accept-Encoding"))
+	if err != nil {
+		log.Errorf("download image failed: %v", err)
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrExpiredToken) {
+			c.JSON(401, gin.H{"message": err.Error()})
+
+			return
+		}
+
 		c.JSON(404, gin.H{"message": err.Error()})
 
 		return
 	}
+	defer reader.Close()
+
+	fileName := fmt.Sprintf("%s.tar", imageID)
 	c.Header("Content-Type", "application/octet-stream")
 	c.Header("Content-Disposition", "attachment; filename="+fileName)
 	c.Header("Content-Transfer-Encoding", "binary")
-	c.File(fileName)
+	c.Header("Vary", "Accept-Encoding")
+	if encoding != compress.NONE {
+		c.Header("Content-Encoding", encoding)
+	}
+	c.Writer.WriteHeader(200)
+
+	wlen, err := io.Copy(c.Writer, reader)
+	if err != nil {
+		log.Errorf("copy %s to response failed: %v", fileName, err)
+
+		return
+	}
+
+	log.Debugf("download %s size: %d byte", fileName, wlen)
 }
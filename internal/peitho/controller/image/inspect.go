@@ -17,6 +17,13 @@ import (
 func (ic *ImageController) Inspect(c *gin.Context) {
 	log.L(c).Info("inspect image function called.")
 
+	// /images/:name/sbom shares the route of /images/:name/json
+	if c.Param("json") == "/sbom" {
+		ic.SBOM(c)
+
+		return
+	}
+
 	imageID := c.Param("name")
 
 	value, err := ic.srv.Images().Inspect(context.Background(), imageID)
@@ -0,0 +1,39 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+)
+
+func (ic *ImageController) SBOM(c *gin.Context) {
+	log.L(c).Info("get image sbom function called.")
+
+	data, err := ic.srv.Images().SBOM(context.Background(), c.Param("name"))
+	if err != nil {
+		if errors.Is(err, service.ErrNoSuchImage) {
+			c.JSON(404, gin.H{
+				"message": err.Error(),
+			})
+
+			return
+		}
+
+		c.JSON(500, gin.H{
+			"message": err.Error(),
+		})
+
+		return
+	}
+
+	c.Data(200, sbom.MediaType, data)
+}
@@ -0,0 +1,43 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package image
+
+import (
+	"context"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// Token exchange the service account token of the puller for a short-lived download token.
+func (ic *ImageController) Token(c *gin.Context) {
+	log.L(c).Info("issue download token function called.")
+
+	credential := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if credential == "" {
+		c.JSON(401, gin.H{"message": "credential not be empty"})
+
+		return
+	}
+
+	downloadToken, err := ic.srv.Images().IssueToken(context.Background(), c.Param("name"), credential)
+	if err != nil {
+		if errors.Is(err, k8s.ErrCredentialRejected) {
+			c.JSON(401, gin.H{"message": err.Error()})
+
+			return
+		}
+
+		c.JSON(500, gin.H{"message": err.Error()})
+
+		return
+	}
+
+	c.JSON(200, gin.H{"token": downloadToken})
+}
@@ -0,0 +1,92 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package registry
+
+import (
+	"context"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+const apiVersionHeader = "Docker-Distribution-API-Version"
+
+// Distribution dispatch /v2/<name>/manifests/<reference> and /v2/<name>/blobs/<digest>.
+func (rc *RegistryController) Distribution(c *gin.Context) {
+	c.Header(apiVersionHeader, "registry/2.0")
+
+	path := strings.Trim(c.Param("path"), "/")
+	// api version check
+	if path == "" {
+		c.JSON(200, gin.H{})
+
+		return
+	}
+
+	if i := strings.LastIndex(path, "/manifests/"); i > 0 {
+		rc.manifest(c, path[:i], path[i+len("/manifests/"):])
+
+		return
+	}
+
+	if i := strings.LastIndex(path, "/blobs/"); i > 0 {
+		rc.blob(c, path[:i], path[i+len("/blobs/"):])
+
+		return
+	}
+
+	registryError(c, 404, "NAME_UNKNOWN", "repository name not known to registry")
+}
+
+func (rc *RegistryController) manifest(c *gin.Context, name string, reference string) {
+	log.L(c).Infof("get manifest %s:%s function called.", name, reference)
+
+	data, dgst, err := rc.srv.Registry().Manifest(context.Background(), name, reference)
+	if err != nil {
+		registryError(c, 404, "MANIFEST_UNKNOWN", err.Error())
+
+		return
+	}
+
+	c.Header("Docker-Content-Digest", dgst)
+	c.Header("Content-Length", strconv.Itoa(len(data)))
+	c.Data(200, ocispec.MediaTypeImageManifest, data)
+}
+
+func (rc *RegistryController) blob(c *gin.Context, name string, dgst string) {
+	log.L(c).Infof("get blob %s@%s function called.", name, dgst)
+
+	reader, size, err := rc.srv.Registry().Blob(context.Background(), name, dgst)
+	if err != nil {
+		registryError(c, 404, "BLOB_UNKNOWN", err.Error())
+
+		return
+	}
+	defer reader.Close()
+
+	c.Header("Docker-Content-Digest", dgst)
+	c.Header("Content-Length", strconv.FormatInt(size, 10))
+	c.Header("Content-Type", "application/octet-stream")
+	c.Writer.WriteHeader(200)
+
+	if c.Request.Method == "HEAD" {
+		return
+	}
+
+	if _, err := io.Copy(c.Writer, reader); err != nil {
+		log.Errorf("copy blob %s to response failed: %v", dgst, err)
+	}
+}
+
+func registryError(c *gin.Context, status int, code string, message string) {
+	c.JSON(status, gin.H{
+		"errors": []gin.H{{"code": code, "message": message}},
+	})
+}
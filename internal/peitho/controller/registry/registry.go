@@ -0,0 +1,17 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package registry
+
+import "github.com/tianrandailove/peitho/internal/peitho/service"
+
+type RegistryController struct {
+	srv service.Service
+}
+
+func NewRegistryController(srv service.Service) *RegistryController {
+	return &RegistryController{
+		srv: srv,
+	}
+}
@@ -0,0 +1,51 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package peitho
+
+import (
+	"context"
+	"time"
+
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// watchRegistryCredentials keep the registry credentials up to date from the docker config file or
+// the dockerconfigjson secret, the file is mirrored into the secret so chaincode pods can pull with it.
+func watchRegistryCredentials(
+	ctx context.Context,
+	opt *options.DockerOption,
+	dockerService *docker.Docker,
+	k8sService k8s.K8sService,
+) error {
+	var source docker.CredentialSource
+
+	switch {
+	case opt.Registry.ConfigFile != "":
+		source = docker.FileCredentialSource(opt.Registry.ConfigFile)
+		if opt.Registry.Secret != "" {
+			readFile := source
+			source = func(ctx context.Context) ([]byte, error) {
+				data, err := readFile(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				return data, k8sService.ApplyDockerConfigSecret(ctx, opt.Registry.Secret, data)
+			}
+		}
+	case opt.Registry.Secret != "":
+		source = func(ctx context.Context) ([]byte, error) {
+			return k8sService.GetDockerConfigSecret(ctx, opt.Registry.Secret)
+		}
+	default:
+		return nil
+	}
+
+	interval := time.Duration(opt.Registry.RefreshInterval) * time.Second
+
+	return dockerService.Credentials.Watch(ctx, source, interval)
+}
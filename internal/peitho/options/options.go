@@ -20,6 +20,13 @@ type Options struct {
 	Log          *log.Options           `json:"log"    mapstructure:"log"`
 	Sweeperption *options.SweeperOption `json:"sweeper" mapstructure:"sweeper"`
 	PeithoOption *options.PeithoOption `json:"peitho" mapstructure:"peitho"`
+	SigningOption *options.SigningOption `json:"signing" mapstructure:"signing"`
+	ScannerOption *options.ScannerOption `json:"scanner" mapstructure:"scanner"`
+	BaseImageOption *options.BaseImageOption `json:"baseimage" mapstructure:"baseimage"`
+	BuilderOption *options.BuilderOption `json:"builder" mapstructure:"builder"`
+	LeaderElectionOption *options.LeaderElectionOption `json:"leader-election" mapstructure:"leader-election"`
+	ChaincodeCRDOption *options.ChaincodeCRDOption `json:"chaincode-crd" mapstructure:"chaincode-crd"`
+	DriftOption *options.DriftOption `json:"drift" mapstructure:"drift"`
 
 }
 
@@ -31,6 +38,13 @@ func NewOptions() *Options {
 		Log:          log.NewOptions(),
 		Sweeperption: options.NewSweeperOption(),
 		PeithoOption: options.NewPeithoOption(),
+		SigningOption: options.NewSigningOption(),
+		ScannerOption: options.NewScannerOption(),
+		BaseImageOption: options.NewBaseImageOption(),
+		BuilderOption: options.NewBuilderOption(),
+		LeaderElectionOption: options.NewLeaderElectionOption(),
+		ChaincodeCRDOption: options.NewChaincodeCRDOption(),
+		DriftOption: options.NewDriftOption(),
 	}
 
 	return &option
@@ -42,6 +56,13 @@ func (o *Options) Flags() (fss cliflag.NamedFlagSets) {
 	o.Log.AddFlags(fss.FlagSet("log"))
 	o.Sweeperption.AddFlags(fss.FlagSet("sweeper"))
 	o.PeithoOption.AddFlags(fss.FlagSet("peitho"))
+	o.SigningOption.AddFlags(fss.FlagSet("signing"))
+	o.ScannerOption.AddFlags(fss.FlagSet("scanner"))
+	o.BaseImageOption.AddFlags(fss.FlagSet("baseimage"))
+	o.BuilderOption.AddFlags(fss.FlagSet("builder"))
+	o.LeaderElectionOption.AddFlags(fss.FlagSet("leader-election"))
+	o.ChaincodeCRDOption.AddFlags(fss.FlagSet("chaincode-crd"))
+	o.DriftOption.AddFlags(fss.FlagSet("drift"))
   
 	return fss
 }
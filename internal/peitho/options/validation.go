@@ -11,6 +11,15 @@ func (o *Options) Validate() []error {
 	errs = append(errs, o.K8sOption.Validate()...)
 	errs = append(errs, o.DockerOption.Validate()...)
 	errs = append(errs, o.Log.Validate()...)
+	errs = append(errs, o.PeithoOption.Validate()...)
+	errs = append(errs, o.SigningOption.Validate()...)
+	errs = append(errs, o.ScannerOption.Validate()...)
+	errs = append(errs, o.BaseImageOption.Validate()...)
+	errs = append(errs, o.BuilderOption.Validate()...)
+	errs = append(errs, o.Sweeperption.Validate()...)
+	errs = append(errs, o.LeaderElectionOption.Validate()...)
+	errs = append(errs, o.ChaincodeCRDOption.Validate()...)
+	errs = append(errs, o.DriftOption.Validate()...)
 
 	return errs
 }
@@ -7,25 +7,33 @@ package peitho
 import (
 	"github.com/gin-gonic/gin"
 
+	"github.com/tianrandailove/peitho/internal/peitho/controller/chaincode"
 	"github.com/tianrandailove/peitho/internal/peitho/controller/container"
+	"github.com/tianrandailove/peitho/internal/peitho/controller/health"
 	"github.com/tianrandailove/peitho/internal/peitho/controller/image"
+	"github.com/tianrandailove/peitho/internal/peitho/controller/registry"
 	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/lifecycle"
+	"github.com/tianrandailove/peitho/pkg/options"
 )
 
-func initRouter(g *gin.Engine) {
-	installController(g)
+func initRouter(g *gin.Engine, tracker *lifecycle.Tracker, imageMode string) {
+	installController(g, tracker, imageMode)
 }
 
-func installController(g *gin.Engine) {
+func installController(g *gin.Engine, tracker *lifecycle.Tracker, imageMode string) {
+	drain := drainRequests(tracker)
+
 	containerController := container.NewContainerController(service.Srv)
 
 	g.HEAD("/_ping", containerController.Ping)
 	g.GET("/_ping", containerController.Ping)
 
-	g.POST("/containers/create", containerController.Create)
+	g.POST("/containers/create", drain, containerController.Create)
 
-	g.PUT("/containers/:id/archive", containerController.Upload)
+	g.PUT("/containers/:id/archive", drain, containerController.Upload)
 	g.GET("/containers/:id/archive", containerController.Fetch)
+	g.GET("/containers/:id/json", containerController.Inspect)
 
 	g.POST("/containers/:id/attach", containerController.Attach)
 	g.POST("/containers/:id/start", containerController.Start)
@@ -38,6 +46,34 @@ func installController(g *gin.Engine) {
 
 	g.POST("/images/create", imageController.Create)
 	g.GET("/images/:name/*json", imageController.Inspect)
-	g.POST("/build", imageController.Build)
+	g.POST("/build", drain, imageController.Build)
 	g.GET("/tar/:name", imageController.Download)
+	g.POST("/tar/:name/token", imageController.Token)
+
+	// the nodes pull without credentials from the embedded registry, it is not served in other modes
+	if imageMode == options.IMAGE_MODE_EMBEDDED {
+		registryController := registry.NewRegistryController(service.Srv)
+
+		g.GET("/v2/*path", registryController.Distribution)
+		g.HEAD("/v2/*path", registryController.Distribution)
+	}
+
+	healthController := health.NewHealthController(service.Srv)
+
+	g.GET("/healthz", healthController.Check)
+
+	chaincodeController := chaincode.NewChaincodeController(service.Srv)
+
+	g.GET("/chaincodes", chaincodeController.List)
+	g.GET("/chaincodes/:id", chaincodeController.Get)
+}
+
+// drainRequests track the requests, so they are completed before the server is closed.
+func drainRequests(tracker *lifecycle.Tracker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		done := tracker.Begin()
+		defer done()
+
+		c.Next()
+	}
 }
@@ -0,0 +1,43 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package peitho
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/tianrandailove/peitho/pkg/lifecycle"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func Test_installController_registry(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		mode string
+		want int
+	}{
+		{mode: options.IMAGE_MODE_EMBEDDED, want: http.StatusOK},
+		{mode: options.IMAGE_MODE_DELIVERY, want: http.StatusNotFound},
+		{mode: options.IMAGE_MODE_REGISTRY, want: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			engine := gin.New()
+			installController(engine, lifecycle.NewTracker(), tt.mode)
+
+			for _, method := range []string{http.MethodGet, http.MethodHead} {
+				recorder := httptest.NewRecorder()
+				engine.ServeHTTP(recorder, httptest.NewRequest(method, "/v2/", nil))
+				if recorder.Code != tt.want {
+					t.Errorf("%s /v2/ in %s mode = %d, want %d", method, tt.mode, recorder.Code, tt.want)
+				}
+			}
+		})
+	}
+}
@@ -5,29 +5,58 @@
 package peitho
 
 import (
+	"context"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
 	"github.com/gin-gonic/gin"
-	"github.com/tianrandailove/peitho/pkg/sweeper"
 
 	"github.com/tianrandailove/peitho/internal/peitho/config"
 	"github.com/tianrandailove/peitho/internal/peitho/service"
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/chaincode"
+	"github.com/tianrandailove/peitho/pkg/distribution"
 	"github.com/tianrandailove/peitho/pkg/docker"
 	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/lifecycle"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+	"github.com/tianrandailove/peitho/pkg/signature"
+	"github.com/tianrandailove/peitho/pkg/sweeper"
+	"github.com/tianrandailove/peitho/pkg/token"
 )
 
-// Run runs the specified APIServer. This should never exit.
+// Run runs the specified APIServer until SIGTERM or interrupt, then stops it gracefully.
 func Run(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	// new k8s client
 	k8sService, err := k8s.NewK8sService(cfg.K8sOption)
 	if err != nil {
 		panic(err)
 	}
 
+	// label the chaincode deployments created before the ownership labels, the sweeper only selects owned ones
+	if _, err := k8sService.AdoptChaincodeResources(ctx); err != nil {
+		log.Errorf("adopt chaincode resources failed: %v", err)
+	}
+
 	// new sweeper
 	sweeper, err := sweeper.NewPeithoSweeper(k8sService, cfg.Sweeperption)
 	if err != nil {
 		panic(err)
 	}
-	go sweeper.Start()
+
+	// new chaincode resource controller
+	controller := chaincode.NewController(k8sService, cfg.ChaincodeCRDOption)
 
 	// new docker client
 	dockerService, err := docker.NewDockerService(cfg.DockerOption, cfg.PeithoOption)
@@ -35,13 +64,115 @@ func Run(cfg *config.Config) error {
 		panic(err)
 	}
 
+	// load registry credentials
+	if err := watchRegistryCredentials(ctx, cfg.DockerOption, dockerService, k8sService); err != nil {
+		panic(err)
+	}
+
+	// keep the builder and runtime images with the loaded credentials
+	baseImages, err := baseimage.NewPeithoBaseImages(dockerService, cfg.BaseImageOption)
+	if err != nil {
+		panic(err)
+	}
+
+	// new download token signer
+	signer, err := token.NewSigner(cfg.PeithoOption)
+	if err != nil {
+		panic(err)
+	}
+
+	// new artifact store
+	store, err := artifact.NewStore(cfg.PeithoOption.ArtifactDir)
+	if err != nil {
+		panic(err)
+	}
+
+	// new registry client
+	client := distribution.NewClient(distribution.Options{
+		Credentials: dockerService.BasicAuth,
+		PlainHTTP:   dockerService.IsInsecure,
+	})
+
+	// new image signer
+	cosigner, err := signature.NewSigner(cfg.SigningOption)
+	if err != nil {
+		panic(err)
+	}
+
+	// new sbom scanner
+	scanner := sbom.NewScanner(cfg.ScannerOption)
+
+	// new chaincode image builder
+	imageBuilder := builder.NewBuilder(cfg.BuilderOption, dockerService, store, client)
+
 	// new service
-	service.Srv = service.NewService(dockerService, k8sService)
+	service.Srv = service.NewService(
+		dockerService,
+		k8sService,
+		signer,
+		store,
+		client,
+		cosigner,
+		scanner,
+		baseImages,
+		imageBuilder,
+		cfg.ChaincodeCRDOption,
+	)
+
+	// the build, upload and create requests are drained on shutdown
+	tracker := lifecycle.NewTracker()
 
 	engine := gin.New()
-	engine.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/_ping"}}))
+	engine.Use(gin.LoggerWithConfig(gin.LoggerConfig{SkipPaths: []string{"/_ping", "/healthz"}}))
 
-	initRouter(engine)
+	initRouter(engine, tracker, dockerService.GetImageMode())
+
+	listener, err := net.Listen("tcp", address())
+	if err != nil {
+		log.Errorf("listen failed: %v", err)
+
+		return err
+	}
+	log.Infof("listening and serving HTTP on %s", listener.Addr())
+
+	// the server is added last, so it is stopped first and the workers outlive the drained requests
+	shutdown := time.Duration(cfg.PeithoOption.ShutdownTimeout) * time.Second
+	group := lifecycle.NewGroup(shutdown + 5*time.Second)
+	// the sweeper deletes deployments, the controller and the drift detector write them,
+	// they only run on the replica holding the lease
+	group.Add("sweeper, chaincode controller and drift detector", func(ctx context.Context) error {
+		return k8sService.Lead(ctx, cfg.LeaderElectionOption, func(ctx context.Context) {
+			var wg sync.WaitGroup
+			wg.Add(2)
+			go func() {
+				defer wg.Done()
+				controller.Start(ctx)
+			}()
+			go func() {
+				defer wg.Done()
+				if err := k8sService.DetectDrift(ctx, cfg.DriftOption); err != nil {
+					log.Errorf("detect drift failed: %v", err)
+				}
+			}()
+			sweeper.Start(ctx)
+			wg.Wait()
+		})
+	})
+	group.Add("base image keeper", func(ctx context.Context) error {
+		baseImages.Start(ctx)
+
+		return nil
+	})
+	group.Add("server", lifecycle.Serve(listener, &http.Server{Handler: engine}, tracker, shutdown))
+
+	return group.Run(ctx)
+}
+
+// address return the listen address of the server, the port can be set by PORT like gin.
+func address() string {
+	if port := os.Getenv("PORT"); port != "" {
+		return ":" + port
+	}
 
-	return engine.Run()
+	return ":8080"
 }
@@ -0,0 +1,173 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/bundle"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+// BundleSrv defines functions used to provision peitho in air-gapped environments.
+type BundleSrv interface {
+	// Export write the chaincode images, the base images and the puller image into a signed bundle
+	Export(ctx context.Context, images []string, w io.Writer) (*bundle.Manifest, error)
+	// Import load the bundle into the artifact store or the registries, depending on the image mode
+	Import(ctx context.Context, r io.Reader) (*bundle.Manifest, error)
+}
+
+type bundleService struct {
+	docker     docker.DockerService
+	store      *artifact.Store
+	client     *distribution.Client
+	cosigner   *signature.Signer
+	baseImages baseimage.BaseImageService
+	images     *imageService
+}
+
+var _ BundleSrv = (*bundleService)(nil)
+
+func newBundle(srv *service) *bundleService {
+	return &bundleService{
+		docker:     srv.docker,
+		store:      srv.store,
+		client:     srv.client,
+		cosigner:   srv.cosigner,
+		baseImages: srv.baseImages,
+		images:     newImage(srv),
+	}
+}
+
+// Export write the bundle, chaincode images are read from the artifact store if saved there, base images
+// and the puller image are pulled if missing on the docker host.
+func (b *bundleService) Export(ctx context.Context, images []string, w io.Writer) (*bundle.Manifest, error) {
+	sources := make([]bundle.Source, 0, len(images)+3)
+	for _, image := range images {
+		image := image
+		sources = append(sources, bundle.Source{Name: image, Role: bundle.ROLE_CHAINCODE, Open: func() (io.ReadCloser, error) {
+			if b.store.HasTar(image) {
+				return b.store.OpenTar(image)
+			}
+
+			return b.images.builder.Save(ctx, []string{image})
+		}})
+	}
+
+	if b.baseImages != nil {
+		for _, status := range b.baseImages.Status() {
+			sources = append(sources, b.localSource(ctx, status.Name(), bundle.ROLE_BASE))
+		}
+	}
+
+	if puller := b.docker.GetPullerImage(); puller != "" {
+		sources = append(sources, b.localSource(ctx, puller, bundle.ROLE_PULLER))
+	}
+
+	return bundle.Export(w, sources, b.cosigner)
+}
+
+// localSource save the image from the docker host, it is pulled first if missing.
+func (b *bundleService) localSource(ctx context.Context, image string, role string) bundle.Source {
+	return bundle.Source{Name: image, Role: role, Open: func() (io.ReadCloser, error) {
+		if _, _, err := b.docker.ImageInspectWithRaw(ctx, image); err != nil {
+			reader, err := b.docker.ImagePull(ctx, image, types.ImagePullOptions{RegistryAuth: b.docker.PullAuth(image)})
+			if err != nil {
+				return nil, err
+			}
+			defer reader.Close()
+
+			if err := jsonmessage.DisplayJSONMessagesStream(reader, ioutil.Discard, 0, false, nil); err != nil {
+				return nil, err
+			}
+		}
+
+		return b.docker.ImageSave(ctx, []string{image})
+	}}
+}
+
+// Import verify the bundle and load its images. chaincode images are saved into the artifact store in
+// delivery and embedded mode, or pushed to the registries in registry mode, they are signed again with the
+// local key. the base images and the puller image are loaded into the docker host, the puller image is also
+// pushed if it belongs to one of the registries, so the nodes can pull it.
+func (b *bundleService) Import(ctx context.Context, r io.Reader) (*bundle.Manifest, error) {
+	return bundle.Import(r, b.cosigner, func(image bundle.Image, content io.Reader) error {
+		log.Infof("import %s image %s", image.Role, image.Name)
+
+		switch image.Role {
+		case bundle.ROLE_CHAINCODE:
+			return b.importChaincode(ctx, image.Name, content)
+		case bundle.ROLE_PULLER:
+			if err := b.load(ctx, content); err != nil {
+				return err
+			}
+			if !inRegistries(b.docker.GetRegistries(), image.Name) {
+				log.Warnf("puller image %s is loaded on the docker host only, make it available to the nodes", image.Name)
+
+				return nil
+			}
+
+			reader, err := b.images.Push(ctx, image.Name)
+			if err != nil {
+				return err
+			}
+			defer reader.Close()
+
+			return jsonmessage.DisplayJSONMessagesStream(reader, ioutil.Discard, 0, false, nil)
+		default:
+			return b.load(ctx, content)
+		}
+	})
+}
+
+func (b *bundleService) importChaincode(ctx context.Context, image string, content io.Reader) error {
+	if mode := b.docker.GetImageMode(); mode == options.IMAGE_MODE_DELIVERY || mode == options.IMAGE_MODE_EMBEDDED {
+		if err := b.images.storeImage(image, content); err != nil {
+			return err
+		}
+	} else {
+		if err := b.images.builder.Load(ctx, content); err != nil {
+			log.Errorf("load %s failed: %v", image, err)
+
+			return err
+		}
+
+		ref, dgst, err := pushImage(ctx, b.docker, b.images.builder, b.client, b.cosigner, image, "", false)
+		if err != nil {
+			return err
+		}
+		log.Infof("%s is published as %s", ref, pinDigest(ref, dgst))
+	}
+
+	if _, err := generateSBOM(ctx, b.images.builder, b.store, image); err != nil {
+		log.Warnf("generate sbom of %s failed: %v", image, err)
+	}
+
+	return nil
+}
+
+// load the docker save tar into the docker host.
+func (b *bundleService) load(ctx context.Context, content io.Reader) error {
+	resp, err := b.docker.ImageLoad(ctx, content, true)
+	if err != nil {
+		log.Errorf("load image failed: %v", err)
+
+		return err
+	}
+	defer resp.Body.Close()
+
+	return jsonmessage.DisplayJSONMessagesStream(resp.Body, ioutil.Discard, 0, false, nil)
+}
@@ -0,0 +1,75 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/golang/mock/gomock"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/bundle"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func Test_bundleService(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	ccenv := "hyperledger/fabric-ccenv:2.2"
+
+	// the connected side exports the chaincode image from its artifact store
+	source := newTestStore(t, "mycc:latest", []byte("{}"))
+	exporter := docker.NewMockDockerService(ctrl)
+	exporter.EXPECT().GetPullerImage().Return("")
+	exporter.EXPECT().ImageInspectWithRaw(ctx, ccenv).Return(types.ImageInspect{ID: "sha256:ccenv"}, nil, nil)
+	exporter.EXPECT().ImageSave(ctx, []string{ccenv}).Return(ioutil.NopCloser(strings.NewReader("ccenv")), nil)
+	baseImages, _ := baseimage.NewPeithoBaseImages(exporter, &options.BaseImageOption{Images: []string{ccenv}, Interval: 60})
+
+	b := bundleService{docker: exporter, store: source, baseImages: baseImages}
+	buf := &bytes.Buffer{}
+	manifest, err := b.Export(ctx, []string{"mycc:latest"}, buf)
+	if err != nil {
+		t.Fatalf("bundleService.Export() error = %v", err)
+	}
+	if len(manifest.Images) != 2 || manifest.Images[0].Role != bundle.ROLE_CHAINCODE || manifest.Images[1].Name != ccenv {
+		t.Errorf("bundleService.Export() manifest = %+v", manifest)
+	}
+
+	// the air-gapped side saves the chaincode image in its artifact store and loads the base image
+	store, _ := artifact.NewStore(t.TempDir())
+	importer := docker.NewMockDockerService(ctrl)
+	importer.EXPECT().GetImageMode().Return(options.IMAGE_MODE_DELIVERY).AnyTimes()
+	importer.EXPECT().ImageLoad(ctx, gomock.Any(), true).DoAndReturn(
+		func(ctx context.Context, input io.Reader, quiet bool) (types.ImageLoadResponse, error) {
+			if data, _ := ioutil.ReadAll(input); string(data) != "ccenv" {
+				t.Errorf("ImageLoad() got %s, want the base image", data)
+			}
+
+			return types.ImageLoadResponse{Body: ioutil.NopCloser(strings.NewReader("{}"))}, nil
+		},
+	)
+
+	b = bundleService{docker: importer, store: store, images: &imageService{docker: importer, store: store}}
+	if _, err := b.Import(ctx, buf); err != nil {
+		t.Fatalf("bundleService.Import() error = %v", err)
+	}
+
+	if !store.HasTar("mycc:latest") {
+		t.Errorf("bundleService.Import() does not save the chaincode image")
+	}
+	if _, err := store.SBOM("mycc:latest"); err != nil {
+		t.Errorf("SBOM() error = %v", err)
+	}
+}
@@ -0,0 +1,50 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+
+	"github.com/marmotedu/errors"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+
+	"github.com/tianrandailove/peitho/internal/peitho/util"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+)
+
+var ErrNoSuchChaincode = errors.New("no such chaincode")
+
+// ChaincodeSrv defines functions used to query the inventory of the chaincode containers.
+type ChaincodeSrv interface {
+	List(ctx context.Context) ([]k8s.Chaincode, error)
+	Get(ctx context.Context, id string) (*k8s.Chaincode, error)
+}
+
+type chaincodeService struct {
+	k8s k8s.K8sService
+}
+
+var _ ChaincodeSrv = (*chaincodeService)(nil)
+
+func newChaincode(srv *service) *chaincodeService {
+	return &chaincodeService{
+		k8s: srv.k8s,
+	}
+}
+
+// List list the chaincode containers recorded on the chaincode deployments.
+func (cs *chaincodeService) List(ctx context.Context) ([]k8s.Chaincode, error) {
+	return cs.k8s.ListChaincodes(ctx)
+}
+
+// Get get the chaincode container by the container id the peer created it as, or by its deployment name.
+func (cs *chaincodeService) Get(ctx context.Context, id string) (*k8s.Chaincode, error) {
+	chaincode, err := cs.k8s.GetChaincode(ctx, util.GetDeploymentName(id))
+	if apierrors.IsNotFound(err) {
+		return nil, ErrNoSuchChaincode
+	}
+
+	return chaincode, err
+}
@@ -11,24 +11,37 @@ import (
 	"context"
 	"fmt"
 	"io"
-	"os"
+	"net"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/marmotedu/errors"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 
 	"github.com/tianrandailove/peitho/internal/peitho/util"
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/distribution"
 	"github.com/tianrandailove/peitho/pkg/docker"
 	"github.com/tianrandailove/peitho/pkg/k8s"
 	"github.com/tianrandailove/peitho/pkg/log"
 	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+	"github.com/tianrandailove/peitho/pkg/signature"
 )
 
+var ErrNoSuchContainer = errors.New("no such container")
+
 const (
 	VERSION_KEY   = "version"
 	VERSION_VALUE = "v2.0.0"
+	// SERVER_ADDRESS_ENV is the address the chaincode in server mode listens on
+	SERVER_ADDRESS_ENV = "CHAINCODE_SERVER_ADDRESS"
 )
 
 type Container struct {
@@ -60,20 +73,36 @@ type ContainerSrv interface {
 	Stop(ctx context.Context, containerID string, timeout time.Duration) error
 	Kill(ctx context.Context, containerID string, signal string) error
 	Remove(ctx context.Context, containerID string) error
+	Inspect(ctx context.Context, containerID string) (interface{}, error)
 	Wait(ctx context.Context, containerID string) error
 }
 
 type containerService struct {
-	docker docker.DockerService
-	k8s    k8s.K8sService
+	docker   docker.DockerService
+	k8s      k8s.K8sService
+	store    *artifact.Store
+	client   *distribution.Client
+	cosigner *signature.Signer
+	scanner  sbom.Scanner
+	builder  builder.Builder
+	// crd manage the chaincode containers as chaincode resources
+	crd    bool
+	events *k8s.EventRecorder
 }
 
 var _ ContainerSrv = (*containerService)(nil)
 
 func newContainer(srv *service) *containerService {
 	return &containerService{
-		docker: srv.docker,
-		k8s:    srv.k8s,
+		docker:   srv.docker,
+		k8s:      srv.k8s,
+		store:    srv.store,
+		client:   srv.client,
+		cosigner: srv.cosigner,
+		scanner:  srv.scanner,
+		builder:  srv.builder,
+		crd:      srv.chaincodeCRD != nil && srv.chaincodeCRD.Enable,
+		events:   srv.events,
 	}
 }
 
@@ -92,7 +121,8 @@ func (cs *containerService) Create(ctx context.Context, containerID string, c Co
 			LogConfig: container.LogConfig{},
 		}
 
-		response, err := cs.docker.ContainerCreate(ctx, config, hostConfig, nil, nil, containerID)
+		// chaincode is compiled for the primary platform
+		response, err := cs.docker.ContainerCreate(ctx, config, hostConfig, nil, primaryPlatform(cs.docker), containerID)
 		if err != nil {
 			log.Errorf("create container failed: %v", err)
 
@@ -102,60 +132,299 @@ func (cs *containerService) Create(ctx context.Context, containerID string, c Co
 		return &ContainerResult{Id: response.ID, Warnings: response.Warnings}, err
 	}
 
+	mode := cs.docker.GetImageMode()
+
 	// self delivery
-	if cs.docker.GetImageMode() == options.IMAGE_MODE_DELIVERY {
-		fileName := fmt.Sprintf("%s.tar", c.Image)
-		_, err := os.Stat(fileName)
-		if err != nil {
-			log.Errorf("%s not exists: %v", fileName, err)
+	if mode == options.IMAGE_MODE_DELIVERY {
+		if !cs.store.HasTar(c.Image) {
+			log.Errorf("%s not exists", cs.store.TarPath(c.Image))
 
 			return nil, ErrNoSuchImage
 		}
 		podName := util.GetDeploymentName(containerID)
+		if err := cs.verifyTar(c.Image); err != nil {
+			log.Errorf("verify signature of %s failed: %v", c.Image, err)
+			cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_REFUSED, "verify signature of %s failed: %v", c.Image, err)
+
+			return nil, err
+		}
+		if err := cs.scan(ctx, podName, c.Image); err != nil {
+			return nil, err
+		}
 		log.Infof("create chiancode deployment, podname: %s.", podName)
 		// create chaincode deployment
 		pullerCMD := []string{
 			"./puller",
 			fmt.Sprintf("--image=%s", c.Image),
 			fmt.Sprintf("--pullAddress=%s", cs.docker.GetPullerAccessAddress()),
+			fmt.Sprintf("--credential=%s", k8s.PullerCredentialPath),
 		}
-		pullerCMD = append(pullerCMD, "--docker.endpoint=unix:///host/var/run/docker.sock")
-		if err := cs.k8s.CreateChaincodeDeploymentWithPuller(ctx, podName, c.Image, c.Env, c.Cmd, cs.docker.GetPullerImage(), pullerCMD); err != nil {
+		runtimeArgs, mounts := pullerRuntimeArgs(cs.docker.GetRuntime())
+		pullerCMD = append(pullerCMD, runtimeArgs...)
+		spec := v1alpha1.ChaincodeSpec{
+			ContainerID: containerID,
+			Image:       c.Image,
+			Env:         c.Env,
+			Command:     c.Cmd,
+			Archs:       cs.imageArchs(ctx, mode, c.Image, c.Image),
+			Puller: &v1alpha1.PullerSpec{
+				Image:   cs.docker.GetPullerImage(),
+				Command: pullerCMD,
+				Mounts:  hostPaths(mounts),
+			},
+		}
+		annotations := k8s.InventoryAnnotations(containerID, c.Env, mode, time.Now())
+		if err := cs.deploy(ctx, podName, spec, annotations, k8s.ChaincodeLabels(containerID, c.Env)); err != nil {
 			return nil, err
 		}
 
 		return &ContainerResult{Id: podName, Warnings: nil}, nil
 	}
 
-	// deployment image tag
-	imageTag := fmt.Sprintf("%s/%s/%s", cs.docker.GetServerAddress(), cs.docker.GetProjectName(), c.Image)
+	// embedded registry
+	if mode == options.IMAGE_MODE_EMBEDDED {
+		podName := util.GetDeploymentName(containerID)
+		repo, tag := artifact.SplitReference(c.Image)
+		dgst, err := cs.store.Resolve(repo, tag)
+		if err != nil {
+			log.Errorf("%s not exists in embedded registry: %v", c.Image, err)
+			cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_MISSING, "%s not exists in embedded registry", c.Image)
+
+			return nil, ErrNoSuchImage
+		}
+
+		imageTag := fmt.Sprintf("%s/%s", cs.docker.GetRegistryAddress(), c.Image)
+		identity := fmt.Sprintf("%s/%s", cs.docker.GetRegistryAddress(), repo)
+		if err := verifyLocal(cs.store, cs.cosigner, repo, identity, dgst); err != nil {
+			log.Errorf("verify signature of %s failed: %v", imageTag, err)
+			cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_REFUSED, "verify signature of %s failed: %v", imageTag, err)
+
+			return nil, err
+		}
+		if err := cs.scan(ctx, podName, c.Image); err != nil {
+			return nil, err
+		}
+
+		log.Infof("create chiancode deployment, podname: %s.", podName)
+
+		spec := v1alpha1.ChaincodeSpec{
+			ContainerID: containerID,
+			Image:       pinDigest(imageTag, dgst),
+			Env:         c.Env,
+			Command:     c.Cmd,
+			Archs:       cs.imageArchs(ctx, mode, c.Image, imageTag),
+		}
+		annotations := inventoryAnnotations(containerID, c.Env, mode, imageTag, dgst)
+		if err := cs.deploy(ctx, podName, spec, annotations, k8s.ChaincodeLabels(containerID, c.Env)); err != nil {
+			return nil, err
+		}
+
+		return &ContainerResult{Id: podName, Warnings: nil}, nil
+	}
 
-	// ensure registry has the image
-	// try pull
-	registryAuth, err := cs.docker.RegistryAuth()
-	output, err := cs.docker.ImagePull(ctx, imageTag, types.ImagePullOptions{
-		RegistryAuth: registryAuth,
-	})
+	// ensure registry has the image in the project of the peer org
+	podName := util.GetDeploymentName(containerID)
+	msp := mspID(c.Env)
+	imageTag, desc, err := findImage(ctx, cs.docker, cs.client, c.Image, msp)
+	dgst := desc.Digest
 	if err != nil {
-		return nil, ErrNoSuchImage
+		// the image is built here but not yet pushed to the project of the org
+		if _, inspectErr := cs.builder.ImageID(ctx, c.Image); inspectErr != nil {
+			cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_MISSING, "%s not exists for %s", c.Image, msp)
+
+			return nil, ErrNoSuchImage
+		}
+		imageTag, dgst, err = pushImage(ctx, cs.docker, cs.builder, cs.client, cs.cosigner, c.Image, msp, false)
+		if err != nil {
+			log.Errorf("push %s for %s failed: %v", c.Image, msp, err)
+			cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_MISSING, "push %s for %s failed: %v", c.Image, msp, err)
+
+			return nil, ErrNoSuchImage
+		}
+		// the digest is not reported by the push stream, ask the registry
+		if dgst == "" {
+			if imageTag, desc, err = findImage(ctx, cs.docker, cs.client, c.Image, msp); err != nil {
+				return nil, err
+			}
+			dgst = desc.Digest
+		}
 	}
-	defer output.Close()
 
-	log.Debugf("image %s exists", imageTag)
+	// refuse images which are not signed by the configured key
+	if err := verifyRemote(ctx, cs.client, cs.cosigner, imageTag, dgst); err != nil {
+		log.Errorf("verify signature of %s failed: %v", imageTag, err)
+		cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_IMAGE_REFUSED, "verify signature of %s failed: %v", imageTag, err)
+
+		return nil, err
+	}
+	if err := cs.scan(ctx, podName, c.Image); err != nil {
+		return nil, err
+	}
 
 	// in create chaincode containter phase
 	// use k8sapi to create deployment
-	podName := util.GetDeploymentName(containerID)
 	log.Infof("create chiancode deployment, podname: %s.", podName)
 
-	// create chaincode deployment
-	if err := cs.k8s.CreateChaincodeDeployment(ctx, podName, imageTag, c.Env, c.Cmd); err != nil {
+	// create chaincode deployment pinned to the digest, the pods pull the image with the registry secret
+	secrets := pullSecrets(cs.docker.GetRegistries())
+	spec := v1alpha1.ChaincodeSpec{
+		ContainerID: containerID,
+		Image:       pinDigest(imageTag, dgst),
+		Env:         c.Env,
+		Command:     c.Cmd,
+		PullSecrets: secrets,
+		Archs:       cs.imageArchs(ctx, mode, c.Image, pinDigest(imageTag, dgst)),
+	}
+	annotations := inventoryAnnotations(containerID, c.Env, mode, imageTag, dgst)
+	if err := cs.deploy(ctx, podName, spec, annotations, k8s.ChaincodeLabels(containerID, c.Env)); err != nil {
 		return nil, err
 	}
 
 	return &ContainerResult{Id: podName, Warnings: nil}, nil
 }
 
+// deploy create the chaincode deployment, or the chaincode resource reconciled into it.
+func (cs *containerService) deploy(
+	ctx context.Context,
+	name string,
+	spec v1alpha1.ChaincodeSpec,
+	annotations map[string]string,
+	labels map[string]string,
+) error {
+	spec.Port = serverPort(spec.Env)
+	if err := cs.create(ctx, name, spec, annotations, labels); err != nil {
+		cs.events.Eventf(name, v1.EventTypeWarning, k8s.REASON_CREATE_FAILED, "create chaincode %s failed: %v", spec.Image, err)
+
+		return err
+	}
+	cs.events.Eventf(name, v1.EventTypeNormal, k8s.REASON_CREATED, "created chaincode %s", spec.Image)
+
+	return nil
+}
+
+// create create the deployment, or apply and reconcile the chaincode resource in the crd mode.
+func (cs *containerService) create(
+	ctx context.Context,
+	name string,
+	spec v1alpha1.ChaincodeSpec,
+	annotations map[string]string,
+	labels map[string]string,
+) error {
+	if cs.crd {
+		cc := &v1alpha1.Chaincode{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Labels: labels, Annotations: annotations},
+			Spec:       spec,
+		}
+		if err := cs.k8s.ApplyChaincodeResource(ctx, cc); err != nil {
+			return err
+		}
+
+		// the deployment is created at once, the tls files are uploaded to it next
+		return cs.k8s.ReconcileChaincodeResource(ctx, name)
+	}
+	if spec.Port > 0 {
+		log.Warnf("chaincode %s is served in server mode, enable chaincode-crd to hand it off to its new versions", name)
+	}
+
+	if puller := spec.Puller; puller != nil {
+		mounts := make([]k8s.HostPathMount, 0, len(puller.Mounts))
+		for _, m := range puller.Mounts {
+			mounts = append(mounts, k8s.HostPathMount{Name: m.Name, HostPath: m.HostPath, MountPath: m.MountPath})
+		}
+
+		return cs.k8s.CreateChaincodeDeploymentWithPuller(
+			ctx,
+			name,
+			spec.Image,
+			spec.Env,
+			spec.Command,
+			puller.Image,
+			puller.Command,
+			mounts,
+			annotations,
+			labels,
+			spec.Archs,
+		)
+	}
+
+	return cs.k8s.CreateChaincodeDeployment(
+		ctx,
+		name,
+		spec.Image,
+		spec.Env,
+		spec.Command,
+		spec.PullSecrets,
+		annotations,
+		labels,
+		spec.Archs,
+	)
+}
+
+// serverPort return the port the chaincode serves in server mode, passed as CHAINCODE_SERVER_ADDRESS,
+// or 0 for the chaincode connecting to the peer.
+func serverPort(env []string) int32 {
+	for _, e := range env {
+		if !strings.HasPrefix(e, SERVER_ADDRESS_ENV+"=") {
+			continue
+		}
+
+		_, port, err := net.SplitHostPort(strings.TrimPrefix(e, SERVER_ADDRESS_ENV+"="))
+		if err != nil {
+			log.Warnf("parse %s failed: %v", e, err)
+
+			return 0
+		}
+		p, err := strconv.ParseUint(port, 10, 16)
+		if err != nil {
+			log.Warnf("parse %s failed: %v", e, err)
+
+			return 0
+		}
+
+		return int32(p)
+	}
+
+	return 0
+}
+
+// verifyTar verify the signature of the manifest the saved image tar is delivered as.
+func (cs *containerService) verifyTar(image string) error {
+	if !cs.cosigner.Enabled() {
+		return nil
+	}
+
+	dgst, err := cs.store.ManifestDigest(image)
+	if err != nil {
+		return err
+	}
+	repo, _ := artifact.SplitReference(image)
+
+	return verifyLocal(cs.store, cs.cosigner, repo, repo, dgst)
+}
+
+// scan run the scanner on the SBOM of the image, an image without SBOM can not be scanned and is refused.
+func (cs *containerService) scan(ctx context.Context, name string, image string) error {
+	if cs.scanner == nil || !cs.scanner.Enabled() {
+		return nil
+	}
+
+	bom, err := imageSBOM(ctx, cs.builder, cs.store, image)
+	if err != nil {
+		log.Errorf("get sbom of %s failed: %v", image, err)
+		cs.events.Eventf(name, v1.EventTypeWarning, k8s.REASON_IMAGE_REFUSED, "%s has no sbom to scan", image)
+
+		return sbom.ErrBlocked
+	}
+
+	if err := cs.scanner.Scan(ctx, image, bom); err != nil {
+		cs.events.Eventf(name, v1.EventTypeWarning, k8s.REASON_IMAGE_REFUSED, "scan %s failed: %v", image, err)
+
+		return err
+	}
+
+	return nil
+}
+
 // Upload upload archive, like contract source code.
 func (cs *containerService) Upload(ctx context.Context, containerID string, path string, content io.Reader) error {
 	// it's not chaincode container id
@@ -223,8 +492,25 @@ func (cs *containerService) Upload(ctx context.Context, containerID string, path
 		}
 	}
 
-	// create tls configmap
 	name := util.GetDeploymentName(containerID)
+	if err := cs.mount(ctx, name, files); err != nil {
+		cs.events.Eventf(name, v1.EventTypeWarning, k8s.REASON_TLS_FAILED, "mount tls files failed: %v", err)
+
+		return err
+	}
+	cs.record(ctx, name, k8s.STATE_CONFIGURED)
+	cs.events.Eventf(name, v1.EventTypeNormal, k8s.REASON_TLS_MOUNTED, "mounted %d tls files of the peer", len(files))
+
+	return nil
+}
+
+// mount mount the tls files of the peer into the chaincode deployment.
+func (cs *containerService) mount(ctx context.Context, name string, files map[string]string) error {
+	if cs.crd {
+		return cs.configure(ctx, name, files)
+	}
+
+	// create tls configmap
 	if err := cs.k8s.CreateConfigMap(ctx, name, files); err != nil {
 		return err
 	}
@@ -232,12 +518,9 @@ func (cs *containerService) Upload(ctx context.Context, containerID string, path
 	if len(files) > 3 {
 		ctx = context.WithValue(ctx, VERSION_KEY, VERSION_VALUE)
 	}
-	// update chaincode deployment
-	if err := cs.k8s.UpdateDeployment(ctx, name); err != nil {
-		return err
-	}
 
-	return nil
+	// update chaincode deployment
+	return cs.k8s.UpdateDeployment(ctx, name)
 }
 
 // Fetch fetch contract bin.
@@ -276,11 +559,14 @@ func (cs *containerService) Start(ctx context.Context, containerID string) error
 		ok, _ := cs.k8s.QueryDeploymentStatus(ctx, podName)
 		if ok {
 			log.Info("check chaincode deployment ok")
+			cs.record(ctx, podName, k8s.STATE_RUNNING)
+			cs.events.Eventf(podName, v1.EventTypeNormal, k8s.REASON_STARTED, "chaincode deployment is ready")
 
 			return nil
 		}
 		time.Sleep(1 * time.Second)
 	}
+	cs.events.Eventf(podName, v1.EventTypeWarning, k8s.REASON_READINESS_TIMEOUT, "chaincode deployment is not ready in 100s")
 
 	return errors.New("check chaincode deployment status timeout")
 }
@@ -337,10 +623,89 @@ func (cs *containerService) Remove(ctx context.Context, containerID string) erro
 	name := util.GetDeploymentName(containerID)
 	_ = cs.k8s.DeleteChaincodeDeployment(ctx, name)
 	_ = cs.k8s.DeleteConfigMapDeployment(ctx, name)
+	cs.events.Eventf(name, v1.EventTypeNormal, k8s.REASON_REMOVED, "chaincode deployment is removed by the peer")
 
 	return nil
 }
 
+// Inspect inspect a universal container, or the chaincode deployment with its pinned image digest.
+func (cs *containerService) Inspect(ctx context.Context, containerID string) (interface{}, error) {
+	if util.IsContainerID(containerID) {
+		containerJSON, err := cs.docker.ContainerInspect(ctx, containerID)
+		if err != nil {
+			log.Errorf("inspect container failed: %v", err)
+
+			return nil, err
+		}
+
+		return containerJSON, nil
+	}
+
+	name := util.GetDeploymentName(containerID)
+	deployment, err := cs.k8s.GetDeployment(ctx, name)
+	if err != nil {
+		return nil, ErrNoSuchContainer
+	}
+
+	running := deployment.Status.AvailableReplicas > 0
+	status := "created"
+	if running {
+		status = "running"
+	}
+
+	config := &container.Config{
+		Image:  deployment.Annotations[k8s.AnnotationImage],
+		Labels: k8s.OwnerLabels(deployment.Labels),
+	}
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		if config.Image == "" {
+			config.Image = containers[0].Image
+		}
+		config.Cmd = containers[0].Command
+		for _, env := range containers[0].Env {
+			config.Env = append(config.Env, fmt.Sprintf("%s=%s", env.Name, env.Value))
+		}
+	}
+
+	return types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:      name,
+			Name:    "/" + name,
+			Created: deployment.CreationTimestamp.Format(time.RFC3339Nano),
+			Image:   deployment.Annotations[k8s.AnnotationImageDigest],
+			State: &types.ContainerState{
+				Status:  status,
+				Running: running,
+			},
+		},
+		Config: config,
+	}, nil
+}
+
+// configure refer the chaincode resource to the tls secret of the files, it is reconciled at once.
+func (cs *containerService) configure(ctx context.Context, name string, files map[string]string) error {
+	if err := cs.k8s.CreateTLSSecret(ctx, name, files); err != nil {
+		return err
+	}
+
+	cc, err := cs.k8s.GetChaincodeResource(ctx, name)
+	if err != nil {
+		return err
+	}
+	cc.Spec.TLS = &v1alpha1.TLSReference{Secret: k8s.TLSSecretName(name), PEM: len(files) > 3}
+	if err := cs.k8s.ApplyChaincodeResource(ctx, cc); err != nil {
+		return err
+	}
+
+	return cs.k8s.ReconcileChaincodeResource(ctx, name)
+}
+
+// record record the lifecycle state of the chaincode deployment in the inventory,
+// the peer is not failed by a failure, the state is only informative.
+func (cs *containerService) record(ctx context.Context, name string, state string) {
+	_ = cs.k8s.AnnotateDeployment(ctx, name, map[string]string{k8s.AnnotationState: state})
+}
+
 // Wait wait for universal container.
 func (cs *containerService) Wait(ctx context.Context, containerID string) error {
 	if util.IsContainerID(containerID) {
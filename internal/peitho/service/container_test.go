@@ -5,6 +5,9 @@
 package service
 
 import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
 	"context"
 	"io"
 	"reflect"
@@ -14,9 +17,15 @@ import (
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
 	"github.com/golang/mock/gomock"
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
 
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
 	"github.com/tianrandailove/peitho/pkg/docker"
 	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
 )
 
 func TestContainerCreate(t *testing.T) {
@@ -28,8 +37,9 @@ func TestContainerCreate(t *testing.T) {
 	k8sSrv := k8s.NewMockK8sService(ctrl)
 
 	containerSrv := newContainer(&service{
-		docker: dockerSrv,
-		k8s:    k8sSrv,
+		docker:  dockerSrv,
+		builder: newDockerBuilder(dockerSrv),
+		k8s:     k8sSrv,
 	})
 
 	ctx := context.Background()
@@ -44,6 +54,7 @@ func TestContainerCreate(t *testing.T) {
 		LogConfig: container.LogConfig{},
 	}
 
+	dockerSrv.EXPECT().GetPlatforms().Return(nil).AnyTimes()
 	dockerSrv.EXPECT().ContainerCreate(ctx, config, hostConfig, nil, nil, "").Return(struct {
 		ID       string   `json:"Id"`
 		Warnings []string `json:"Warnings"`
@@ -66,19 +77,49 @@ func TestContainerCreate(t *testing.T) {
 
 	ctx = context.Background()
 	podName := "dev.peer0.org1"
-	dockerSrv.EXPECT().GetServerAddress().Return("172.198.101.18:8099")
-	dockerSrv.EXPECT().GetProjectName().Return("chaincode")
-
-	dockerSrv.EXPECT().
-		ImageInspectWithRaw(ctx, gomock.Eq("hyperledger/fabric-ccenv-amd64:1.4.8")).
-		Return(types.ImageInspect{ID: "hyperledger/fabric-ccenv-amd64:1.4.8"}, nil, nil)
-	dockerSrv.EXPECT().
-		ImageInspectWithRaw(ctx, gomock.Eq("172.198.101.18:8099/chaincode/hyperledger/fabric-ccenv-amd64:1.4.8")).
-		Return(types.ImageInspect{ID: "172.198.101.18:8099/chaincode/hyperledger/fabric-ccenv-amd64:1.4.8"}, nil, nil)
-
+	dockerSrv.EXPECT().GetImageMode().Return(options.IMAGE_MODE_REGISTRY)
+	store := newTestStore(t, "chaincode/hyperledger/fabric-ccenv-amd64:1.4.8", []byte(`{"architecture":"amd64","os":"linux"}`))
+	dgst, _ := store.Resolve("chaincode/hyperledger/fabric-ccenv-amd64", "1.4.8")
+	client, host := newTestRegistry(t, store)
+	containerSrv.client = client
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{
+		{Serveraddress: host, Project: "chaincode", Secret: "registry-secret"},
+	}).AnyTimes()
+
+	imageTag := host + "/chaincode/hyperledger/fabric-ccenv-amd64:1.4.8"
 	k8sSrv.EXPECT().
-		CreateChaincodeDeployment(ctx, "dev-peer0-org1", "172.198.101.18:8099/chaincode/hyperledger/fabric-ccenv-amd64:1.4.8", con.Env, con.Cmd).
-		Return(nil)
+		CreateChaincodeDeployment(
+			ctx,
+			"dev-peer0-org1",
+			host+"/chaincode/hyperledger/fabric-ccenv-amd64@"+dgst.String(),
+			con.Env,
+			con.Cmd,
+			[]string{"registry-secret"},
+			gomock.Any(),
+			map[string]string{k8s.LabelManagedBy: k8s.ManagedBy},
+			// the image is built for amd64 only
+			[]string{"amd64"},
+		).
+		DoAndReturn(func(_, _, _, _, _, _ interface{}, annotations map[string]string, _, _ interface{}) error {
+			// the deployment records the container in the inventory
+			want := map[string]string{
+				k8s.AnnotationImage:       imageTag,
+				k8s.AnnotationImageDigest: dgst.String(),
+				k8s.AnnotationContainerID: podName,
+				k8s.AnnotationImageMode:   options.IMAGE_MODE_REGISTRY,
+				k8s.AnnotationState:       k8s.STATE_CREATED,
+			}
+			for k, v := range want {
+				if annotations[k] != v {
+					t.Errorf("annotation %s = %s, want %s", k, annotations[k], v)
+				}
+			}
+			if _, err := time.Parse(time.RFC3339, annotations[k8s.AnnotationCreated]); err != nil {
+				t.Errorf("annotation %s = %s, want the creation time", k8s.AnnotationCreated, annotations[k8s.AnnotationCreated])
+			}
+
+			return nil
+		})
 
 	t.Run("create chaincode deployment", func(t *testing.T) {
 		result, err := containerSrv.Create(ctx, podName, con)
@@ -93,6 +134,67 @@ func TestContainerCreate(t *testing.T) {
 	})
 }
 
+func Test_containerService_Create_serverMode(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	option := options.NewChaincodeCRDOption()
+	option.Enable = true
+	containerSrv := newContainer(&service{
+		docker:       dockerSrv,
+		builder:      newDockerBuilder(dockerSrv),
+		k8s:          k8sSrv,
+		chaincodeCRD: option,
+	})
+
+	ctx := context.Background()
+	store := newTestStore(t, "chaincode/mycc:1.1", []byte(`{"architecture":"amd64","os":"linux"}`))
+	client, host := newTestRegistry(t, store)
+	containerSrv.client = client
+	dockerSrv.EXPECT().GetImageMode().Return(options.IMAGE_MODE_REGISTRY)
+	dockerSrv.EXPECT().GetPlatforms().Return(nil).AnyTimes()
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{{Serveraddress: host, Project: "chaincode"}}).AnyTimes()
+
+	// the chaincode served in server mode is handed off by its port
+	gomock.InOrder(
+		k8sSrv.EXPECT().ApplyChaincodeResource(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, cc *v1alpha1.Chaincode) error {
+			if cc.Name != "dev-peer0-org1-mycc-1-1" || cc.Spec.Port != 9999 {
+				t.Errorf("chaincode %s port = %d, want 9999", cc.Name, cc.Spec.Port)
+			}
+
+			return nil
+		}),
+		k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, "dev-peer0-org1-mycc-1-1").Return(nil),
+	)
+
+	con := Container{Image: "mycc:1.1", Env: []string{"CORE_CHAINCODE_ID_NAME=mycc:1.1", "CHAINCODE_SERVER_ADDRESS=0.0.0.0:9999"}}
+	if _, err := containerSrv.Create(ctx, "dev.peer0.org1.mycc.1.1", con); err != nil {
+		t.Errorf("Create() error = %v", err)
+	}
+}
+
+func Test_serverPort(t *testing.T) {
+	tests := []struct {
+		name string
+		env  []string
+		want int32
+	}{
+		{name: "server mode", env: []string{"CHAINCODE_SERVER_ADDRESS=0.0.0.0:9999"}, want: 9999},
+		{name: "connecting to the peer", env: []string{"CORE_PEER_ADDRESS=peer0:7052"}, want: 0},
+		{name: "without port", env: []string{"CHAINCODE_SERVER_ADDRESS=0.0.0.0"}, want: 0},
+		{name: "invalid port", env: []string{"CHAINCODE_SERVER_ADDRESS=0.0.0.0:99999"}, want: 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := serverPort(tt.env); got != tt.want {
+				t.Errorf("serverPort() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
 func Test_newContainer(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -186,8 +288,9 @@ func Test_containerService_Upload(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Upload(tt.args.ctx, tt.args.containerID, tt.args.path, tt.args.content); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Upload() error = %v, wantErr %v", err, tt.wantErr)
@@ -196,6 +299,52 @@ func Test_containerService_Upload(t *testing.T) {
 	}
 }
 
+func Test_containerService_Upload_chaincodeCRD(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	cs := &containerService{k8s: k8sSrv, crd: true, events: k8s.NewEventRecorder(recorder, "fabric")}
+	ctx := context.Background()
+	name := "dev-peer0-org1-mycc"
+
+	// the tls files of the peer
+	buf := &bytes.Buffer{}
+	gw := gzip.NewWriter(buf)
+	tw := tar.NewWriter(gw)
+	files := map[string]string{"client.key": "key", "client.crt": "crt", "peer.crt": "ca"}
+	for file, content := range files {
+		_ = tw.WriteHeader(&tar.Header{Name: "/etc/hyperledger/fabric/" + file, Mode: 0o600, Size: int64(len(content))})
+		_, _ = tw.Write([]byte(content))
+	}
+	_ = tw.Close()
+	_ = gw.Close()
+
+	cc := &v1alpha1.Chaincode{ObjectMeta: metav1.ObjectMeta{Name: name}, Spec: v1alpha1.ChaincodeSpec{Image: "mycc:1.0"}}
+	gomock.InOrder(
+		k8sSrv.EXPECT().CreateTLSSecret(ctx, name, files).Return(nil),
+		k8sSrv.EXPECT().GetChaincodeResource(ctx, name).Return(cc, nil),
+		k8sSrv.EXPECT().ApplyChaincodeResource(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, cc *v1alpha1.Chaincode) error {
+			want := &v1alpha1.TLSReference{Secret: name + "-tls"}
+			if !reflect.DeepEqual(cc.Spec.TLS, want) {
+				t.Errorf("chaincode tls = %v, want %v", cc.Spec.TLS, want)
+			}
+
+			return nil
+		}),
+		k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, name).Return(nil),
+		k8sSrv.EXPECT().AnnotateDeployment(ctx, name, map[string]string{k8s.AnnotationState: k8s.STATE_CONFIGURED}).Return(nil),
+	)
+
+	if err := cs.Upload(ctx, "dev-peer0-org1-mycc", "/etc/hyperledger/fabric", buf); err != nil {
+		t.Errorf("Upload() error = %v", err)
+	}
+	if event := <-recorder.Events; event != "Normal TLSMounted mounted 3 tls files of the peer" {
+		t.Errorf("event = %q, want the tls files mounted", event)
+	}
+}
+
 func Test_containerService_Fetch(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -242,8 +391,9 @@ func Test_containerService_Fetch(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			got, err := cs.Fetch(tt.args.ctx, tt.args.containerID, tt.args.path)
 			if (err != nil) != tt.wantErr {
@@ -270,6 +420,9 @@ func Test_containerService_Start(t *testing.T) {
 		Return(nil).
 		AnyTimes()
 	k8sSrv.EXPECT().QueryDeploymentStatus(ctx, "dev-peer0-org1-mycc").Return(true, nil)
+	k8sSrv.EXPECT().
+		AnnotateDeployment(ctx, "dev-peer0-org1-mycc", map[string]string{k8s.AnnotationState: k8s.STATE_RUNNING}).
+		Return(nil)
 	type fields struct {
 		docker docker.DockerService
 		k8s    k8s.K8sService
@@ -312,8 +465,9 @@ func Test_containerService_Start(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Start(tt.args.ctx, tt.args.containerID); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Start() error = %v, wantErr %v", err, tt.wantErr)
@@ -377,8 +531,9 @@ func Test_containerService_Stop(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Stop(tt.args.ctx, tt.args.containerID, tt.args.timeout); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Stop() error = %v, wantErr %v", err, tt.wantErr)
@@ -439,8 +594,9 @@ func Test_containerService_Kill(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Kill(tt.args.ctx, tt.args.containerID, tt.args.signal); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Kill() error = %v, wantErr %v", err, tt.wantErr)
@@ -505,8 +661,9 @@ func Test_containerService_Remove(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Remove(tt.args.ctx, tt.args.containerID); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Remove() error = %v, wantErr %v", err, tt.wantErr)
@@ -515,6 +672,50 @@ func Test_containerService_Remove(t *testing.T) {
 	}
 }
 
+func Test_containerService_Inspect(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	ctx := context.Background()
+	annotations := map[string]string{
+		k8s.AnnotationImage:       "harbor/chaincode/mycc:latest",
+		k8s.AnnotationImageDigest: "sha256:0123",
+	}
+	// the labels added by hand are not the labels of the container
+	labels := k8s.ChaincodeLabels("dev-peer0.org1-mycc-1.0", []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0"})
+	labels["team"] = "ops"
+	k8sSrv.EXPECT().GetDeployment(ctx, "dev-peer0-org1-mycc").Return(&appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: "dev-peer0-org1-mycc", Annotations: annotations, Labels: labels},
+		Status:     appsv1.DeploymentStatus{AvailableReplicas: 1},
+	}, nil)
+	k8sSrv.EXPECT().GetDeployment(ctx, "dev-peer1-org1-mycc").Return(nil, errors.New("not found"))
+
+	cs := &containerService{k8s: k8sSrv}
+
+	got, err := cs.Inspect(ctx, "dev.peer0.org1.mycc")
+	if err != nil {
+		t.Fatalf("containerService.Inspect() error = %v", err)
+	}
+	inspect := got.(types.ContainerJSON)
+	if inspect.Image != "sha256:0123" || inspect.Config.Image != "harbor/chaincode/mycc:latest" || !inspect.State.Running {
+		t.Errorf("containerService.Inspect() = %+v, %+v, want the pinned digest", inspect.ContainerJSONBase, inspect.Config)
+	}
+	want := map[string]string{
+		k8s.LabelManagedBy:        k8s.ManagedBy,
+		k8s.LabelPeerID:           "peer0.org1",
+		k8s.LabelChaincodeName:    "mycc",
+		k8s.LabelChaincodeVersion: "1.0",
+	}
+	if !reflect.DeepEqual(inspect.Config.Labels, want) {
+		t.Errorf("containerService.Inspect() labels = %v, want %v", inspect.Config.Labels, want)
+	}
+
+	if _, err := cs.Inspect(ctx, "dev.peer1.org1.mycc"); err != ErrNoSuchContainer {
+		t.Errorf("containerService.Inspect() error = %v, want %v", err, ErrNoSuchContainer)
+	}
+}
+
 func Test_containerService_Wait(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -556,8 +757,9 @@ func Test_containerService_Wait(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			cs := &containerService{
-				docker: tt.fields.docker,
-				k8s:    tt.fields.k8s,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
+				k8s:     tt.fields.k8s,
 			}
 			if err := cs.Wait(tt.args.ctx, tt.args.containerID); (err != nil) != tt.wantErr {
 				t.Errorf("containerService.Wait() error = %v, wantErr %v", err, tt.wantErr)
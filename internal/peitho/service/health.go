@@ -0,0 +1,46 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+)
+
+// Health is the state of the dependencies peitho needs to build chaincode images.
+type Health struct {
+	Healthy    bool               `json:"healthy"`
+	BaseImages []baseimage.Status `json:"baseImages"`
+}
+
+// HealthSrv defines functions used to check peitho health.
+type HealthSrv interface {
+	Check(ctx context.Context) *Health
+}
+
+type healthService struct {
+	baseImages baseimage.BaseImageService
+}
+
+var _ HealthSrv = (*healthService)(nil)
+
+func newHealth(srv *service) *healthService {
+	return &healthService{
+		baseImages: srv.baseImages,
+	}
+}
+
+// Check report whether the base images are present on the docker host.
+func (h *healthService) Check(ctx context.Context) *Health {
+	if h.baseImages == nil {
+		return &Health{Healthy: true, BaseImages: []baseimage.Status{}}
+	}
+
+	return &Health{
+		Healthy:    h.baseImages.Healthy(),
+		BaseImages: h.baseImages.Status(),
+	}
+}
@@ -5,7 +5,13 @@
 package service
 
 import (
+	"archive/tar"
+	"bufio"
+	"bytes"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -15,11 +21,22 @@ import (
 	"time"
 
 	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/pkg/jsonmessage"
 	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
 
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/compress"
+	"github.com/tianrandailove/peitho/pkg/distribution"
 	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/k8s"
 	"github.com/tianrandailove/peitho/pkg/log"
 	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/signature"
+	"github.com/tianrandailove/peitho/pkg/token"
 )
 
 var ErrNoSuchImage = errors.New("no such image")
@@ -41,23 +58,41 @@ type ImageSrv interface {
 	Inspect(ctx context.Context, imageID string) (interface{}, error)
 	AddTag(ctx context.Context, image, newTag string) error
 	Push(ctx context.Context, imageTag string) (io.ReadCloser, error)
+	Download(ctx context.Context, imageID string, downloadToken string, acceptEncoding string) (io.ReadCloser, string, error)
+	IssueToken(ctx context.Context, imageID string, credential string) (string, error)
+	SBOM(ctx context.Context, image string) ([]byte, error)
 }
 
 type imageService struct {
-	docker docker.DockerService
-	lock   sync.Mutex
+	docker   docker.DockerService
+	k8s      k8s.K8sService
+	signer   *token.Signer
+	store    *artifact.Store
+	client   *distribution.Client
+	cosigner *signature.Signer
+	// baseImages are kept by peitho, they are not pulled on request
+	baseImages baseimage.BaseImageService
+	builder    builder.Builder
+	lock       sync.Mutex
 }
 
 var _ ImageSrv = (*imageService)(nil)
 
 func newImage(srv *service) *imageService {
 	return &imageService{
-		docker: srv.docker,
-		lock:   sync.Mutex{},
+		docker:     srv.docker,
+		k8s:        srv.k8s,
+		signer:     srv.signer,
+		store:      srv.store,
+		client:     srv.client,
+		cosigner:   srv.cosigner,
+		baseImages: srv.baseImages,
+		builder:    srv.builder,
+		lock:       sync.Mutex{},
 	}
 }
 
-// Build build an image and push it to registry.
+// Build build an image and push it to registry, an image built from the same context is reused.
 func (i *imageService) Build(
 	ctx context.Context,
 	dockerfile string,
@@ -77,108 +112,337 @@ func (i *imageService) Build(
 		return nil, errors.New("content is nil")
 	}
 
+	// the primary image is tagged as requested, the other platforms are built after it
+	if platform := primaryPlatform(i.docker); platform != nil {
+		imageOptions.Platform = docker.FormatPlatform(*platform)
+	}
+
+	// spool the build context to hash it
+	buildContext, err := ioutil.TempFile("", "build-context-*.tar")
+	if err != nil {
+		log.Errorf("create build context file failed: %v", err)
+
+		return nil, err
+	}
+	defer os.Remove(buildContext.Name())
+	defer buildContext.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(buildContext, hasher), content); err != nil {
+		log.Errorf("read build context failed: %v", err)
+
+		return nil, err
+	}
+
+	key := i.buildKey(ctx, buildContext, dockerfile, hex.EncodeToString(hasher.Sum(nil)))
+	log.Debugf("build key of %s: %s", tags[0], key)
+
+	if record, ok := i.store.LookupBuild(key); ok {
+		if _, err := i.builder.ImageID(ctx, record.ImageID); err == nil {
+			return i.reuse(ctx, record, tags)
+		}
+
+		log.Infof("image %s of build %s is gone, rebuild it", record.ImageID, record.Key)
+	}
+
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
 	// lock
 	i.lock.Lock()
-	resp, err := i.docker.ImageBuild(ctx, content, imageOptions)
+	stream, err := i.builder.Build(ctx, buildContext, imageOptions)
 	if err != nil {
+		i.lock.Unlock()
 		log.Errorf("build image failed: %v", err)
 
 		return nil, err
 	}
 
-	// waitting for image build
-	for t := 0; t < 300; t++ {
-		_, _, inspectErr := i.docker.ImageInspectWithRaw(ctx, tags[0])
-		if inspectErr == nil {
-			break
-		}
-		time.Sleep(1 * time.Second)
-	}
+	// the tag may still refer to an image built before, the built image is the one reported in the stream
+	stream, imageID := readBuild(stream)
 
 	// release lock
 	i.lock.Unlock()
 
-	log.Infof("build image %s complete", tags[0])
+	log.Infof("build image %s complete: %s", tags[0], imageID)
 
-	// self delivery
-	if i.docker.GetImageMode() == options.IMAGE_MODE_DELIVERY {
-		// save image to tar
-		fileName := fmt.Sprintf("%s.tar", tags[0])
-		_, err := os.Stat(fileName)
-		if err == nil {
-			os.Remove(fileName)
+	var platforms map[string]string
+	if imageID != "" && len(i.docker.GetPlatforms()) > 1 {
+		if i.docker.GetImageMode() == options.IMAGE_MODE_REGISTRY {
+			platforms = i.buildPlatforms(ctx, buildContext, imageOptions, tags, imageID)
+		} else {
+			log.Warnf("%s is built for the primary platform only, multi-platform images need registry mode", tags[0])
 		}
-		file, err := os.Create(fileName)
-		if err != nil {
-			log.Errorf("create %s failed: %v", fileName, err)
+	}
 
-			return resp.Body, err
+	if imageID != "" {
+		if err := i.store.RecordBuild(artifact.BuildRecord{
+			Key:       key,
+			Tags:      tags,
+			ImageID:   imageID,
+			Created:   time.Now(),
+			Platforms: platforms,
+		}); err != nil {
+			log.Errorf("record build of %s failed: %v", tags[0], err)
 		}
-		tarReader, err := i.docker.ImageSave(ctx, tags)
-		if err != nil {
-			log.Errorf("save %s failed: %v", fileName, err)
+	}
+
+	if err := i.publish(ctx, tags, platforms, false); err != nil {
+		return nil, err
+	}
+
+	if imageID != "" {
+		if _, err := generateSBOM(ctx, i.builder, i.store, tags[0]); err != nil {
+			log.Errorf("generate sbom of %s failed: %v", tags[0], err)
+		}
+	}
+
+	return stream, nil
+}
+
+// readBuild read the build stream to its end, return it for the peer and the id of the built image,
+// which is empty if the build failed.
+func readBuild(stream io.ReadCloser) (io.ReadCloser, string) {
+	defer stream.Close()
+
+	output := &bytes.Buffer{}
+	reader := io.TeeReader(stream, output)
+
+	var imageID string
+	if err := jsonmessage.DisplayJSONMessagesStream(reader, ioutil.Discard, 0, false, auxImageID(&imageID)); err != nil {
+		log.Errorf("build image failed: %v", err)
+		imageID = ""
+	}
+	// the build errors are reported to the peer in the rest of the stream
+	if _, err := io.Copy(ioutil.Discard, reader); err != nil {
+		log.Errorf("read build stream failed: %v", err)
+	}
 
+	return ioutil.NopCloser(output), imageID
+}
+
+// auxImageID return the aux callback saving the image id reported in a build stream to imageID.
+func auxImageID(imageID *string) func(jsonmessage.JSONMessage) {
+	return func(message jsonmessage.JSONMessage) {
+		result := types.BuildResult{}
+		if message.Aux != nil && json.Unmarshal(*message.Aux, &result) == nil && result.ID != "" {
+			*imageID = result.ID
+		}
+	}
+}
+
+// reuse tag the image of the build record and publish it, return a synthetic build stream.
+func (i *imageService) reuse(ctx context.Context, record *artifact.BuildRecord, tags []string) (io.ReadCloser, error) {
+	log.Infof("reuse image %s built for %v", record.ImageID, record.Tags)
+
+	shortID := strings.TrimPrefix(record.ImageID, "sha256:")
+	if len(shortID) > 12 {
+		shortID = shortID[:12]
+	}
+
+	messages := []string{fmt.Sprintf("Reusing image %s built from the same context\n", shortID)}
+	for _, tag := range tags {
+		if err := i.AddTag(ctx, record.ImageID, tag); err != nil {
 			return nil, err
 		}
-		length, err := io.Copy(file, tarReader)
+	}
+	for platform, id := range record.Platforms {
+		p, err := docker.ParsePlatform(platform)
 		if err != nil {
-			log.Errorf("copy data to %s failed: %v", file, err)
-
 			return nil, err
 		}
-		log.Infof("%s's size :%d byte", fileName, length)
+		for _, tag := range tags {
+			if err := i.AddTag(ctx, id, platformTag(tag, p)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	messages = append(messages, fmt.Sprintf("Successfully built %s\n", shortID))
+	for _, tag := range tags {
+		messages = append(messages, fmt.Sprintf("Successfully tagged %s\n", tag))
+	}
 
-		return resp.Body, nil
+	if err := i.store.RecordBuild(artifact.BuildRecord{
+		Key:       record.Key,
+		Tags:      tags,
+		ImageID:   record.ImageID,
+		Created:   record.Created,
+		Platforms: record.Platforms,
+	}); err != nil {
+		log.Errorf("record build of %s failed: %v", tags[0], err)
 	}
 
-	log.Infof("ready push")
+	if err := i.publish(ctx, tags, record.Platforms, true); err != nil {
+		return nil, err
+	}
 
-	oldTag := tags[0]
-	newTag := fmt.Sprintf("%s/%s/%s", i.docker.GetServerAddress(), i.docker.GetProjectName(), tags[0])
+	if _, err := imageSBOM(ctx, i.builder, i.store, tags[0]); err != nil {
+		log.Errorf("generate sbom of %s failed: %v", tags[0], err)
+	}
 
-	log.Debugf("oldTag:%s", oldTag)
-	log.Debugf("newTag:%s", newTag)
+	stream := &bytes.Buffer{}
+	encoder := json.NewEncoder(stream)
+	for _, message := range messages {
+		_ = encoder.Encode(map[string]string{"stream": message})
+	}
 
-	if tagErr := i.AddTag(ctx, oldTag, newTag); tagErr != nil {
-		log.Errorf("add new tag failed: %v", tagErr)
+	return ioutil.NopCloser(stream), nil
+}
 
-		return nil, tagErr
+// buildKey hash the build context together with the ids of the base images in the dockerfile.
+func (i *imageService) buildKey(ctx context.Context, buildContext io.ReadSeeker, dockerfile string, contextHash string) string {
+	hasher := sha256.New()
+	hasher.Write([]byte(contextHash))
+	for _, platform := range i.docker.GetPlatforms() {
+		hasher.Write([]byte{'\n'})
+		hasher.Write([]byte(docker.FormatPlatform(platform)))
 	}
 
-	pushOpt := types.ImagePushOptions{}
-	auth, authErr := i.docker.RegistryAuth()
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return contextHash
+	}
+
+	for _, image := range baseImages(buildContext, dockerfile) {
+		imageID := image
+		if id, err := i.builder.ImageID(ctx, image); err == nil {
+			imageID = id
+		}
+		log.Debugf("base image %s: %s", image, imageID)
+		hasher.Write([]byte{'\n'})
+		hasher.Write([]byte(imageID))
+	}
+
+	return hex.EncodeToString(hasher.Sum(nil))
+}
+
+// baseImages find the FROM images of the dockerfile in the build context.
+func baseImages(buildContext io.Reader, dockerfile string) []string {
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	dockerfile = strings.TrimPrefix(dockerfile, "./")
+
+	tr := tar.NewReader(buildContext)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return nil
+		}
+		if strings.TrimPrefix(header.Name, "./") != dockerfile {
+			continue
+		}
+
+		var images []string
+		stages := make(map[string]bool)
+		scanner := bufio.NewScanner(tr)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) < 2 || !strings.EqualFold(fields[0], "FROM") {
+				continue
+			}
+			fields = fields[1:]
+			if strings.HasPrefix(fields[0], "--platform=") && len(fields) > 1 {
+				fields = fields[1:]
+			}
+			if !stages[strings.ToLower(fields[0])] {
+				images = append(images, fields[0])
+			}
+			if len(fields) == 3 && strings.EqualFold(fields[1], "AS") {
+				stages[strings.ToLower(fields[2])] = true
+			}
+		}
+
+		return images
+	}
+}
+
+// publish save the image into the artifact store, or push it to registry. the images of a multi-platform
+// build are pushed with a manifest list.
+func (i *imageService) publish(ctx context.Context, tags []string, platforms map[string]string, onlyIfMissing bool) error {
+	// self delivery or embedded registry
+	if mode := i.docker.GetImageMode(); mode == options.IMAGE_MODE_DELIVERY || mode == options.IMAGE_MODE_EMBEDDED {
+		if onlyIfMissing && i.store.HasTar(tags[0]) {
+			return nil
+		}
+
+		// save image to tar
+		tarReader, err := i.builder.Save(ctx, tags)
+		if err != nil {
+			log.Errorf("save %s failed: %v", tags[0], err)
+
+			return err
+		}
+		defer tarReader.Close()
+
+		return i.storeImage(tags[0], tarReader)
+	}
+
+	log.Infof("ready push")
+
+	if len(platforms) > 1 {
+		return i.publishIndex(ctx, tags[0], platforms, onlyIfMissing)
+	}
+
+	ref, dgst, err := pushImage(ctx, i.docker, i.builder, i.client, i.cosigner, tags[0], "", onlyIfMissing)
 	if err != nil {
-		log.Errorf("get registryAuth failed: %v", authErr)
-	} else {
-		pushOpt.RegistryAuth = auth
+		return err
 	}
+	log.Infof("%s is published as %s", ref, pinDigest(ref, dgst))
 
-	log.Debugf("RegistryAuth: %s", pushOpt.RegistryAuth)
+	return nil
+}
 
-	readerCloser, pushErr := i.docker.ImagePush(ctx, newTag, pushOpt)
-	if pushErr != nil {
-		log.Errorf("push failed: %v", pushErr)
+// storeImage save the docker save tar of the image into the artifact store, import it into the embedded
+// registry in embedded mode, and sign it.
+func (i *imageService) storeImage(image string, content io.Reader) error {
+	length, err := i.store.SaveTar(image, content)
+	if err != nil {
+		log.Errorf("copy data to %s failed: %v", i.store.TarPath(image), err)
 
-		return nil, pushErr
+		return err
 	}
-	defer readerCloser.Close()
+	log.Infof("%s's size :%d byte", i.store.TarPath(image), length)
+
+	repo, _ := artifact.SplitReference(image)
+	identity := repo
 
-	pushResult, readErr := ioutil.ReadAll(readerCloser)
-	if readErr != nil {
-		log.Errorf("read falied: %v", readErr)
+	var dgst digest.Digest
+	if i.docker.GetImageMode() == options.IMAGE_MODE_EMBEDDED {
+		if dgst, err = i.store.Import(image); err != nil {
+			log.Errorf("import %s to registry failed: %v", image, err)
+
+			return err
+		}
+		// the nodes pull the image from the embedded registry
+		identity = fmt.Sprintf("%s/%s", i.docker.GetRegistryAddress(), repo)
+	} else if i.cosigner.CanSign() {
+		if dgst, err = i.store.ManifestDigest(image); err != nil {
+			log.Errorf("compute manifest digest of %s failed: %v", image, err)
 
-		return nil, readErr
+			return err
+		}
 	}
 
-	log.Debugf(string(pushResult))
-	log.Infof("%s push success", newTag)
+	if err := signLocal(i.store, i.cosigner, repo, identity, dgst); err != nil {
+		log.Errorf("sign %s failed: %v", image, err)
 
-	return resp.Body, err
+		return err
+	}
+
+	return nil
 }
 
-// Create pull a image.
+// Create pull a image with the credentials of its registry, base images kept by peitho are not pulled.
 func (i *imageService) Create(ctx context.Context, fromImage string) (io.ReadCloser, error) {
-	resp, err := i.docker.ImagePull(ctx, fromImage, types.ImagePullOptions{})
+	if i.baseImages != nil && i.baseImages.Has(fromImage) {
+		log.Infof("%s is kept as base image, skip pull", fromImage)
+		stream, _ := json.Marshal(map[string]string{"status": fmt.Sprintf("Image is up to date for %s", fromImage)})
+
+		return ioutil.NopCloser(bytes.NewReader(stream)), nil
+	}
+
+	resp, err := i.docker.ImagePull(ctx, fromImage, types.ImagePullOptions{RegistryAuth: i.docker.PullAuth(fromImage)})
 	if err != nil {
 		log.Errorf("pull image failed: %v", err)
 
@@ -188,22 +452,10 @@ func (i *imageService) Create(ctx context.Context, fromImage string) (io.ReadClo
 	return resp, nil
 }
 
-// Inspect inspect image information.
+// Inspect inspect image information, in registry mode the image is inspected from the registry without pulling.
 func (i *imageService) Inspect(ctx context.Context, imageID string) (interface{}, error) {
-	if !strings.HasPrefix(imageID, i.docker.GetServerAddress()) {
-		// for chiancode, pull it firstly then inspect
-		imageID = fmt.Sprintf("%s/%s/%s", i.docker.GetServerAddress(), i.docker.GetProjectName(), imageID)
-
-		registryAuth, err := i.docker.RegistryAuth()
-		if err != nil {
-			return nil, errors.Errorf("failed get registryAuth: %v", err)
-		}
-
-		reader, err := i.docker.ImagePull(ctx, imageID, types.ImagePullOptions{RegistryAuth: registryAuth})
-		if err != nil {
-			return nil, ErrNoSuchImage
-		}
-		defer reader.Close()
+	if i.docker.GetImageMode() == options.IMAGE_MODE_REGISTRY {
+		return i.inspectRemote(ctx, imageID)
 	}
 
 	log.Debugf("inspect %s image", imageID)
@@ -218,9 +470,61 @@ func (i *imageService) Inspect(ctx context.Context, imageID string) (interface{}
 	return imageInspect, nil
 }
 
+// inspectRemote build the image inspection from the manifest and config in the registry.
+func (i *imageService) inspectRemote(ctx context.Context, imageID string) (types.ImageInspect, error) {
+	ref := imageID
+	if !inRegistries(i.docker.GetRegistries(), imageID) {
+		found, _, err := findImage(ctx, i.docker, i.client, imageID, "")
+		if err != nil {
+			return types.ImageInspect{}, err
+		}
+		ref = found
+	}
+
+	log.Debugf("inspect %s image in registry", ref)
+
+	config, manifest, desc, err := i.client.Config(ctx, ref)
+	if err != nil {
+		log.Errorf("inspect image in registry failed: %v", err)
+
+		return types.ImageInspect{}, ErrNoSuchImage
+	}
+
+	repo, _ := artifact.SplitReference(strings.SplitN(ref, "@", 2)[0])
+	inspect := types.ImageInspect{
+		ID:           manifest.Config.Digest.String(),
+		RepoTags:     []string{ref},
+		RepoDigests:  []string{fmt.Sprintf("%s@%s", repo, desc.Digest)},
+		Author:       config.Author,
+		Architecture: config.Architecture,
+		Os:           config.OS,
+		Config: &container.Config{
+			User:       config.Config.User,
+			Env:        config.Config.Env,
+			Cmd:        config.Config.Cmd,
+			Entrypoint: config.Config.Entrypoint,
+			WorkingDir: config.Config.WorkingDir,
+			Labels:     config.Config.Labels,
+		},
+		RootFS: types.RootFS{Type: config.RootFS.Type},
+	}
+	if config.Created != nil {
+		inspect.Created = config.Created.Format(time.RFC3339Nano)
+	}
+	for _, diffID := range config.RootFS.DiffIDs {
+		inspect.RootFS.Layers = append(inspect.RootFS.Layers, diffID.String())
+	}
+	for _, layer := range manifest.Layers {
+		inspect.Size += layer.Size
+	}
+	inspect.VirtualSize = inspect.Size
+
+	return inspect, nil
+}
+
 // AddTag add a new tag for image.
 func (i *imageService) AddTag(ctx context.Context, imageTag, newTag string) error {
-	if err := i.docker.ImageTag(ctx, imageTag, newTag); err != nil {
+	if err := i.builder.Tag(ctx, imageTag, newTag); err != nil {
 		log.Errorf("add tag failed: %v", err)
 
 		return err
@@ -231,7 +535,7 @@ func (i *imageService) AddTag(ctx context.Context, imageTag, newTag string) erro
 
 // Push push a image.
 func (i *imageService) Push(ctx context.Context, imageTag string) (io.ReadCloser, error) {
-	auth, err := i.docker.RegistryAuth()
+	auth, err := i.docker.RegistryAuthFor(strings.SplitN(imageTag, "/", 2)[0])
 	if err != nil {
 		log.Errorf("get RegistryAuth failed: %v", err)
 	}
@@ -251,3 +555,74 @@ func (i *imageService) Push(ctx context.Context, imageTag string) (io.ReadCloser
 
 	return response, nil
 }
+
+// Download verify the download token, open the saved image tar and compress it while streaming
+// with the encoding negotiated from acceptEncoding.
+func (i *imageService) Download(
+	ctx context.Context,
+	imageID string,
+	downloadToken string,
+	acceptEncoding string,
+) (io.ReadCloser, string, error) {
+	if err := i.signer.Verify(downloadToken, imageID); err != nil {
+		log.Errorf("verify download token of %s failed: %v", imageID, err)
+
+		return nil, "", err
+	}
+
+	fileName := i.store.TarPath(imageID)
+	file, err := i.store.OpenTar(imageID)
+	if err != nil {
+		log.Errorf("open %s failed: %v", fileName, err)
+
+		return nil, "", ErrNoSuchImage
+	}
+
+	encoding := compress.Negotiate(acceptEncoding, i.docker.GetCompression())
+	if encoding == compress.NONE {
+		return file, encoding, nil
+	}
+
+	log.Debugf("deliver %s with %s encoding", fileName, encoding)
+
+	reader, writer := io.Pipe()
+	go func() {
+		defer file.Close()
+
+		encoder, err := compress.NewWriter(writer, encoding, i.docker.GetCompressionLevel())
+		if err != nil {
+			writer.CloseWithError(err)
+
+			return
+		}
+
+		if _, err := io.Copy(encoder, file); err != nil {
+			log.Errorf("compress %s failed: %v", fileName, err)
+			encoder.Close()
+			writer.CloseWithError(err)
+
+			return
+		}
+
+		writer.CloseWithError(encoder.Close())
+	}()
+
+	return reader, encoding, nil
+}
+
+// IssueToken exchange the credential of a puller for a download token of imageID, which expires after
+// the ttl. The credential is the service account token of the chaincode pod the image is loaded for.
+func (i *imageService) IssueToken(ctx context.Context, imageID string, credential string) (string, error) {
+	if err := i.k8s.ReviewPullerCredential(ctx, credential, imageID); err != nil {
+		log.Errorf("review puller credential for %s failed: %v", imageID, err)
+
+		return "", err
+	}
+
+	return i.signer.Sign(imageID), nil
+}
+
+// SBOM return the CycloneDX SBOM of the built image.
+func (i *imageService) SBOM(ctx context.Context, image string) ([]byte, error) {
+	return imageSBOM(ctx, i.builder, i.store, image)
+}
@@ -6,19 +6,33 @@ package service
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"io"
+	"io/ioutil"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/docker/docker/api/types"
 	"github.com/golang/mock/gomock"
 	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
 
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/builder"
 	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/token"
 
 	"github.com/tianrandailove/peitho/pkg/docker"
 )
 
+// newDockerBuilder build images with the docker daemon of the mock.
+func newDockerBuilder(d docker.DockerService) builder.Builder {
+	return builder.NewBuilder(options.NewBuilderOption(), d, nil, nil)
+}
+
 func Test_newImage(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -94,7 +108,8 @@ func Test_imageService_Build(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			i := imageService{
-				docker: tt.fields.docker,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
 			}
 			got, err := i.Build(tt.args.ctx, tt.args.dockerfile, tt.args.tags, tt.args.content)
 			if (err != nil) != tt.wantErr {
@@ -108,12 +123,103 @@ func Test_imageService_Build(t *testing.T) {
 	}
 }
 
+func Test_imageService_Build_reuse(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	store := newTestStore(t, "chaincode/mycc:latest", []byte("{}"))
+	client, host := newTestRegistry(t, store)
+
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	ctx := context.Background()
+	dockerSrv.EXPECT().GetPlatforms().Return(nil).AnyTimes()
+	dockerSrv.EXPECT().ImageInspectWithRaw(ctx, gomock.Any()).Return(types.ImageInspect{}, nil, nil).AnyTimes()
+	dockerSrv.EXPECT().ImageTag(ctx, "sha256:0123456789abcdef", "mycc:latest").Return(nil)
+	dockerSrv.EXPECT().ImageTag(ctx, "mycc:latest", host+"/chaincode/mycc:latest").Return(nil)
+	dockerSrv.EXPECT().GetImageMode().Return("registry")
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{{Serveraddress: host, Project: "chaincode"}}).AnyTimes()
+	dockerSrv.EXPECT().ImageSave(ctx, []string{"mycc:latest"}).DoAndReturn(
+		func(ctx context.Context, images []string) (io.ReadCloser, error) {
+			return store.OpenTar("chaincode-mycc:latest")
+		},
+	)
+
+	// the image is in the registry already, so it is not pushed
+	i := imageService{
+		docker:  dockerSrv,
+		builder: newDockerBuilder(dockerSrv),
+		store:   store,
+		client:  client,
+	}
+
+	// the image was built from the same context before
+	contextHash := sha256.Sum256([]byte("context"))
+	key := i.buildKey(ctx, strings.NewReader("context"), "", hex.EncodeToString(contextHash[:]))
+	record := artifact.BuildRecord{Key: key, Tags: []string{"mycc:1.0"}, ImageID: "sha256:0123456789abcdef"}
+	if err := store.RecordBuild(record); err != nil {
+		t.Fatalf("RecordBuild() error = %v", err)
+	}
+
+	got, err := i.Build(ctx, "", []string{"mycc:latest"}, strings.NewReader("context"))
+	if err != nil {
+		t.Fatalf("imageService.Build() error = %v", err)
+	}
+	defer got.Close()
+
+	stream, _ := ioutil.ReadAll(got)
+	if !strings.Contains(string(stream), "Successfully tagged mycc:latest") {
+		t.Errorf("imageService.Build() = %s, want a successful build stream", stream)
+	}
+
+	// the sbom of the new tag is generated from the local image
+	if _, err := store.SBOM("mycc:latest"); err != nil {
+		t.Errorf("SBOM() error = %v", err)
+	}
+}
+
+func Test_readBuild(t *testing.T) {
+	tests := []struct {
+		name        string
+		stream      string
+		wantImageID string
+	}{
+		{
+			name: "built",
+			stream: `{"stream":"Step 1/2 : FROM hyperledger/fabric-ccenv"}
+{"aux":{"ID":"sha256:0123456789abcdef"}}
+{"stream":"Successfully built 0123456789ab"}
+`,
+			wantImageID: "sha256:0123456789abcdef",
+		},
+		{
+			name: "failed",
+			stream: `{"stream":"Step 1/2 : FROM hyperledger/fabric-ccenv"}
+{"errorDetail":{"message":"no such image"},"error":"no such image"}
+{"stream":"Removing intermediate container"}
+`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stream, imageID := readBuild(ioutil.NopCloser(strings.NewReader(tt.stream)))
+			if imageID != tt.wantImageID {
+				t.Errorf("readBuild() image id = %s, want %s", imageID, tt.wantImageID)
+			}
+			// the peer reads the whole stream
+			if output, _ := ioutil.ReadAll(stream); string(output) != tt.stream {
+				t.Errorf("readBuild() stream = %s, want %s", output, tt.stream)
+			}
+		})
+	}
+}
+
 func Test_imageService_Create(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
 
 	dockerSrv := docker.NewMockDockerService(ctrl)
 	ctx := context.Background()
+	dockerSrv.EXPECT().PullAuth("hyperledger/fabric-ccenv:latest").Return("")
 	dockerSrv.EXPECT().ImagePull(ctx, "hyperledger/fabric-ccenv:latest", gomock.Any()).Return(nil, nil)
 	type fields struct {
 		docker docker.DockerService
@@ -143,7 +249,8 @@ func Test_imageService_Create(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			i := imageService{
-				docker: tt.fields.docker,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
 			}
 			got, err := i.Create(tt.args.ctx, tt.args.fromImage)
 			if (err != nil) != tt.wantErr {
@@ -163,8 +270,9 @@ func Test_imageService_Inspect(t *testing.T) {
 
 	dockerSrv := docker.NewMockDockerService(ctrl)
 	ctx := context.Background()
+	dockerSrv.EXPECT().GetImageMode().Return(options.IMAGE_MODE_DELIVERY)
 	dockerSrv.EXPECT().
-		ImageInspectWithRaw(ctx, "hyperledger/fabric-ccenv:latest").
+		ImageInspectWithRaw(ctx, "172.198.101.18:8099/chaincode/hyperledger/fabric-ccenv:latest").
 		Return(types.ImageInspect{ID: "1"}, nil, errors.New("no such image"))
 	type fields struct {
 		docker docker.DockerService
@@ -185,7 +293,7 @@ func Test_imageService_Inspect(t *testing.T) {
 			fields: fields{dockerSrv},
 			args: args{
 				ctx:     ctx,
-				imageID: "hyperledger/fabric-ccenv:latest",
+				imageID: "172.198.101.18:8099/chaincode/hyperledger/fabric-ccenv:latest",
 			},
 			want:    types.ImageInspect{ID: "1"},
 			wantErr: true,
@@ -194,7 +302,8 @@ func Test_imageService_Inspect(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			i := imageService{
-				docker: tt.fields.docker,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
 			}
 			_, err := i.Inspect(tt.args.ctx, tt.args.imageID)
 			if (err != nil) != tt.wantErr {
@@ -205,6 +314,45 @@ func Test_imageService_Inspect(t *testing.T) {
 	}
 }
 
+func Test_imageService_Inspect_registry(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	config := []byte(`{"architecture":"amd64","os":"linux","config":{"Cmd":["chaincode"]},"rootfs":{"type":"layers"}}`)
+	client, host := newTestRegistry(t, newTestStore(t, "chaincode/mycc:latest", config))
+
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	ctx := context.Background()
+	dockerSrv.EXPECT().GetImageMode().Return(options.IMAGE_MODE_REGISTRY).AnyTimes()
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{{Serveraddress: host, Project: "chaincode"}}).AnyTimes()
+
+	// no local pull is expected
+	i := imageService{
+		docker:  dockerSrv,
+		builder: newDockerBuilder(dockerSrv),
+		client:  client,
+	}
+	got, err := i.Inspect(ctx, "mycc:latest")
+	if err != nil {
+		t.Fatalf("imageService.Inspect() error = %v", err)
+	}
+
+	inspect := got.(types.ImageInspect)
+	if inspect.ID != digest.FromBytes(config).String() {
+		t.Errorf("imageService.Inspect() ID = %s, want %s", inspect.ID, digest.FromBytes(config))
+	}
+	if inspect.Architecture != "amd64" || len(inspect.Config.Cmd) != 1 || inspect.Config.Cmd[0] != "chaincode" {
+		t.Errorf("imageService.Inspect() = %+v, want the config of the image", inspect)
+	}
+	if len(inspect.RepoDigests) != 1 || !strings.HasPrefix(inspect.RepoDigests[0], host+"/chaincode/mycc@sha256:") {
+		t.Errorf("imageService.Inspect() RepoDigests = %v", inspect.RepoDigests)
+	}
+
+	if _, err := i.Inspect(ctx, "othercc:latest"); err != ErrNoSuchImage {
+		t.Errorf("imageService.Inspect() of missing image error = %v, want %v", err, ErrNoSuchImage)
+	}
+}
+
 func Test_imageService_AddTag(t *testing.T) {
 	ctrl := gomock.NewController(t)
 	defer ctrl.Finish()
@@ -241,7 +389,8 @@ func Test_imageService_AddTag(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			i := imageService{
-				docker: tt.fields.docker,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
 			}
 			if err := i.AddTag(tt.args.ctx, tt.args.imageTag, tt.args.newTag); (err != nil) != tt.wantErr {
 				t.Errorf("imageService.AddTag() error = %v, wantErr %v", err, tt.wantErr)
@@ -256,7 +405,7 @@ func Test_imageService_Push(t *testing.T) {
 
 	dockerSrv := docker.NewMockDockerService(ctrl)
 	ctx := context.Background()
-	dockerSrv.EXPECT().RegistryAuth().Return("base64 auth", nil)
+	dockerSrv.EXPECT().RegistryAuthFor("172.198.161.22:8099").Return("base64 auth", nil)
 	dockerSrv.EXPECT().ImagePush(ctx, "172.198.161.22:8099/chaincode/mycc:latest", gomock.Any()).Return(nil, nil)
 
 	type fields struct {
@@ -287,7 +436,8 @@ func Test_imageService_Push(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			i := imageService{
-				docker: tt.fields.docker,
+				docker:  tt.fields.docker,
+				builder: newDockerBuilder(tt.fields.docker),
 			}
 			got, err := i.Push(tt.args.ctx, tt.args.imageTag)
 			if (err != nil) != tt.wantErr {
@@ -300,3 +450,27 @@ func Test_imageService_Push(t *testing.T) {
 		})
 	}
 }
+
+func Test_imageService_IssueToken(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	k8sSrv.EXPECT().ReviewPullerCredential(ctx, "pod token", "mycc").Return(nil)
+	k8sSrv.EXPECT().ReviewPullerCredential(ctx, "forged", "mycc").Return(k8s.ErrCredentialRejected)
+	signer, _ := token.NewSigner(&options.PeithoOption{DownloadSecret: "secret", DownloadTokenTTL: 60})
+	i := imageService{k8s: k8sSrv, signer: signer}
+
+	downloadToken, err := i.IssueToken(ctx, "mycc", "pod token")
+	if err != nil {
+		t.Fatalf("imageService.IssueToken() error = %v", err)
+	}
+	if err := signer.Verify(downloadToken, "mycc"); err != nil {
+		t.Errorf("verify issued token error = %v", err)
+	}
+
+	if _, err := i.IssueToken(ctx, "mycc", "forged"); !errors.Is(err, k8s.ErrCredentialRejected) {
+		t.Errorf("imageService.IssueToken() with forged credential error = %v, want %v", err, k8s.ErrCredentialRejected)
+	}
+}
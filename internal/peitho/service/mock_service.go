@@ -3,7 +3,7 @@
 // license that can be found in the LICENSE file.
 
 // Code generated by MockGen. DO NOT EDIT.
-// Source: github.com/tianrandailove/peitho/internal/peitho/service (interfaces: Service,ImageSrv,ContainerSrv)
+// Source: github.com/tianrandailove/peitho/internal/peitho/service (interfaces: Service,ImageSrv,ContainerSrv,RegistrySrv,HealthSrv,BundleSrv,ChaincodeSrv)
 
 // Package service is a generated GoMock package.
 package service
@@ -15,6 +15,8 @@ import (
 	time "time"
 
 	gomock "github.com/golang/mock/gomock"
+	bundle "github.com/tianrandailove/peitho/pkg/bundle"
+	k8s "github.com/tianrandailove/peitho/pkg/k8s"
 )
 
 // MockService is a mock of Service interface.
@@ -40,6 +42,34 @@ func (m *MockService) EXPECT() *MockServiceMockRecorder {
 	return m.recorder
 }
 
+// Bundle mocks base method.
+func (m *MockService) Bundle() BundleSrv {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Bundle")
+	ret0, _ := ret[0].(BundleSrv)
+	return ret0
+}
+
+// Bundle indicates an expected call of Bundle.
+func (mr *MockServiceMockRecorder) Bundle() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Bundle", reflect.TypeOf((*MockService)(nil).Bundle))
+}
+
+// Chaincodes mocks base method.
+func (m *MockService) Chaincodes() ChaincodeSrv {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Chaincodes")
+	ret0, _ := ret[0].(ChaincodeSrv)
+	return ret0
+}
+
+// Chaincodes indicates an expected call of Chaincodes.
+func (mr *MockServiceMockRecorder) Chaincodes() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Chaincodes", reflect.TypeOf((*MockService)(nil).Chaincodes))
+}
+
 // Containers mocks base method.
 func (m *MockService) Containers() ContainerSrv {
 	m.ctrl.T.Helper()
@@ -54,6 +84,20 @@ func (mr *MockServiceMockRecorder) Containers() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Containers", reflect.TypeOf((*MockService)(nil).Containers))
 }
 
+// Health mocks base method.
+func (m *MockService) Health() HealthSrv {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Health")
+	ret0, _ := ret[0].(HealthSrv)
+	return ret0
+}
+
+// Health indicates an expected call of Health.
+func (mr *MockServiceMockRecorder) Health() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Health", reflect.TypeOf((*MockService)(nil).Health))
+}
+
 // Images mocks base method.
 func (m *MockService) Images() ImageSrv {
 	m.ctrl.T.Helper()
@@ -68,6 +112,20 @@ func (mr *MockServiceMockRecorder) Images() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Images", reflect.TypeOf((*MockService)(nil).Images))
 }
 
+// Registry mocks base method.
+func (m *MockService) Registry() RegistrySrv {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Registry")
+	ret0, _ := ret[0].(RegistrySrv)
+	return ret0
+}
+
+// Registry indicates an expected call of Registry.
+func (mr *MockServiceMockRecorder) Registry() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Registry", reflect.TypeOf((*MockService)(nil).Registry))
+}
+
 // MockImageSrv is a mock of ImageSrv interface.
 type MockImageSrv struct {
 	ctrl     *gomock.Controller
@@ -135,6 +193,22 @@ func (mr *MockImageSrvMockRecorder) Create(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Create", reflect.TypeOf((*MockImageSrv)(nil).Create), arg0, arg1)
 }
 
+// Download mocks base method.
+func (m *MockImageSrv) Download(arg0 context.Context, arg1, arg2, arg3 string) (io.ReadCloser, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Download", arg0, arg1, arg2, arg3)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Download indicates an expected call of Download.
+func (mr *MockImageSrvMockRecorder) Download(arg0, arg1, arg2, arg3 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Download", reflect.TypeOf((*MockImageSrv)(nil).Download), arg0, arg1, arg2, arg3)
+}
+
 // Inspect mocks base method.
 func (m *MockImageSrv) Inspect(arg0 context.Context, arg1 string) (interface{}, error) {
 	m.ctrl.T.Helper()
@@ -150,6 +224,21 @@ func (mr *MockImageSrvMockRecorder) Inspect(arg0, arg1 interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockImageSrv)(nil).Inspect), arg0, arg1)
 }
 
+// IssueToken mocks base method.
+func (m *MockImageSrv) IssueToken(arg0 context.Context, arg1, arg2 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "IssueToken", arg0, arg1, arg2)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// IssueToken indicates an expected call of IssueToken.
+func (mr *MockImageSrvMockRecorder) IssueToken(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "IssueToken", reflect.TypeOf((*MockImageSrv)(nil).IssueToken), arg0, arg1, arg2)
+}
+
 // Push mocks base method.
 func (m *MockImageSrv) Push(arg0 context.Context, arg1 string) (io.ReadCloser, error) {
 	m.ctrl.T.Helper()
@@ -165,6 +254,21 @@ func (mr *MockImageSrvMockRecorder) Push(arg0, arg1 interface{}) *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Push", reflect.TypeOf((*MockImageSrv)(nil).Push), arg0, arg1)
 }
 
+// SBOM mocks base method.
+func (m *MockImageSrv) SBOM(arg0 context.Context, arg1 string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SBOM", arg0, arg1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SBOM indicates an expected call of SBOM.
+func (mr *MockImageSrvMockRecorder) SBOM(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SBOM", reflect.TypeOf((*MockImageSrv)(nil).SBOM), arg0, arg1)
+}
+
 // MockContainerSrv is a mock of ContainerSrv interface.
 type MockContainerSrv struct {
 	ctrl     *gomock.Controller
@@ -218,6 +322,21 @@ func (mr *MockContainerSrvMockRecorder) Fetch(arg0, arg1, arg2 interface{}) *gom
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Fetch", reflect.TypeOf((*MockContainerSrv)(nil).Fetch), arg0, arg1, arg2)
 }
 
+// Inspect mocks base method.
+func (m *MockContainerSrv) Inspect(arg0 context.Context, arg1 string) (interface{}, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Inspect", arg0, arg1)
+	ret0, _ := ret[0].(interface{})
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Inspect indicates an expected call of Inspect.
+func (mr *MockContainerSrvMockRecorder) Inspect(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Inspect", reflect.TypeOf((*MockContainerSrv)(nil).Inspect), arg0, arg1)
+}
+
 // Kill mocks base method.
 func (m *MockContainerSrv) Kill(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -301,3 +420,201 @@ func (mr *MockContainerSrvMockRecorder) Wait(arg0, arg1 interface{}) *gomock.Cal
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Wait", reflect.TypeOf((*MockContainerSrv)(nil).Wait), arg0, arg1)
 }
+
+// MockRegistrySrv is a mock of RegistrySrv interface.
+type MockRegistrySrv struct {
+	ctrl     *gomock.Controller
+	recorder *MockRegistrySrvMockRecorder
+}
+
+// MockRegistrySrvMockRecorder is the mock recorder for MockRegistrySrv.
+type MockRegistrySrvMockRecorder struct {
+	mock *MockRegistrySrv
+}
+
+// NewMockRegistrySrv creates a new mock instance.
+func NewMockRegistrySrv(ctrl *gomock.Controller) *MockRegistrySrv {
+	mock := &MockRegistrySrv{ctrl: ctrl}
+	mock.recorder = &MockRegistrySrvMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockRegistrySrv) EXPECT() *MockRegistrySrvMockRecorder {
+	return m.recorder
+}
+
+// Blob mocks base method.
+func (m *MockRegistrySrv) Blob(arg0 context.Context, arg1, arg2 string) (io.ReadCloser, int64, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Blob", arg0, arg1, arg2)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(int64)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Blob indicates an expected call of Blob.
+func (mr *MockRegistrySrvMockRecorder) Blob(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Blob", reflect.TypeOf((*MockRegistrySrv)(nil).Blob), arg0, arg1, arg2)
+}
+
+// Manifest mocks base method.
+func (m *MockRegistrySrv) Manifest(arg0 context.Context, arg1, arg2 string) ([]byte, string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Manifest", arg0, arg1, arg2)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(string)
+	ret2, _ := ret[2].(error)
+	return ret0, ret1, ret2
+}
+
+// Manifest indicates an expected call of Manifest.
+func (mr *MockRegistrySrvMockRecorder) Manifest(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Manifest", reflect.TypeOf((*MockRegistrySrv)(nil).Manifest), arg0, arg1, arg2)
+}
+
+// MockHealthSrv is a mock of HealthSrv interface.
+type MockHealthSrv struct {
+	ctrl     *gomock.Controller
+	recorder *MockHealthSrvMockRecorder
+}
+
+// MockHealthSrvMockRecorder is the mock recorder for MockHealthSrv.
+type MockHealthSrvMockRecorder struct {
+	mock *MockHealthSrv
+}
+
+// NewMockHealthSrv creates a new mock instance.
+func NewMockHealthSrv(ctrl *gomock.Controller) *MockHealthSrv {
+	mock := &MockHealthSrv{ctrl: ctrl}
+	mock.recorder = &MockHealthSrvMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockHealthSrv) EXPECT() *MockHealthSrvMockRecorder {
+	return m.recorder
+}
+
+// Check mocks base method.
+func (m *MockHealthSrv) Check(arg0 context.Context) *Health {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Check", arg0)
+	ret0, _ := ret[0].(*Health)
+	return ret0
+}
+
+// Check indicates an expected call of Check.
+func (mr *MockHealthSrvMockRecorder) Check(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Check", reflect.TypeOf((*MockHealthSrv)(nil).Check), arg0)
+}
+
+// MockBundleSrv is a mock of BundleSrv interface.
+type MockBundleSrv struct {
+	ctrl     *gomock.Controller
+	recorder *MockBundleSrvMockRecorder
+}
+
+// MockBundleSrvMockRecorder is the mock recorder for MockBundleSrv.
+type MockBundleSrvMockRecorder struct {
+	mock *MockBundleSrv
+}
+
+// NewMockBundleSrv creates a new mock instance.
+func NewMockBundleSrv(ctrl *gomock.Controller) *MockBundleSrv {
+	mock := &MockBundleSrv{ctrl: ctrl}
+	mock.recorder = &MockBundleSrvMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockBundleSrv) EXPECT() *MockBundleSrvMockRecorder {
+	return m.recorder
+}
+
+// Export mocks base method.
+func (m *MockBundleSrv) Export(arg0 context.Context, arg1 []string, arg2 io.Writer) (*bundle.Manifest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Export", arg0, arg1, arg2)
+	ret0, _ := ret[0].(*bundle.Manifest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Export indicates an expected call of Export.
+func (mr *MockBundleSrvMockRecorder) Export(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Export", reflect.TypeOf((*MockBundleSrv)(nil).Export), arg0, arg1, arg2)
+}
+
+// Import mocks base method.
+func (m *MockBundleSrv) Import(arg0 context.Context, arg1 io.Reader) (*bundle.Manifest, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Import", arg0, arg1)
+	ret0, _ := ret[0].(*bundle.Manifest)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Import indicates an expected call of Import.
+func (mr *MockBundleSrvMockRecorder) Import(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Import", reflect.TypeOf((*MockBundleSrv)(nil).Import), arg0, arg1)
+}
+
+// MockChaincodeSrv is a mock of ChaincodeSrv interface.
+type MockChaincodeSrv struct {
+	ctrl     *gomock.Controller
+	recorder *MockChaincodeSrvMockRecorder
+}
+
+// MockChaincodeSrvMockRecorder is the mock recorder for MockChaincodeSrv.
+type MockChaincodeSrvMockRecorder struct {
+	mock *MockChaincodeSrv
+}
+
+// NewMockChaincodeSrv creates a new mock instance.
+func NewMockChaincodeSrv(ctrl *gomock.Controller) *MockChaincodeSrv {
+	mock := &MockChaincodeSrv{ctrl: ctrl}
+	mock.recorder = &MockChaincodeSrvMockRecorder{mock}
+	return mock
+}
+
+// EXPECT returns an object that allows the caller to indicate expected use.
+func (m *MockChaincodeSrv) EXPECT() *MockChaincodeSrvMockRecorder {
+	return m.recorder
+}
+
+// Get mocks base method.
+func (m *MockChaincodeSrv) Get(arg0 context.Context, arg1 string) (*k8s.Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Get", arg0, arg1)
+	ret0, _ := ret[0].(*k8s.Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// Get indicates an expected call of Get.
+func (mr *MockChaincodeSrvMockRecorder) Get(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Get", reflect.TypeOf((*MockChaincodeSrv)(nil).Get), arg0, arg1)
+}
+
+// List mocks base method.
+func (m *MockChaincodeSrv) List(arg0 context.Context) ([]k8s.Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", arg0)
+	ret0, _ := ret[0].([]k8s.Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockChaincodeSrvMockRecorder) List(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockChaincodeSrv)(nil).List), arg0)
+}
@@ -0,0 +1,249 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// platformTag tag the image of the platform, like mycc:latest-linux-arm64.
+func platformTag(image string, platform ocispec.Platform) string {
+	repo, tag := artifact.SplitReference(image)
+
+	return fmt.Sprintf("%s:%s-%s", repo, tag, strings.ReplaceAll(docker.FormatPlatform(platform), "/", "-"))
+}
+
+// primaryPlatform return the platform chaincode is compiled for, nil for the platform of the docker host.
+func primaryPlatform(d docker.DockerService) *ocispec.Platform {
+	if platforms := d.GetPlatforms(); len(platforms) > 0 {
+		return &platforms[0]
+	}
+
+	return nil
+}
+
+// buildPlatforms tag the primary image for its platform and build the image for every other configured
+// platform, a platform is skipped if its build fails or the binaries in the build context are compiled for
+// another architecture. return the image id of every built platform.
+func (i *imageService) buildPlatforms(
+	ctx context.Context,
+	buildContext io.ReadSeeker,
+	imageOptions types.ImageBuildOptions,
+	tags []string,
+	imageID string,
+) map[string]string {
+	configured := i.docker.GetPlatforms()
+
+	archs := make(map[string]bool)
+	if _, err := buildContext.Seek(0, io.SeekStart); err == nil {
+		builder.BinaryArchs(buildContext, archs)
+	}
+
+	for _, tag := range tags {
+		if err := i.builder.Tag(ctx, imageID, platformTag(tag, configured[0])); err != nil {
+			log.Errorf("tag %s for %s failed: %v", tag, docker.FormatPlatform(configured[0]), err)
+
+			return nil
+		}
+	}
+	platforms := map[string]string{docker.FormatPlatform(configured[0]): imageID}
+
+	for _, platform := range configured[1:] {
+		name := docker.FormatPlatform(platform)
+		if len(archs) > 0 && !archs[platform.Architecture] {
+			log.Warnf("skip platform %s of %s, the chaincode is compiled for another architecture", name, tags[0])
+
+			continue
+		}
+
+		id, err := i.buildPlatform(ctx, buildContext, imageOptions, tags, platform)
+		if err != nil {
+			log.Warnf("build %s for %s failed, skip the platform: %v", tags[0], name, err)
+
+			continue
+		}
+		log.Infof("build image %s for %s complete", tags[0], name)
+		platforms[name] = id
+	}
+
+	return platforms
+}
+
+// buildPlatform build the image for the platform, it is tagged with the platform tags.
+func (i *imageService) buildPlatform(
+	ctx context.Context,
+	buildContext io.ReadSeeker,
+	imageOptions types.ImageBuildOptions,
+	tags []string,
+	platform ocispec.Platform,
+) (string, error) {
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	imageOptions.Platform = docker.FormatPlatform(platform)
+	imageOptions.Tags = make([]string, 0, len(tags))
+	for _, tag := range tags {
+		imageOptions.Tags = append(imageOptions.Tags, platformTag(tag, platform))
+	}
+
+	stream, err := i.builder.Build(ctx, buildContext, imageOptions)
+	if err != nil {
+		return "", err
+	}
+	defer stream.Close()
+
+	// build errors and the built image are reported in the progress stream
+	var imageID string
+	if err := jsonmessage.DisplayJSONMessagesStream(stream, ioutil.Discard, 0, false, auxImageID(&imageID)); err != nil {
+		return "", err
+	}
+	if imageID == "" {
+		return "", fmt.Errorf("no image built for %s", imageOptions.Platform)
+	}
+
+	return imageID, nil
+}
+
+// publishIndex push the image of every built platform, then a manifest list of them under the tag in every
+// registry holding them all. the manifest list is signed when a signing key is configured.
+func (i *imageService) publishIndex(ctx context.Context, image string, platforms map[string]string, onlyIfMissing bool) error {
+	var built []ocispec.Platform
+	for _, platform := range i.docker.GetPlatforms() {
+		if _, ok := platforms[docker.FormatPlatform(platform)]; !ok {
+			continue
+		}
+		if _, _, err := pushImage(ctx, i.docker, i.builder, i.client, i.cosigner, platformTag(image, platform), "", onlyIfMissing); err != nil {
+			return err
+		}
+		built = append(built, platform)
+	}
+
+	var published string
+	for _, registry := range i.docker.GetRegistries() {
+		ref := registry.Reference("", image)
+
+		dgst, err := pushIndex(ctx, i.client, registry, image, built)
+		if err != nil {
+			log.Errorf("push manifest list %s failed: %v", ref, err)
+
+			continue
+		}
+		if err := signRemote(ctx, i.client, i.cosigner, ref, dgst); err != nil {
+			log.Errorf("sign %s failed: %v", ref, err)
+
+			return err
+		}
+		if published == "" {
+			published = pinDigest(ref, dgst)
+		}
+	}
+
+	if published == "" {
+		return ErrNoRegistry
+	}
+	log.Infof("%s is published as %s for %d platforms", image, published, len(built))
+
+	return nil
+}
+
+// pushIndex push the manifest list of the platform images in the registry, return its digest.
+func pushIndex(
+	ctx context.Context,
+	client *distribution.Client,
+	registry *docker.Registry,
+	image string,
+	platforms []ocispec.Platform,
+) (digest.Digest, error) {
+	manifests := make([]ocispec.Descriptor, 0, len(platforms))
+	for _, platform := range platforms {
+		desc, err := client.Head(ctx, registry.Reference("", platformTag(image, platform)))
+		if err != nil {
+			return "", err
+		}
+		platform := platform
+		desc.Platform = &platform
+		manifests = append(manifests, desc)
+	}
+
+	r, err := distribution.ParseReference(registry.Reference("", image))
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := client.PushIndex(ctx, r, manifests)
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest, nil
+}
+
+// nodeArchs return the architectures the chaincode pods are restricted to, none if every configured
+// platform is available.
+func nodeArchs(available []ocispec.Platform, configured []ocispec.Platform) []string {
+	var archs []string
+	for _, platform := range available {
+		if platform.Architecture != "" && !contains(archs, platform.Architecture) {
+			archs = append(archs, platform.Architecture)
+		}
+	}
+
+	covered := len(configured) > 0
+	for _, platform := range configured {
+		if !contains(archs, platform.Architecture) {
+			covered = false
+		}
+	}
+	if covered {
+		return nil
+	}
+
+	return archs
+}
+
+// imageArchs find the platforms of the image the deployment runs, from the registry in registry mode or
+// from the saved image otherwise, and return the architectures the pods are restricted to.
+func (cs *containerService) imageArchs(ctx context.Context, mode string, image string, ref string) []string {
+	var platforms []ocispec.Platform
+	var err error
+
+	switch mode {
+	case options.IMAGE_MODE_DELIVERY, options.IMAGE_MODE_EMBEDDED:
+		// the image is on the docker host if it is built here, the saved tar is read otherwise
+		if inspect, _, inspectErr := cs.docker.ImageInspectWithRaw(ctx, image); inspectErr == nil {
+			platforms = []ocispec.Platform{{OS: inspect.Os, Architecture: inspect.Architecture, Variant: inspect.Variant}}
+		} else {
+			var platform ocispec.Platform
+			platform, err = cs.store.Platform(image)
+			platforms = []ocispec.Platform{platform}
+		}
+	default:
+		platforms, err = cs.client.Platforms(ctx, ref)
+	}
+	if err != nil {
+		log.Warnf("find platforms of %s failed, it is scheduled to every node: %v", image, err)
+
+		return nil
+	}
+
+	return nodeArchs(platforms, cs.docker.GetPlatforms())
+}
@@ -0,0 +1,48 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+func Test_nodeArchs(t *testing.T) {
+	amd64 := ocispec.Platform{OS: "linux", Architecture: "amd64"}
+	arm64 := ocispec.Platform{OS: "linux", Architecture: "arm64"}
+
+	tests := []struct {
+		name       string
+		available  []ocispec.Platform
+		configured []ocispec.Platform
+		want       []string
+	}{
+		{name: "host platform", available: []ocispec.Platform{amd64}, want: []string{"amd64"}},
+		{name: "every platform", available: []ocispec.Platform{amd64, arm64}, configured: []ocispec.Platform{amd64, arm64}},
+		{
+			name:       "some platforms",
+			available:  []ocispec.Platform{amd64},
+			configured: []ocispec.Platform{amd64, arm64},
+			want:       []string{"amd64"},
+		},
+		{name: "unknown", available: []ocispec.Platform{{}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := nodeArchs(tt.available, tt.configured); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeArchs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_platformTag(t *testing.T) {
+	arm := ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	if got := platformTag("localhost:5000/mycc", arm); got != "localhost:5000/mycc:latest-linux-arm-v7" {
+		t.Errorf("platformTag() = %s", got)
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"io"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+var ErrNoSuchBlob = errors.New("no such blob")
+
+// RegistrySrv serve the built chaincode images through the read-only OCI distribution api.
+type RegistrySrv interface {
+	Manifest(ctx context.Context, name string, reference string) ([]byte, string, error)
+	Blob(ctx context.Context, name string, dgst string) (io.ReadCloser, int64, error)
+}
+
+type registryService struct {
+	store *artifact.Store
+}
+
+var _ RegistrySrv = (*registryService)(nil)
+
+func newRegistry(srv *service) *registryService {
+	return &registryService{
+		store: srv.store,
+	}
+}
+
+// Manifest return the manifest and its digest of the reference.
+func (r *registryService) Manifest(ctx context.Context, name string, reference string) ([]byte, string, error) {
+	data, dgst, err := r.store.Manifest(name, reference)
+	if err != nil {
+		log.Errorf("get manifest %s:%s failed: %v", name, reference, err)
+
+		return nil, "", ErrNoSuchImage
+	}
+
+	return data, dgst.String(), nil
+}
+
+// Blob open the blob of the digest.
+func (r *registryService) Blob(ctx context.Context, name string, dgst string) (io.ReadCloser, int64, error) {
+	file, err := r.store.Blob(digest.Digest(dgst))
+	if err != nil {
+		log.Errorf("get blob %s of %s failed: %v", dgst, name, err)
+
+		return nil, 0, ErrNoSuchBlob
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return nil, 0, err
+	}
+
+	return file, info.Size(), nil
+}
@@ -0,0 +1,236 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+const MSPID_ENV = "CORE_PEER_LOCALMSPID"
+
+var ErrNoRegistry = errors.New("no registry available")
+
+// mspID find the MSP ID of the peer from the chaincode environment.
+func mspID(env []string) string {
+	for _, e := range env {
+		if strings.HasPrefix(e, MSPID_ENV+"=") {
+			return strings.TrimPrefix(e, MSPID_ENV+"=")
+		}
+	}
+
+	return ""
+}
+
+// inRegistries check the image reference is in one of the registries.
+func inRegistries(registries []*docker.Registry, image string) bool {
+	for _, registry := range registries {
+		if registry.Serveraddress != "" && strings.HasPrefix(image, registry.Serveraddress+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pullSecrets return the image pull secrets of the registries.
+func pullSecrets(registries []*docker.Registry) []string {
+	var secrets []string
+	for _, registry := range registries {
+		if registry.Secret != "" && !contains(secrets, registry.Secret) {
+			secrets = append(secrets, registry.Secret)
+		}
+	}
+
+	return secrets
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
+
+// pushImage push the local image into the project of the MSP ID, the registries are tried in priority
+// order until one accepts it, then it is replicated to every mirror. the push fails if no registry but the
+// mirrors would accept it, a replica alone is not a pushed image. the image is signed in every registry
+// which received it when a signing key is configured.
+// return the reference and the manifest digest in the first registry that accepted it.
+func pushImage(
+	ctx context.Context,
+	d docker.DockerService,
+	b builder.Builder,
+	client *distribution.Client,
+	cosigner *signature.Signer,
+	image string,
+	mspID string,
+	onlyIfMissing bool,
+) (string, digest.Digest, error) {
+	var ref string
+	var dgst digest.Digest
+	lastErr := ErrNoRegistry
+
+	for _, registry := range d.GetRegistries() {
+		if registry.Mirror || ref != "" {
+			continue
+		}
+
+		pushed, err := pushTo(ctx, b, client, cosigner, registry, image, mspID, onlyIfMissing)
+		if err != nil {
+			log.Errorf("push %s to %s failed, try next registry: %v", image, registry.Serveraddress, err)
+			lastErr = err
+
+			continue
+		}
+		ref, dgst = registry.Reference(mspID, image), pushed
+	}
+
+	if ref == "" {
+		return "", "", lastErr
+	}
+
+	for _, registry := range d.GetRegistries() {
+		if !registry.Mirror {
+			continue
+		}
+
+		if _, err := pushTo(ctx, b, client, cosigner, registry, image, mspID, onlyIfMissing); err != nil {
+			log.Warnf("replicate %s to mirror %s failed: %v", image, registry.Serveraddress, err)
+		}
+	}
+
+	return ref, dgst, nil
+}
+
+// pushTo push the image to the registry and sign it, return the manifest digest reported by the push.
+func pushTo(
+	ctx context.Context,
+	b builder.Builder,
+	client *distribution.Client,
+	cosigner *signature.Signer,
+	registry *docker.Registry,
+	image string,
+	mspID string,
+	onlyIfMissing bool,
+) (digest.Digest, error) {
+	ref := registry.Reference(mspID, image)
+
+	log.Debugf("oldTag:%s", image)
+	log.Debugf("newTag:%s", ref)
+
+	if err := b.Tag(ctx, image, ref); err != nil {
+		log.Errorf("add new tag failed: %v", err)
+
+		return "", err
+	}
+
+	if onlyIfMissing {
+		if desc, err := client.Head(ctx, ref); err == nil {
+			log.Infof("%s already exists in registry, skip push", ref)
+
+			return desc.Digest, signRemote(ctx, client, cosigner, ref, desc.Digest)
+		}
+	}
+
+	dgst, err := b.Push(ctx, ref)
+	if err != nil {
+		return "", err
+	}
+
+	log.Infof("%s push success, digest: %s", ref, dgst)
+
+	if cosigner.CanSign() {
+		// the digest is not reported by every daemon, ask the registry
+		if dgst == "" {
+			desc, err := client.Head(ctx, ref)
+			if err != nil {
+				return "", err
+			}
+			dgst = desc.Digest
+		}
+		if err := signRemote(ctx, client, cosigner, ref, dgst); err != nil {
+			log.Errorf("sign %s failed: %v", ref, err)
+
+			return "", err
+		}
+	}
+
+	return dgst, nil
+}
+
+// pinDigest replace the tag of the reference with the digest.
+func pinDigest(ref string, dgst digest.Digest) string {
+	if dgst == "" {
+		return ref
+	}
+	repo, _ := artifact.SplitReference(ref)
+
+	return fmt.Sprintf("%s@%s", repo, dgst)
+}
+
+// imageAnnotations record the image reference and its digest on the deployment.
+func imageAnnotations(ref string, dgst digest.Digest) map[string]string {
+	annotations := map[string]string{k8s.AnnotationImage: ref}
+	if dgst != "" {
+		annotations[k8s.AnnotationImageDigest] = dgst.String()
+	}
+
+	return annotations
+}
+
+// inventoryAnnotations return the inventory and image annotations of the chaincode deployment.
+func inventoryAnnotations(containerID string, env []string, mode string, ref string, dgst digest.Digest) map[string]string {
+	annotations := k8s.InventoryAnnotations(containerID, env, mode, time.Now())
+	for k, v := range imageAnnotations(ref, dgst) {
+		annotations[k] = v
+	}
+
+	return annotations
+}
+
+// findImage find the image in the project of the MSP ID of the first registry which holds it,
+// return the reference and its manifest descriptor.
+func findImage(
+	ctx context.Context,
+	d docker.DockerService,
+	client *distribution.Client,
+	image string,
+	mspID string,
+) (string, ocispec.Descriptor, error) {
+	for _, registry := range d.GetRegistries() {
+		ref := registry.Reference(mspID, image)
+
+		desc, err := client.Head(ctx, ref)
+		if err != nil {
+			log.Debugf("head %s failed: %v", ref, err)
+
+			continue
+		}
+
+		log.Debugf("image %s exists, digest: %s", ref, desc.Digest)
+
+		return ref, desc, nil
+	}
+
+	return "", ocispec.Descriptor{}, ErrNoSuchImage
+}
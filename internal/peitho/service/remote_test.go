@@ -0,0 +1,178 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+)
+
+func Test_pushImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{
+		{Serveraddress: "primary", Project: "chaincode", Projects: map[string]string{"Org1MSP": "org1"}},
+		{Serveraddress: "secondary", Project: "chaincode"},
+		{Serveraddress: "mirror", Project: "chaincode", Mirror: true},
+	}).AnyTimes()
+	dockerSrv.EXPECT().RegistryAuthFor(gomock.Any()).Return("auth", nil).AnyTimes()
+	dockerSrv.EXPECT().ImageTag(ctx, "mycc:latest", gomock.Any()).Return(nil).AnyTimes()
+
+	// the primary fails in the progress stream, the secondary takes over and the mirror gets a replica
+	dockerSrv.EXPECT().
+		ImagePush(ctx, "primary/org1/mycc:latest", gomock.Any()).
+		Return(io.NopCloser(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied"}`)), nil)
+	dockerSrv.EXPECT().
+		ImagePush(ctx, "secondary/chaincode/mycc:latest", gomock.Any()).
+		Return(io.NopCloser(strings.NewReader(`{"status":"pushed"}`+"\n"+
+			`{"aux":{"Tag":"latest","Digest":"sha256:e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855","Size":1}}`)), nil)
+	dockerSrv.EXPECT().
+		ImagePush(ctx, "mirror/chaincode/mycc:latest", gomock.Any()).
+		Return(io.NopCloser(strings.NewReader("")), nil)
+
+	ref, dgst, err := pushImage(ctx, dockerSrv, newDockerBuilder(dockerSrv), nil, nil, "mycc:latest", "Org1MSP", false)
+	if err != nil {
+		t.Fatalf("pushImage() error = %v", err)
+	}
+	if ref != "secondary/chaincode/mycc:latest" || dgst != digest.FromString("") {
+		t.Errorf("pushImage() = %s, %s, want the reference and digest in the secondary", ref, dgst)
+	}
+	if pinned := pinDigest(ref, dgst); pinned != "secondary/chaincode/mycc@"+digest.FromString("").String() {
+		t.Errorf("pinDigest() = %s", pinned)
+	}
+}
+
+func Test_pushImage_mirrorOnly(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{
+		{Serveraddress: "primary", Project: "chaincode"},
+		{Serveraddress: "mirror", Project: "chaincode", Mirror: true},
+	}).AnyTimes()
+	dockerSrv.EXPECT().RegistryAuthFor(gomock.Any()).Return("auth", nil).AnyTimes()
+	dockerSrv.EXPECT().ImageTag(ctx, "mycc:latest", gomock.Any()).Return(nil).AnyTimes()
+
+	// the primary refuses the image, it is not replicated and the push fails
+	dockerSrv.EXPECT().
+		ImagePush(ctx, "primary/chaincode/mycc:latest", gomock.Any()).
+		Return(io.NopCloser(strings.NewReader(`{"errorDetail":{"message":"denied"},"error":"denied"}`)), nil)
+
+	if ref, _, err := pushImage(ctx, dockerSrv, newDockerBuilder(dockerSrv), nil, nil, "mycc:latest", "", false); err == nil {
+		t.Errorf("pushImage() = %s, want an error when only a mirror could take the image", ref)
+	}
+}
+
+// newTestRegistry serve the images of the store through an in-process registry,
+// return a client of it and its host.
+func newTestRegistry(t *testing.T, store *artifact.Store) (*distribution.Client, string) {
+	registry := &registryService{store: store}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path := strings.TrimPrefix(r.URL.Path, "/v2/")
+		if i := strings.LastIndex(path, "/manifests/"); i > 0 {
+			data, dgst, err := registry.Manifest(r.Context(), path[:i], path[i+len("/manifests/"):])
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", dgst)
+			_, _ = w.Write(data)
+
+			return
+		}
+		if i := strings.LastIndex(path, "/blobs/"); i > 0 {
+			blob, _, err := registry.Blob(r.Context(), path[:i], path[i+len("/blobs/"):])
+			if err != nil {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			defer blob.Close()
+			_, _ = io.Copy(w, blob)
+
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	t.Cleanup(server.Close)
+
+	client := distribution.NewClient(distribution.Options{PlainHTTP: func(string) bool { return true }})
+
+	return client, strings.TrimPrefix(server.URL, "http://")
+}
+
+// newTestStore create a store holding the image with the config.
+func newTestStore(t *testing.T, image string, config []byte) *artifact.Store {
+	store, err := artifact.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	manifest, _ := json.Marshal([]map[string]interface{}{
+		{"Config": "config.json", "RepoTags": []string{image}, "Layers": []string{"layer.tar"}},
+	})
+	for name, data := range map[string][]byte{"layer.tar": []byte("layer"), "config.json": config, "manifest.json": manifest} {
+		_ = tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg})
+		_, _ = tw.Write(data)
+	}
+	tw.Close()
+
+	name := strings.ReplaceAll(image, "/", "-")
+	if _, err := store.SaveTar(name, buf); err != nil {
+		t.Fatalf("SaveTar() error = %v", err)
+	}
+	if _, err := store.Import(name); err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	return store
+}
+
+func Test_findImage(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	client, host := newTestRegistry(t, newTestStore(t, "chaincode/mycc:latest", []byte("{}")))
+
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().GetRegistries().Return([]*docker.Registry{
+		{Serveraddress: host, Project: "org1"},
+		{Serveraddress: host, Project: "chaincode"},
+	}).AnyTimes()
+
+	ref, desc, err := findImage(ctx, dockerSrv, client, "mycc:latest", "Org1MSP")
+	if err != nil || ref != host+"/chaincode/mycc:latest" || desc.Digest == "" {
+		t.Errorf("findImage() = %s, %v, %v, want %s/chaincode/mycc:latest", ref, desc.Digest, err, host)
+	}
+
+	if _, _, err := findImage(ctx, dockerSrv, client, "othercc:latest", ""); err != ErrNoSuchImage {
+		t.Errorf("findImage() of missing image error = %v, want %v", err, ErrNoSuchImage)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"fmt"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// hostRoot is where the node paths mounted in the puller container.
+const hostRoot = "/host"
+
+type runtimeSocket struct {
+	// the directory on the node contains the socket, mounted into puller, empty if the loader has no socket
+	dir    string
+	socket string
+	// extra directories the loader writes to
+	extra []string
+}
+
+var runtimeSockets = map[string]runtimeSocket{
+	options.RUNTIME_DOCKER:             {dir: "/var/run/", socket: "docker.sock"},
+	options.RUNTIME_CONTAINERD:         {dir: "/run/containerd/", socket: "containerd.sock"},
+	options.RUNTIME_CONTAINERS_STORAGE: {extra: []string{"/var/lib/containers/", "/run/containers/"}},
+}
+
+// pullerRuntimeArgs return the puller flags and host mounts for the runtime.
+func pullerRuntimeArgs(runtime string) ([]string, []k8s.HostPathMount) {
+	rs, ok := runtimeSockets[runtime]
+	if !ok {
+		rs = runtimeSockets[options.RUNTIME_DOCKER]
+		runtime = options.RUNTIME_DOCKER
+	}
+
+	args := []string{fmt.Sprintf("--runtime=%s", runtime)}
+	mounts := []k8s.HostPathMount{}
+	if rs.socket != "" {
+		args = append(args, fmt.Sprintf("--runtime.endpoint=unix://%s%s%s", hostRoot, rs.dir, rs.socket))
+		mounts = append(mounts, k8s.HostPathMount{Name: runtime, HostPath: rs.dir, MountPath: hostRoot + rs.dir})
+	}
+	for i, dir := range rs.extra {
+		mounts = append(mounts, k8s.HostPathMount{
+			Name:      fmt.Sprintf("%s-%d", runtime, i),
+			HostPath:  dir,
+			MountPath: dir,
+		})
+	}
+
+	return args, mounts
+}
+
+// hostPaths return the mounts of the puller in the chaincode spec.
+func hostPaths(mounts []k8s.HostPathMount) []v1alpha1.HostPath {
+	paths := make([]v1alpha1.HostPath, 0, len(mounts))
+	for _, m := range mounts {
+		paths = append(paths, v1alpha1.HostPath{Name: m.Name, HostPath: m.HostPath, MountPath: m.MountPath})
+	}
+
+	return paths
+}
@@ -0,0 +1,72 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func Test_pullerRuntimeArgs(t *testing.T) {
+	tests := []struct {
+		name       string
+		runtime    string
+		wantArgs   []string
+		wantMounts []k8s.HostPathMount
+	}{
+		{
+			name:    "docker",
+			runtime: options.RUNTIME_DOCKER,
+			wantArgs: []string{
+				"--runtime=docker",
+				"--runtime.endpoint=unix:///host/var/run/docker.sock",
+			},
+			wantMounts: []k8s.HostPathMount{{Name: "docker", HostPath: "/var/run/", MountPath: "/host/var/run/"}},
+		},
+		{
+			name:    "containerd",
+			runtime: options.RUNTIME_CONTAINERD,
+			wantArgs: []string{
+				"--runtime=containerd",
+				"--runtime.endpoint=unix:///host/run/containerd/containerd.sock",
+			},
+			wantMounts: []k8s.HostPathMount{
+				{Name: "containerd", HostPath: "/run/containerd/", MountPath: "/host/run/containerd/"},
+			},
+		},
+		{
+			name:     "containers-storage",
+			runtime:  options.RUNTIME_CONTAINERS_STORAGE,
+			wantArgs: []string{"--runtime=containers-storage"},
+			wantMounts: []k8s.HostPathMount{
+				{Name: "containers-storage-0", HostPath: "/var/lib/containers/", MountPath: "/var/lib/containers/"},
+				{Name: "containers-storage-1", HostPath: "/run/containers/", MountPath: "/run/containers/"},
+			},
+		},
+		{
+			name:    "unknown fallback to docker",
+			runtime: "",
+			wantArgs: []string{
+				"--runtime=docker",
+				"--runtime.endpoint=unix:///host/var/run/docker.sock",
+			},
+			wantMounts: []k8s.HostPathMount{{Name: "docker", HostPath: "/var/run/", MountPath: "/host/var/run/"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			args, mounts := pullerRuntimeArgs(tt.runtime)
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("pullerRuntimeArgs() args = %v, want %v", args, tt.wantArgs)
+			}
+			if !reflect.DeepEqual(mounts, tt.wantMounts) {
+				t.Errorf("pullerRuntimeArgs() mounts = %v, want %v", mounts, tt.wantMounts)
+			}
+		})
+	}
+}
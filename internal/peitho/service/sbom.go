@@ -0,0 +1,64 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+)
+
+// generateSBOM generate the SBOM of the image from its saved tar, or from the built image,
+// and store it next to the image tar.
+func generateSBOM(ctx context.Context, b builder.Builder, store *artifact.Store, image string) ([]byte, error) {
+	var content io.ReadCloser
+	var err error
+	if store.HasTar(image) {
+		content, err = store.OpenTar(image)
+	} else {
+		content, err = b.Save(ctx, []string{image})
+	}
+	if err != nil {
+		log.Errorf("open %s failed: %v", image, err)
+
+		return nil, ErrNoSuchImage
+	}
+	defer content.Close()
+
+	bom, err := sbom.Generate(image, content)
+	if err != nil {
+		log.Errorf("generate sbom of %s failed: %v", image, err)
+
+		return nil, err
+	}
+
+	data, err := json.Marshal(bom)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := store.SaveSBOM(image, data); err != nil {
+		log.Errorf("save sbom of %s failed: %v", image, err)
+
+		return nil, err
+	}
+	log.Infof("sbom of %s is generated, %d components", image, len(bom.Components))
+
+	return data, nil
+}
+
+// imageSBOM return the stored SBOM of the image, it is generated if missing.
+func imageSBOM(ctx context.Context, b builder.Builder, store *artifact.Store, image string) ([]byte, error) {
+	if data, err := store.SBOM(image); err == nil {
+		return data, nil
+	}
+
+	return generateSBOM(ctx, b, store, image)
+}
@@ -4,10 +4,18 @@
 
 package service
 
-//go:generate mockgen -self_package=github.com/tianrandailove/peitho/internal/peitho/service -destination mock_service.go -package service github.com/tianrandailove/peitho/internal/peitho/service Service,ImageSrv,ContainerSrv
+//go:generate mockgen -self_package=github.com/tianrandailove/peitho/internal/peitho/service -destination mock_service.go -package service github.com/tianrandailove/peitho/internal/peitho/service Service,ImageSrv,ContainerSrv,RegistrySrv,HealthSrv,BundleSrv,ChaincodeSrv
 import (
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/baseimage"
+	"github.com/tianrandailove/peitho/pkg/builder"
+	"github.com/tianrandailove/peitho/pkg/distribution"
 	"github.com/tianrandailove/peitho/pkg/docker"
 	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/sbom"
+	"github.com/tianrandailove/peitho/pkg/signature"
+	"github.com/tianrandailove/peitho/pkg/token"
 )
 
 var Srv Service
@@ -16,11 +24,29 @@ var Srv Service
 type Service interface {
 	Containers() ContainerSrv
 	Images() ImageSrv
+	Registry() RegistrySrv
+	Health() HealthSrv
+	Bundle() BundleSrv
+	Chaincodes() ChaincodeSrv
 }
 
 type service struct {
 	docker docker.DockerService
 	k8s    k8s.K8sService
+	signer *token.Signer
+	store  *artifact.Store
+	client *distribution.Client
+	// cosigner sign and verify chaincode images
+	cosigner *signature.Signer
+	scanner  sbom.Scanner
+	// baseImages keep the builder and runtime images
+	baseImages baseimage.BaseImageService
+	// builder build the chaincode images
+	builder builder.Builder
+	// chaincodeCRD manage the chaincode containers as chaincode resources
+	chaincodeCRD *options.ChaincodeCRDOption
+	// events record the lifecycle events on the chaincode deployments
+	events *k8s.EventRecorder
 }
 
 func (s *service) Containers() ContainerSrv {
@@ -31,10 +57,46 @@ func (s *service) Images() ImageSrv {
 	return newImage(s)
 }
 
+func (s *service) Registry() RegistrySrv {
+	return newRegistry(s)
+}
+
+func (s *service) Health() HealthSrv {
+	return newHealth(s)
+}
+
+func (s *service) Bundle() BundleSrv {
+	return newBundle(s)
+}
+
+func (s *service) Chaincodes() ChaincodeSrv {
+	return newChaincode(s)
+}
+
 // NewService returns Service interface.
-func NewService(docker docker.DockerService, k8s k8s.K8sService) Service {
+func NewService(
+	docker docker.DockerService,
+	k8s k8s.K8sService,
+	signer *token.Signer,
+	store *artifact.Store,
+	client *distribution.Client,
+	cosigner *signature.Signer,
+	scanner sbom.Scanner,
+	baseImages baseimage.BaseImageService,
+	builder builder.Builder,
+	chaincodeCRD *options.ChaincodeCRDOption,
+) Service {
 	return &service{
-		docker: docker,
-		k8s:    k8s,
+		docker:       docker,
+		k8s:          k8s,
+		signer:       signer,
+		store:        store,
+		client:       client,
+		cosigner:     cosigner,
+		scanner:      scanner,
+		baseImages:   baseImages,
+		builder:      builder,
+		chaincodeCRD: chaincodeCRD,
+		events:       k8s.EventRecorder(),
 	}
 }
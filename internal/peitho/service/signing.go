@@ -0,0 +1,162 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+// signRemote sign the manifest digest of the image reference and push the signature next to it,
+// under the tag cosign looks for.
+func signRemote(
+	ctx context.Context,
+	client *distribution.Client,
+	cosigner *signature.Signer,
+	ref string,
+	dgst digest.Digest,
+) error {
+	if !cosigner.CanSign() {
+		return nil
+	}
+
+	r, err := distribution.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+
+	sig, err := cosigner.Sign(fmt.Sprintf("%s/%s", r.Host, r.Repository), dgst)
+	if err != nil {
+		return err
+	}
+	manifest, config, err := sig.Manifest()
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.PushBlob(ctx, r, signature.SimpleSigningMediaType, sig.Payload); err != nil {
+		return err
+	}
+	if _, err := client.PushBlob(ctx, r, ocispec.MediaTypeImageConfig, config); err != nil {
+		return err
+	}
+
+	r.Reference = signature.Tag(dgst)
+	if _, err := client.PushManifest(ctx, r, ocispec.MediaTypeImageManifest, manifest); err != nil {
+		return err
+	}
+
+	log.Infof("%s@%s is signed", ref, dgst)
+
+	return nil
+}
+
+// verifyRemote verify the signature of the manifest digest stored next to the image reference.
+func verifyRemote(
+	ctx context.Context,
+	client *distribution.Client,
+	cosigner *signature.Signer,
+	ref string,
+	dgst digest.Digest,
+) error {
+	if !cosigner.Enabled() {
+		return nil
+	}
+
+	r, err := distribution.ParseReference(ref)
+	if err != nil {
+		return err
+	}
+	identity := fmt.Sprintf("%s/%s", r.Host, r.Repository)
+
+	r.Reference = signature.Tag(dgst)
+	manifest, _, err := client.Manifest(ctx, r.String())
+	if errors.Is(err, distribution.ErrNotFound) {
+		return signature.ErrUnsigned
+	}
+	if err != nil {
+		return err
+	}
+
+	blob := func(d digest.Digest) ([]byte, error) {
+		reader, err := client.Blob(ctx, r, d)
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return ioutil.ReadAll(reader)
+	}
+
+	return cosigner.VerifyManifest(manifest, blob, identity, dgst)
+}
+
+// signLocal sign the manifest digest of the image as the identity and store the signature in the
+// repository of the artifact store.
+func signLocal(store *artifact.Store, cosigner *signature.Signer, repo string, identity string, dgst digest.Digest) error {
+	if !cosigner.CanSign() {
+		return nil
+	}
+
+	sig, err := cosigner.Sign(identity, dgst)
+	if err != nil {
+		return err
+	}
+	manifest, config, err := sig.Manifest()
+	if err != nil {
+		return err
+	}
+
+	if _, err := store.Put(repo, signature.Tag(dgst), manifest, sig.Payload, config); err != nil {
+		return err
+	}
+
+	log.Infof("%s@%s is signed", identity, dgst)
+
+	return nil
+}
+
+// verifyLocal verify the signature of the manifest digest stored in the repository of the artifact store.
+func verifyLocal(store *artifact.Store, cosigner *signature.Signer, repo string, identity string, dgst digest.Digest) error {
+	if !cosigner.Enabled() {
+		return nil
+	}
+
+	data, _, err := store.Manifest(repo, signature.Tag(dgst))
+	if errors.Is(err, artifact.ErrNotFound) {
+		return signature.ErrUnsigned
+	}
+	if err != nil {
+		return err
+	}
+
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return err
+	}
+
+	blob := func(d digest.Digest) ([]byte, error) {
+		file, err := store.Blob(d)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+
+		return ioutil.ReadAll(file)
+	}
+
+	return cosigner.VerifyManifest(manifest, blob, identity, dgst)
+}
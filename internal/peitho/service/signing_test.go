@@ -0,0 +1,98 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package service
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+// newTestSigner create a signer with a new key.
+func newTestSigner(t *testing.T) *signature.Signer {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+
+	path := filepath.Join(t.TempDir(), "cosign.key")
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, err := signature.NewSigner(&options.SigningOption{Key: path})
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	return signer
+}
+
+func Test_verifyLocal(t *testing.T) {
+	store := newTestStore(t, "mycc:latest", []byte("{}"))
+	cosigner := newTestSigner(t)
+
+	dgst, err := store.Resolve("mycc", "latest")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+
+	if err := verifyLocal(store, cosigner, "mycc", "mycc", dgst); err != signature.ErrUnsigned {
+		t.Errorf("verifyLocal() of unsigned image error = %v, want %v", err, signature.ErrUnsigned)
+	}
+
+	if err := signLocal(store, cosigner, "mycc", "mycc", dgst); err != nil {
+		t.Fatalf("signLocal() error = %v", err)
+	}
+	if err := verifyLocal(store, cosigner, "mycc", "mycc", dgst); err != nil {
+		t.Errorf("verifyLocal() error = %v", err)
+	}
+	if err := verifyLocal(store, newTestSigner(t), "mycc", "mycc", dgst); err != signature.ErrInvalidSignature {
+		t.Errorf("verifyLocal() with other key error = %v, want %v", err, signature.ErrInvalidSignature)
+	}
+	if err := verifyLocal(store, nil, "mycc", "mycc", digest.FromString("other")); err != nil {
+		t.Errorf("verifyLocal() without key error = %v, want nil", err)
+	}
+}
+
+func Test_verifyRemote(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t, "chaincode/mycc:latest", []byte("{}"))
+	client, host := newTestRegistry(t, store)
+	cosigner := newTestSigner(t)
+
+	dgst, err := store.Resolve("chaincode/mycc", "latest")
+	if err != nil {
+		t.Fatalf("Resolve() error = %v", err)
+	}
+	ref := host + "/chaincode/mycc:latest"
+
+	if err := verifyRemote(ctx, client, cosigner, ref, dgst); err != signature.ErrUnsigned {
+		t.Errorf("verifyRemote() of unsigned image error = %v, want %v", err, signature.ErrUnsigned)
+	}
+
+	// the test registry serves the store, put the signature as a push would
+	if err := signLocal(store, cosigner, "chaincode/mycc", host+"/chaincode/mycc", dgst); err != nil {
+		t.Fatalf("signLocal() error = %v", err)
+	}
+	if err := verifyRemote(ctx, client, cosigner, ref, dgst); err != nil {
+		t.Errorf("verifyRemote() error = %v", err)
+	}
+	if err := verifyRemote(ctx, client, newTestSigner(t), ref, dgst); err != signature.ErrInvalidSignature {
+		t.Errorf("verifyRemote() with other key error = %v, want %v", err, signature.ErrInvalidSignature)
+	}
+}
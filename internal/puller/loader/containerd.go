@@ -0,0 +1,81 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/namespaces"
+	"github.com/containerd/containerd/reference/docker"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+type containerdLoader struct {
+	client    *containerd.Client
+	namespace string
+}
+
+var _ Loader = (*containerdLoader)(nil)
+
+func newContainerdLoader(opt *options.PullerOption) (*containerdLoader, error) {
+	client, err := containerd.New(strings.TrimPrefix(opt.Endpoint(), "unix://"))
+	if err != nil {
+		log.Errorf("new containerd client failed: %v", err)
+
+		return nil, err
+	}
+
+	return &containerdLoader{
+		client:    client,
+		namespace: opt.Namespace,
+	}, nil
+}
+
+func (c *containerdLoader) Exists(ctx context.Context, image string) (bool, error) {
+	ref, err := docker.ParseDockerRef(image)
+	if err != nil {
+		return false, err
+	}
+
+	ctx = namespaces.WithNamespace(ctx, c.namespace)
+	if _, err := c.client.GetImage(ctx, ref.String()); err != nil {
+		if errdefs.IsNotFound(err) {
+			return false, nil
+		}
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *containerdLoader) Load(ctx context.Context, image string, archive io.Reader) error {
+	ctx = namespaces.WithNamespace(ctx, c.namespace)
+
+	images, err := c.client.Import(ctx, archive)
+	if err != nil {
+		log.Errorf("import %s failed: %v", image, err)
+
+		return err
+	}
+
+	// unpack into the snapshotter, kubelet won't do it for an imported image
+	for _, img := range images {
+		log.Infof("unpacking %s (%s)", img.Name, img.Target.Digest)
+		if err := containerd.NewImage(c.client, img).Unpack(ctx, containerd.DefaultSnapshotter); err != nil {
+			log.Errorf("unpack %s failed: %v", img.Name, err)
+
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,59 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+type dockerLoader struct {
+	docker docker.DockerService
+}
+
+var _ Loader = (*dockerLoader)(nil)
+
+func newDockerLoader(opt *options.PullerOption) (*dockerLoader, error) {
+	dockerService, err := docker.NewDockerService(&options.DockerOption{
+		Endpoint: opt.Endpoint(),
+	}, options.NewPeithoOption())
+	if err != nil {
+		return nil, err
+	}
+
+	return &dockerLoader{docker: dockerService}, nil
+}
+
+func (d *dockerLoader) Exists(ctx context.Context, image string) (bool, error) {
+	_, _, err := d.docker.ImageInspectWithRaw(ctx, image)
+
+	return err == nil, nil
+}
+
+func (d *dockerLoader) Load(ctx context.Context, image string, archive io.Reader) error {
+	loadResp, err := d.docker.ImageLoad(ctx, archive, false)
+	if err != nil {
+		log.Errorf("load %s failed: %v", image, err)
+
+		return err
+	}
+	defer loadResp.Body.Close()
+
+	reader := bufio.NewReader(loadResp.Body)
+	for {
+		line, _, err := reader.ReadLine()
+		if err != nil {
+			break
+		}
+		log.Infof("%s", line)
+	}
+
+	return nil
+}
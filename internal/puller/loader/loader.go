@@ -0,0 +1,33 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// Loader load an image archive into the container runtime of the node.
+type Loader interface {
+	Exists(ctx context.Context, image string) (bool, error)
+	Load(ctx context.Context, image string, archive io.Reader) error
+}
+
+// NewLoader create the loader of the configured runtime.
+func NewLoader(opt *options.PullerOption) (Loader, error) {
+	switch opt.Runtime {
+	case options.RUNTIME_DOCKER:
+		return newDockerLoader(opt)
+	case options.RUNTIME_CONTAINERD:
+		return newContainerdLoader(opt)
+	case options.RUNTIME_CONTAINERS_STORAGE:
+		return newStorageLoader(opt)
+	}
+
+	return nil, fmt.Errorf("unsupported runtime: %s", opt.Runtime)
+}
@@ -0,0 +1,90 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// storageLoader copy the archive into the containers-storage of the node with skopeo, where CRI-O and
+// podman keep their images, the storage directories are mounted into the puller.
+type storageLoader struct {
+	command       string
+	existsCommand string
+}
+
+var _ Loader = (*storageLoader)(nil)
+
+func newStorageLoader(opt *options.PullerOption) (*storageLoader, error) {
+	return &storageLoader{
+		command:       opt.LoadCommand,
+		existsCommand: opt.ExistsCommand,
+	}, nil
+}
+
+// Exists run the exists command, the image exists if it succeeds.
+func (c *storageLoader) Exists(ctx context.Context, image string) (bool, error) {
+	args := strings.Fields(strings.NewReplacer("{image}", image).Replace(c.existsCommand))
+
+	// #nosec G204
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			log.Debugf("%s not exists: %s", image, output)
+
+			return false, nil
+		}
+		log.Errorf("check %s exists failed: %v", image, err)
+
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (c *storageLoader) Load(ctx context.Context, image string, archive io.Reader) error {
+	file, err := ioutil.TempFile("", "puller-*.tar")
+	if err != nil {
+		log.Errorf("create archive file failed: %v", err)
+
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := io.Copy(file, archive); err != nil {
+		file.Close()
+		log.Errorf("write archive file failed: %v", err)
+
+		return err
+	}
+	file.Close()
+
+	args := strings.Fields(strings.NewReplacer("{archive}", file.Name(), "{image}", image).Replace(c.command))
+	log.Infof("load %s: %s", image, strings.Join(args, " "))
+
+	// #nosec G204
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	log.Infof("%s", output)
+	if err != nil {
+		log.Errorf("load %s failed: %v", image, err)
+
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,35 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package loader
+
+import (
+	"context"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+func TestStorageLoader_Exists(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	image := filepath.Join(dir, "mycc")
+	if err := ioutil.WriteFile(image, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	loader := &storageLoader{existsCommand: "test -e {image}"}
+
+	if exists, err := loader.Exists(ctx, image); err != nil || !exists {
+		t.Errorf("Exists() = %v, %v, want true", exists, err)
+	}
+	if exists, err := loader.Exists(ctx, filepath.Join(dir, "othercc")); err != nil || exists {
+		t.Errorf("Exists() of missing image = %v, %v, want false", exists, err)
+	}
+
+	// the image is unknown if the command can not run
+	loader.existsCommand = filepath.Join(dir, "skopeo") + " inspect containers-storage:{image}"
+	if _, err := loader.Exists(ctx, image); err == nil {
+		t.Errorf("Exists() without command error = nil, want error")
+	}
+}
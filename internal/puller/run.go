@@ -6,25 +6,26 @@ package puller
 
 import (
 	"github.com/tianrandailove/peitho/internal/puller/config"
+	"github.com/tianrandailove/peitho/internal/puller/loader"
 	"github.com/tianrandailove/peitho/internal/puller/service"
-	"github.com/tianrandailove/peitho/pkg/docker"
 	"github.com/tianrandailove/peitho/pkg/log"
-	"github.com/tianrandailove/peitho/pkg/options"
 )
 
 // Run runs the specified APIServer. This should never exit.
 func Run(cfg *config.Config) error {
-	// new docker client
-	dockerService, err := docker.NewDockerService(&options.DockerOption{
-		Endpoint: cfg.PullerOption.DockerEndpoint,
-	}, options.NewPeithoOption())
+	// new image loader of the node runtime
+	imageLoader, err := loader.NewLoader(cfg.PullerOption)
 	if err != nil {
 		panic(err)
 	}
 
 	// new service
-	srv := service.NewService(dockerService)
-	err = srv.Pullers().PullImage(cfg.PullerOption.Image, cfg.PullerOption.PullAddress)
+	srv := service.NewService(imageLoader)
+	err = srv.Pullers().PullImage(
+		cfg.PullerOption.Image,
+		cfg.PullerOption.PullAddress,
+		cfg.PullerOption.Credential,
+	)
 	if err != nil {
 		log.Errorf("pull and load image failed: %v", err)
 
@@ -5,55 +5,57 @@
 package service
 
 import (
-	"bufio"
 	"context"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/http"
-	"os"
+	"strings"
 
-	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/internal/puller/loader"
+	"github.com/tianrandailove/peitho/pkg/compress"
 	"github.com/tianrandailove/peitho/pkg/log"
 )
 
 type PullerSrv interface {
-	PullImage(image string, pullAddress string) error
+	PullImage(image string, pullAddress string, credential string) error
 }
 
 type pullerService struct {
-	docker docker.DockerService
+	loader loader.Loader
 }
 
 var _ PullerSrv = (*pullerService)(nil)
 
 func newPuller(srv *service) *pullerService {
 	return &pullerService{
-		docker: srv.docker,
+		loader: srv.loader,
 	}
 }
 
-func (p *pullerService) PullImage(image string, pullAddress string) error {
+// PullImage download the image tar from pullAddress and load it, the download token is exchanged for
+// the service account token of the pod read from credential.
+func (p *pullerService) PullImage(image string, pullAddress string, credential string) error {
 	ctx := context.Background()
 	// check exists
-	_, _, err := p.docker.ImageInspectWithRaw(ctx, image)
-	if err == nil {
+	exists, err := p.loader.Exists(ctx, image)
+	if err != nil {
+		log.Errorf("check %s exists failed: %v", image, err)
+
+		return err
+	}
+	if exists {
 		log.Infof("%s already exists the host", image)
 
 		return nil
 	}
 	log.Infof("%s not exists the host", image)
 
-	fileName := fmt.Sprintf("%s.tar", image)
-	// if the file exists, then delete it
-	_, err = os.Stat(fileName)
-	if err == nil {
-		log.Debugf("%s already exists, then delete it", fileName)
-		err = os.Remove(fileName)
-		if err != nil {
-			log.Errorf("delete %s failed, cause by: %v", fileName, err)
-
-			return err
-		}
+	downloadToken, err := issueToken(ctx, image, pullAddress, credential)
+	if err != nil {
+		return err
 	}
+
 	// download image.tar from pullAddress
 	request, err := http.NewRequestWithContext(ctx, "GET", fmt.Sprintf("%s/%s", pullAddress, image), nil)
 	if err != nil {
@@ -61,6 +63,9 @@ func (p *pullerService) PullImage(image string, pullAddress string) error {
 
 		return err
 	}
+	request.Header.Set("Authorization", "Bearer "+downloadToken)
+	// negotiate the encoding with peitho
+	request.Header.Set("Accept-Encoding", fmt.Sprintf("%s, %s", compress.ZSTD, compress.GZIP))
 	resp, err := http.DefaultClient.Do(request)
 	if err != nil {
 		log.Errorf("download %s.tar failed, cause by:%v", image, err)
@@ -69,38 +74,65 @@ func (p *pullerService) PullImage(image string, pullAddress string) error {
 	}
 	defer resp.Body.Close()
 
-	//// create file
-	//file, err := os.Create(fileName)
-	//if err != nil {
-	//	log.Errorf("create %s failed, cause by:%v", fileName, err)
-	//
-	//	return err
-	//}
-	//defer file.Close()
-	//fileSize, err := io.Copy(file, resp.Body)
-	//if err != nil {
-	//	log.Errorf("copy file failed: %v", err)
-	//
-	//	return err
-	//}
-
-	// log.Infof("write file completed, file size: %d byte", fileSize)
-	// load image.tar
-	loadResp, err := p.docker.ImageLoad(ctx, resp.Body, false)
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("download %s.tar failed, status code: %d", image, resp.StatusCode)
+
+		return fmt.Errorf("download %s.tar failed, status code: %d", image, resp.StatusCode)
+	}
+
+	// decompress while streaming into the runtime
+	encoding := resp.Header.Get("Content-Encoding")
+	log.Infof("download %s.tar with %s encoding", image, encoding)
+	body, err := compress.NewReader(resp.Body, encoding)
 	if err != nil {
-		log.Errorf("load %s failed: %v", fileName, err)
+		log.Errorf("decompress %s.tar failed: %v", image, err)
 
 		return err
 	}
-	defer loadResp.Body.Close()
-	reader := bufio.NewReader(loadResp.Body)
-	for {
-		line, _, err1 := reader.ReadLine()
-		if err1 != nil {
-			break
-		}
-		log.Infof("%s", line)
+	defer body.Close()
+
+	// load image.tar
+	return p.loader.Load(ctx, image, body)
+}
+
+// issueToken exchange the service account token in credential file for a short-lived download token of image.
+func issueToken(ctx context.Context, image string, pullAddress string, credential string) (string, error) {
+	serviceAccountToken, err := ioutil.ReadFile(credential)
+	if err != nil {
+		log.Errorf("read credential %s failed: %v", credential, err)
+
+		return "", err
+	}
+
+	request, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s/%s/token", pullAddress, image), nil)
+	if err != nil {
+		log.Errorf("create http request failed: %v", err)
+
+		return "", err
+	}
+	request.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(serviceAccountToken)))
+	resp, err := http.DefaultClient.Do(request)
+	if err != nil {
+		log.Errorf("issue download token of %s failed: %v", image, err)
+
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Errorf("issue download token of %s failed, status code: %d", image, resp.StatusCode)
+
+		return "", fmt.Errorf("issue download token of %s failed, status code: %d", image, resp.StatusCode)
+	}
+
+	result := struct {
+		Token string `json:"token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		log.Errorf("decode download token of %s failed: %v", image, err)
+
+		return "", err
 	}
 
-	return err
+	return result.Token, nil
 }
@@ -6,7 +6,7 @@ package service
 
 //go:generate mockgen -self_package=github.com/tianrandailove/peitho/internal/peitho/service -destination mock_service.go -package service github.com/tianrandailove/peitho/internal/peitho/service Service,ImageSrv,ContainerSrv
 import (
-	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/internal/puller/loader"
 )
 
 var Srv Service
@@ -17,7 +17,7 @@ type Service interface {
 }
 
 type service struct {
-	docker docker.DockerService
+	loader loader.Loader
 }
 
 func (s *service) Pullers() PullerSrv {
@@ -25,8 +25,8 @@ func (s *service) Pullers() PullerSrv {
 }
 
 // NewService returns Service interface.
-func NewService(docker docker.DockerService) Service {
+func NewService(loader loader.Loader) Service {
 	return &service{
-		docker: docker,
+		loader: loader,
 	}
 }
@@ -0,0 +1,135 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package v1alpha1 defines the Chaincode custom resource, it is installed by
+// deployments/peitho-chaincode-crd.yaml and accessed with the dynamic client.
+package v1alpha1
+
+import (
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+const (
+	Group   = "peitho.io"
+	Version = "v1alpha1"
+	Kind    = "Chaincode"
+)
+
+const (
+	// PHASE_PENDING the deployment waits for the tls secret uploaded by the peer.
+	PHASE_PENDING = "Pending"
+	// PHASE_STARTING the deployment is scaled up but not yet available.
+	PHASE_STARTING = "Starting"
+	// PHASE_RUNNING the deployment is available.
+	PHASE_RUNNING = "Running"
+	// PHASE_FAILED the last reconcile failed, see the last error.
+	PHASE_FAILED = "Failed"
+)
+
+// Resource is the group version resource of the chaincodes.
+var Resource = schema.GroupVersionResource{Group: Group, Version: Version, Resource: "chaincodes"}
+
+// Chaincode is a chaincode container the peer requested, reconciled into a deployment,
+// the tls secret and a service.
+type Chaincode struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   ChaincodeSpec   `json:"spec"`
+	Status ChaincodeStatus `json:"status,omitempty"`
+}
+
+// ChaincodeSpec is what the peer requested for the chaincode container.
+type ChaincodeSpec struct {
+	// ContainerID is the container id the peer created the chaincode container as
+	ContainerID string   `json:"containerID"`
+	Image       string   `json:"image"`
+	Env         []string `json:"env,omitempty"`
+	Command     []string `json:"command,omitempty"`
+	PullSecrets []string `json:"pullSecrets,omitempty"`
+	// Archs are the architectures the image is available for, the pods are scheduled on them
+	Archs []string `json:"archs,omitempty"`
+	// Puller loads the image onto the node in delivery mode
+	Puller *PullerSpec `json:"puller,omitempty"`
+	// TLS is the client certificate of the chaincode uploaded by the peer
+	TLS       *TLSReference           `json:"tls,omitempty"`
+	Resources v1.ResourceRequirements `json:"resources,omitempty"`
+	// Port is served by the chaincode in server mode, a service is created for it
+	Port int32 `json:"port,omitempty"`
+}
+
+// PullerSpec is the init container loading the delivered image into the node runtime.
+type PullerSpec struct {
+	Image   string     `json:"image"`
+	Command []string   `json:"command,omitempty"`
+	Mounts  []HostPath `json:"mounts,omitempty"`
+}
+
+// HostPath is a node directory mounted into the puller.
+type HostPath struct {
+	Name      string `json:"name"`
+	HostPath  string `json:"hostPath"`
+	MountPath string `json:"mountPath"`
+}
+
+// TLSReference refer to the secret holding client.key, client.crt and peer.crt.
+type TLSReference struct {
+	Secret string `json:"secret"`
+	// PEM the secret holds client_pem.key and client_pem.crt too, they are passed by fabric 2
+	PEM bool `json:"pem,omitempty"`
+}
+
+// ChaincodeStatus is the observed state of the chaincode.
+type ChaincodeStatus struct {
+	Phase              string `json:"phase,omitempty"`
+	ReadyReplicas      int32  `json:"readyReplicas"`
+	Digest             string `json:"digest,omitempty"`
+	LastError          string `json:"lastError,omitempty"`
+	ObservedGeneration int64  `json:"observedGeneration,omitempty"`
+	// StartedAt is when the chaincode left pending, it is cleared when it is pending again
+	StartedAt *metav1.Time `json:"startedAt,omitempty"`
+	// ReadySince is when the chaincode was last observed running, it is cleared when it is not
+	ReadySince *metav1.Time `json:"readySince,omitempty"`
+}
+
+// OwnerReference return the reference of the objects reconciled from the chaincode,
+// they are garbage collected with it.
+func (cc *Chaincode) OwnerReference() metav1.OwnerReference {
+	controller := true
+
+	return metav1.OwnerReference{
+		APIVersion: Group + "/" + Version,
+		Kind:       Kind,
+		Name:       cc.Name,
+		UID:        cc.UID,
+		Controller: &controller,
+	}
+}
+
+// ToUnstructured convert the chaincode for the dynamic client.
+func ToUnstructured(cc *Chaincode) (*unstructured.Unstructured, error) {
+	cc.APIVersion = Group + "/" + Version
+	cc.Kind = Kind
+
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	return &unstructured.Unstructured{Object: object}, nil
+}
+
+// FromUnstructured convert the object returned by the dynamic client.
+func FromUnstructured(u *unstructured.Unstructured) (*Chaincode, error) {
+	cc := &Chaincode{}
+	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(u.Object, cc); err != nil {
+		return nil, err
+	}
+
+	return cc, nil
+}
@@ -152,6 +152,14 @@ func WithDefaultValidArgs() Option {
 	}
 }
 
+// WithCommands adds sub commands to the application, they must be added before
+// the application command is built.
+func WithCommands(cmds ...*Command) Option {
+	return func(a *App) {
+		a.commands = append(a.commands, cmds...)
+	}
+}
+
 // NewApp creates a new application instance based on the given application name,
 // binary name, and other options.
 func NewApp(name string, basename string, opts ...Option) *App {
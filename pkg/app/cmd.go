@@ -11,7 +11,10 @@ import (
 	"strings"
 
 	"github.com/fatih/color"
+	"github.com/marmotedu/errors"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
 )
 
 // Command is a sub command structure of a cli application.
@@ -93,6 +96,9 @@ func (c *Command) cobraCommand() *cobra.Command {
 			cmd.Flags().AddFlagSet(f)
 		}
 		// c.options.AddFlags(cmd.Flags())
+		if f := pflag.Lookup(configFlagName); f != nil {
+			cmd.Flags().AddFlag(f)
+		}
 	}
 	addHelpCommandFlag(c.usage, cmd.Flags())
 
@@ -100,6 +106,12 @@ func (c *Command) cobraCommand() *cobra.Command {
 }
 
 func (c *Command) runCommand(cmd *cobra.Command, args []string) {
+	if c.options != nil {
+		if err := c.applyOptions(cmd); err != nil {
+			fmt.Printf("%v %v\n", color.RedString("Error:"), err)
+			os.Exit(1)
+		}
+	}
 	if c.runFunc != nil {
 		if err := c.runFunc(args); err != nil {
 			fmt.Printf("%v %v\n", color.RedString("Error:"), err)
@@ -129,3 +141,27 @@ func FormatBaseName(basename string) string {
 
 	return basename
 }
+
+// applyOptions reads the options from the configuration file and the command
+// line, then completes and validates them.
+func (c *Command) applyOptions(cmd *cobra.Command) error {
+	if err := viper.BindPFlags(cmd.Flags()); err != nil {
+		return err
+	}
+
+	if err := viper.Unmarshal(c.options); err != nil {
+		return err
+	}
+
+	if completeableOptions, ok := c.options.(CompleteableOptions); ok {
+		if err := completeableOptions.Complete(); err != nil {
+			return err
+		}
+	}
+
+	if errs := c.options.Validate(); len(errs) != 0 {
+		return errors.NewAggregate(errs)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// BuildRecord is the result of a chaincode image build.
+type BuildRecord struct {
+	// Key is the hash of build context and the base image ids
+	Key     string    `json:"key"`
+	Tags    []string  `json:"tags"`
+	ImageID string    `json:"imageID"`
+	Created time.Time `json:"created"`
+	// Platforms are the image ids of a multi-platform build by platform
+	Platforms map[string]string `json:"platforms,omitempty"`
+}
+
+func (s *Store) buildIndexPath() string {
+	return filepath.Join(s.root, "builds.json")
+}
+
+func (s *Store) loadBuilds() (map[string]BuildRecord, error) {
+	builds := make(map[string]BuildRecord)
+
+	data, err := ioutil.ReadFile(s.buildIndexPath())
+	if os.IsNotExist(err) {
+		return builds, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &builds); err != nil {
+		return nil, err
+	}
+
+	return builds, nil
+}
+
+// LookupBuild find the build record by the key, a tag built from other content or base images must not
+// reuse the stale image.
+func (s *Store) LookupBuild(key string) (*BuildRecord, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	builds, err := s.loadBuilds()
+	if err != nil {
+		return nil, false
+	}
+
+	record, ok := builds[key]
+	if !ok {
+		return nil, false
+	}
+
+	return &record, true
+}
+
+// RecordBuild save the build record, tags are merged into the existing record of the same key.
+func (s *Store) RecordBuild(record BuildRecord) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	builds, err := s.loadBuilds()
+	if err != nil {
+		return err
+	}
+
+	if old, ok := builds[record.Key]; ok && old.ImageID == record.ImageID {
+		for _, tag := range old.Tags {
+			if !contains(record.Tags, tag) {
+				record.Tags = append(record.Tags, tag)
+			}
+		}
+	}
+	builds[record.Key] = record
+
+	data, err := json.MarshalIndent(builds, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.buildIndexPath() + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.buildIndexPath())
+}
+
+func contains(items []string, item string) bool {
+	for _, i := range items {
+		if i == item {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,138 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"path"
+
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// annotationImageName is the image name containerd reads from index.json.
+const annotationImageName = "io.containerd.image.name"
+
+// Save write the images of the store in docker save format, the tar is an OCI image layout too.
+// the blobs are written once under blobs/sha256, manifest.json and index.json refer to them.
+func (s *Store) Save(w io.Writer, images ...string) error {
+	var manifests []dockerManifest
+	index := ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}}
+	entries := make(map[digest.Digest]int)
+	var blobs []digest.Digest
+	written := make(map[digest.Digest]bool)
+	addBlob := func(dgst digest.Digest) {
+		if !written[dgst] {
+			written[dgst] = true
+			blobs = append(blobs, dgst)
+		}
+	}
+
+	for _, image := range images {
+		repo, tag := SplitReference(image)
+		data, dgst, err := s.Manifest(repo, tag)
+		if err != nil {
+			return err
+		}
+
+		manifest := ocispec.Manifest{}
+		if err := json.Unmarshal(data, &manifest); err != nil {
+			return err
+		}
+
+		index.Manifests = append(index.Manifests, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageManifest,
+			Digest:    dgst,
+			Size:      int64(len(data)),
+			Annotations: map[string]string{
+				annotationImageName:       image,
+				ocispec.AnnotationRefName: tag,
+			},
+		})
+
+		if i, ok := entries[dgst]; ok {
+			manifests[i].RepoTags = append(manifests[i].RepoTags, image)
+
+			continue
+		}
+		entries[dgst] = len(manifests)
+
+		m := dockerManifest{Config: blobName(manifest.Config.Digest), RepoTags: []string{image}}
+		addBlob(manifest.Config.Digest)
+		for _, layer := range manifest.Layers {
+			m.Layers = append(m.Layers, blobName(layer.Digest))
+			addBlob(layer.Digest)
+		}
+		addBlob(dgst)
+		manifests = append(manifests, m)
+	}
+
+	tw := tar.NewWriter(w)
+	for _, dgst := range blobs {
+		if err := s.writeTarBlob(tw, dgst); err != nil {
+			return err
+		}
+	}
+
+	layout, _ := json.Marshal(ocispec.ImageLayout{Version: ocispec.ImageLayoutVersion})
+	indexData, err := json.Marshal(index)
+	if err != nil {
+		return err
+	}
+	manifestData, err := json.Marshal(manifests)
+	if err != nil {
+		return err
+	}
+	for _, f := range []struct {
+		name string
+		data []byte
+	}{
+		{name: ocispec.ImageLayoutFile, data: layout},
+		{name: "index.json", data: indexData},
+		{name: "manifest.json", data: manifestData},
+	} {
+		if err := tw.WriteHeader(&tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}); err != nil {
+			return err
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			return err
+		}
+	}
+
+	return tw.Close()
+}
+
+func (s *Store) writeTarBlob(tw *tar.Writer, dgst digest.Digest) error {
+	file, err := s.Blob(dgst)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+
+	if err := tw.WriteHeader(&tar.Header{
+		Name:     blobName(dgst),
+		Mode:     0o644,
+		Size:     info.Size(),
+		Typeflag: tar.TypeReg,
+	}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, file)
+
+	return err
+}
+
+// blobName is the path of the blob in an OCI image layout.
+func blobName(dgst digest.Digest) string {
+	return path.Join("blobs", dgst.Algorithm().String(), dgst.Encoded())
+}
@@ -0,0 +1,41 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// SBOMPath return the path of the SBOM of the image, next to the image tar.
+func (s *Store) SBOMPath(image string) string {
+	return filepath.Join(s.root, fmt.Sprintf("%s.sbom.json", image))
+}
+
+// SaveSBOM replace the SBOM of the image.
+func (s *Store) SaveSBOM(image string, data []byte) error {
+	fileName := s.SBOMPath(image)
+	tmp := fileName + ".tmp"
+
+	if err := ioutil.WriteFile(tmp, data, 0o644); err != nil {
+		os.Remove(tmp)
+
+		return err
+	}
+
+	return os.Rename(tmp, fileName)
+}
+
+// SBOM return the SBOM of the image.
+func (s *Store) SBOM(image string) ([]byte, error) {
+	data, err := ioutil.ReadFile(s.SBOMPath(image))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
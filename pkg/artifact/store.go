@@ -0,0 +1,440 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+var ErrNotFound = errors.New("artifact not found")
+
+// Store keep the built image artifacts on disk.
+// layout:
+//
+//	<root>/<image>.tar                    docker save output
+//	<root>/blobs/sha256/<hex>             content addressable layers, configs and manifests
+//	<root>/repositories/<repo>/<tag>      manifest digest of the tag
+type Store struct {
+	root string
+	lock sync.Mutex
+}
+
+// NewStore create a store in the root directory.
+func NewStore(root string) (*Store, error) {
+	for _, dir := range []string{root, filepath.Join(root, "blobs", "sha256"), filepath.Join(root, "repositories")} {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Errorf("create artifact directory %s failed: %v", dir, err)
+
+			return nil, err
+		}
+	}
+
+	return &Store{root: root}, nil
+}
+
+// TarPath return the path of the image tar.
+func (s *Store) TarPath(image string) string {
+	return filepath.Join(s.root, fmt.Sprintf("%s.tar", image))
+}
+
+// SaveTar replace the image tar with content.
+func (s *Store) SaveTar(image string, content io.Reader) (int64, error) {
+	fileName := s.TarPath(image)
+	tmp := fileName + ".tmp"
+
+	file, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+
+	length, err := io.Copy(file, content)
+	file.Close()
+	if err != nil {
+		os.Remove(tmp)
+
+		return 0, err
+	}
+
+	return length, os.Rename(tmp, fileName)
+}
+
+// OpenTar open the image tar.
+func (s *Store) OpenTar(image string) (*os.File, error) {
+	file, err := os.Open(s.TarPath(image))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+// HasTar check the image tar exists.
+func (s *Store) HasTar(image string) bool {
+	_, err := os.Stat(s.TarPath(image))
+
+	return err == nil
+}
+
+// dockerManifest is an entry of manifest.json in docker save output.
+type dockerManifest struct {
+	Config   string
+	RepoTags []string
+	Layers   []string
+}
+
+// Import split the saved image tar into blobs and record an OCI manifest for its tags.
+func (s *Store) Import(image string) (digest.Digest, error) {
+	return s.convert(image, s.writeBlob, true)
+}
+
+// ManifestDigest compute the digest of the OCI manifest Import records for the saved image tar,
+// nothing is written to the store.
+func (s *Store) ManifestDigest(image string) (digest.Digest, error) {
+	return s.convert(image, hashBlob, false)
+}
+
+// convert build the OCI manifest of the saved image tar, the layers and config are passed to write.
+func (s *Store) convert(
+	image string,
+	write func(io.Reader) (ocispec.Descriptor, error),
+	tag bool,
+) (digest.Digest, error) {
+	file, err := s.OpenTar(image)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return s.read(file, image, write, tag)
+}
+
+// Load split the docker save tar into blobs and record an OCI manifest for its tags, like Import, without
+// keeping the tar.
+func (s *Store) Load(content io.Reader) (digest.Digest, error) {
+	return s.read(content, "", s.writeBlob, true)
+}
+
+// read build the OCI manifest of the docker save tar, the tags default to image.
+func (s *Store) read(
+	content io.Reader,
+	image string,
+	write func(io.Reader) (ocispec.Descriptor, error),
+	tag bool,
+) (digest.Digest, error) {
+	descriptors := make(map[string]ocispec.Descriptor)
+	links := make(map[string]string)
+	var manifests []dockerManifest
+
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			links[header.Name] = path.Join(path.Dir(header.Name), header.Linkname)
+		case tar.TypeReg:
+			if header.Name == "manifest.json" {
+				if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+					return "", err
+				}
+
+				continue
+			}
+			// the OCI layout files of newer docker save output are not blobs
+			if header.Name == ocispec.ImageLayoutFile || header.Name == "index.json" {
+				continue
+			}
+
+			desc, err := write(tr)
+			if err != nil {
+				return "", err
+			}
+			descriptors[header.Name] = desc
+		}
+	}
+
+	if len(manifests) == 0 {
+		return "", errors.Errorf("%s.tar has no manifest.json", image)
+	}
+
+	lookup := func(name string) (ocispec.Descriptor, error) {
+		if target, ok := links[name]; ok {
+			name = target
+		}
+		desc, ok := descriptors[name]
+		if !ok {
+			return desc, errors.Errorf("%s not found in %s.tar", name, image)
+		}
+
+		return desc, nil
+	}
+
+	m := manifests[0]
+	config, err := lookup(m.Config)
+	if err != nil {
+		return "", err
+	}
+	config.MediaType = ocispec.MediaTypeImageConfig
+
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    config,
+	}
+	for _, layer := range m.Layers {
+		desc, err := lookup(layer)
+		if err != nil {
+			return "", err
+		}
+		desc.MediaType = ocispec.MediaTypeImageLayer
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+
+	data, err := json.Marshal(struct {
+		MediaType string `json:"mediaType"`
+		ocispec.Manifest
+	}{ocispec.MediaTypeImageManifest, manifest})
+	if err != nil {
+		return "", err
+	}
+
+	desc, err := write(bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	if !tag {
+		return desc.Digest, nil
+	}
+
+	tags := m.RepoTags
+	if len(tags) == 0 && image != "" {
+		tags = []string{image}
+	}
+	if len(tags) == 0 {
+		return "", errors.New("the image has no tags")
+	}
+	for _, tag := range tags {
+		repo, ref := SplitReference(tag)
+		if err := s.Tag(repo, ref, desc.Digest); err != nil {
+			return "", err
+		}
+	}
+
+	log.Infof("import %s as %s", tags[0], desc.Digest)
+
+	return desc.Digest, nil
+}
+
+// Platform read the platform from the image config of the saved image tar.
+func (s *Store) Platform(image string) (ocispec.Platform, error) {
+	platform := ocispec.Platform{}
+
+	file, err := s.OpenTar(image)
+	if err != nil {
+		return platform, err
+	}
+	defer file.Close()
+
+	// the config is small, keep every json file until manifest.json tells which one it is
+	files := make(map[string][]byte)
+	links := make(map[string]string)
+	tr := tar.NewReader(file)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return platform, err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeSymlink:
+			links[header.Name] = path.Join(path.Dir(header.Name), header.Linkname)
+		case tar.TypeReg:
+			if !strings.HasSuffix(header.Name, ".json") && !strings.HasPrefix(header.Name, "blobs/") ||
+				header.Size > 1<<20 {
+				continue
+			}
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return platform, err
+			}
+			files[header.Name] = data
+		}
+	}
+
+	var manifests []dockerManifest
+	if err := json.Unmarshal(files["manifest.json"], &manifests); err != nil || len(manifests) == 0 {
+		return platform, errors.Errorf("%s has no manifest.json", image)
+	}
+
+	name := manifests[0].Config
+	if target, ok := links[name]; ok {
+		name = target
+	}
+	config, ok := files[name]
+	if !ok {
+		return platform, errors.Errorf("%s not found in %s.tar", name, image)
+	}
+
+	// the platform fields are at the top level of the image config, the variant included
+	if err := json.Unmarshal(config, &platform); err != nil {
+		return platform, err
+	}
+
+	return platform, nil
+}
+
+// Resolve return the manifest digest of the reference, which is a tag or a digest.
+func (s *Store) Resolve(repo string, reference string) (digest.Digest, error) {
+	if dgst, err := digest.Parse(reference); err == nil {
+		if _, err := os.Stat(s.blobPath(dgst)); err != nil {
+			return "", ErrNotFound
+		}
+
+		return dgst, nil
+	}
+
+	data, err := ioutil.ReadFile(filepath.Join(s.root, "repositories", filepath.Clean("/"+repo), filepath.Base(reference)))
+	if os.IsNotExist(err) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+
+	return digest.Parse(strings.TrimSpace(string(data)))
+}
+
+// Manifest return the OCI manifest of the reference.
+func (s *Store) Manifest(repo string, reference string) ([]byte, digest.Digest, error) {
+	dgst, err := s.Resolve(repo, reference)
+	if err != nil {
+		return nil, "", err
+	}
+
+	data, err := ioutil.ReadFile(s.blobPath(dgst))
+	if os.IsNotExist(err) {
+		return nil, "", ErrNotFound
+	}
+
+	return data, dgst, err
+}
+
+// Blob open the blob of the digest.
+func (s *Store) Blob(dgst digest.Digest) (*os.File, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, ErrNotFound
+	}
+
+	file, err := os.Open(s.blobPath(dgst))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return file, err
+}
+
+func (s *Store) blobPath(dgst digest.Digest) string {
+	return filepath.Join(s.root, "blobs", dgst.Algorithm().String(), dgst.Encoded())
+}
+
+func (s *Store) writeBlob(content io.Reader) (ocispec.Descriptor, error) {
+	tmp, err := ioutil.TempFile(filepath.Join(s.root, "blobs"), "ingest-")
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), content)
+	tmp.Close()
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	dgst := digest.NewDigestFromEncoded(digest.SHA256, hex.EncodeToString(hasher.Sum(nil)))
+	if err := os.Rename(tmp.Name(), s.blobPath(dgst)); err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return ocispec.Descriptor{Digest: dgst, Size: size}, nil
+}
+
+// hashBlob compute the descriptor of the content without storing it.
+func hashBlob(content io.Reader) (ocispec.Descriptor, error) {
+	hasher := sha256.New()
+	size, err := io.Copy(hasher, content)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return ocispec.Descriptor{
+		Digest: digest.NewDigestFromEncoded(digest.SHA256, hex.EncodeToString(hasher.Sum(nil))),
+		Size:   size,
+	}, nil
+}
+
+// Put store the blobs and the manifest referencing them, and tag the manifest in the repository.
+func (s *Store) Put(repo string, tag string, manifest []byte, blobs ...[]byte) (digest.Digest, error) {
+	for _, blob := range blobs {
+		if _, err := s.writeBlob(bytes.NewReader(blob)); err != nil {
+			return "", err
+		}
+	}
+
+	desc, err := s.writeBlob(bytes.NewReader(manifest))
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest, s.Tag(repo, tag, desc.Digest)
+}
+
+// Tag point the tag of the repository at the manifest digest.
+func (s *Store) Tag(repo string, tag string, dgst digest.Digest) error {
+	dir := filepath.Join(s.root, "repositories", filepath.Clean("/"+repo))
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, tag), []byte(dgst.String()), 0o644)
+}
+
+// SplitReference split an image reference into repository and tag, tag defaults to latest.
+func SplitReference(reference string) (string, string) {
+	i := strings.LastIndex(reference, ":")
+	if i > strings.LastIndex(reference, "/") {
+		return reference[:i], reference[i+1:]
+	}
+
+	return reference, "latest"
+}
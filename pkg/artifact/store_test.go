@@ -0,0 +1,156 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package artifact
+
+import (
+	"archive/tar"
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// dockerSave build a tar in docker save format.
+func dockerSave(t *testing.T, tag string, config []byte, layer []byte) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+
+	manifest, _ := json.Marshal([]dockerManifest{{
+		Config:   "config.json",
+		RepoTags: []string{tag},
+		Layers:   []string{"layer1/layer.tar", "layer2/layer.tar"},
+	}})
+
+	files := []struct {
+		name string
+		link string
+		data []byte
+	}{
+		{name: "layer1/layer.tar", data: layer},
+		{name: "layer2/layer.tar", link: "../layer1/layer.tar"},
+		{name: "config.json", data: config},
+		{name: "manifest.json", data: manifest},
+	}
+	for _, f := range files {
+		header := &tar.Header{Name: f.name, Mode: 0o644, Size: int64(len(f.data)), Typeflag: tar.TypeReg}
+		if f.link != "" {
+			header = &tar.Header{Name: f.name, Linkname: f.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	return buf.Bytes()
+}
+
+func TestStoreImport(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+
+	config := []byte(`{"architecture":"amd64"}`)
+	layer := []byte("layer content")
+	image := "dev-peer0-org1-mycc-1.0"
+
+	if _, err := store.SaveTar(image, bytes.NewReader(dockerSave(t, image+":latest", config, layer))); err != nil {
+		t.Fatalf("SaveTar() error = %v", err)
+	}
+
+	dgst, err := store.Import(image)
+	if err != nil {
+		t.Fatalf("Import() error = %v", err)
+	}
+
+	data, got, err := store.Manifest(image, "latest")
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	if got != dgst || digest.FromBytes(data) != dgst {
+		t.Errorf("Manifest() digest = %v, want %v", got, dgst)
+	}
+
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatalf("unmarshal manifest error = %v", err)
+	}
+	if manifest.Config.Digest != digest.FromBytes(config) {
+		t.Errorf("config digest = %v, want %v", manifest.Config.Digest, digest.FromBytes(config))
+	}
+	if len(manifest.Layers) != 2 || manifest.Layers[1].Digest != digest.FromBytes(layer) {
+		t.Errorf("layers = %v, want two layers of %v", manifest.Layers, digest.FromBytes(layer))
+	}
+
+	blob, err := store.Blob(digest.FromBytes(layer))
+	if err != nil {
+		t.Fatalf("Blob() error = %v", err)
+	}
+	defer blob.Close()
+	if content, _ := ioutil.ReadAll(blob); !bytes.Equal(content, layer) {
+		t.Errorf("Blob() content = %s, want %s", content, layer)
+	}
+
+	if _, _, err := store.Manifest(image, "v2"); err != ErrNotFound {
+		t.Errorf("Manifest() of unknown tag error = %v, want %v", err, ErrNotFound)
+	}
+
+	if platform, err := store.Platform(image); err != nil || platform.Architecture != "amd64" {
+		t.Errorf("Platform() = %v, %v, want amd64", platform, err)
+	}
+}
+
+func TestStoreLookupBuild(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	if err := store.RecordBuild(BuildRecord{Key: "key", Tags: []string{"mycc:1.0"}, ImageID: "sha256:1"}); err != nil {
+		t.Fatalf("RecordBuild() error = %v", err)
+	}
+
+	tests := []struct {
+		key     string
+		imageID string
+	}{
+		{key: "key", imageID: "sha256:1"},
+		// the tag is rebuilt from other content
+		{key: "other"},
+	}
+	for _, tt := range tests {
+		record, ok := store.LookupBuild(tt.key)
+		if tt.imageID == "" && ok {
+			t.Errorf("LookupBuild(%s) = %v, want none", tt.key, record.ImageID)
+		}
+		if tt.imageID != "" && (!ok || record.ImageID != tt.imageID) {
+			t.Errorf("LookupBuild(%s) = %v, %v, want %s", tt.key, record, ok, tt.imageID)
+		}
+	}
+}
+
+func TestSplitReference(t *testing.T) {
+	tests := []struct {
+		reference string
+		repo      string
+		tag       string
+	}{
+		{reference: "mycc", repo: "mycc", tag: "latest"},
+		{reference: "mycc:1.0", repo: "mycc", tag: "1.0"},
+		{reference: "127.0.0.1:5000/mycc", repo: "127.0.0.1:5000/mycc", tag: "latest"},
+	}
+	for _, tt := range tests {
+		repo, tag := SplitReference(tt.reference)
+		if repo != tt.repo || tag != tt.tag {
+			t.Errorf("SplitReference(%s) = %s, %s, want %s, %s", tt.reference, repo, tag, tt.repo, tt.tag)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package baseimage
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// Status is the state of a base image on the docker host.
+type Status struct {
+	Image   string    `json:"image"`
+	Present bool      `json:"present"`
+	ID      string    `json:"id,omitempty"`
+	Pinned  string    `json:"pinned,omitempty"`
+	Error   string    `json:"error,omitempty"`
+	Checked time.Time `json:"checked"`
+}
+
+// Ready report whether builds can use the image.
+func (s Status) Ready() bool {
+	return s.Present && s.Error == ""
+}
+
+// Name return the local name of the image.
+func (s Status) Name() string {
+	name, _ := reference(s.Image)
+
+	return name
+}
+
+// BaseImageService keep the builder and runtime images on the docker host.
+type BaseImageService interface {
+	Start(ctx context.Context)
+	Stop()
+	// Status return the state of the base images in configured order
+	Status() []Status
+	// Healthy report whether every base image is ready
+	Healthy() bool
+	// Has report whether the image is a ready base image
+	Has(image string) bool
+}
+
+type PeithoBaseImages struct {
+	docker   docker.DockerService
+	images   []string
+	bundle   string
+	interval int
+	ch       chan struct{}
+	stop     sync.Once
+
+	lock   sync.RWMutex
+	status map[string]Status
+}
+
+func NewPeithoBaseImages(docker docker.DockerService, option *options.BaseImageOption) (*PeithoBaseImages, error) {
+	return &PeithoBaseImages{
+		docker:   docker,
+		images:   option.Images,
+		bundle:   option.Bundle,
+		interval: option.Interval,
+		ch:       make(chan struct{}),
+		status:   make(map[string]Status),
+	}, nil
+}
+
+// Start pull the base images, then refresh them every interval until ctx is done or it is stopped.
+func (pb *PeithoBaseImages) Start(ctx context.Context) {
+	if len(pb.images) == 0 {
+		log.Info("no base image to keep")
+
+		return
+	}
+	log.Info("starting base image keeper")
+
+	pb.Sync(ctx)
+
+	ticker := time.NewTicker(time.Duration(pb.interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			pb.Sync(ctx)
+		case <-ctx.Done():
+			return
+		case <-pb.ch:
+			return
+		}
+	}
+}
+
+// Stop stop refreshing the images, it can be called more than once.
+func (pb *PeithoBaseImages) Stop() {
+	pb.stop.Do(func() {
+		close(pb.ch)
+	})
+}
+
+// Sync load the bundle if an image is missing, then pull and verify every image.
+func (pb *PeithoBaseImages) Sync(ctx context.Context) {
+	if pb.bundle != "" {
+		for _, image := range pb.images {
+			name, _ := reference(image)
+			if _, _, err := pb.docker.ImageInspectWithRaw(ctx, name); err != nil {
+				pb.load(ctx)
+
+				break
+			}
+		}
+	}
+
+	for _, image := range pb.images {
+		status := pb.ensure(ctx, image)
+
+		pb.lock.Lock()
+		if previous, ok := pb.status[image]; ok && previous.ID != "" && status.ID != "" && previous.ID != status.ID {
+			log.Infof("base image %s is updated from %s to %s", image, previous.ID, status.ID)
+		}
+		pb.status[image] = status
+		pb.lock.Unlock()
+	}
+}
+
+// ensure pull the image unless it is pinned and present, and check it matches the pin.
+func (pb *PeithoBaseImages) ensure(ctx context.Context, image string) Status {
+	name, pin := reference(image)
+	status := Status{Image: image, Pinned: pin.String(), Checked: time.Now()}
+
+	inspect, _, err := pb.docker.ImageInspectWithRaw(ctx, name)
+	// the content of a pinned image never changes
+	if err != nil || pin == "" || !matches(inspect, pin) {
+		if err := pb.pull(ctx, name, pin); err != nil {
+			log.Warnf("pull base image %s failed, use the local one: %v", image, err)
+		}
+		inspect, _, err = pb.docker.ImageInspectWithRaw(ctx, name)
+	}
+	if err != nil {
+		log.Errorf("base image %s is missing: %v", image, err)
+		status.Error = err.Error()
+
+		return status
+	}
+
+	status.Present = true
+	status.ID = inspect.ID
+	if pin != "" && !matches(inspect, pin) {
+		log.Errorf("base image %s is %s, not the pinned one", image, inspect.ID)
+		status.Error = fmt.Sprintf("image %s does not match the pinned digest", inspect.ID)
+	}
+
+	return status
+}
+
+// pull the image, a pinned image is pulled by digest and tagged with the configured name.
+func (pb *PeithoBaseImages) pull(ctx context.Context, name string, pin digest.Digest) error {
+	ref := name
+	if pin != "" {
+		ref = fmt.Sprintf("%s@%s", repository(strings.SplitN(name, "@", 2)[0]), pin)
+	}
+
+	reader, err := pb.docker.ImagePull(ctx, ref, types.ImagePullOptions{RegistryAuth: pb.docker.PullAuth(ref)})
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	// pull errors are reported in the progress stream
+	if err := jsonmessage.DisplayJSONMessagesStream(reader, ioutil.Discard, 0, false, nil); err != nil {
+		return err
+	}
+
+	if ref != name {
+		return pb.docker.ImageTag(ctx, ref, name)
+	}
+
+	return nil
+}
+
+// load the images of the bundle into the docker host.
+func (pb *PeithoBaseImages) load(ctx context.Context) {
+	file, err := os.Open(pb.bundle)
+	if err != nil {
+		log.Errorf("open base image bundle failed: %v", err)
+
+		return
+	}
+	defer file.Close()
+
+	resp, err := pb.docker.ImageLoad(ctx, file, true)
+	if err != nil {
+		log.Errorf("load base image bundle failed: %v", err)
+
+		return
+	}
+	defer resp.Body.Close()
+
+	if err := jsonmessage.DisplayJSONMessagesStream(resp.Body, ioutil.Discard, 0, false, nil); err != nil {
+		log.Errorf("load base image bundle failed: %v", err)
+
+		return
+	}
+
+	log.Infof("base images are loaded from %s", pb.bundle)
+}
+
+func (pb *PeithoBaseImages) Status() []Status {
+	pb.lock.RLock()
+	defer pb.lock.RUnlock()
+
+	status := make([]Status, 0, len(pb.images))
+	for _, image := range pb.images {
+		s, ok := pb.status[image]
+		if !ok {
+			s = Status{Image: image, Error: "not checked yet"}
+		}
+		status = append(status, s)
+	}
+
+	return status
+}
+
+func (pb *PeithoBaseImages) Healthy() bool {
+	for _, s := range pb.Status() {
+		if !s.Ready() {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (pb *PeithoBaseImages) Has(image string) bool {
+	for _, s := range pb.Status() {
+		name, _ := reference(s.Image)
+		if s.Ready() && (name == image || name == image+":latest") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// reference split the configured image into the local name and the pinned digest.
+func reference(image string) (string, digest.Digest) {
+	i := strings.Index(image, "@")
+	if i < 0 {
+		return image, ""
+	}
+
+	name, pin := image[:i], digest.Digest(image[i+1:])
+	// an image pinned without tag is known by its digest
+	if repository(name) == name {
+		return image, pin
+	}
+
+	return name, pin
+}
+
+// repository strip the tag of the image name.
+func repository(name string) string {
+	if i := strings.LastIndex(name, ":"); i > strings.LastIndex(name, "/") {
+		return name[:i]
+	}
+
+	return name
+}
+
+// matches check the image is the pinned manifest digest or image id.
+func matches(inspect types.ImageInspect, pin digest.Digest) bool {
+	if inspect.ID == pin.String() {
+		return true
+	}
+
+	for _, repoDigest := range inspect.RepoDigests {
+		if strings.HasSuffix(repoDigest, "@"+pin.String()) {
+			return true
+		}
+	}
+
+	return false
+}
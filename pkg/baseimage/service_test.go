@@ -0,0 +1,148 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package baseimage
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/golang/mock/gomock"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+const (
+	ccenv  = "hyperledger/fabric-ccenv:2.2"
+	baseos = "hyperledger/fabric-baseos:2.2"
+	pin    = "sha256:8600907bbe3d1af9b498775f343359db7b2f4540fb3958bf7878b3ca0d7e3f79"
+)
+
+var errNoSuchImage = errors.New("no such image")
+
+func pullStream(message string) io.ReadCloser {
+	return ioutil.NopCloser(strings.NewReader(message))
+}
+
+func TestPeithoBaseImages_Sync(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().PullAuth(gomock.Any()).Return("").AnyTimes()
+
+	// the pinned ccenv is present, it is not pulled again
+	dockerSrv.EXPECT().ImageInspectWithRaw(ctx, ccenv).
+		Return(types.ImageInspect{ID: "sha256:ccenv", RepoDigests: []string{"hyperledger/fabric-ccenv@" + pin}}, nil, nil).
+		AnyTimes()
+	// baseos is refreshed, and the registry is not reachable
+	dockerSrv.EXPECT().ImageInspectWithRaw(ctx, baseos).Return(types.ImageInspect{ID: "sha256:baseos"}, nil, nil).AnyTimes()
+	dockerSrv.EXPECT().ImagePull(ctx, baseos, gomock.Any()).
+		Return(pullStream(`{"errorDetail":{"message":"connection refused"},"error":"connection refused"}`), nil)
+
+	pb, _ := NewPeithoBaseImages(dockerSrv, &options.BaseImageOption{Images: []string{ccenv + "@" + pin, baseos}, Interval: 60})
+	if pb.Healthy() {
+		t.Errorf("Healthy() before sync = true, want false")
+	}
+
+	pb.Sync(ctx)
+
+	if !pb.Healthy() {
+		t.Errorf("Healthy() = false, status %+v", pb.Status())
+	}
+	if !pb.Has(ccenv) || !pb.Has(baseos) || pb.Has("hyperledger/fabric-peer:2.2") {
+		t.Errorf("Has() does not match the base images")
+	}
+}
+
+func TestPeithoBaseImages_Sync_pin(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	ctx := context.Background()
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().PullAuth(gomock.Any()).Return("").AnyTimes()
+
+	// the local tag is another image, the pinned one is pulled by digest and tagged
+	gomock.InOrder(
+		dockerSrv.EXPECT().ImageInspectWithRaw(ctx, ccenv).Return(types.ImageInspect{ID: "sha256:other"}, nil, nil),
+		dockerSrv.EXPECT().ImagePull(ctx, "hyperledger/fabric-ccenv@"+pin, gomock.Any()).Return(pullStream(`{}`), nil),
+		dockerSrv.EXPECT().ImageTag(ctx, "hyperledger/fabric-ccenv@"+pin, ccenv).Return(nil),
+		dockerSrv.EXPECT().ImageInspectWithRaw(ctx, ccenv).Return(types.ImageInspect{ID: pin}, nil, nil),
+	)
+
+	pb, _ := NewPeithoBaseImages(dockerSrv, &options.BaseImageOption{Images: []string{ccenv + "@" + pin}, Interval: 60})
+	pb.Sync(ctx)
+
+	if !pb.Healthy() {
+		t.Errorf("Healthy() = false, status %+v", pb.Status())
+	}
+
+	// a pull failure leaves the wrong image, it is reported
+	dockerSrv.EXPECT().ImageInspectWithRaw(ctx, ccenv).Return(types.ImageInspect{ID: "sha256:other"}, nil, nil).Times(2)
+	dockerSrv.EXPECT().ImagePull(ctx, "hyperledger/fabric-ccenv@"+pin, gomock.Any()).Return(nil, errors.New("offline"))
+
+	pb.Sync(ctx)
+
+	if pb.Healthy() || pb.Has(ccenv) {
+		t.Errorf("Healthy() = true for a mismatched pin, status %+v", pb.Status())
+	}
+}
+
+func TestPeithoBaseImages_Sync_bundle(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	bundle := filepath.Join(t.TempDir(), "base-images.tar")
+	if err := ioutil.WriteFile(bundle, []byte("bundle"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	dockerSrv := docker.NewMockDockerService(ctrl)
+	dockerSrv.EXPECT().PullAuth(gomock.Any()).Return("").AnyTimes()
+
+	// the image is missing and the registry is not reachable, it is loaded from the bundle
+	gomock.InOrder(
+		dockerSrv.EXPECT().ImageInspectWithRaw(ctx, baseos).Return(types.ImageInspect{}, nil, errNoSuchImage),
+		dockerSrv.EXPECT().ImageLoad(ctx, gomock.Any(), true).Return(types.ImageLoadResponse{Body: pullStream(`{}`)}, nil),
+		dockerSrv.EXPECT().ImageInspectWithRaw(ctx, baseos).Return(types.ImageInspect{ID: "sha256:baseos"}, nil, nil),
+	)
+	dockerSrv.EXPECT().ImagePull(ctx, baseos, gomock.Any()).Return(nil, errors.New("offline"))
+	dockerSrv.EXPECT().ImageInspectWithRaw(ctx, baseos).Return(types.ImageInspect{ID: "sha256:baseos"}, nil, nil)
+
+	pb, _ := NewPeithoBaseImages(dockerSrv, &options.BaseImageOption{Images: []string{baseos}, Bundle: bundle, Interval: 60})
+	pb.Sync(ctx)
+
+	if !pb.Healthy() {
+		t.Errorf("Healthy() = false, status %+v", pb.Status())
+	}
+}
+
+func Test_reference(t *testing.T) {
+	tests := []struct {
+		image string
+		name  string
+		pin   string
+	}{
+		{image: ccenv, name: ccenv},
+		{image: ccenv + "@" + pin, name: ccenv, pin: pin},
+		{image: "hyperledger/fabric-ccenv@" + pin, name: "hyperledger/fabric-ccenv@" + pin, pin: pin},
+		{image: "localhost:5000/fabric-ccenv", name: "localhost:5000/fabric-ccenv"},
+	}
+	for _, tt := range tests {
+		name, dgst := reference(tt.image)
+		if name != tt.name || dgst.String() != tt.pin {
+			t.Errorf("reference(%s) = %s, %s, want %s, %s", tt.image, name, dgst, tt.name, tt.pin)
+		}
+	}
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package builder build chaincode images, with the docker daemon or without it.
+package builder
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/pkg/jsonmessage"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// Builder build chaincode images and keep them until they are published.
+type Builder interface {
+	// Build build the image of the build context, the progress is reported in the returned stream
+	Build(ctx context.Context, buildContext io.ReadSeeker, options types.ImageBuildOptions) (io.ReadCloser, error)
+	// ImageID return the id of the image, base images are resolved too
+	ImageID(ctx context.Context, image string) (string, error)
+	// Tag add a tag to the built image
+	Tag(ctx context.Context, image string, tag string) error
+	// Save export the images in docker save format
+	Save(ctx context.Context, images []string) (io.ReadCloser, error)
+	// Load import the images of a docker save tar
+	Load(ctx context.Context, content io.Reader) error
+	// Push push the image tagged with the registry reference, return its manifest digest
+	Push(ctx context.Context, ref string) (digest.Digest, error)
+}
+
+// NewBuilder new builder from option, images are built with the docker daemon unless the daemonless
+// backend is configured.
+func NewBuilder(
+	option *options.BuilderOption,
+	docker docker.DockerService,
+	store *artifact.Store,
+	client *distribution.Client,
+) Builder {
+	if option.Backend == options.BUILDER_DAEMONLESS {
+		return &daemonlessBuilder{store: store, client: client, mirror: strings.TrimSuffix(option.Mirror, "/")}
+	}
+
+	return &dockerBuilder{docker: docker}
+}
+
+// dockerBuilder build images with the docker daemon.
+type dockerBuilder struct {
+	docker docker.DockerService
+}
+
+func (d *dockerBuilder) Build(
+	ctx context.Context,
+	buildContext io.ReadSeeker,
+	options types.ImageBuildOptions,
+) (io.ReadCloser, error) {
+	resp, err := d.docker.ImageBuild(ctx, buildContext, options)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+func (d *dockerBuilder) ImageID(ctx context.Context, image string) (string, error) {
+	inspect, _, err := d.docker.ImageInspectWithRaw(ctx, image)
+	if err != nil {
+		return "", err
+	}
+
+	return inspect.ID, nil
+}
+
+func (d *dockerBuilder) Tag(ctx context.Context, image string, tag string) error {
+	return d.docker.ImageTag(ctx, image, tag)
+}
+
+func (d *dockerBuilder) Save(ctx context.Context, images []string) (io.ReadCloser, error) {
+	return d.docker.ImageSave(ctx, images)
+}
+
+func (d *dockerBuilder) Load(ctx context.Context, content io.Reader) error {
+	resp, err := d.docker.ImageLoad(ctx, content, true)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	return jsonmessage.DisplayJSONMessagesStream(resp.Body, ioutil.Discard, 0, false, nil)
+}
+
+// Push push the image with the credentials of its registry, the digest is the one reported by the push
+// stream, which is empty for some daemons.
+func (d *dockerBuilder) Push(ctx context.Context, ref string) (digest.Digest, error) {
+	pushOpt := types.ImagePushOptions{}
+	auth, err := d.docker.RegistryAuthFor(strings.SplitN(ref, "/", 2)[0])
+	if err != nil {
+		log.Errorf("get registryAuth failed: %v", err)
+	} else {
+		pushOpt.RegistryAuth = auth
+	}
+
+	reader, err := d.docker.ImagePush(ctx, ref, pushOpt)
+	if err != nil {
+		return "", err
+	}
+	defer reader.Close()
+
+	// push errors and the pushed digest are reported in the progress stream
+	var dgst digest.Digest
+	aux := func(message jsonmessage.JSONMessage) {
+		result := types.PushResult{}
+		if message.Aux != nil && json.Unmarshal(*message.Aux, &result) == nil && result.Digest != "" {
+			dgst = digest.Digest(result.Digest)
+		}
+	}
+	if err := jsonmessage.DisplayJSONMessagesStream(reader, ioutil.Discard, 0, false, aux); err != nil {
+		return "", err
+	}
+
+	return dgst, nil
+}
@@ -0,0 +1,334 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// fabricDockerfile is the dockerfile fabric builds golang chaincode images with.
+const fabricDockerfile = `FROM hyperledger/fabric-baseos:2.2
+ADD binpackage.tar /usr/local/bin
+LABEL org.hyperledger.fabric.chaincode.id.name="mycc" \
+      org.hyperledger.fabric.chaincode.id.version="1.0" \
+      org.hyperledger.fabric.chaincode.type="GOLANG"
+ENV CORE_CHAINCODE_BUILDLEVEL=2.2.0
+`
+
+// elfHeader return the start of a little endian ELF binary of the machine.
+func elfHeader(machine byte) []byte {
+	head := make([]byte, 64)
+	copy(head, elfMagic)
+	head[5] = 1
+	head[18] = machine
+
+	return head
+}
+
+func tarFiles(t *testing.T, files map[string][]byte) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for name, data := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o755, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	return buf.Bytes()
+}
+
+// registry is an in-process registry keeping manifests by repository:reference and blobs by digest.
+type registry struct {
+	lock      sync.Mutex
+	manifests map[string][]byte
+	types     map[string]string
+	blobs     map[digest.Digest][]byte
+	uploads   int
+}
+
+func newTestRegistry(t *testing.T) (*registry, *httptest.Server) {
+	reg := &registry{manifests: make(map[string][]byte), types: make(map[string]string), blobs: make(map[digest.Digest][]byte)}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reg.lock.Lock()
+		defer reg.lock.Unlock()
+
+		body, _ := ioutil.ReadAll(r.Body)
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/upload/"):
+			dgst := digest.Digest(r.URL.Query().Get("digest"))
+			if digest.FromBytes(body) != dgst {
+				w.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+			reg.blobs[dgst] = body
+			w.WriteHeader(http.StatusCreated)
+		case strings.HasSuffix(r.URL.Path, "/blobs/uploads/"):
+			reg.uploads++
+			w.Header().Set("Location", fmt.Sprintf("/upload/%d", reg.uploads))
+			w.WriteHeader(http.StatusAccepted)
+		case strings.Contains(r.URL.Path, "/blobs/"):
+			data, ok := reg.blobs[digest.Digest(r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			_, _ = w.Write(data)
+		case strings.Contains(r.URL.Path, "/manifests/"):
+			i := strings.Index(r.URL.Path, "/manifests/")
+			key := r.URL.Path[len("/v2/"):i] + ":" + r.URL.Path[i+len("/manifests/"):]
+			if r.Method == http.MethodPut {
+				reg.manifests[key] = body
+				reg.types[key] = r.Header.Get("Content-Type")
+				w.WriteHeader(http.StatusCreated)
+
+				return
+			}
+			data, ok := reg.manifests[key]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+			w.Header().Set("Content-Type", reg.types[key])
+			w.Header().Set("Docker-Content-Digest", digest.FromBytes(data).String())
+			_, _ = w.Write(data)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	return reg, server
+}
+
+// put store the manifest under the repository and its digest.
+func (r *registry) put(repo string, ref string, mediaType string, data []byte) ocispec.Descriptor {
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+	for _, key := range []string{repo + ":" + ref, repo + ":" + desc.Digest.String()} {
+		r.manifests[key] = data
+		r.types[key] = mediaType
+	}
+
+	return desc
+}
+
+// baseImage put a multi-platform runtime image with a gzip compressed layer for every architecture.
+func (r *registry) baseImage(t *testing.T, repo string, tag string, archs ...string) {
+	index := ocispec.Index{Versioned: specs.Versioned{SchemaVersion: 2}}
+	for _, arch := range archs {
+		layer := tarFiles(t, map[string][]byte{"etc/os-release": []byte("ID=alpine\n"), "arch": []byte(arch)})
+		compressed := &bytes.Buffer{}
+		gz := gzip.NewWriter(compressed)
+		_, _ = gz.Write(layer)
+		gz.Close()
+
+		config, _ := json.Marshal(ocispec.Image{
+			Architecture: arch,
+			OS:           "linux",
+			Config:       ocispec.ImageConfig{Env: []string{"PATH=/usr/local/bin:/usr/bin:/bin"}},
+			RootFS:       ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{digest.FromBytes(layer)}},
+		})
+		r.blobs[digest.FromBytes(config)] = config
+		r.blobs[digest.FromBytes(compressed.Bytes())] = compressed.Bytes()
+
+		manifest, _ := json.Marshal(ocispec.Manifest{
+			Versioned: specs.Versioned{SchemaVersion: 2},
+			Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromBytes(config)},
+			Layers: []ocispec.Descriptor{{
+				MediaType: ocispec.MediaTypeImageLayerGzip,
+				Digest:    digest.FromBytes(compressed.Bytes()),
+				Size:      int64(compressed.Len()),
+			}},
+		})
+		desc := r.put(repo, arch, ocispec.MediaTypeImageManifest, manifest)
+		desc.Platform = &ocispec.Platform{OS: "linux", Architecture: arch}
+		index.Manifests = append(index.Manifests, desc)
+	}
+
+	data, _ := json.Marshal(index)
+	r.put(repo, tag, ocispec.MediaTypeImageIndex, data)
+}
+
+func Test_parseDockerfile(t *testing.T) {
+	instructions, err := parseDockerfile(strings.NewReader("# runtime image\n" + fabricDockerfile))
+	if err != nil {
+		t.Fatalf("parseDockerfile() error = %v", err)
+	}
+	if len(instructions) != 4 {
+		t.Fatalf("parseDockerfile() = %d instructions, want 4", len(instructions))
+	}
+
+	labels, err := keyValues(instructions[2])
+	if err != nil {
+		t.Fatalf("keyValues() error = %v", err)
+	}
+	if len(labels) != 3 || labels[0] != [2]string{"org.hyperledger.fabric.chaincode.id.name", "mycc"} {
+		t.Errorf("keyValues() = %v, want the chaincode labels", labels)
+	}
+
+	if _, err := parseDockerfile(strings.NewReader("FROM alpine\nRUN apk add git\n")); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("parseDockerfile() of RUN error = %v, want %v", err, ErrUnsupported)
+	}
+	if _, err := parseDockerfile(strings.NewReader("ADD a /a\n")); err == nil {
+		t.Errorf("parseDockerfile() without FROM returns no error")
+	}
+}
+
+func TestBinaryArchs(t *testing.T) {
+	// the chaincode binary is packed in binpackage.tar of the build context
+	buildContext := tarFiles(t, map[string][]byte{
+		"Dockerfile":      []byte(fabricDockerfile),
+		"binpackage.tar":  tarFiles(t, map[string][]byte{"chaincode": elfHeader(0xb7)}),
+		"codepackage.tgz": []byte("source"),
+	})
+
+	archs := make(map[string]bool)
+	BinaryArchs(bytes.NewReader(buildContext), archs)
+
+	if !reflect.DeepEqual(archs, map[string]bool{"arm64": true}) {
+		t.Errorf("BinaryArchs() = %v, want arm64", archs)
+	}
+}
+
+func TestDaemonless(t *testing.T) {
+	ctx := context.Background()
+	reg, server := newTestRegistry(t)
+	host := strings.TrimPrefix(server.URL, "http://")
+	reg.baseImage(t, "dockerhub/hyperledger/fabric-baseos", "2.2", "amd64", "arm64")
+
+	client := distribution.NewClient(distribution.Options{PlainHTTP: func(string) bool { return true }})
+	store, _ := artifact.NewStore(t.TempDir())
+	b := NewBuilder(&options.BuilderOption{Backend: options.BUILDER_DAEMONLESS, Mirror: host + "/dockerhub"}, nil, store, client)
+
+	// the chaincode is compiled for arm64, the arm64 runtime image is used
+	binary := elfHeader(0xb7)
+	buildContext := tarFiles(t, map[string][]byte{
+		"Dockerfile":     []byte(fabricDockerfile),
+		"binpackage.tar": tarFiles(t, map[string][]byte{"chaincode": binary}),
+	})
+	stream, err := b.Build(ctx, bytes.NewReader(buildContext), types.ImageBuildOptions{Tags: []string{"mycc:latest"}})
+	if err != nil {
+		t.Fatalf("Build() error = %v", err)
+	}
+	progress, _ := ioutil.ReadAll(stream)
+	if !strings.Contains(string(progress), "Successfully tagged mycc:latest") {
+		t.Errorf("Build() stream = %s", progress)
+	}
+
+	id, err := b.ImageID(ctx, "mycc:latest")
+	if err != nil || !strings.Contains(string(progress), id) {
+		t.Fatalf("ImageID() = %s, %v, want the id in the build stream", id, err)
+	}
+
+	data, _, _ := store.Manifest("mycc", "latest")
+	manifest := ocispec.Manifest{}
+	_ = json.Unmarshal(data, &manifest)
+	if len(manifest.Layers) != 2 {
+		t.Fatalf("manifest layers = %v, want the runtime layer and the chaincode layer", manifest.Layers)
+	}
+
+	blob, _ := store.Blob(manifest.Config.Digest)
+	config := ocispec.Image{}
+	_ = json.NewDecoder(blob).Decode(&config)
+	blob.Close()
+	if config.Architecture != "arm64" || config.Config.Labels["org.hyperledger.fabric.chaincode.type"] != "GOLANG" ||
+		config.Config.Env[1] != "CORE_CHAINCODE_BUILDLEVEL=2.2.0" {
+		t.Errorf("config = %+v, want the arm64 runtime image with the chaincode labels and env", config)
+	}
+
+	blob, _ = store.Blob(manifest.Layers[1].Digest)
+	files := make(map[string][]byte)
+	tr := tar.NewReader(blob)
+	for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+		files[header.Name], _ = ioutil.ReadAll(tr)
+	}
+	blob.Close()
+	if !bytes.Equal(files["usr/local/bin/chaincode"], binary) {
+		t.Errorf("chaincode layer = %v, want the binary extracted into /usr/local/bin", files)
+	}
+
+	// the image is saved in docker save format and loaded back under both tags
+	if err := b.Tag(ctx, id, "mycc:1.0"); err != nil {
+		t.Fatalf("Tag() error = %v", err)
+	}
+	saved, err := b.Save(ctx, []string{"mycc:latest", "mycc:1.0"})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	other, _ := artifact.NewStore(t.TempDir())
+	loaded, err := other.Load(saved)
+	if err != nil || loaded.String() != id {
+		t.Errorf("Load() = %s, %v, want %s", loaded, err, id)
+	}
+	if dgst, err := other.Resolve("mycc", "1.0"); err != nil || dgst.String() != id {
+		t.Errorf("Resolve() = %s, %v, want %s", dgst, err, id)
+	}
+
+	// the image is pushed without a docker daemon
+	ref := host + "/chaincode/mycc:latest"
+	if err := b.Tag(ctx, "mycc:latest", ref); err != nil {
+		t.Fatalf("Tag() error = %v", err)
+	}
+	dgst, err := b.Push(ctx, ref)
+	if err != nil || dgst.String() != id {
+		t.Fatalf("Push() = %s, %v, want %s", dgst, err, id)
+	}
+	if pushed := reg.manifests["chaincode/mycc:latest"]; digest.FromBytes(pushed).String() != id {
+		t.Errorf("pushed manifest digest = %s, want %s", digest.FromBytes(pushed), id)
+	}
+	if _, ok := reg.blobs[manifest.Layers[1].Digest]; !ok {
+		t.Errorf("chaincode layer is not pushed")
+	}
+}
+
+func Test_daemonlessBuilder_reference(t *testing.T) {
+	tests := []struct {
+		mirror string
+		image  string
+		want   string
+	}{
+		{image: "hyperledger/fabric-baseos:2.2", want: DOCKER_HUB + "/hyperledger/fabric-baseos:2.2"},
+		{image: "alpine", want: DOCKER_HUB + "/library/alpine"},
+		{image: "docker.io/hyperledger/fabric-baseos:2.2", want: DOCKER_HUB + "/hyperledger/fabric-baseos:2.2"},
+		{mirror: "harbor/dockerhub", image: "hyperledger/fabric-baseos:2.2", want: "harbor/dockerhub/hyperledger/fabric-baseos:2.2"},
+		{mirror: "harbor/dockerhub", image: "harbor:8099/fabric/baseos:2.2", want: "harbor:8099/fabric/baseos:2.2"},
+		{image: "localhost/baseos:2.2@sha256:abc", want: "localhost/baseos@sha256:abc"},
+	}
+	for _, tt := range tests {
+		b := &daemonlessBuilder{mirror: tt.mirror}
+		if got := b.reference(tt.image); got != tt.want {
+			t.Errorf("reference(%s) = %s, want %s", tt.image, got, tt.want)
+		}
+	}
+}
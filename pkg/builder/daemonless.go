@@ -0,0 +1,812 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/klauspost/compress/zstd"
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/artifact"
+	"github.com/tianrandailove/peitho/pkg/distribution"
+	"github.com/tianrandailove/peitho/pkg/docker"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// DOCKER_HUB is the registry of the images without a registry host.
+const DOCKER_HUB = "registry-1.docker.io"
+
+// daemonlessBuilder assemble the image from the runtime image in the registry and the files of the build
+// context, no command is run in the image. the images are kept in the artifact store as OCI manifests,
+// their ids are the manifest digests.
+type daemonlessBuilder struct {
+	store  *artifact.Store
+	client *distribution.Client
+	// mirror replaces docker hub
+	mirror string
+}
+
+// contextFile is a regular file or a directory of the build context.
+type contextFile struct {
+	header *tar.Header
+	data   []byte
+}
+
+// Build assemble the image, the build stream is written once the image is stored.
+func (b *daemonlessBuilder) Build(
+	ctx context.Context,
+	buildContext io.ReadSeeker,
+	options types.ImageBuildOptions,
+) (io.ReadCloser, error) {
+	if len(options.Tags) == 0 {
+		return nil, errors.New("image has no tags")
+	}
+
+	files, err := readContext(buildContext)
+	if err != nil {
+		return nil, err
+	}
+
+	dockerfile := strings.TrimPrefix(options.Dockerfile, "./")
+	if dockerfile == "" {
+		dockerfile = "Dockerfile"
+	}
+	f, ok := files[dockerfile]
+	if !ok || f.data == nil {
+		return nil, errors.Errorf("%s not found in the build context", dockerfile)
+	}
+	instructions, err := parseDockerfile(bytes.NewReader(f.data))
+	if err != nil {
+		return nil, err
+	}
+
+	platform, err := b.platform(buildContext, options.Platform)
+	if err != nil {
+		return nil, err
+	}
+
+	from := instructions[0].args
+	if len(from) > 0 && strings.HasPrefix(from[0], "--platform=") {
+		from = from[1:]
+	}
+	if len(from) == 0 {
+		return nil, errors.New("FROM has no image")
+	}
+
+	stream := &bytes.Buffer{}
+	encoder := json.NewEncoder(stream)
+	progress := func(format string, args ...interface{}) {
+		_ = encoder.Encode(map[string]string{"stream": fmt.Sprintf(format, args...)})
+	}
+
+	progress("Step 1/%d : %s\n", len(instructions), instructions[0])
+	config, blobs, err := b.base(ctx, from[0], platform)
+	if err != nil {
+		log.Errorf("fetch base image %s failed: %v", from[0], err)
+
+		return nil, err
+	}
+
+	for n, inst := range instructions[1:] {
+		progress("Step %d/%d : %s\n", n+2, len(instructions), inst)
+
+		layer, err := apply(config, inst, files)
+		if err != nil {
+			return nil, err
+		}
+
+		history := ocispec.History{
+			Created:    now(),
+			CreatedBy:  "/bin/sh -c #(nop) " + inst.String(),
+			EmptyLayer: layer == nil,
+		}
+		config.History = append(config.History, history)
+
+		if layer != nil {
+			diffID := digest.FromBytes(layer)
+			config.RootFS.DiffIDs = append(config.RootFS.DiffIDs, diffID)
+			blobs = append(blobs, layer)
+			progress(" ---> %s\n", shortID(diffID))
+		}
+	}
+
+	for key, value := range options.Labels {
+		if config.Config.Labels == nil {
+			config.Config.Labels = make(map[string]string)
+		}
+		config.Config.Labels[key] = value
+	}
+	config.Created = now()
+
+	dgst, err := b.put(config, blobs, options.Tags)
+	if err != nil {
+		log.Errorf("store image %s failed: %v", options.Tags[0], err)
+
+		return nil, err
+	}
+
+	_ = encoder.Encode(map[string]interface{}{"aux": map[string]string{"ID": dgst.String()}})
+	progress("Successfully built %s\n", shortID(dgst))
+	for _, tag := range options.Tags {
+		progress("Successfully tagged %s\n", tag)
+	}
+
+	return ioutil.NopCloser(stream), nil
+}
+
+// platform return the requested platform, or the platform of the binaries in the build context.
+func (b *daemonlessBuilder) platform(buildContext io.ReadSeeker, requested string) (ocispec.Platform, error) {
+	if requested != "" {
+		return docker.ParsePlatform(requested)
+	}
+
+	platform := ocispec.Platform{OS: "linux", Architecture: runtime.GOARCH}
+
+	archs := make(map[string]bool)
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return platform, err
+	}
+	BinaryArchs(buildContext, archs)
+	if len(archs) == 1 {
+		for arch := range archs {
+			platform.Architecture = arch
+		}
+	}
+
+	return platform, nil
+}
+
+// base fetch the config of the base image for the platform and the layers which are not in the store yet.
+func (b *daemonlessBuilder) base(ctx context.Context, image string, platform ocispec.Platform) (*ocispec.Image, [][]byte, error) {
+	ref := b.reference(image)
+	log.Debugf("fetch base image %s for %s", ref, docker.FormatPlatform(platform))
+
+	manifest, _, err := b.client.PlatformManifest(ctx, ref, platform)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	r, err := distribution.ParseReference(ref)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	content, err := b.client.Blob(ctx, r, manifest.Config.Digest)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer content.Close()
+
+	config := &ocispec.Image{}
+	if err := json.NewDecoder(content).Decode(config); err != nil {
+		return nil, nil, err
+	}
+	if len(config.RootFS.DiffIDs) != len(manifest.Layers) {
+		return nil, nil, errors.Errorf("%s has %d layers but %d diff ids", ref, len(manifest.Layers), len(config.RootFS.DiffIDs))
+	}
+
+	var blobs [][]byte
+	for i, layer := range manifest.Layers {
+		diffID := config.RootFS.DiffIDs[i]
+		if blob, err := b.store.Blob(diffID); err == nil {
+			// the uncompressed layer is kept by an earlier build
+			blob.Close()
+
+			continue
+		}
+
+		data, err := b.layer(ctx, r, layer.Digest)
+		if err != nil {
+			return nil, nil, err
+		}
+		if digest.FromBytes(data) != diffID {
+			return nil, nil, errors.Errorf("layer %s of %s does not match its diff id %s", layer.Digest, ref, diffID)
+		}
+		blobs = append(blobs, data)
+	}
+
+	return config, blobs, nil
+}
+
+// layer download the layer blob and decompress it.
+func (b *daemonlessBuilder) layer(ctx context.Context, r distribution.Reference, dgst digest.Digest) ([]byte, error) {
+	content, err := b.client.Blob(ctx, r, dgst)
+	if err != nil {
+		return nil, err
+	}
+	defer content.Close()
+
+	data, err := ioutil.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+
+	return decompress(data)
+}
+
+// reference qualify the image with its registry, docker hub images are fetched from the mirror if set.
+func (b *daemonlessBuilder) reference(image string) string {
+	// a tag before the digest is ignored
+	if i := strings.Index(image, "@"); i > 0 {
+		if j := strings.LastIndex(image[:i], ":"); j > strings.LastIndex(image[:i], "/") {
+			image = image[:j] + image[i:]
+		}
+	}
+
+	if i := strings.Index(image, "/"); i > 0 {
+		host := image[:i]
+		if host == "docker.io" || host == "index.docker.io" {
+			image = image[i+1:]
+		} else if strings.ContainsAny(host, ".:") || host == "localhost" {
+			return image
+		}
+	}
+
+	if !strings.Contains(image, "/") {
+		image = "library/" + image
+	}
+	if b.mirror != "" {
+		return b.mirror + "/" + image
+	}
+
+	return DOCKER_HUB + "/" + image
+}
+
+// put store the blobs and the manifest of the image, and tag it.
+func (b *daemonlessBuilder) put(config *ocispec.Image, blobs [][]byte, tags []string) (digest.Digest, error) {
+	configData, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+
+	manifest := ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(configData),
+			Size:      int64(len(configData)),
+		},
+	}
+	for _, diffID := range config.RootFS.DiffIDs {
+		blob, err := b.store.Blob(diffID)
+		size := int64(-1)
+		if err == nil {
+			info, statErr := blob.Stat()
+			blob.Close()
+			if statErr != nil {
+				return "", statErr
+			}
+			size = info.Size()
+		}
+		for _, data := range blobs {
+			if size < 0 && digest.FromBytes(data) == diffID {
+				size = int64(len(data))
+			}
+		}
+		if size < 0 {
+			return "", errors.Errorf("layer %s is missing", diffID)
+		}
+		manifest.Layers = append(manifest.Layers, ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageLayer,
+			Digest:    diffID,
+			Size:      size,
+		})
+	}
+
+	data, err := json.Marshal(struct {
+		MediaType string `json:"mediaType"`
+		ocispec.Manifest
+	}{ocispec.MediaTypeImageManifest, manifest})
+	if err != nil {
+		return "", err
+	}
+
+	repo, tag := artifact.SplitReference(tags[0])
+	dgst, err := b.store.Put(repo, tag, data, append(blobs, configData)...)
+	if err != nil {
+		return "", err
+	}
+	for _, tag := range tags[1:] {
+		repo, ref := artifact.SplitReference(tag)
+		if err := b.store.Tag(repo, ref, dgst); err != nil {
+			return "", err
+		}
+	}
+	log.Infof("assemble image %s as %s", tags[0], dgst)
+
+	return dgst, nil
+}
+
+// ImageID return the manifest digest of the image in the store, or of the image in its registry.
+func (b *daemonlessBuilder) ImageID(ctx context.Context, image string) (string, error) {
+	if dgst, err := b.resolve(image); err == nil {
+		return dgst.String(), nil
+	}
+
+	if _, err := digest.Parse(image); err == nil {
+		return "", artifact.ErrNotFound
+	}
+
+	desc, err := b.client.Head(ctx, b.reference(image))
+	if err != nil {
+		return "", err
+	}
+
+	return desc.Digest.String(), nil
+}
+
+// resolve find the manifest digest of the image id or tag in the store.
+func (b *daemonlessBuilder) resolve(image string) (digest.Digest, error) {
+	repo, ref := artifact.SplitReference(image)
+	if _, err := digest.Parse(image); err == nil {
+		repo, ref = "", image
+	}
+
+	dgst, err := b.store.Resolve(repo, ref)
+	if err != nil {
+		return "", err
+	}
+
+	// an image id is a manifest, not any blob
+	blob, err := b.store.Blob(dgst)
+	if err != nil {
+		return "", err
+	}
+	defer blob.Close()
+
+	manifest := ocispec.Manifest{}
+	if err := json.NewDecoder(blob).Decode(&manifest); err != nil || manifest.Config.Digest == "" {
+		return "", artifact.ErrNotFound
+	}
+
+	return dgst, nil
+}
+
+func (b *daemonlessBuilder) Tag(ctx context.Context, image string, tag string) error {
+	dgst, err := b.resolve(image)
+	if err != nil {
+		return err
+	}
+	repo, ref := artifact.SplitReference(tag)
+
+	return b.store.Tag(repo, ref, dgst)
+}
+
+func (b *daemonlessBuilder) Save(ctx context.Context, images []string) (io.ReadCloser, error) {
+	for _, image := range images {
+		if _, err := b.resolve(image); err != nil {
+			return nil, err
+		}
+	}
+
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(b.store.Save(writer, images...))
+	}()
+
+	return reader, nil
+}
+
+func (b *daemonlessBuilder) Load(ctx context.Context, content io.Reader) error {
+	_, err := b.store.Load(content)
+
+	return err
+}
+
+// Push upload the blobs and the manifest of the image tagged with the reference into its registry.
+func (b *daemonlessBuilder) Push(ctx context.Context, ref string) (digest.Digest, error) {
+	r, err := distribution.ParseReference(ref)
+	if err != nil {
+		return "", err
+	}
+
+	repo, tag := artifact.SplitReference(ref)
+	data, dgst, err := b.store.Manifest(repo, tag)
+	if err != nil {
+		return "", err
+	}
+
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return "", err
+	}
+
+	for _, desc := range append([]ocispec.Descriptor{manifest.Config}, manifest.Layers...) {
+		blob, err := b.store.Blob(desc.Digest)
+		if err != nil {
+			return "", err
+		}
+		content, err := ioutil.ReadAll(blob)
+		blob.Close()
+		if err != nil {
+			return "", err
+		}
+		if _, err := b.client.PushBlob(ctx, r, desc.MediaType, content); err != nil {
+			return "", err
+		}
+	}
+
+	if _, err := b.client.PushManifest(ctx, r, ocispec.MediaTypeImageManifest, data); err != nil {
+		return "", err
+	}
+
+	return dgst, nil
+}
+
+// readContext read the regular files and directories of the build context.
+func readContext(buildContext io.ReadSeeker) (map[string]*contextFile, error) {
+	if _, err := buildContext.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	files := make(map[string]*contextFile)
+	tr := tar.NewReader(buildContext)
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return files, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		switch header.Typeflag {
+		case tar.TypeDir:
+			files[name] = &contextFile{header: header}
+		case tar.TypeReg:
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return nil, err
+			}
+			files[name] = &contextFile{header: header, data: data}
+		}
+	}
+}
+
+// apply change the config for the instruction, ADD and COPY return the layer of the files they add.
+func apply(config *ocispec.Image, inst instruction, files map[string]*contextFile) ([]byte, error) {
+	switch inst.command {
+	case "ADD", "COPY":
+		return addFiles(config, inst, files)
+	case "LABEL":
+		pairs, err := keyValues(inst)
+		if err != nil {
+			return nil, err
+		}
+		if config.Config.Labels == nil {
+			config.Config.Labels = make(map[string]string)
+		}
+		for _, kv := range pairs {
+			config.Config.Labels[kv[0]] = kv[1]
+		}
+	case "ENV":
+		pairs, err := keyValues(inst)
+		if err != nil {
+			return nil, err
+		}
+		for _, kv := range pairs {
+			config.Config.Env = setEnv(config.Config.Env, kv[0], kv[1])
+		}
+	case "WORKDIR":
+		config.Config.WorkingDir = resolvePath(config.Config.WorkingDir, inst.args[0])
+	case "USER":
+		config.Config.User = inst.args[0]
+	case "CMD":
+		config.Config.Cmd = command(inst)
+	case "ENTRYPOINT":
+		config.Config.Entrypoint = command(inst)
+		// docker resets CMD when ENTRYPOINT is set
+		config.Config.Cmd = nil
+	case "EXPOSE":
+		if config.Config.ExposedPorts == nil {
+			config.Config.ExposedPorts = make(map[string]struct{})
+		}
+		for _, port := range inst.args {
+			if !strings.Contains(port, "/") {
+				port += "/tcp"
+			}
+			config.Config.ExposedPorts[port] = struct{}{}
+		}
+	}
+
+	return nil, nil
+}
+
+// addFiles build the layer of ADD and COPY, tar archives are extracted by ADD.
+func addFiles(config *ocispec.Image, inst instruction, files map[string]*contextFile) ([]byte, error) {
+	args := inst.args
+	uid, gid := 0, 0
+	for len(args) > 0 && strings.HasPrefix(args[0], "--") {
+		if !strings.HasPrefix(args[0], "--chown=") {
+			return nil, errors.Wrap(ErrUnsupported, inst.command+" "+args[0])
+		}
+		var err error
+		if uid, gid, err = parseChown(strings.TrimPrefix(args[0], "--chown=")); err != nil {
+			return nil, err
+		}
+		args = args[1:]
+	}
+	if len(args) < 2 {
+		return nil, errors.Errorf("%s needs a source and a destination", inst.command)
+	}
+
+	sources, dest := args[:len(args)-1], resolvePath(config.Config.WorkingDir, args[len(args)-1])
+	toDir := strings.HasSuffix(args[len(args)-1], "/") || len(sources) > 1
+
+	layer := newLayerWriter()
+	for _, source := range sources {
+		if strings.Contains(source, "://") {
+			return nil, errors.Wrap(ErrUnsupported, inst.command+" of an url")
+		}
+		name := path.Clean(strings.TrimPrefix(source, "/"))
+
+		f, ok := files[name]
+		if !ok && name != "." {
+			return nil, errors.Errorf("%s: %s not found in the build context", inst.command, source)
+		}
+
+		if f != nil && f.data != nil {
+			if inst.command == "ADD" {
+				if entries, ok := archive(f.data); ok {
+					if err := layer.extract(entries, dest); err != nil {
+						return nil, err
+					}
+
+					continue
+				}
+			}
+			target := dest
+			if toDir {
+				target = path.Join(dest, path.Base(name))
+			}
+			if err := layer.file(target, f.header, f.data, uid, gid); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		// a directory copies its content
+		for file, f := range files {
+			if f.data == nil {
+				continue
+			}
+			rel := file
+			if name != "." {
+				if !strings.HasPrefix(file, name+"/") {
+					continue
+				}
+				rel = strings.TrimPrefix(file, name+"/")
+			}
+			if err := layer.file(path.Join(dest, rel), f.header, f.data, uid, gid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return layer.close()
+}
+
+// layerWriter write a layer tar, the parent directories of every entry are added first.
+type layerWriter struct {
+	buf  *bytes.Buffer
+	tw   *tar.Writer
+	dirs map[string]bool
+}
+
+func newLayerWriter() *layerWriter {
+	buf := &bytes.Buffer{}
+
+	return &layerWriter{buf: buf, tw: tar.NewWriter(buf), dirs: make(map[string]bool)}
+}
+
+func (l *layerWriter) parents(name string) error {
+	dir := path.Dir(name)
+	if dir == "." || dir == "/" || l.dirs[dir] {
+		return nil
+	}
+	if err := l.parents(dir); err != nil {
+		return err
+	}
+	l.dirs[dir] = true
+
+	return l.tw.WriteHeader(&tar.Header{
+		Name:     strings.TrimPrefix(dir, "/") + "/",
+		Mode:     0o755,
+		Typeflag: tar.TypeDir,
+		ModTime:  time.Unix(0, 0),
+	})
+}
+
+func (l *layerWriter) file(name string, header *tar.Header, data []byte, uid int, gid int) error {
+	if err := l.parents(name); err != nil {
+		return err
+	}
+
+	return l.write(&tar.Header{
+		Name:     strings.TrimPrefix(name, "/"),
+		Mode:     header.Mode,
+		Size:     int64(len(data)),
+		Uid:      uid,
+		Gid:      gid,
+		ModTime:  header.ModTime,
+		Typeflag: tar.TypeReg,
+	}, data)
+}
+
+// extract add the archive entries under the directory, their owners and modes are kept.
+func (l *layerWriter) extract(entries []*contextFile, dir string) error {
+	for _, entry := range entries {
+		header := *entry.header
+		name := path.Join(dir, path.Clean("/"+header.Name))
+		header.Name = strings.TrimPrefix(name, "/")
+		if header.Typeflag == tar.TypeLink {
+			header.Linkname = strings.TrimPrefix(path.Join(dir, path.Clean("/"+header.Linkname)), "/")
+		}
+		if err := l.parents(name); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeDir {
+			if l.dirs[name] {
+				continue
+			}
+			l.dirs[name] = true
+			header.Name += "/"
+		}
+		if err := l.write(&header, entry.data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (l *layerWriter) write(header *tar.Header, data []byte) error {
+	if err := l.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	_, err := l.tw.Write(data)
+
+	return err
+}
+
+func (l *layerWriter) close() ([]byte, error) {
+	if err := l.tw.Close(); err != nil {
+		return nil, err
+	}
+
+	return l.buf.Bytes(), nil
+}
+
+// archive read the entries of a tar, gzip compressed or not, it reports false for other files.
+func archive(data []byte) ([]*contextFile, bool) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, false
+	}
+
+	var entries []*contextFile
+	tr := tar.NewReader(bytes.NewReader(data))
+	for {
+		header, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return entries, len(entries) > 0
+		}
+		if err != nil {
+			return nil, false
+		}
+		content, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, false
+		}
+		entries = append(entries, &contextFile{header: header, data: content})
+	}
+}
+
+// decompress the gzip or zstd compressed data, other data is returned as is.
+func decompress(data []byte) ([]byte, error) {
+	switch {
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer reader.Close()
+
+		return ioutil.ReadAll(reader)
+	case bytes.HasPrefix(data, []byte{0x28, 0xb5, 0x2f, 0xfd}):
+		decoder, err := zstd.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer decoder.Close()
+
+		return ioutil.ReadAll(decoder)
+	}
+
+	return data, nil
+}
+
+func parseChown(chown string) (int, int, error) {
+	fields := strings.SplitN(chown, ":", 2)
+	uid, err := strconv.Atoi(fields[0])
+	if err != nil {
+		return 0, 0, errors.Wrap(ErrUnsupported, "--chown by name")
+	}
+	gid := uid
+	if len(fields) == 2 {
+		if gid, err = strconv.Atoi(fields[1]); err != nil {
+			return 0, 0, errors.Wrap(ErrUnsupported, "--chown by name")
+		}
+	}
+
+	return uid, gid, nil
+}
+
+// command return the exec form of CMD and ENTRYPOINT, the shell form is run by /bin/sh.
+func command(inst instruction) []string {
+	if inst.json {
+		return inst.args
+	}
+
+	return []string{"/bin/sh", "-c", inst.raw}
+}
+
+func setEnv(env []string, key string, value string) []string {
+	for i, e := range env {
+		if strings.HasPrefix(e, key+"=") {
+			env[i] = key + "=" + value
+
+			return env
+		}
+	}
+
+	return append(env, key+"="+value)
+}
+
+// resolvePath resolve the path against the working directory.
+func resolvePath(workdir string, p string) string {
+	if path.IsAbs(p) {
+		return path.Clean(p)
+	}
+	if workdir == "" {
+		workdir = "/"
+	}
+
+	return path.Join(workdir, p)
+}
+
+func shortID(dgst digest.Digest) string {
+	id := dgst.Encoded()
+	if len(id) > 12 {
+		id = id[:12]
+	}
+
+	return id
+}
+
+func now() *time.Time {
+	t := time.Now().UTC()
+
+	return &t
+}
@@ -0,0 +1,177 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+
+	"github.com/marmotedu/errors"
+)
+
+var ErrUnsupported = errors.New("dockerfile instruction is not supported without docker")
+
+// instruction is a line of the dockerfile, continuation lines joined.
+type instruction struct {
+	command string
+	// args are the words of the line, or the elements of its JSON array form
+	args []string
+	// raw is the line after the command
+	raw string
+	// json report whether args are given as a JSON array
+	json bool
+}
+
+// String return the instruction as written.
+func (i instruction) String() string {
+	return i.command + " " + i.raw
+}
+
+// parseDockerfile parse the dockerfile of a single stage, the instructions which run commands in the image
+// are refused, they need a container runtime.
+func parseDockerfile(r io.Reader) ([]instruction, error) {
+	var instructions []instruction
+	var line string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		text := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(text, "#") || (text == "" && line == "") {
+			continue
+		}
+		if strings.HasSuffix(text, "\\") {
+			line += strings.TrimSuffix(text, "\\") + " "
+
+			continue
+		}
+		line += text
+
+		inst, err := parseInstruction(line)
+		if err != nil {
+			return nil, err
+		}
+		instructions = append(instructions, inst)
+		line = ""
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(line) != "" {
+		return nil, errors.Errorf("dockerfile ends with a continuation line")
+	}
+
+	if len(instructions) == 0 || instructions[0].command != "FROM" {
+		return nil, errors.New("dockerfile must start with FROM")
+	}
+
+	for _, inst := range instructions[1:] {
+		switch inst.command {
+		case "ADD", "COPY", "LABEL", "ENV", "WORKDIR", "USER", "CMD", "ENTRYPOINT", "EXPOSE":
+		case "FROM":
+			return nil, errors.Wrap(ErrUnsupported, "multi-stage build")
+		default:
+			return nil, errors.Wrap(ErrUnsupported, inst.command)
+		}
+	}
+
+	return instructions, nil
+}
+
+func parseInstruction(line string) (instruction, error) {
+	fields := strings.SplitN(strings.TrimSpace(line), " ", 2)
+	inst := instruction{command: strings.ToUpper(fields[0])}
+	if len(fields) < 2 || strings.TrimSpace(fields[1]) == "" {
+		return inst, errors.Errorf("%s has no arguments", inst.command)
+	}
+	inst.raw = strings.TrimSpace(fields[1])
+
+	if strings.HasPrefix(inst.raw, "[") {
+		if err := json.Unmarshal([]byte(inst.raw), &inst.args); err == nil {
+			inst.json = true
+
+			return inst, nil
+		}
+	}
+
+	args, err := words(inst.raw)
+	if err != nil {
+		return inst, errors.Wrap(err, inst.command)
+	}
+	inst.args = args
+
+	return inst, nil
+}
+
+// words split the arguments on white spaces, quotes group words and are removed, a backslash escapes
+// the next character.
+func words(s string) ([]string, error) {
+	var result []string
+	var word strings.Builder
+	inWord := false
+	var quote rune
+	escaped := false
+
+	for _, c := range s {
+		switch {
+		case escaped:
+			word.WriteRune(c)
+			escaped = false
+		case c == '\\' && quote != '\'':
+			escaped = true
+			inWord = true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				word.WriteRune(c)
+			}
+		case c == '"' || c == '\'':
+			quote = c
+			inWord = true
+		case c == ' ' || c == '\t':
+			if inWord {
+				result = append(result, word.String())
+				word.Reset()
+				inWord = false
+			}
+		default:
+			word.WriteRune(c)
+			inWord = true
+		}
+	}
+	if quote != 0 {
+		return nil, errors.New("unterminated quote")
+	}
+	if inWord {
+		result = append(result, word.String())
+	}
+
+	return result, nil
+}
+
+// keyValues parse the KEY=VALUE pairs of LABEL and ENV, the legacy `KEY VALUE` form included.
+func keyValues(inst instruction) ([][2]string, error) {
+	if len(inst.args) > 0 && !strings.Contains(inst.args[0], "=") {
+		if len(inst.args) < 2 {
+			return nil, errors.Errorf("%s needs a value", inst)
+		}
+		fields := strings.SplitN(inst.raw, " ", 2)
+
+		return [][2]string{{inst.args[0], strings.TrimSpace(fields[1])}}, nil
+	}
+
+	pairs := make([][2]string, 0, len(inst.args))
+	for _, arg := range inst.args {
+		kv := strings.SplitN(arg, "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			return nil, errors.Errorf("%s: invalid %q", inst.command, arg)
+		}
+		pairs = append(pairs, [2]string{kv[0], kv[1]})
+	}
+
+	return pairs, nil
+}
@@ -0,0 +1,60 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package builder
+
+import (
+	"archive/tar"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+const elfMagic = "\x7fELF"
+
+// elfMachines map the ELF machine to the architecture of the binary.
+var elfMachines = map[uint16]string{
+	0x03: "386",
+	0x28: "arm",
+	0x3e: "amd64",
+	0xb7: "arm64",
+	0x15: "ppc64le",
+	0x16: "s390x",
+	0xf3: "riscv64",
+}
+
+// BinaryArchs find the architectures of the ELF binaries in the build context, the chaincode package
+// tars in it are searched too.
+func BinaryArchs(buildContext io.Reader, archs map[string]bool) {
+	tr := tar.NewReader(buildContext)
+	for {
+		header, err := tr.Next()
+		if err != nil {
+			return
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if strings.HasSuffix(header.Name, ".tar") {
+			BinaryArchs(tr, archs)
+
+			continue
+		}
+
+		head := make([]byte, 20)
+		if _, err := io.ReadFull(tr, head); err != nil || string(head[:4]) != elfMagic {
+			continue
+		}
+
+		var machine uint16
+		if head[5] == 2 {
+			machine = binary.BigEndian.Uint16(head[18:])
+		} else {
+			machine = binary.LittleEndian.Uint16(head[18:])
+		}
+		if arch, ok := elfMachines[machine]; ok {
+			archs[arch] = true
+		}
+	}
+}
@@ -0,0 +1,271 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package bundle reads and writes air-gapped bundles, a tar archive of docker saved images
+// described by a signed manifest.
+package bundle
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"time"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+const (
+	// ManifestFile is the first entry of the bundle.
+	ManifestFile = "manifest.json"
+	// SignatureFile holds the base64 signature of the manifest, it is compatible with `cosign verify-blob`.
+	SignatureFile = "manifest.json.sig"
+
+	ROLE_CHAINCODE = "chaincode"
+	ROLE_BASE      = "base"
+	ROLE_PULLER    = "puller"
+
+	version = 1
+)
+
+var (
+	ErrInvalidBundle = errors.New("invalid bundle")
+	ErrUnsigned      = errors.New("bundle is not signed")
+)
+
+// Image is a docker saved image in the bundle.
+type Image struct {
+	Name   string        `json:"name"`
+	Role   string        `json:"role"`
+	File   string        `json:"file"`
+	Digest digest.Digest `json:"digest"`
+	Size   int64         `json:"size"`
+}
+
+// Manifest describe the images of the bundle.
+type Manifest struct {
+	Version int       `json:"version"`
+	Created time.Time `json:"created"`
+	Images  []Image   `json:"images"`
+}
+
+// Source is an image to export.
+type Source struct {
+	Name string
+	Role string
+	// Open return the docker save tar of the image
+	Open func() (io.ReadCloser, error)
+}
+
+// Export write the images into the bundle, the manifest is signed when the signer has a private key.
+// the images are spooled into a temporary directory, so their digests are listed before them.
+func Export(w io.Writer, sources []Source, signer *signature.Signer) (*Manifest, error) {
+	dir, err := ioutil.TempDir("", "peitho-bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest := &Manifest{Version: version, Created: time.Now().UTC(), Images: make([]Image, 0, len(sources))}
+	for i, source := range sources {
+		image := Image{Name: source.Name, Role: source.Role, File: fmt.Sprintf("images/%d.tar", i)}
+		if image.Digest, image.Size, err = spool(source, path.Join(dir, path.Base(image.File))); err != nil {
+			log.Errorf("save %s failed: %v", source.Name, err)
+
+			return nil, err
+		}
+		manifest.Images = append(manifest.Images, image)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+
+	tw := tar.NewWriter(w)
+	if err := writeFile(tw, ManifestFile, data); err != nil {
+		return nil, err
+	}
+
+	if signer.CanSign() {
+		sig, err := signer.SignBlob(data)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeFile(tw, SignatureFile, []byte(sig)); err != nil {
+			return nil, err
+		}
+	} else {
+		log.Warn("signing key is not configured, the bundle is not signed")
+	}
+
+	for _, image := range manifest.Images {
+		if err := copyFile(tw, image.File, path.Join(dir, path.Base(image.File)), image.Size); err != nil {
+			return nil, err
+		}
+	}
+
+	return manifest, tw.Close()
+}
+
+// Import read the bundle, verify its manifest and the digest of every image, then hand each image to load
+// in the bundle order. the signature is required when the signer has a verifying key.
+func Import(r io.Reader, signer *signature.Signer, load func(image Image, content io.Reader) error) (*Manifest, error) {
+	dir, err := ioutil.TempDir("", "peitho-bundle")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(dir)
+
+	tr := tar.NewReader(r)
+
+	header, err := tr.Next()
+	if err != nil || header.Name != ManifestFile {
+		return nil, ErrInvalidBundle
+	}
+	data, err := ioutil.ReadAll(tr)
+	if err != nil {
+		return nil, err
+	}
+
+	manifest := &Manifest{}
+	if err := json.Unmarshal(data, manifest); err != nil || manifest.Version != version {
+		return nil, ErrInvalidBundle
+	}
+
+	header, err = tr.Next()
+	if err != nil {
+		return nil, ErrInvalidBundle
+	}
+
+	if header.Name == SignatureFile {
+		sig, readErr := ioutil.ReadAll(tr)
+		if readErr != nil {
+			return nil, readErr
+		}
+		if signer.Enabled() {
+			if err := signer.VerifyBlob(data, string(sig)); err != nil {
+				return nil, err
+			}
+			log.Info("bundle signature is verified")
+		}
+		if header, err = tr.Next(); err != nil && err != io.EOF {
+			return nil, ErrInvalidBundle
+		}
+	} else if signer.Enabled() {
+		return nil, ErrUnsigned
+	}
+
+	images := make(map[string]Image, len(manifest.Images))
+	for _, image := range manifest.Images {
+		images[image.File] = image
+	}
+
+	for ; header != nil; header, err = tr.Next() {
+		image, ok := images[header.Name]
+		if !ok {
+			log.Errorf("%s is not listed in the bundle manifest", header.Name)
+
+			return nil, ErrInvalidBundle
+		}
+		delete(images, header.Name)
+
+		if err := verify(image, tr, path.Join(dir, path.Base(image.File)), load); err != nil {
+			return nil, err
+		}
+	}
+	if err != io.EOF {
+		return nil, err
+	}
+
+	if len(images) != 0 {
+		log.Errorf("bundle misses %d images of the manifest", len(images))
+
+		return nil, ErrInvalidBundle
+	}
+
+	return manifest, nil
+}
+
+// spool copy the docker save tar of the source into the file, return its digest and size.
+func spool(source Source, file string) (digest.Digest, int64, error) {
+	content, err := source.Open()
+	if err != nil {
+		return "", 0, err
+	}
+	defer content.Close()
+
+	f, err := os.Create(file)
+	if err != nil {
+		return "", 0, err
+	}
+	defer f.Close()
+
+	digester := digest.Canonical.Digester()
+	size, err := io.Copy(io.MultiWriter(f, digester.Hash()), content)
+	if err != nil {
+		return "", 0, err
+	}
+
+	return digester.Digest(), size, nil
+}
+
+// verify spool the image into the file and check its digest before loading it.
+func verify(image Image, content io.Reader, file string, load func(image Image, content io.Reader) error) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		f.Close()
+		os.Remove(file)
+	}()
+
+	digester := digest.Canonical.Digester()
+	if _, err := io.Copy(io.MultiWriter(f, digester.Hash()), content); err != nil {
+		return err
+	}
+	if digester.Digest() != image.Digest {
+		log.Errorf("digest of %s is %s, want %s", image.Name, digester.Digest(), image.Digest)
+
+		return ErrInvalidBundle
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	return load(image, f)
+}
+
+func writeFile(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: int64(len(data)), Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+
+	return err
+}
+
+func copyFile(tw *tar.Writer, name string, file string, size int64) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if err := tw.WriteHeader(&tar.Header{Name: name, Mode: 0o644, Size: size, Typeflag: tar.TypeReg}); err != nil {
+		return err
+	}
+	_, err = io.Copy(tw, f)
+
+	return err
+}
@@ -0,0 +1,135 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+	"github.com/tianrandailove/peitho/pkg/signature"
+)
+
+// newTestSigners return a signer with a private key and a verifier with its public key.
+func newTestSigners(t *testing.T) (*signature.Signer, *signature.Signer) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	signer, _ := signature.NewSigner(&options.SigningOption{Key: keyPath})
+	verifier, _ := signature.NewSigner(&options.SigningOption{PublicKey: pubPath})
+
+	return signer, verifier
+}
+
+func source(name string, role string, content string) Source {
+	return Source{Name: name, Role: role, Open: func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(strings.NewReader(content)), nil
+	}}
+}
+
+func export(t *testing.T, signer *signature.Signer) []byte {
+	buf := &bytes.Buffer{}
+	_, err := Export(buf, []Source{
+		source("mycc:latest", ROLE_CHAINCODE, "chaincode"),
+		source("hyperledger/fabric-ccenv:2.2", ROLE_BASE, "ccenv"),
+		source("puller:latest", ROLE_PULLER, "puller"),
+	}, signer)
+	if err != nil {
+		t.Fatalf("Export() error = %v", err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestImport(t *testing.T) {
+	signer, verifier := newTestSigners(t)
+	_, other := newTestSigners(t)
+	unsigned, _ := signature.NewSigner(&options.SigningOption{})
+
+	tests := []struct {
+		name     string
+		bundle   []byte
+		verifier *signature.Signer
+		wantErr  error
+	}{
+		{name: "signed", bundle: export(t, signer), verifier: verifier},
+		{name: "verification disabled", bundle: export(t, signer), verifier: unsigned},
+		{name: "unsigned", bundle: export(t, unsigned), verifier: verifier, wantErr: ErrUnsigned},
+		{name: "other key", bundle: export(t, signer), verifier: other, wantErr: signature.ErrInvalidSignature},
+		{
+			name:     "tampered image",
+			bundle:   bytes.Replace(export(t, unsigned), []byte("ccenv\x00"), []byte("CCENV\x00"), 1),
+			verifier: unsigned,
+			wantErr:  ErrInvalidBundle,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			loaded := make(map[string]string)
+			manifest, err := Import(bytes.NewReader(tt.bundle), tt.verifier, func(image Image, content io.Reader) error {
+				data, _ := ioutil.ReadAll(content)
+				loaded[image.Role] = string(data)
+
+				return nil
+			})
+			if err != tt.wantErr {
+				t.Fatalf("Import() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			if len(manifest.Images) != 3 || loaded[ROLE_CHAINCODE] != "chaincode" ||
+				loaded[ROLE_BASE] != "ccenv" || loaded[ROLE_PULLER] != "puller" {
+				t.Errorf("Import() loaded %v, manifest %+v", loaded, manifest)
+			}
+		})
+	}
+}
+
+func TestImport_missingImage(t *testing.T) {
+	data := export(t, nil)
+
+	// drop the last image of the bundle
+	buf := &bytes.Buffer{}
+	tr := tar.NewReader(bytes.NewReader(data))
+	tw := tar.NewWriter(buf)
+	for header, err := tr.Next(); err == nil; header, err = tr.Next() {
+		if header.Name == "images/2.tar" {
+			continue
+		}
+		_ = tw.WriteHeader(header)
+		_, _ = io.Copy(tw, tr)
+	}
+	tw.Close()
+
+	if _, err := Import(buf, nil, func(Image, io.Reader) error { return nil }); err != ErrInvalidBundle {
+		t.Errorf("Import() error = %v, want %v", err, ErrInvalidBundle)
+	}
+}
@@ -0,0 +1,88 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+// Package chaincode reconciles the Chaincode resources into their deployments, tls secrets and services,
+// so the resources edited by kubectl or GitOps tools take effect, and hands the server mode chaincodes
+// over to their new versions without downtime.
+package chaincode
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+type Controller struct {
+	option *options.ChaincodeCRDOption
+	k8s    k8s.K8sService
+	ch     chan struct{}
+	stop   sync.Once
+}
+
+func NewController(k8s k8s.K8sService, option *options.ChaincodeCRDOption) *Controller {
+	return &Controller{
+		option: option,
+		k8s:    k8s,
+		ch:     make(chan struct{}),
+	}
+}
+
+// Start reconcile the chaincode resources every interval until ctx is done or it is stopped.
+func (c *Controller) Start(ctx context.Context) {
+	if !c.option.Enable {
+		return
+	}
+	log.Info("starting chaincode controller")
+
+	ticker := time.NewTicker(time.Duration(c.option.Interval) * time.Second)
+	defer ticker.Stop()
+
+	for {
+		c.reconcile(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			log.Info("chaincode controller stopped")
+
+			return
+		case <-c.ch:
+			log.Info("chaincode controller stopped")
+
+			return
+		}
+	}
+}
+
+// Stop stop the controller, it can be called more than once.
+func (c *Controller) Stop() {
+	c.stop.Do(func() {
+		close(c.ch)
+	})
+}
+
+// reconcile reconcile every chaincode resource, a failed one is reported in its status and retried next time,
+// then the server mode chaincodes are handed over to their new versions.
+func (c *Controller) reconcile(ctx context.Context) {
+	start := time.Now()
+	chaincodes, err := c.k8s.ListChaincodeResources(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, cc := range chaincodes {
+		if ctx.Err() != nil {
+			return
+		}
+		_ = c.k8s.ReconcileChaincodeResource(ctx, cc.Name)
+	}
+
+	if ctx.Err() == nil {
+		c.handoff(ctx, start)
+	}
+}
@@ -0,0 +1,56 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import (
+	"context"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/marmotedu/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func TestController_Start(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	option := options.NewChaincodeCRDOption()
+	option.Enable = true
+	c := NewController(k8sSrv, option)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+		{ObjectMeta: metav1.ObjectMeta{Name: "broken"}},
+		{ObjectMeta: metav1.ObjectMeta{Name: "mycc"}},
+	}, nil)
+	// a failed chaincode does not stop the others
+	gomock.InOrder(
+		k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, "broken").Return(errors.New("tls secret not found")),
+		k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, "mycc").DoAndReturn(func(context.Context, string) error {
+			cancel()
+
+			return nil
+		}),
+	)
+
+	c.Start(ctx)
+}
+
+func TestController_Start_disabled(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	defer ctrl.Finish()
+
+	// the chaincode resources are not listed without the CRD
+	c := NewController(k8s.NewMockK8sService(ctrl), options.NewChaincodeCRDOption())
+	c.Start(context.Background())
+	c.Stop()
+	c.Stop()
+}
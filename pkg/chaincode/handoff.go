@@ -0,0 +1,139 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// handoff hand the server mode chaincodes over to their new versions, now is when the reconcile started.
+// A new version for the same chaincode name and peer is brought up beside the previous ones, they are retired
+// only when it has been ready since a former reconcile, so the chaincode is served all along. A new version
+// starting for longer than the readiness timeout is rolled back to the previous image, the previous version
+// keeps serving until it is ready.
+func (c *Controller) handoff(ctx context.Context, now time.Time) {
+	chaincodes, err := c.k8s.ListChaincodeResources(ctx)
+	if err != nil {
+		return
+	}
+
+	for _, versions := range serverModeVersions(chaincodes) {
+		if ctx.Err() != nil {
+			return
+		}
+		if len(versions) < 2 {
+			continue
+		}
+
+		incoming, previous := versions[len(versions)-1], versions[:len(versions)-1]
+		switch incoming.Status.Phase {
+		case v1alpha1.PHASE_RUNNING:
+			// a version ready for a moment, like one crashing after its first connection, is not trusted yet
+			if since := incoming.Status.ReadySince; since != nil && since.Time.Before(now) {
+				c.retire(ctx, incoming, previous)
+			}
+		case v1alpha1.PHASE_STARTING:
+			// the time waiting for the tls secret does not count, the new version was not started
+			timeout := time.Duration(c.option.ReadinessTimeout) * time.Second
+			started := incoming.Status.StartedAt
+			if started != nil && now.Sub(started.Time) > timeout && incoming.Annotations[k8s.AnnotationRolledBack] == "" {
+				c.rollback(ctx, incoming, serving(previous))
+			}
+		default:
+			// the new version waits for its tls secret, or its reconcile failed and is retried, it is not failing
+		}
+	}
+}
+
+// serverModeVersions return the versions of every server mode chaincode by chaincode name and peer,
+// the newest last. The chaincodes without the name or peer labels can not be told apart and are left alone.
+func serverModeVersions(chaincodes []v1alpha1.Chaincode) map[string][]v1alpha1.Chaincode {
+	result := make(map[string][]v1alpha1.Chaincode)
+	for _, cc := range chaincodes {
+		name, peer := cc.Labels[k8s.LabelChaincodeName], cc.Labels[k8s.LabelPeerID]
+		if cc.Spec.Port <= 0 || name == "" || peer == "" || cc.DeletionTimestamp != nil {
+			continue
+		}
+		key := peer + "/" + name
+		result[key] = append(result[key], cc)
+	}
+
+	for _, versions := range result {
+		sort.Slice(versions, func(i, j int) bool {
+			ti, tj := versions[i].CreationTimestamp, versions[j].CreationTimestamp
+			if ti.Equal(&tj) {
+				return versions[i].Name < versions[j].Name
+			}
+
+			return ti.Before(&tj)
+		})
+	}
+
+	return result
+}
+
+// serving return the newest running previous version, or the newest one if none is running.
+func serving(previous []v1alpha1.Chaincode) v1alpha1.Chaincode {
+	for i := len(previous) - 1; i >= 0; i-- {
+		if previous[i].Status.Phase == v1alpha1.PHASE_RUNNING {
+			return previous[i]
+		}
+	}
+
+	return previous[len(previous)-1]
+}
+
+// retire delete the previous versions with their deployments, the new version is ready to serve.
+func (c *Controller) retire(ctx context.Context, incoming v1alpha1.Chaincode, previous []v1alpha1.Chaincode) {
+	events := c.k8s.EventRecorder()
+	for _, cc := range previous {
+		if err := c.k8s.DeleteChaincodeDeployment(ctx, cc.Name); err != nil {
+			log.Errorf("retire chaincode %s failed: %v", cc.Name, err)
+
+			continue
+		}
+		log.Infof("chaincode %s is handed off to %s, retired", cc.Name, incoming.Name)
+		events.Eventf(cc.Name, v1.EventTypeNormal, k8s.REASON_RETIRED, "handed off to %s", incoming.Name)
+		events.Eventf(incoming.Name, v1.EventTypeNormal, k8s.REASON_HANDED_OFF, "%s is retired", cc.Name)
+	}
+}
+
+// rollback run the new version with the image of the previous one, which is handed off to it once it is ready.
+// The env of the new version is kept, it is the chaincode id the peer connects to.
+func (c *Controller) rollback(ctx context.Context, incoming v1alpha1.Chaincode, previous v1alpha1.Chaincode) {
+	log.Warnf("chaincode %s is not ready in %ds, roll it back to %s of %s",
+		incoming.Name, c.option.ReadinessTimeout, previous.Spec.Image, previous.Name)
+
+	spec := incoming.Spec
+	spec.Image = previous.Spec.Image
+	spec.Command = previous.Spec.Command
+	spec.PullSecrets = previous.Spec.PullSecrets
+	spec.Archs = previous.Spec.Archs
+	spec.Puller = previous.Spec.Puller
+	cc := &v1alpha1.Chaincode{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        incoming.Name,
+			Annotations: map[string]string{k8s.AnnotationRolledBack: previous.Name},
+		},
+		Spec: spec,
+	}
+	if err := c.k8s.ApplyChaincodeResource(ctx, cc); err != nil {
+		return
+	}
+
+	c.k8s.EventRecorder().Eventf(incoming.Name, v1.EventTypeWarning, k8s.REASON_ROLLED_BACK,
+		"%s not ready in %ds, rolled back to %s of %s",
+		incoming.Spec.Image, c.option.ReadinessTimeout, previous.Spec.Image, previous.Name)
+	_ = c.k8s.ReconcileChaincodeResource(ctx, cc.Name)
+}
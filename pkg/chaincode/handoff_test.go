@@ -0,0 +1,194 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package chaincode
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+var start = time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+func version(name string, image string, created time.Time, phase string) v1alpha1.Chaincode {
+	var startedAt, readySince *metav1.Time
+	if phase != v1alpha1.PHASE_PENDING {
+		started := metav1.NewTime(created)
+		startedAt = &started
+	}
+	if phase == v1alpha1.PHASE_RUNNING {
+		since := metav1.NewTime(created.Add(time.Minute))
+		readySince = &since
+	}
+
+	return v1alpha1.Chaincode{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:              name,
+			CreationTimestamp: metav1.NewTime(created),
+			Labels: map[string]string{
+				k8s.LabelChaincodeName: "mycc",
+				k8s.LabelPeerID:        "peer0-org1",
+			},
+		},
+		Spec:   v1alpha1.ChaincodeSpec{Image: image, Port: 9999},
+		Status: v1alpha1.ChaincodeStatus{Phase: phase, StartedAt: startedAt, ReadySince: readySince},
+	}
+}
+
+func newHandoff(t *testing.T) (*Controller, *k8s.MockK8sService, *record.FakeRecorder) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	recorder := record.NewFakeRecorder(10)
+	k8sSrv.EXPECT().EventRecorder().Return(k8s.NewEventRecorder(recorder, "fabric")).AnyTimes()
+	option := options.NewChaincodeCRDOption()
+	option.Enable = true
+
+	return NewController(k8sSrv, option), k8sSrv, recorder
+}
+
+func TestController_handoff_retire(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, recorder := newHandoff(t)
+
+	// the previous versions are retired when the new one is ready, other chaincodes are left alone
+	other := version("othercc-1-0", "othercc:1.0", start, v1alpha1.PHASE_RUNNING)
+	other.Labels[k8s.LabelChaincodeName] = "othercc"
+	client := version("mycc-client", "mycc:0.9", start, v1alpha1.PHASE_RUNNING)
+	client.Spec.Port = 0
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+		version("mycc-1-1", "mycc:1.1", start.Add(2*time.Hour), v1alpha1.PHASE_RUNNING),
+		version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING),
+		other,
+		client,
+	}, nil)
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "mycc-1-0").Return(nil)
+
+	c.handoff(ctx, start.Add(3*time.Hour))
+
+	if event := <-recorder.Events; event != "Normal Retired handed off to mycc-1-1" {
+		t.Errorf("event = %q", event)
+	}
+}
+
+func TestController_handoff_justReady(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, _ := newHandoff(t)
+
+	// the new version became ready in this reconcile, the previous one is retired by the next one
+	incoming := version("mycc-1-1", "mycc:1.1", start.Add(time.Hour), v1alpha1.PHASE_RUNNING)
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+		version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING),
+		incoming,
+	}, nil).Times(2)
+
+	c.handoff(ctx, incoming.Status.ReadySince.Time)
+
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "mycc-1-0").Return(nil)
+	c.handoff(ctx, incoming.Status.ReadySince.Add(30*time.Second))
+}
+
+func TestController_handoff_rollback(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, recorder := newHandoff(t)
+
+	previous := version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING)
+	incoming := version("mycc-1-1", "mycc:1.1", start.Add(time.Hour), v1alpha1.PHASE_STARTING)
+	incoming.Spec.Env = []string{"CORE_CHAINCODE_ID_NAME=mycc:1.1"}
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{previous, incoming}, nil).Times(2)
+
+	// the new version has time to become ready
+	c.handoff(ctx, start.Add(time.Hour+time.Minute))
+
+	// it is run with the previous image and its own env, the previous version keeps serving until it is ready
+	gomock.InOrder(
+		k8sSrv.EXPECT().ApplyChaincodeResource(ctx, gomock.Any()).DoAndReturn(func(_ context.Context, cc *v1alpha1.Chaincode) error {
+			if cc.Name != "mycc-1-1" || cc.Spec.Image != "mycc:1.0" || cc.Spec.Env[0] != "CORE_CHAINCODE_ID_NAME=mycc:1.1" ||
+				cc.Annotations[k8s.AnnotationRolledBack] != "mycc-1-0" {
+				t.Errorf("rolled back chaincode %s image %s annotations %v", cc.Name, cc.Spec.Image, cc.Annotations)
+			}
+
+			return nil
+		}),
+		k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, "mycc-1-1").Return(nil),
+	)
+	c.handoff(ctx, start.Add(time.Hour+10*time.Minute))
+
+	if event := <-recorder.Events; event != "Warning RolledBack mycc:1.1 not ready in 300s, rolled back to mycc:1.0 of mycc-1-0" {
+		t.Errorf("event = %q", event)
+	}
+}
+
+func TestController_handoff_rolledBackReady(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, recorder := newHandoff(t)
+
+	// the new version ready with the previous image takes over from the previous version
+	rolledBack := version("mycc-1-1", "mycc:1.0", start.Add(time.Hour), v1alpha1.PHASE_RUNNING)
+	rolledBack.Annotations = map[string]string{k8s.AnnotationRolledBack: "mycc-1-0"}
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+		version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING),
+		rolledBack,
+	}, nil)
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "mycc-1-0").Return(nil)
+
+	c.handoff(ctx, start.Add(2*time.Hour))
+
+	if event := <-recorder.Events; event != "Normal Retired handed off to mycc-1-1" {
+		t.Errorf("event = %q", event)
+	}
+}
+
+func TestController_handoff_waiting(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, _ := newHandoff(t)
+
+	// a new version waiting for its tls secret, failing a reconcile for a moment, or rolled back already,
+	// is not rolled back
+	rolledBack := version("mycc-1-2", "mycc:1.2", start.Add(time.Hour), v1alpha1.PHASE_STARTING)
+	rolledBack.Annotations = map[string]string{k8s.AnnotationRolledBack: "mycc-1-0"}
+	for _, incoming := range []v1alpha1.Chaincode{
+		version("mycc-1-1", "mycc:1.1", start.Add(time.Hour), v1alpha1.PHASE_PENDING),
+		version("mycc-1-1", "mycc:1.1", start.Add(time.Hour), v1alpha1.PHASE_FAILED),
+		rolledBack,
+	} {
+		k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+			version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING),
+			incoming,
+		}, nil)
+
+		c.handoff(ctx, start.Add(2*time.Hour))
+	}
+}
+
+func TestController_handoff_startedLate(t *testing.T) {
+	ctx := context.Background()
+	c, k8sSrv, _ := newHandoff(t)
+
+	// the new version waited for its tls secret for longer than the timeout, it is started just now
+	incoming := version("mycc-1-1", "mycc:1.1", start.Add(time.Hour), v1alpha1.PHASE_STARTING)
+	started := metav1.NewTime(start.Add(3 * time.Hour))
+	incoming.Status.StartedAt = &started
+	k8sSrv.EXPECT().ListChaincodeResources(ctx).Return([]v1alpha1.Chaincode{
+		version("mycc-1-0", "mycc:1.0", start, v1alpha1.PHASE_RUNNING),
+		incoming,
+	}, nil).Times(2)
+
+	// it has the whole timeout to become ready
+	c.handoff(ctx, started.Add(time.Minute))
+
+	k8sSrv.EXPECT().ApplyChaincodeResource(ctx, gomock.Any()).Return(nil)
+	k8sSrv.EXPECT().ReconcileChaincodeResource(ctx, "mycc-1-1").Return(nil)
+	c.handoff(ctx, started.Add(6*time.Minute))
+}
@@ -0,0 +1,119 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	NONE = "none"
+	GZIP = "gzip"
+	ZSTD = "zstd"
+)
+
+// Supported reports whether encoding is a known content encoding.
+func Supported(encoding string) bool {
+	return encoding == NONE || encoding == GZIP || encoding == ZSTD
+}
+
+// Negotiate choose a content encoding from the Accept-Encoding header value,
+// preferred encoding is used when the client accepts it, otherwise fallback to
+// any other supported encoding, return NONE if nothing matches.
+func Negotiate(acceptEncoding string, preferred string) string {
+	accepted := make(map[string]bool)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+
+		// q=0 means "not acceptable"
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if v, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = v
+				}
+			}
+		}
+		accepted[name] = q > 0
+	}
+
+	if preferred == NONE || preferred == "" {
+		return NONE
+	}
+
+	if accepted[preferred] {
+		return preferred
+	}
+
+	for _, encoding := range []string{ZSTD, GZIP} {
+		if accepted[encoding] {
+			return encoding
+		}
+	}
+
+	return NONE
+}
+
+// NewWriter wrap w with an encoder of encoding, level 0 means the default level of the encoding.
+func NewWriter(w io.Writer, encoding string, level int) (io.WriteCloser, error) {
+	switch encoding {
+	case GZIP:
+		if level == 0 {
+			level = gzip.DefaultCompression
+		}
+
+		return gzip.NewWriterLevel(w, level)
+	case ZSTD:
+		opts := []zstd.EOption{}
+		if level != 0 {
+			opts = append(opts, zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(level)))
+		}
+
+		return zstd.NewWriter(w, opts...)
+	case NONE, "":
+		return nopWriteCloser{w}, nil
+	}
+
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+// NewReader wrap r with a decoder of encoding.
+func NewReader(r io.Reader, encoding string) (io.ReadCloser, error) {
+	switch strings.ToLower(encoding) {
+	case GZIP:
+		return gzip.NewReader(r)
+	case ZSTD:
+		decoder, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, err
+		}
+
+		return decoder.IOReadCloser(), nil
+	case NONE, "", "identity":
+		return ioutil.NopCloser(r), nil
+	}
+
+	return nil, fmt.Errorf("unsupported encoding: %s", encoding)
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
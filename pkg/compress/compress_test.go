@@ -0,0 +1,67 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package compress
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		preferred      string
+		want           string
+	}{
+		{name: "no accept encoding", acceptEncoding: "", preferred: ZSTD, want: NONE},
+		{name: "preferred accepted", acceptEncoding: "zstd, gzip", preferred: GZIP, want: GZIP},
+		{name: "fallback", acceptEncoding: "gzip", preferred: ZSTD, want: GZIP},
+		{name: "refused by q", acceptEncoding: "zstd;q=0, gzip;q=0.5", preferred: ZSTD, want: GZIP},
+		{name: "compression disabled", acceptEncoding: "zstd, gzip", preferred: NONE, want: NONE},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Negotiate(tt.acceptEncoding, tt.preferred); got != tt.want {
+				t.Errorf("Negotiate() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	content := bytes.Repeat([]byte("peitho chaincode image layer "), 1024)
+
+	for _, encoding := range []string{NONE, GZIP, ZSTD} {
+		t.Run(encoding, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			w, err := NewWriter(buf, encoding, 3)
+			if err != nil {
+				t.Fatalf("NewWriter() error = %v", err)
+			}
+			if _, err := w.Write(content); err != nil {
+				t.Fatalf("Write() error = %v", err)
+			}
+			if err := w.Close(); err != nil {
+				t.Fatalf("Close() error = %v", err)
+			}
+
+			r, err := NewReader(buf, encoding)
+			if err != nil {
+				t.Fatalf("NewReader() error = %v", err)
+			}
+			defer r.Close()
+
+			got, err := ioutil.ReadAll(r)
+			if err != nil {
+				t.Fatalf("ReadAll() error = %v", err)
+			}
+			if !bytes.Equal(got, content) {
+				t.Errorf("content mismatch after %s round trip", encoding)
+			}
+		})
+	}
+}
@@ -0,0 +1,524 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package distribution
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+const (
+	mediaTypeDockerManifest = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeDockerList     = "application/vnd.docker.distribution.manifest.list.v2+json"
+)
+
+var (
+	ErrNotFound     = errors.New("manifest unknown")
+	ErrUnauthorized = errors.New("registry authentication required")
+)
+
+// manifestMediaTypes are accepted when fetching a manifest.
+var manifestMediaTypes = []string{
+	ocispec.MediaTypeImageManifest,
+	mediaTypeDockerManifest,
+	ocispec.MediaTypeImageIndex,
+	mediaTypeDockerList,
+}
+
+// Options defines how the client reaches the registries.
+type Options struct {
+	// Credentials return the username and password of the registry host
+	Credentials func(host string) (string, string)
+	// PlainHTTP report whether the registry host is served over http
+	PlainHTTP func(host string) bool
+	Timeout   time.Duration
+}
+
+// Client talk to registries through the distribution api without a docker daemon.
+type Client struct {
+	httpClient *http.Client
+	options    Options
+
+	lock   sync.Mutex
+	tokens map[string]string
+}
+
+// NewClient new client from options.
+func NewClient(options Options) *Client {
+	if options.Timeout == 0 {
+		options.Timeout = 30 * time.Second
+	}
+
+	return &Client{
+		httpClient: &http.Client{Timeout: options.Timeout},
+		options:    options,
+		tokens:     make(map[string]string),
+	}
+}
+
+// Reference is a parsed image reference.
+type Reference struct {
+	Host       string
+	Repository string
+	// Reference is a tag or a digest
+	Reference string
+}
+
+// ParseReference parse host/repository[:tag|@digest], the tag defaults to latest.
+func ParseReference(ref string) (Reference, error) {
+	i := strings.Index(ref, "/")
+	if i <= 0 {
+		return Reference{}, errors.Errorf("%s has no registry host", ref)
+	}
+	r := Reference{Host: ref[:i]}
+	name := ref[i+1:]
+
+	if i := strings.Index(name, "@"); i > 0 {
+		r.Repository, r.Reference = name[:i], name[i+1:]
+	} else if i := strings.LastIndex(name, ":"); i > 0 {
+		r.Repository, r.Reference = name[:i], name[i+1:]
+	} else {
+		r.Repository, r.Reference = name, "latest"
+	}
+
+	if r.Repository == "" || r.Reference == "" {
+		return Reference{}, errors.Errorf("invalid reference %s", ref)
+	}
+
+	return r, nil
+}
+
+func (r Reference) String() string {
+	if strings.Contains(r.Reference, ":") {
+		return fmt.Sprintf("%s/%s@%s", r.Host, r.Repository, r.Reference)
+	}
+
+	return fmt.Sprintf("%s/%s:%s", r.Host, r.Repository, r.Reference)
+}
+
+// Head return the manifest descriptor of the reference without downloading it.
+func (c *Client) Head(ctx context.Context, ref string) (ocispec.Descriptor, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	resp, err := c.do(ctx, http.MethodHead, r, "manifests/"+r.Reference, manifestMediaTypes)
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+	resp.Body.Close()
+
+	size, _ := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64)
+	desc := ocispec.Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    digest.Digest(resp.Header.Get("Docker-Content-Digest")),
+		Size:      size,
+	}
+	if desc.Digest == "" {
+		// some registries only report the digest on GET
+		_, desc, err = c.Manifest(ctx, ref)
+	}
+
+	return desc, err
+}
+
+// Manifest fetch the image manifest of the reference and its descriptor.
+func (c *Client) Manifest(ctx context.Context, ref string) (ocispec.Manifest, ocispec.Descriptor, error) {
+	manifest := ocispec.Manifest{}
+
+	r, err := ParseReference(ref)
+	if err != nil {
+		return manifest, ocispec.Descriptor{}, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, r, "manifests/"+r.Reference, manifestMediaTypes)
+	if err != nil {
+		return manifest, ocispec.Descriptor{}, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return manifest, ocispec.Descriptor{}, err
+	}
+
+	desc := ocispec.Descriptor{
+		MediaType: resp.Header.Get("Content-Type"),
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+
+	switch desc.MediaType {
+	case ocispec.MediaTypeImageIndex, mediaTypeDockerList:
+		return manifest, desc, errors.Errorf("%s is a multi-platform index", ref)
+	}
+
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return manifest, desc, err
+	}
+
+	return manifest, desc, nil
+}
+
+// Config fetch the image config of the reference, with the manifest and its descriptor.
+func (c *Client) Config(ctx context.Context, ref string) (ocispec.Image, ocispec.Manifest, ocispec.Descriptor, error) {
+	config := ocispec.Image{}
+
+	manifest, desc, err := c.Manifest(ctx, ref)
+	if err != nil {
+		return config, manifest, desc, err
+	}
+
+	r, _ := ParseReference(ref)
+	blob, err := c.Blob(ctx, r, manifest.Config.Digest)
+	if err != nil {
+		return config, manifest, desc, err
+	}
+	defer blob.Close()
+
+	if err := json.NewDecoder(blob).Decode(&config); err != nil {
+		return config, manifest, desc, err
+	}
+
+	return config, manifest, desc, nil
+}
+
+// Platforms return the platforms of the reference, the entries of a multi-platform index or the platform
+// in the config of an image manifest.
+func (c *Client) Platforms(ctx context.Context, ref string) ([]ocispec.Platform, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, r, "manifests/"+r.Reference, manifestMediaTypes)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.Header.Get("Content-Type") {
+	case ocispec.MediaTypeImageIndex, mediaTypeDockerList:
+		index := ocispec.Index{}
+		if err := json.NewDecoder(resp.Body).Decode(&index); err != nil {
+			return nil, err
+		}
+
+		var platforms []ocispec.Platform
+		for _, manifest := range index.Manifests {
+			if manifest.Platform != nil {
+				platforms = append(platforms, *manifest.Platform)
+			}
+		}
+
+		return platforms, nil
+	}
+
+	manifest := ocispec.Manifest{}
+	if err := json.NewDecoder(resp.Body).Decode(&manifest); err != nil {
+		return nil, err
+	}
+
+	blob, err := c.Blob(ctx, r, manifest.Config.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer blob.Close()
+
+	// the platform fields are at the top level of the image config, the variant included
+	platform := ocispec.Platform{}
+	if err := json.NewDecoder(blob).Decode(&platform); err != nil {
+		return nil, err
+	}
+
+	return []ocispec.Platform{platform}, nil
+}
+
+// PlatformManifest fetch the image manifest of the reference for the platform, the entry of the platform
+// is followed if the reference is a multi-platform index.
+func (c *Client) PlatformManifest(
+	ctx context.Context,
+	ref string,
+	platform ocispec.Platform,
+) (ocispec.Manifest, ocispec.Descriptor, error) {
+	r, err := ParseReference(ref)
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.Descriptor{}, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, r, "manifests/"+r.Reference, manifestMediaTypes)
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.Descriptor{}, err
+	}
+	mediaType := resp.Header.Get("Content-Type")
+	data, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return ocispec.Manifest{}, ocispec.Descriptor{}, err
+	}
+
+	if mediaType != ocispec.MediaTypeImageIndex && mediaType != mediaTypeDockerList {
+		manifest := ocispec.Manifest{}
+		desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(data), Size: int64(len(data))}
+
+		return manifest, desc, json.Unmarshal(data, &manifest)
+	}
+
+	index := ocispec.Index{}
+	if err := json.Unmarshal(data, &index); err != nil {
+		return ocispec.Manifest{}, ocispec.Descriptor{}, err
+	}
+	for _, manifest := range index.Manifests {
+		if manifest.Platform == nil || manifest.Platform.OS != platform.OS ||
+			manifest.Platform.Architecture != platform.Architecture ||
+			platform.Variant != "" && manifest.Platform.Variant != platform.Variant {
+			continue
+		}
+
+		r.Reference = manifest.Digest.String()
+
+		return c.Manifest(ctx, r.String())
+	}
+
+	return ocispec.Manifest{}, ocispec.Descriptor{}, errors.Errorf("%s has no image for %s/%s", ref, platform.OS, platform.Architecture)
+}
+
+// Blob open the blob of the repository.
+func (c *Client) Blob(ctx context.Context, r Reference, dgst digest.Digest) (io.ReadCloser, error) {
+	if err := dgst.Validate(); err != nil {
+		return nil, err
+	}
+
+	resp, err := c.do(ctx, http.MethodGet, r, "blobs/"+dgst.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.Body, nil
+}
+
+// request is a call to the registry api.
+type request struct {
+	method      string
+	url         string
+	accept      []string
+	contentType string
+	body        []byte
+	// action is pull or push
+	action string
+}
+
+// do send a pull request to the path under the repository.
+func (c *Client) do(ctx context.Context, method string, r Reference, path string, accept []string) (*http.Response, error) {
+	return c.send(ctx, r, request{
+		method: method,
+		url:    c.endpoint(r, path),
+		accept: accept,
+		action: "pull",
+	})
+}
+
+func (c *Client) endpoint(r Reference, path string) string {
+	scheme := "https"
+	if c.options.PlainHTTP != nil && c.options.PlainHTTP(r.Host) {
+		scheme = "http"
+	}
+
+	return fmt.Sprintf("%s://%s/v2/%s/%s", scheme, r.Host, r.Repository, path)
+}
+
+// send the request, answer the auth challenge and retry once.
+func (c *Client) send(ctx context.Context, r Reference, call request) (*http.Response, error) {
+	scope := fmt.Sprintf("repository:%s:%s", r.Repository, call.action)
+	if call.action == "push" {
+		scope = fmt.Sprintf("repository:%s:pull,push", r.Repository)
+	}
+
+	for attempt := 0; ; attempt++ {
+		var body io.Reader
+		if call.body != nil {
+			body = bytes.NewReader(call.body)
+		}
+		req, err := http.NewRequestWithContext(ctx, call.method, call.url, body)
+		if err != nil {
+			return nil, err
+		}
+		for _, mediaType := range call.accept {
+			req.Header.Add("Accept", mediaType)
+		}
+		if call.contentType != "" {
+			req.Header.Set("Content-Type", call.contentType)
+		}
+		c.authorize(req, r.Host, scope)
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		switch {
+		case resp.StatusCode == http.StatusUnauthorized && attempt == 0:
+			challenge := resp.Header.Get("WWW-Authenticate")
+			resp.Body.Close()
+			if err := c.login(ctx, r.Host, scope, challenge); err != nil {
+				log.Errorf("authenticate to %s failed: %v", r.Host, err)
+
+				return nil, ErrUnauthorized
+			}
+
+			continue
+		case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+			resp.Body.Close()
+
+			return nil, ErrUnauthorized
+		case resp.StatusCode == http.StatusNotFound:
+			resp.Body.Close()
+
+			return nil, ErrNotFound
+		case resp.StatusCode < 200 || resp.StatusCode > 299:
+			resp.Body.Close()
+
+			return nil, errors.Errorf("%s %s: unexpected status %s", call.method, call.url, resp.Status)
+		}
+
+		return resp, nil
+	}
+}
+
+func (c *Client) authorize(req *http.Request, host string, scope string) {
+	c.lock.Lock()
+	token, ok := c.tokens[host+"|"+scope]
+	c.lock.Unlock()
+
+	if ok {
+		req.Header.Set("Authorization", token)
+	}
+}
+
+// login answer a Basic or Bearer challenge and cache the authorization of the scope.
+func (c *Client) login(ctx context.Context, host string, scope string, challenge string) error {
+	scheme, params := parseChallenge(challenge)
+
+	var username, password string
+	if c.options.Credentials != nil {
+		username, password = c.options.Credentials(host)
+	}
+
+	var authorization string
+	switch strings.ToLower(scheme) {
+	case "basic":
+		if username == "" {
+			return errors.New("no credentials")
+		}
+		req, _ := http.NewRequest(http.MethodGet, "/", nil)
+		req.SetBasicAuth(username, password)
+		authorization = req.Header.Get("Authorization")
+	case "bearer":
+		token, err := c.fetchToken(ctx, params, scope, username, password)
+		if err != nil {
+			return err
+		}
+		authorization = "Bearer " + token
+	default:
+		return errors.Errorf("unsupported auth challenge %q", challenge)
+	}
+
+	c.lock.Lock()
+	c.tokens[host+"|"+scope] = authorization
+	c.lock.Unlock()
+
+	return nil
+}
+
+// fetchToken get a bearer token from the token server of the challenge.
+func (c *Client) fetchToken(
+	ctx context.Context,
+	params map[string]string,
+	scope string,
+	username, password string,
+) (string, error) {
+	realm, err := url.Parse(params["realm"])
+	if err != nil || params["realm"] == "" {
+		return "", errors.Errorf("invalid token realm %q", params["realm"])
+	}
+
+	query := realm.Query()
+	if service := params["service"]; service != "" {
+		query.Set("service", service)
+	}
+	query.Set("scope", scope)
+	realm.RawQuery = query.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, realm.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	if username != "" {
+		req.SetBasicAuth(username, password)
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", errors.Errorf("token server responded %s", resp.Status)
+	}
+
+	result := struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}{}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+
+	if result.Token != "" {
+		return result.Token, nil
+	}
+	if result.AccessToken != "" {
+		return result.AccessToken, nil
+	}
+
+	return "", errors.New("token server returned no token")
+}
+
+// parseChallenge parse `Bearer realm="...",service="..."` into the scheme and its parameters.
+func parseChallenge(challenge string) (string, map[string]string) {
+	params := make(map[string]string)
+
+	parts := strings.SplitN(strings.TrimSpace(challenge), " ", 2)
+	if len(parts) < 2 {
+		return parts[0], params
+	}
+
+	for _, param := range strings.Split(parts[1], ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+		if len(kv) == 2 {
+			params[strings.ToLower(kv[0])] = strings.Trim(kv[1], `"`)
+		}
+	}
+
+	return parts[0], params
+}
@@ -0,0 +1,130 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package distribution
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// newRegistry start an in-process registry holding one image, it requires a bearer token from /token.
+func newRegistry(t *testing.T, repo string, tag string) (*httptest.Server, digest.Digest) {
+	config, _ := json.Marshal(ocispec.Image{Architecture: "amd64", OS: "linux"})
+	manifest, _ := json.Marshal(ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config:    ocispec.Descriptor{MediaType: ocispec.MediaTypeImageConfig, Digest: digest.FromBytes(config)},
+	})
+	manifestDigest := digest.FromBytes(manifest)
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			username, password, ok := r.BasicAuth()
+			if !ok || username != "admin" || password != "harbor" || r.URL.Query().Get("scope") != "repository:"+repo+":pull" {
+				w.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]string{"token": "secret-token"})
+
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret-token" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="`+server.URL+`/token",service="registry"`)
+			w.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		switch r.URL.Path {
+		case "/v2/" + repo + "/manifests/" + tag, "/v2/" + repo + "/manifests/" + manifestDigest.String():
+			w.Header().Set("Content-Type", ocispec.MediaTypeImageManifest)
+			w.Header().Set("Docker-Content-Digest", manifestDigest.String())
+			_, _ = w.Write(manifest)
+		case "/v2/" + repo + "/blobs/" + digest.FromBytes(config).String():
+			_, _ = w.Write(config)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server, manifestDigest
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	server, manifestDigest := newRegistry(t, "chaincode/mycc", "1.0")
+	defer server.Close()
+
+	host := strings.TrimPrefix(server.URL, "http://")
+	client := NewClient(Options{
+		Credentials: func(string) (string, string) { return "admin", "harbor" },
+		PlainHTTP:   func(string) bool { return true },
+	})
+
+	desc, err := client.Head(ctx, host+"/chaincode/mycc:1.0")
+	if err != nil {
+		t.Fatalf("Head() error = %v", err)
+	}
+	if desc.Digest != manifestDigest {
+		t.Errorf("Head() digest = %v, want %v", desc.Digest, manifestDigest)
+	}
+
+	if _, err := client.Head(ctx, host+"/chaincode/mycc@"+manifestDigest.String()); err != nil {
+		t.Errorf("Head() by digest error = %v", err)
+	}
+
+	if _, err := client.Head(ctx, host+"/chaincode/mycc:2.0"); err != ErrNotFound {
+		t.Errorf("Head() of unknown tag error = %v, want %v", err, ErrNotFound)
+	}
+
+	config, _, desc, err := client.Config(ctx, host+"/chaincode/mycc:1.0")
+	if err != nil {
+		t.Fatalf("Config() error = %v", err)
+	}
+	if config.Architecture != "amd64" || desc.Digest != manifestDigest {
+		t.Errorf("Config() = %v, %v", config, desc.Digest)
+	}
+
+	platforms, err := client.Platforms(ctx, host+"/chaincode/mycc:1.0")
+	if err != nil || len(platforms) != 1 || platforms[0].Architecture != "amd64" {
+		t.Errorf("Platforms() = %v, %v", platforms, err)
+	}
+
+	anonymous := NewClient(Options{PlainHTTP: func(string) bool { return true }})
+	if _, err := anonymous.Head(ctx, host+"/chaincode/mycc:1.0"); err != ErrUnauthorized {
+		t.Errorf("Head() without credentials error = %v, want %v", err, ErrUnauthorized)
+	}
+}
+
+func TestParseReference(t *testing.T) {
+	tests := []struct {
+		ref  string
+		want Reference
+	}{
+		{ref: "harbor:8099/chaincode/mycc", want: Reference{"harbor:8099", "chaincode/mycc", "latest"}},
+		{ref: "harbor:8099/chaincode/mycc:1.0", want: Reference{"harbor:8099", "chaincode/mycc", "1.0"}},
+		{ref: "harbor/mycc@sha256:abc", want: Reference{"harbor", "mycc", "sha256:abc"}},
+	}
+	for _, tt := range tests {
+		got, err := ParseReference(tt.ref)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseReference(%s) = %v, %v, want %v", tt.ref, got, err, tt.want)
+		}
+	}
+
+	if _, err := ParseReference("mycc:1.0"); err == nil {
+		t.Errorf("ParseReference() accepted a reference without host")
+	}
+}
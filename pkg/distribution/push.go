@@ -0,0 +1,107 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package distribution
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// PushBlob upload the blob into the repository unless it exists.
+func (c *Client) PushBlob(ctx context.Context, r Reference, mediaType string, data []byte) (ocispec.Descriptor, error) {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+
+	if resp, err := c.send(ctx, r, request{
+		method: http.MethodHead,
+		url:    c.endpoint(r, "blobs/"+desc.Digest.String()),
+		action: "push",
+	}); err == nil {
+		resp.Body.Close()
+
+		return desc, nil
+	}
+
+	resp, err := c.send(ctx, r, request{
+		method: http.MethodPost,
+		url:    c.endpoint(r, "blobs/uploads/"),
+		action: "push",
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+
+	location, err := resp.Request.URL.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return desc, errors.Errorf("invalid upload location %q", resp.Header.Get("Location"))
+	}
+	query := location.Query()
+	query.Set("digest", desc.Digest.String())
+	location.RawQuery = query.Encode()
+
+	resp, err = c.send(ctx, r, request{
+		method:      http.MethodPut,
+		url:         location.String(),
+		contentType: "application/octet-stream",
+		body:        data,
+		action:      "push",
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+
+	return desc, nil
+}
+
+// PushManifest put the manifest under the reference of r, return its descriptor.
+func (c *Client) PushManifest(ctx context.Context, r Reference, mediaType string, data []byte) (ocispec.Descriptor, error) {
+	desc := ocispec.Descriptor{
+		MediaType: mediaType,
+		Digest:    digest.FromBytes(data),
+		Size:      int64(len(data)),
+	}
+
+	resp, err := c.send(ctx, r, request{
+		method:      http.MethodPut,
+		url:         c.endpoint(r, "manifests/"+url.PathEscape(r.Reference)),
+		contentType: mediaType,
+		body:        data,
+		action:      "push",
+	})
+	if err != nil {
+		return desc, err
+	}
+	resp.Body.Close()
+
+	return desc, nil
+}
+
+// PushIndex put a manifest list of the platform manifests under the reference of r, return its descriptor.
+func (c *Client) PushIndex(ctx context.Context, r Reference, manifests []ocispec.Descriptor) (ocispec.Descriptor, error) {
+	data, err := json.Marshal(struct {
+		MediaType string `json:"mediaType"`
+		ocispec.Index
+	}{mediaTypeDockerList, ocispec.Index{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Manifests: manifests,
+	}})
+	if err != nil {
+		return ocispec.Descriptor{}, err
+	}
+
+	return c.PushManifest(ctx, r, mediaTypeDockerList, data)
+}
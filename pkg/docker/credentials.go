@@ -0,0 +1,170 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/docker/docker/api/types"
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// CredentialSource return the content of a docker config.json or a dockerconfigjson secret.
+type CredentialSource func(ctx context.Context) ([]byte, error)
+
+// FileCredentialSource read the docker config from file.
+func FileCredentialSource(path string) CredentialSource {
+	return func(ctx context.Context) ([]byte, error) {
+		return ioutil.ReadFile(path)
+	}
+}
+
+// dockerConfig is the format of docker config.json and kubernetes.io/dockerconfigjson secret.
+type dockerConfig struct {
+	Auths map[string]dockerConfigEntry `json:"auths"`
+}
+
+type dockerConfigEntry struct {
+	Auth     string `json:"auth"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Email    string `json:"email"`
+}
+
+// Credentials keep the per registry auth entries which can be replaced at runtime.
+type Credentials struct {
+	lock  sync.RWMutex
+	data  []byte
+	auths map[string]types.AuthConfig
+}
+
+// ParseDockerConfig parse the auth entries of a docker config, keyed by registry host.
+func ParseDockerConfig(data []byte) (map[string]types.AuthConfig, error) {
+	config := dockerConfig{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, err
+	}
+
+	auths := make(map[string]types.AuthConfig, len(config.Auths))
+	for server, entry := range config.Auths {
+		auth := types.AuthConfig{
+			Username:      entry.Username,
+			Password:      entry.Password,
+			Email:         entry.Email,
+			ServerAddress: server,
+		}
+		if entry.Auth != "" {
+			decoded, err := base64.StdEncoding.DecodeString(entry.Auth)
+			if err != nil {
+				return nil, errors.Errorf("decode auth of %s failed: %v", server, err)
+			}
+			parts := strings.SplitN(string(decoded), ":", 2)
+			if len(parts) != 2 {
+				return nil, errors.Errorf("invalid auth of %s", server)
+			}
+			auth.Username, auth.Password = parts[0], parts[1]
+		}
+		auths[registryHost(server)] = auth
+	}
+
+	return auths, nil
+}
+
+// Update replace the auth entries with the docker config, return whether they are changed.
+func (c *Credentials) Update(data []byte) (bool, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if c.auths != nil && bytes.Equal(c.data, data) {
+		return false, nil
+	}
+
+	auths, err := ParseDockerConfig(data)
+	if err != nil {
+		return false, err
+	}
+	c.data = data
+	c.auths = auths
+
+	return true, nil
+}
+
+// Lookup find the auth entry of the registry.
+func (c *Credentials) Lookup(server string) (types.AuthConfig, bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+
+	auth, ok := c.auths[registryHost(server)]
+
+	return auth, ok
+}
+
+// Watch load the credentials from source immediately and then every interval until ctx done.
+func (c *Credentials) Watch(ctx context.Context, source CredentialSource, interval time.Duration) error {
+	load := func() error {
+		data, err := source(ctx)
+		if err != nil {
+			return err
+		}
+		changed, err := c.Update(data)
+		if err != nil {
+			return err
+		}
+		if changed {
+			log.Info("registry credentials loaded")
+		}
+
+		return nil
+	}
+
+	if err := load(); err != nil {
+		log.Errorf("load registry credentials failed: %v", err)
+
+		return err
+	}
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if err := load(); err != nil {
+					log.Errorf("reload registry credentials failed: %v", err)
+				}
+			}
+		}
+	}()
+
+	return nil
+}
+
+// registryHost strip scheme and path of the registry address, docker hub entries are keyed by docker.io.
+func registryHost(server string) string {
+	server = strings.TrimPrefix(server, "https://")
+	server = strings.TrimPrefix(server, "http://")
+	if i := strings.Index(server, "/"); i >= 0 {
+		server = server[:i]
+	}
+
+	switch server {
+	case "index.docker.io", "registry-1.docker.io":
+		return "docker.io"
+	}
+
+	return server
+}
@@ -0,0 +1,71 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+)
+
+func TestCredentials(t *testing.T) {
+	config := func(password string) []byte {
+		data, _ := json.Marshal(map[string]interface{}{
+			"auths": map[string]interface{}{
+				"https://harbor.example.com/v2/": map[string]string{
+					"auth": base64.StdEncoding.EncodeToString([]byte("admin:" + password)),
+				},
+				"index.docker.io": map[string]string{"username": "hub", "password": "hub-secret"},
+			},
+		})
+
+		return data
+	}
+
+	c := &Credentials{}
+	if _, ok := c.Lookup("harbor.example.com"); ok {
+		t.Fatalf("Lookup() found credentials before loading")
+	}
+
+	changed, err := c.Update(config("harbor"))
+	if err != nil || !changed {
+		t.Fatalf("Update() = %v, %v, want true, nil", changed, err)
+	}
+
+	tests := []struct {
+		server   string
+		username string
+		password string
+	}{
+		{server: "harbor.example.com", username: "admin", password: "harbor"},
+		{server: "https://harbor.example.com", username: "admin", password: "harbor"},
+		{server: "registry-1.docker.io", username: "hub", password: "hub-secret"},
+	}
+	for _, tt := range tests {
+		auth, ok := c.Lookup(tt.server)
+		if !ok || auth.Username != tt.username || auth.Password != tt.password {
+			t.Errorf("Lookup(%s) = %v, %v, want %s:%s", tt.server, auth, ok, tt.username, tt.password)
+		}
+	}
+
+	if changed, _ := c.Update(config("harbor")); changed {
+		t.Errorf("Update() with the same config reported a change")
+	}
+
+	// rotate
+	if _, err := c.Update(config("rotated")); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	if auth, _ := c.Lookup("harbor.example.com"); auth.Password != "rotated" {
+		t.Errorf("Lookup() password = %s after rotation, want rotated", auth.Password)
+	}
+
+	if _, err := c.Update([]byte("not json")); err == nil {
+		t.Errorf("Update() accepted an invalid config")
+	}
+	if auth, _ := c.Lookup("harbor.example.com"); auth.Password != "rotated" {
+		t.Errorf("invalid config replaced the credentials")
+	}
+}
@@ -27,29 +27,6 @@ type MockDockerService struct {
 	recorder *MockDockerServiceMockRecorder
 }
 
-func (m *MockDockerService) GetImageMode() string {
-	return ""
-}
-
-func (m *MockDockerService) GetPullerAccessAddress() string {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *MockDockerService) GetPullerImage() string {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *MockDockerService) ImageSave(ctx context.Context, imageIDs []string) (io.ReadCloser, error) {
-	//TODO implement me
-	panic("implement me")
-}
-
-func (m *MockDockerService) ImageLoad(ctx context.Context, input io.Reader, quiet bool) (types.ImageLoadResponse, error) {
-	return types.ImageLoadResponse{}, nil
-}
-
 // MockDockerServiceMockRecorder is the mock recorder for MockDockerService.
 type MockDockerServiceMockRecorder struct {
 	mock *MockDockerService
@@ -97,6 +74,21 @@ func (mr *MockDockerServiceMockRecorder) ContainerCreate(arg0, arg1, arg2, arg3,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerCreate", reflect.TypeOf((*MockDockerService)(nil).ContainerCreate), arg0, arg1, arg2, arg3, arg4, arg5)
 }
 
+// ContainerInspect mocks base method.
+func (m *MockDockerService) ContainerInspect(arg0 context.Context, arg1 string) (types.ContainerJSON, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ContainerInspect", arg0, arg1)
+	ret0, _ := ret[0].(types.ContainerJSON)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ContainerInspect indicates an expected call of ContainerInspect.
+func (mr *MockDockerServiceMockRecorder) ContainerInspect(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ContainerInspect", reflect.TypeOf((*MockDockerService)(nil).ContainerInspect), arg0, arg1)
+}
+
 // ContainerKill mocks base method.
 func (m *MockDockerService) ContainerKill(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -198,6 +190,62 @@ func (mr *MockDockerServiceMockRecorder) CopyToContainer(arg0, arg1, arg2, arg3,
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CopyToContainer", reflect.TypeOf((*MockDockerService)(nil).CopyToContainer), arg0, arg1, arg2, arg3, arg4)
 }
 
+// GetCompression mocks base method.
+func (m *MockDockerService) GetCompression() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompression")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetCompression indicates an expected call of GetCompression.
+func (mr *MockDockerServiceMockRecorder) GetCompression() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompression", reflect.TypeOf((*MockDockerService)(nil).GetCompression))
+}
+
+// GetCompressionLevel mocks base method.
+func (m *MockDockerService) GetCompressionLevel() int {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetCompressionLevel")
+	ret0, _ := ret[0].(int)
+	return ret0
+}
+
+// GetCompressionLevel indicates an expected call of GetCompressionLevel.
+func (mr *MockDockerServiceMockRecorder) GetCompressionLevel() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetCompressionLevel", reflect.TypeOf((*MockDockerService)(nil).GetCompressionLevel))
+}
+
+// GetImageMode mocks base method.
+func (m *MockDockerService) GetImageMode() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetImageMode")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetImageMode indicates an expected call of GetImageMode.
+func (mr *MockDockerServiceMockRecorder) GetImageMode() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetImageMode", reflect.TypeOf((*MockDockerService)(nil).GetImageMode))
+}
+
+// GetPlatforms mocks base method.
+func (m *MockDockerService) GetPlatforms() []v1.Platform {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPlatforms")
+	ret0, _ := ret[0].([]v1.Platform)
+	return ret0
+}
+
+// GetPlatforms indicates an expected call of GetPlatforms.
+func (mr *MockDockerServiceMockRecorder) GetPlatforms() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPlatforms", reflect.TypeOf((*MockDockerService)(nil).GetPlatforms))
+}
+
 // GetProjectName mocks base method.
 func (m *MockDockerService) GetProjectName() string {
 	m.ctrl.T.Helper()
@@ -212,6 +260,76 @@ func (mr *MockDockerServiceMockRecorder) GetProjectName() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetProjectName", reflect.TypeOf((*MockDockerService)(nil).GetProjectName))
 }
 
+// GetPullerAccessAddress mocks base method.
+func (m *MockDockerService) GetPullerAccessAddress() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPullerAccessAddress")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetPullerAccessAddress indicates an expected call of GetPullerAccessAddress.
+func (mr *MockDockerServiceMockRecorder) GetPullerAccessAddress() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPullerAccessAddress", reflect.TypeOf((*MockDockerService)(nil).GetPullerAccessAddress))
+}
+
+// GetPullerImage mocks base method.
+func (m *MockDockerService) GetPullerImage() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetPullerImage")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetPullerImage indicates an expected call of GetPullerImage.
+func (mr *MockDockerServiceMockRecorder) GetPullerImage() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetPullerImage", reflect.TypeOf((*MockDockerService)(nil).GetPullerImage))
+}
+
+// GetRegistries mocks base method.
+func (m *MockDockerService) GetRegistries() []*Registry {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRegistries")
+	ret0, _ := ret[0].([]*Registry)
+	return ret0
+}
+
+// GetRegistries indicates an expected call of GetRegistries.
+func (mr *MockDockerServiceMockRecorder) GetRegistries() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRegistries", reflect.TypeOf((*MockDockerService)(nil).GetRegistries))
+}
+
+// GetRegistryAddress mocks base method.
+func (m *MockDockerService) GetRegistryAddress() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRegistryAddress")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetRegistryAddress indicates an expected call of GetRegistryAddress.
+func (mr *MockDockerServiceMockRecorder) GetRegistryAddress() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRegistryAddress", reflect.TypeOf((*MockDockerService)(nil).GetRegistryAddress))
+}
+
+// GetRuntime mocks base method.
+func (m *MockDockerService) GetRuntime() string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetRuntime")
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// GetRuntime indicates an expected call of GetRuntime.
+func (mr *MockDockerServiceMockRecorder) GetRuntime() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetRuntime", reflect.TypeOf((*MockDockerService)(nil).GetRuntime))
+}
+
 // GetServerAddress mocks base method.
 func (m *MockDockerService) GetServerAddress() string {
 	m.ctrl.T.Helper()
@@ -257,6 +375,21 @@ func (mr *MockDockerServiceMockRecorder) ImageInspectWithRaw(arg0, arg1 interfac
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageInspectWithRaw", reflect.TypeOf((*MockDockerService)(nil).ImageInspectWithRaw), arg0, arg1)
 }
 
+// ImageLoad mocks base method.
+func (m *MockDockerService) ImageLoad(arg0 context.Context, arg1 io.Reader, arg2 bool) (types.ImageLoadResponse, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageLoad", arg0, arg1, arg2)
+	ret0, _ := ret[0].(types.ImageLoadResponse)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageLoad indicates an expected call of ImageLoad.
+func (mr *MockDockerServiceMockRecorder) ImageLoad(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageLoad", reflect.TypeOf((*MockDockerService)(nil).ImageLoad), arg0, arg1, arg2)
+}
+
 // ImagePull mocks base method.
 func (m *MockDockerService) ImagePull(arg0 context.Context, arg1 string, arg2 types.ImagePullOptions) (io.ReadCloser, error) {
 	m.ctrl.T.Helper()
@@ -287,6 +420,21 @@ func (mr *MockDockerServiceMockRecorder) ImagePush(arg0, arg1, arg2 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImagePush", reflect.TypeOf((*MockDockerService)(nil).ImagePush), arg0, arg1, arg2)
 }
 
+// ImageSave mocks base method.
+func (m *MockDockerService) ImageSave(arg0 context.Context, arg1 []string) (io.ReadCloser, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ImageSave", arg0, arg1)
+	ret0, _ := ret[0].(io.ReadCloser)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ImageSave indicates an expected call of ImageSave.
+func (mr *MockDockerServiceMockRecorder) ImageSave(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageSave", reflect.TypeOf((*MockDockerService)(nil).ImageSave), arg0, arg1)
+}
+
 // ImageTag mocks base method.
 func (m *MockDockerService) ImageTag(arg0 context.Context, arg1, arg2 string) error {
 	m.ctrl.T.Helper()
@@ -301,6 +449,20 @@ func (mr *MockDockerServiceMockRecorder) ImageTag(arg0, arg1, arg2 interface{})
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ImageTag", reflect.TypeOf((*MockDockerService)(nil).ImageTag), arg0, arg1, arg2)
 }
 
+// PullAuth mocks base method.
+func (m *MockDockerService) PullAuth(arg0 string) string {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "PullAuth", arg0)
+	ret0, _ := ret[0].(string)
+	return ret0
+}
+
+// PullAuth indicates an expected call of PullAuth.
+func (mr *MockDockerServiceMockRecorder) PullAuth(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "PullAuth", reflect.TypeOf((*MockDockerService)(nil).PullAuth), arg0)
+}
+
 // RegistryAuth mocks base method.
 func (m *MockDockerService) RegistryAuth() (string, error) {
 	m.ctrl.T.Helper()
@@ -316,12 +478,17 @@ func (mr *MockDockerServiceMockRecorder) RegistryAuth() *gomock.Call {
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryAuth", reflect.TypeOf((*MockDockerService)(nil).RegistryAuth))
 }
 
-func (mr *MockDockerServiceMockRecorder) GetImageMode() string {
-	return ""
-}
-func (mr *MockDockerServiceMockRecorder) GetPullerAccessAddress() string {
-	return ""
+// RegistryAuthFor mocks base method.
+func (m *MockDockerService) RegistryAuthFor(arg0 string) (string, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "RegistryAuthFor", arg0)
+	ret0, _ := ret[0].(string)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
 }
-func (mr *MockDockerServiceMockRecorder) GetPullerImage() string {
-	return ""
+
+// RegistryAuthFor indicates an expected call of RegistryAuthFor.
+func (mr *MockDockerServiceMockRecorder) RegistryAuthFor(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "RegistryAuthFor", reflect.TypeOf((*MockDockerService)(nil).RegistryAuthFor), arg0)
 }
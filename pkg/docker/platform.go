@@ -0,0 +1,36 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"strings"
+
+	"github.com/marmotedu/errors"
+	specs "github.com/opencontainers/image-spec/specs-go/v1"
+)
+
+// ParsePlatform parse the os/arch[/variant] platform.
+func ParsePlatform(platform string) (specs.Platform, error) {
+	parts := strings.Split(strings.ToLower(platform), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return specs.Platform{}, errors.Errorf("platform %s is not os/arch[/variant]", platform)
+	}
+
+	p := specs.Platform{OS: parts[0], Architecture: parts[1]}
+	if len(parts) == 3 {
+		p.Variant = parts[2]
+	}
+
+	return p, nil
+}
+
+// FormatPlatform format the platform as os/arch[/variant].
+func FormatPlatform(platform specs.Platform) string {
+	if platform.Variant == "" {
+		return platform.OS + "/" + platform.Architecture
+	}
+
+	return platform.OS + "/" + platform.Architecture + "/" + platform.Variant
+}
@@ -9,7 +9,10 @@ import (
 	"context"
 	"encoding/base64"
 	"encoding/json"
+	"fmt"
 	"io"
+	"sort"
+	"strings"
 	"time"
 
 	"github.com/docker/docker/api/types"
@@ -28,18 +31,34 @@ const DOCKER_VERSION = "1.32"
 type Docker struct {
 	DockerClient        *client.Client
 	Registry            *Registry
+	Registries          []*Registry
+	Credentials         *Credentials
 	ImageMode           string
 	PullerAccessAddress string
 	PullerImage         string
+	RegistryAddress     string
+	Runtime             string
+	Compression         string
+	CompressionLevel    int
+	// Platforms are the build platforms, the first one is the primary platform
+	Platforms []specs.Platform
 }
 
 type DockerService interface {
 	RegistryAuth() (string, error)
+	RegistryAuthFor(server string) (string, error)
+	PullAuth(image string) string
+	GetRegistries() []*Registry
 	GetServerAddress() string
 	GetProjectName() string
 	GetImageMode() string
 	GetPullerAccessAddress() string
 	GetPullerImage() string
+	GetRegistryAddress() string
+	GetRuntime() string
+	GetCompression() string
+	GetCompressionLevel() int
+	GetPlatforms() []specs.Platform
 	ContainerAttach(
 		ctx context.Context,
 		container string,
@@ -53,6 +72,7 @@ type DockerService interface {
 		platform *specs.Platform,
 		containerName string,
 	) (containertypes.ContainerCreateCreatedBody, error)
+	ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error)
 	ContainerKill(ctx context.Context, container, signal string) error
 	ContainerRemove(ctx context.Context, container string, options types.ContainerRemoveOptions) error
 	ContainerStart(ctx context.Context, container string, options types.ContainerStartOptions) error
@@ -85,7 +105,22 @@ type DockerService interface {
 
 // new docker client from opt.
 func newDocker(opt *options.DockerOption, option *options.PeithoOption) (*Docker, error) {
-	docker, err := client.NewClientWithOpts(client.WithHost(opt.Endpoint), client.WithVersion(DOCKER_VERSION))
+	platforms := make([]specs.Platform, 0, len(opt.Platforms))
+	for _, p := range opt.Platforms {
+		platform, err := ParsePlatform(p)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+
+	// the platform of containers needs a newer api than the pinned one
+	version := client.WithVersion(DOCKER_VERSION)
+	if len(platforms) > 0 {
+		version = client.WithAPIVersionNegotiation()
+	}
+
+	docker, err := client.NewClientWithOpts(client.WithHost(opt.Endpoint), version)
 	if err != nil {
 		log.Errorf("new docker client failed: %v", err)
 
@@ -99,18 +134,31 @@ func newDocker(opt *options.DockerOption, option *options.PeithoOption) (*Docker
 	}
 	log.Info("docker server alive")
 
+	registry := newRegistry(opt.Registry)
+	var registries []*Registry
+	if registry.Serveraddress != "" {
+		registries = append(registries, registry)
+	}
+	for _, r := range opt.Registries {
+		registries = append(registries, newRegistry(r))
+	}
+	sort.SliceStable(registries, func(i, j int) bool {
+		return registries[i].Priority < registries[j].Priority
+	})
+
 	return &Docker{
-		DockerClient: docker,
-		Registry: &Registry{
-			Username:      opt.Registry.Username,
-			Password:      opt.Registry.Password,
-			Email:         opt.Registry.Email,
-			Serveraddress: opt.Registry.Serveraddress,
-			Project:       opt.Registry.Project,
-		},
+		DockerClient:        docker,
+		Credentials:         &Credentials{},
+		Registry:            registry,
+		Registries:          registries,
 		PullerAccessAddress: option.PullerAccessAddress,
 		ImageMode:           option.ImageMode,
 		PullerImage:         option.PullerImage,
+		RegistryAddress:     option.RegistryAddress,
+		Runtime:             option.Runtime,
+		Compression:         option.Compression,
+		CompressionLevel:    option.CompressionLevel,
+		Platforms:           platforms,
 	}, nil
 }
 
@@ -125,20 +173,84 @@ type Registry struct {
 	Email         string `json:"email"`
 	Serveraddress string `json:"serveraddress"`
 	Project       string `json:"project"`
+	Secret        string `json:"secret"`
+	Priority      int    `json:"priority"`
+	Mirror        bool   `json:"mirror"`
+	Insecure      bool   `json:"insecure"`
+	// Projects map MSP ID to project
+	Projects map[string]string `json:"projects"`
 }
 
-// RegistryAuth registry Authentication encoded by base64.
+func newRegistry(opt options.Registry) *Registry {
+	return &Registry{
+		Secret:        opt.Secret,
+		Username:      opt.Username,
+		Password:      opt.Password,
+		Email:         opt.Email,
+		Serveraddress: opt.Serveraddress,
+		Project:       opt.Project,
+		Priority:      opt.Priority,
+		Mirror:        opt.Mirror,
+		Insecure:      opt.Insecure,
+		Projects:      opt.Projects,
+	}
+}
+
+// ProjectFor return the project of the MSP ID, the default project if no one is configured.
+func (r *Registry) ProjectFor(mspID string) string {
+	// the keys may be lower cased by the config loader
+	for msp, project := range r.Projects {
+		if strings.EqualFold(msp, mspID) && project != "" {
+			return project
+		}
+	}
+
+	return r.Project
+}
+
+// Reference return the reference of the image in the project of the MSP ID.
+func (r *Registry) Reference(mspID string, image string) string {
+	return fmt.Sprintf("%s/%s/%s", r.Serveraddress, r.ProjectFor(mspID), image)
+}
+
+// RegistryAuth registry Authentication of the primary registry encoded by base64.
 func (d *Docker) RegistryAuth() (string, error) {
+	return d.RegistryAuthFor(d.Registry.Serveraddress)
+}
+
+// RegistryAuthFor registry Authentication of the server encoded by base64.
+// the entry of the registry in the loaded docker config is preferred over username and password.
+func (d *Docker) RegistryAuthFor(server string) (string, error) {
+	if auth, ok := d.Credentials.Lookup(server); ok {
+		jsonBytes, err := json.Marshal(auth)
+		if err != nil {
+			log.Errorf("json marshal failed: %v", err)
+
+			return "", err
+		}
+
+		return base64.URLEncoding.EncodeToString(jsonBytes), nil
+	}
+
+	registry := d.Registry
+	for _, r := range d.Registries {
+		if r.Serveraddress == server {
+			registry = r
+
+			break
+		}
+	}
+
 	s := struct {
 		Username      string `json:"username"`
 		Password      string `json:"password"`
 		Email         string `json:"email"`
 		Serveraddress string `json:"serveraddress"`
 	}{
-		Username:      d.Registry.Username,
-		Password:      d.Registry.Password,
+		Username:      registry.Username,
+		Password:      registry.Password,
 		Email:         "",
-		Serveraddress: d.Registry.Serveraddress,
+		Serveraddress: server,
 	}
 
 	jsonBytes, err := json.Marshal(s)
@@ -148,7 +260,76 @@ func (d *Docker) RegistryAuth() (string, error) {
 		return "", err
 	}
 
-	return base64.StdEncoding.EncodeToString(jsonBytes), nil
+	return base64.URLEncoding.EncodeToString(jsonBytes), nil
+}
+
+// ImageHost return the registry host of the image reference, docker hub images are hosted by docker.io.
+func ImageHost(image string) string {
+	i := strings.Index(image, "/")
+	if i < 0 {
+		return "docker.io"
+	}
+
+	host := image[:i]
+	if strings.ContainsAny(host, ".:") || host == "localhost" {
+		return host
+	}
+
+	return "docker.io"
+}
+
+// PullAuth return the encoded auth to pull the image, empty if there are no credentials of its registry.
+func (d *Docker) PullAuth(image string) string {
+	server := ImageHost(image)
+
+	username, password := d.BasicAuth(server)
+	if username == "" {
+		return ""
+	}
+
+	jsonBytes, err := json.Marshal(types.AuthConfig{
+		Username:      username,
+		Password:      password,
+		ServerAddress: server,
+	})
+	if err != nil {
+		log.Errorf("json marshal failed: %v", err)
+
+		return ""
+	}
+
+	return base64.URLEncoding.EncodeToString(jsonBytes)
+}
+
+// BasicAuth return the username and password of the registry.
+func (d *Docker) BasicAuth(server string) (string, string) {
+	if auth, ok := d.Credentials.Lookup(server); ok {
+		return auth.Username, auth.Password
+	}
+
+	for _, r := range d.Registries {
+		if r.Serveraddress == server {
+			return r.Username, r.Password
+		}
+	}
+
+	return "", ""
+}
+
+// IsInsecure report whether the registry is served over plain http.
+func (d *Docker) IsInsecure(server string) bool {
+	for _, r := range d.Registries {
+		if r.Serveraddress == server {
+			return r.Insecure
+		}
+	}
+
+	return false
+}
+
+// GetRegistries return the registries in priority order.
+func (d *Docker) GetRegistries() []*Registry {
+	return d.Registries
 }
 
 func (d *Docker) GetServerAddress() string {
@@ -171,6 +352,26 @@ func (d *Docker) GetPullerImage() string {
 	return d.PullerImage
 }
 
+func (d *Docker) GetRegistryAddress() string {
+	return d.RegistryAddress
+}
+
+func (d *Docker) GetRuntime() string {
+	return d.Runtime
+}
+
+func (d *Docker) GetCompression() string {
+	return d.Compression
+}
+
+func (d *Docker) GetCompressionLevel() int {
+	return d.CompressionLevel
+}
+
+func (d *Docker) GetPlatforms() []specs.Platform {
+	return d.Platforms
+}
+
 func (d *Docker) ContainerAttach(
 	ctx context.Context,
 	container string,
@@ -190,6 +391,10 @@ func (d *Docker) ContainerCreate(
 	return d.DockerClient.ContainerCreate(ctx, config, hostConfig, networkingConfig, platform, containerName)
 }
 
+func (d *Docker) ContainerInspect(ctx context.Context, container string) (types.ContainerJSON, error) {
+	return d.DockerClient.ContainerInspect(ctx, container)
+}
+
 func (d *Docker) ContainerKill(ctx context.Context, container, signal string) error {
 	return d.DockerClient.ContainerKill(ctx, container, signal)
 }
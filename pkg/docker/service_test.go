@@ -0,0 +1,56 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package docker
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+)
+
+func TestDocker_RegistryAuthFor(t *testing.T) {
+	// the password is encoded with + and / by the standard encoding
+	const password = "p+ss/w?>>~"
+	credentials := &Credentials{}
+	data, _ := json.Marshal(map[string]interface{}{
+		"auths": map[string]interface{}{
+			"hub.example.com": map[string]string{"username": "hub", "password": password},
+		},
+	})
+	if _, err := credentials.Update(data); err != nil {
+		t.Fatalf("Update() error = %v", err)
+	}
+	harbor := &Registry{Serveraddress: "harbor.example.com", Username: "admin", Password: password}
+	d := &Docker{Registry: harbor, Registries: []*Registry{harbor}, Credentials: credentials}
+
+	decode := func(encoded string) types.AuthConfig {
+		var auth types.AuthConfig
+		raw, err := base64.URLEncoding.DecodeString(encoded)
+		if err != nil {
+			t.Fatalf("decode %s error = %v", encoded, err)
+		}
+		if err := json.Unmarshal(raw, &auth); err != nil {
+			t.Fatalf("unmarshal %s error = %v", raw, err)
+		}
+
+		return auth
+	}
+
+	for _, server := range []string{"harbor.example.com", "hub.example.com"} {
+		encoded, err := d.RegistryAuthFor(server)
+		if err != nil {
+			t.Fatalf("RegistryAuthFor(%s) error = %v", server, err)
+		}
+		if auth := decode(encoded); auth.Password != password {
+			t.Errorf("RegistryAuthFor(%s) password = %s, want %s", server, auth.Password, password)
+		}
+	}
+
+	if auth := decode(d.PullAuth("harbor.example.com/chaincode/mycc:1.0")); auth.Password != password {
+		t.Errorf("PullAuth() password = %s, want %s", auth.Password, password)
+	}
+}
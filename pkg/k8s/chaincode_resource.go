@@ -0,0 +1,512 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+	"k8s.io/client-go/dynamic"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// tlsSecretSuffix is the suffix of the tls secret names after the chaincode.
+const tlsSecretSuffix = "-tls"
+
+// AnnotationSpecHash is the hash of the chaincode spec the deployment is reconciled from.
+const AnnotationSpecHash = "peitho.io/spec-hash"
+
+// AnnotationRolledBack is the version whose image the chaincode runs, the chaincode was not ready in time
+// with its own image.
+const AnnotationRolledBack = "peitho.io/rolled-back-to"
+
+func (k8s *K8sClient) chaincodes() dynamic.ResourceInterface {
+	return k8s.dynamic.Resource(v1alpha1.Resource).Namespace(k8s.namespace)
+}
+
+// ApplyChaincodeResource create the chaincode resource, or update the spec, labels and annotations of it.
+func (k8s *K8sClient) ApplyChaincodeResource(ctx context.Context, cc *v1alpha1.Chaincode) error {
+	existing, err := k8s.getChaincodeResource(ctx, cc.Name)
+	if apierrors.IsNotFound(err) {
+		u, err := v1alpha1.ToUnstructured(cc)
+		if err != nil {
+			return err
+		}
+		if _, err := k8s.chaincodes().Create(ctx, u, metav1.CreateOptions{}); err != nil {
+			log.Errorf("create chaincode %s failed: %v", cc.Name, err)
+
+			return err
+		}
+
+		return nil
+	}
+	if err != nil {
+		log.Errorf("get chaincode %s failed: %v", cc.Name, err)
+
+		return err
+	}
+
+	existing.Labels = merge(existing.Labels, cc.Labels)
+	existing.Annotations = merge(existing.Annotations, cc.Annotations)
+	existing.Spec = cc.Spec
+	u, err := v1alpha1.ToUnstructured(existing)
+	if err != nil {
+		return err
+	}
+	if _, err := k8s.chaincodes().Update(ctx, u, metav1.UpdateOptions{}); err != nil {
+		log.Errorf("update chaincode %s failed: %v", cc.Name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// GetChaincodeResource get the chaincode resource.
+func (k8s *K8sClient) GetChaincodeResource(ctx context.Context, name string) (*v1alpha1.Chaincode, error) {
+	cc, err := k8s.getChaincodeResource(ctx, name)
+	if err != nil {
+		log.Errorf("get chaincode %s failed: %v", name, err)
+
+		return nil, err
+	}
+
+	return cc, nil
+}
+
+func (k8s *K8sClient) getChaincodeResource(ctx context.Context, name string) (*v1alpha1.Chaincode, error) {
+	u, err := k8s.chaincodes().Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return v1alpha1.FromUnstructured(u)
+}
+
+// ListChaincodeResources list the chaincode resources in the namespace.
+func (k8s *K8sClient) ListChaincodeResources(ctx context.Context) ([]v1alpha1.Chaincode, error) {
+	list, err := k8s.chaincodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		log.Errorf("list chaincodes failed: %v", err)
+
+		return nil, err
+	}
+
+	chaincodes := make([]v1alpha1.Chaincode, 0, len(list.Items))
+	for i := range list.Items {
+		cc, err := v1alpha1.FromUnstructured(&list.Items[i])
+		if err != nil {
+			log.Errorf("convert chaincode %s failed: %v", list.Items[i].GetName(), err)
+
+			continue
+		}
+		chaincodes = append(chaincodes, *cc)
+	}
+
+	return chaincodes, nil
+}
+
+// CreateTLSSecret create the secret holding the tls files of the chaincode, the chaincode refers to it.
+func (k8s *K8sClient) CreateTLSSecret(ctx context.Context, name string, data map[string]string) error {
+	labels := OwnerLabels(nil)
+	if cc, err := k8s.getChaincodeResource(ctx, name); err == nil {
+		labels = OwnerLabels(cc.Labels)
+	}
+
+	secret := &v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   TLSSecretName(name),
+			Labels: labels,
+		},
+		Type: v1.SecretTypeOpaque,
+		Data: make(map[string][]byte, len(data)),
+	}
+	for k, v := range data {
+		secret.Data[k] = []byte(v)
+	}
+
+	secrets := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace)
+	_, err := secrets.Create(ctx, secret, metav1.CreateOptions{})
+	if apierrors.IsAlreadyExists(err) {
+		_, err = secrets.Update(ctx, secret, metav1.UpdateOptions{})
+	}
+	if err != nil {
+		log.Errorf("create tls secret of %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// TLSSecretName return the name of the tls secret of the chaincode.
+func TLSSecretName(name string) string {
+	return name + tlsSecretSuffix
+}
+
+// ListTLSSecrets list the tls secrets created by CreateTLSSecret, the secrets owned by a chaincode resource
+// are deleted with it and left out.
+func (k8s *K8sClient) ListTLSSecrets(ctx context.Context) ([]v1.Secret, error) {
+	secrets, err := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: ManagedSelector(),
+	})
+	if err != nil {
+		log.Errorf("list tls secrets failed: %v", err)
+
+		return nil, err
+	}
+
+	result := make([]v1.Secret, 0, len(secrets.Items))
+	for _, secret := range secrets.Items {
+		if secret.Type != v1.SecretTypeOpaque || !strings.HasSuffix(secret.Name, tlsSecretSuffix) {
+			continue
+		}
+		if metav1.GetControllerOf(&secret) != nil {
+			continue
+		}
+		result = append(result, secret)
+	}
+
+	return result, nil
+}
+
+// DeleteTLSSecret delete the tls secret of the chaincode.
+func (k8s *K8sClient) DeleteTLSSecret(ctx context.Context, name string) error {
+	err := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace).Delete(ctx, TLSSecretName(name), metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
+		log.Errorf("delete tls secret of %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// ReconcileChaincodeResource reconcile the chaincode resource into its deployment, tls secret and service,
+// the result is reported in its status.
+func (k8s *K8sClient) ReconcileChaincodeResource(ctx context.Context, name string) error {
+	cc, err := k8s.GetChaincodeResource(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	status, err := k8s.reconcileChaincode(ctx, cc)
+	if err != nil {
+		log.Errorf("reconcile chaincode %s failed: %v", name, err)
+		k8s.recorder.Eventf(name, v1.EventTypeWarning, REASON_RECONCILE_FAILED, "reconcile chaincode failed: %v", err)
+		status.Phase = v1alpha1.PHASE_FAILED
+		status.LastError = err.Error()
+	}
+
+	cc.Status = status
+	u, convertErr := v1alpha1.ToUnstructured(cc)
+	if convertErr != nil {
+		return convertErr
+	}
+	if _, statusErr := k8s.chaincodes().UpdateStatus(ctx, u, metav1.UpdateOptions{}); statusErr != nil {
+		log.Errorf("update status of chaincode %s failed: %v", name, statusErr)
+		if err == nil {
+			err = statusErr
+		}
+	}
+
+	return err
+}
+
+func (k8s *K8sClient) reconcileChaincode(ctx context.Context, cc *v1alpha1.Chaincode) (v1alpha1.ChaincodeStatus, error) {
+	status := v1alpha1.ChaincodeStatus{
+		Phase:              cc.Status.Phase,
+		ReadyReplicas:      cc.Status.ReadyReplicas,
+		Digest:             imageDigest(cc),
+		ObservedGeneration: cc.Status.ObservedGeneration,
+		StartedAt:          cc.Status.StartedAt,
+		ReadySince:         cc.Status.ReadySince,
+	}
+
+	if cc.Spec.TLS != nil {
+		if err := k8s.ownTLSSecret(ctx, cc); err != nil {
+			return status, err
+		}
+	}
+
+	deployment, err := k8s.applyChaincodeDeployment(ctx, cc)
+	if err != nil {
+		return status, err
+	}
+	k8s.recorder.observe(deployment)
+
+	if cc.Spec.Port > 0 {
+		if err := k8s.applyChaincodeService(ctx, cc); err != nil {
+			return status, err
+		}
+	}
+
+	status.ObservedGeneration = cc.Generation
+	status.ReadyReplicas = deployment.Status.ReadyReplicas
+	// the rolled back version runs the image of the previous one
+	if rolledBack := cc.Annotations[AnnotationRolledBack]; rolledBack != "" {
+		status.LastError = "not ready in time, rolled back to the image of " + rolledBack
+	}
+	switch {
+	case deployment.Status.ReadyReplicas > 0:
+		status.Phase = v1alpha1.PHASE_RUNNING
+	case deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0:
+		status.Phase = v1alpha1.PHASE_PENDING
+	default:
+		status.Phase = v1alpha1.PHASE_STARTING
+	}
+	now := metav1.Now()
+	if status.Phase == v1alpha1.PHASE_PENDING {
+		status.StartedAt = nil
+	} else if status.StartedAt == nil {
+		status.StartedAt = &now
+	}
+	if status.Phase != v1alpha1.PHASE_RUNNING {
+		status.ReadySince = nil
+	} else if status.ReadySince == nil {
+		status.ReadySince = &now
+	}
+
+	return status, nil
+}
+
+// applyChaincodeDeployment create the deployment of the chaincode, or update it when the spec changed.
+func (k8s *K8sClient) applyChaincodeDeployment(ctx context.Context, cc *v1alpha1.Chaincode) (*appsv1.Deployment, error) {
+	desired, err := k8s.chaincodeDeployment(cc)
+	if err != nil {
+		return nil, err
+	}
+
+	deployments := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace)
+	existing, err := deployments.Get(ctx, cc.Name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		created, err := deployments.Create(ctx, desired, metav1.CreateOptions{})
+		if err != nil {
+			return nil, errors.Errorf("create deployment failed: %v", err)
+		}
+
+		return created, nil
+	}
+	if err != nil {
+		return nil, errors.Errorf("get deployment failed: %v", err)
+	}
+
+	if existing.Annotations[AnnotationSpecHash] == desired.Annotations[AnnotationSpecHash] {
+		return existing, nil
+	}
+
+	// the state of the inventory is kept, it changes on the deployment only
+	annotations := merge(existing.Annotations, desired.Annotations)
+	if state, ok := existing.Annotations[AnnotationState]; ok {
+		annotations[AnnotationState] = state
+	}
+	existing.Annotations = annotations
+	existing.Labels = merge(existing.Labels, desired.Labels)
+	existing.OwnerReferences = desired.OwnerReferences
+	existing.Spec.Replicas = desired.Spec.Replicas
+	existing.Spec.Template = desired.Spec.Template
+	updated, err := deployments.Update(ctx, existing, metav1.UpdateOptions{})
+	if err != nil {
+		return nil, errors.Errorf("update deployment failed: %v", err)
+	}
+
+	return updated, nil
+}
+
+// chaincodeDeployment return the deployment the chaincode is reconciled into.
+func (k8s *K8sClient) chaincodeDeployment(cc *v1alpha1.Chaincode) (*appsv1.Deployment, error) {
+	hash, err := specHash(cc.Spec)
+	if err != nil {
+		return nil, err
+	}
+
+	envs, replicas := envVars(cc.Spec.Env)
+	container := v1.Container{
+		Name:            cc.Name,
+		Image:           cc.Spec.Image,
+		ImagePullPolicy: v1.PullIfNotPresent,
+		Env:             envs,
+		Command:         cc.Spec.Command,
+		Resources:       cc.Spec.Resources,
+	}
+	// the chaincode in server mode is ready once it accepts the connections of the peer
+	if cc.Spec.Port > 0 {
+		container.Ports = []v1.ContainerPort{{Name: "chaincode", ContainerPort: cc.Spec.Port, Protocol: v1.ProtocolTCP}}
+		container.ReadinessProbe = &v1.Probe{
+			Handler: v1.Handler{
+				TCPSocket: &v1.TCPSocketAction{Port: intstr.FromInt(int(cc.Spec.Port))},
+			},
+			PeriodSeconds: 10,
+		}
+	}
+	podSpec := v1.PodSpec{
+		HostAliases:      k8s.hostAliases(),
+		ImagePullSecrets: imagePullSecrets(cc.Spec.PullSecrets),
+		Affinity:         nodeAffinity(cc.Spec.Archs),
+	}
+
+	// the delivered image is loaded by the puller, it is never pulled from a registry
+	if puller := cc.Spec.Puller; puller != nil {
+		volumeMounts := make([]v1.VolumeMount, 0, len(puller.Mounts))
+		for _, m := range puller.Mounts {
+			podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+				Name:         m.Name,
+				VolumeSource: v1.VolumeSource{HostPath: &v1.HostPathVolumeSource{Path: m.HostPath}},
+			})
+			volumeMounts = append(volumeMounts, v1.VolumeMount{Name: m.Name, MountPath: m.MountPath})
+		}
+		credential, credentialMount := pullerCredential()
+		podSpec.Volumes = append(podSpec.Volumes, credential)
+		volumeMounts = append(volumeMounts, credentialMount)
+		podSpec.InitContainers = []v1.Container{
+			{
+				Name:            "puller",
+				Image:           puller.Image,
+				ImagePullPolicy: v1.PullAlways,
+				Command:         puller.Command,
+				VolumeMounts:    volumeMounts,
+			},
+		}
+		container.ImagePullPolicy = v1.PullNever
+	}
+
+	if tls := cc.Spec.TLS; tls != nil {
+		items, volumeMounts := tlsMounts(cc.Name+"-config", tls.PEM)
+		podSpec.Volumes = append(podSpec.Volumes, v1.Volume{
+			Name: cc.Name + "-config",
+			VolumeSource: v1.VolumeSource{
+				Secret: &v1.SecretVolumeSource{SecretName: tls.Secret, Items: items},
+			},
+		})
+		container.VolumeMounts = append(container.VolumeMounts, volumeMounts...)
+		replicas = 1
+	}
+	podSpec.Containers = []v1.Container{container}
+
+	labels := merge(cc.Labels, OwnerLabels(nil))
+
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cc.Name,
+			Labels:          labels,
+			Annotations:     merge(cc.Annotations, map[string]string{AnnotationSpecHash: hash}),
+			OwnerReferences: []metav1.OwnerReference{cc.OwnerReference()},
+		},
+		Spec: appsv1.DeploymentSpec{
+			Strategy: appsv1.DeploymentStrategy{
+				Type: appsv1.RecreateDeploymentStrategyType,
+			},
+			Replicas: &replicas,
+			Selector: &metav1.LabelSelector{
+				MatchLabels: map[string]string{"app": cc.Name},
+			},
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        cc.Name,
+					Labels:      merge(labels, map[string]string{"app": cc.Name}),
+					Annotations: podAnnotations(cc.Annotations),
+				},
+				Spec: podSpec,
+			},
+		},
+	}, nil
+}
+
+// ownTLSSecret make the tls secret owned by the chaincode, so it is deleted with it.
+func (k8s *K8sClient) ownTLSSecret(ctx context.Context, cc *v1alpha1.Chaincode) error {
+	secrets := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace)
+	secret, err := secrets.Get(ctx, cc.Spec.TLS.Secret, metav1.GetOptions{})
+	if err != nil {
+		return errors.Errorf("get tls secret %s failed: %v", cc.Spec.TLS.Secret, err)
+	}
+	if metav1.IsControlledBy(secret, cc) {
+		return nil
+	}
+
+	secret.OwnerReferences = append(secret.OwnerReferences, cc.OwnerReference())
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		return errors.Errorf("own tls secret %s failed: %v", secret.Name, err)
+	}
+
+	return nil
+}
+
+// applyChaincodeService create the service of the chaincode served in server mode.
+func (k8s *K8sClient) applyChaincodeService(ctx context.Context, cc *v1alpha1.Chaincode) error {
+	service := &v1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            cc.Name,
+			Labels:          merge(cc.Labels, OwnerLabels(nil)),
+			OwnerReferences: []metav1.OwnerReference{cc.OwnerReference()},
+		},
+		Spec: v1.ServiceSpec{
+			Selector: map[string]string{"app": cc.Name},
+			Ports: []v1.ServicePort{
+				{
+					Name:       "chaincode",
+					Port:       cc.Spec.Port,
+					TargetPort: intstr.FromInt(int(cc.Spec.Port)),
+				},
+			},
+		},
+	}
+
+	_, err := k8s.k8sClientSet.CoreV1().Services(k8s.namespace).Create(ctx, service, metav1.CreateOptions{})
+	if err != nil && !apierrors.IsAlreadyExists(err) {
+		return errors.Errorf("create service failed: %v", err)
+	}
+
+	return nil
+}
+
+// deleteChaincodeResource delete the chaincode resource, its objects are garbage collected.
+func (k8s *K8sClient) deleteChaincodeResource(ctx context.Context, name string) error {
+	if err := k8s.chaincodes().Delete(ctx, name, metav1.DeleteOptions{}); err != nil {
+		log.Errorf("delete chaincode %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// specHash return the hash of the chaincode spec.
+func specHash(spec v1alpha1.ChaincodeSpec) (string, error) {
+	return objectHash(spec)
+}
+
+// objectHash return the short sha256 of the object in json.
+func objectHash(object interface{}) (string, error) {
+	data, err := json.Marshal(object)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+
+	return hex.EncodeToString(sum[:])[:16], nil
+}
+
+// imageDigest return the digest of the chaincode image.
+func imageDigest(cc *v1alpha1.Chaincode) string {
+	if dgst := cc.Annotations[AnnotationImageDigest]; dgst != "" {
+		return dgst
+	}
+	if i := strings.LastIndex(cc.Spec.Image, "@"); i >= 0 {
+		return cc.Spec.Image[i+1:]
+	}
+
+	return ""
+}
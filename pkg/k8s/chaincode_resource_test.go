@@ -0,0 +1,241 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+)
+
+func newResourceClient() *K8sClient {
+	return &K8sClient{
+		k8sClientSet: fake.NewSimpleClientset(),
+		dynamic: dynamicfake.NewSimpleDynamicClientWithCustomListKinds(
+			runtime.NewScheme(),
+			map[schema.GroupVersionResource]string{v1alpha1.Resource: "ChaincodeList"},
+		),
+		namespace: "fabric",
+	}
+}
+
+func TestK8sClient_ReconcileChaincodeResource(t *testing.T) {
+	ctx := context.Background()
+	client := newResourceClient()
+	name := "dev-peer0-org1-mycc-1-0"
+
+	cc := &v1alpha1.Chaincode{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        name,
+			Labels:      map[string]string{LabelManagedBy: ManagedBy, LabelChaincodeName: "mycc"},
+			Annotations: map[string]string{AnnotationState: STATE_CREATED, AnnotationImageDigest: "sha256:8600907b"},
+		},
+		Spec: v1alpha1.ChaincodeSpec{
+			ContainerID: "dev-peer0.org1-mycc-1.0",
+			Image:       "harbor.example.com/org1/mycc@sha256:8600907b",
+			Env:         []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0", "CORE_PEER_TLS_ENABLED=true"},
+			PullSecrets: []string{"registry-secret"},
+		},
+	}
+	if err := client.ApplyChaincodeResource(ctx, cc); err != nil {
+		t.Fatalf("ApplyChaincodeResource() error = %v", err)
+	}
+
+	// the deployment waits for the tls files of the peer
+	if err := client.ReconcileChaincodeResource(ctx, name); err != nil {
+		t.Fatalf("ReconcileChaincodeResource() error = %v", err)
+	}
+	deployment, err := client.GetDeployment(ctx, name)
+	if err != nil {
+		t.Fatalf("deployment is not created: %v", err)
+	}
+	if *deployment.Spec.Replicas != 0 || len(deployment.OwnerReferences) != 1 || deployment.OwnerReferences[0].Kind != v1alpha1.Kind {
+		t.Errorf("deployment replicas %d, owners %v, want 0 replicas owned by the chaincode",
+			*deployment.Spec.Replicas, deployment.OwnerReferences)
+	}
+	if deployment.Labels[LabelChaincodeName] != "mycc" || deployment.Spec.Template.Spec.ImagePullSecrets[0].Name != "registry-secret" {
+		t.Errorf("deployment labels %v, pull secrets %v", deployment.Labels, deployment.Spec.Template.Spec.ImagePullSecrets)
+	}
+	got, _ := client.GetChaincodeResource(ctx, name)
+	if got.Status.Phase != v1alpha1.PHASE_PENDING || got.Status.Digest != "sha256:8600907b" || got.Status.StartedAt != nil {
+		t.Errorf("status = %+v, want pending with the digest", got.Status)
+	}
+
+	// the state is changed on the deployment, the tls files are uploaded and the spec is edited
+	_ = client.AnnotateDeployment(ctx, name, map[string]string{AnnotationState: STATE_CONFIGURED})
+	err = client.CreateTLSSecret(ctx, name, map[string]string{"client.key": "key", "client.crt": "crt", "peer.crt": "ca"})
+	if err != nil {
+		t.Fatalf("CreateTLSSecret() error = %v", err)
+	}
+	got.Spec.TLS = &v1alpha1.TLSReference{Secret: TLSSecretName(name)}
+	got.Spec.Resources = v1.ResourceRequirements{Limits: v1.ResourceList{v1.ResourceMemory: resource.MustParse("256Mi")}}
+	got.Spec.Port = 9999
+	if err := client.ApplyChaincodeResource(ctx, got); err != nil {
+		t.Fatalf("ApplyChaincodeResource() error = %v", err)
+	}
+	if err := client.ReconcileChaincodeResource(ctx, name); err != nil {
+		t.Fatalf("ReconcileChaincodeResource() error = %v", err)
+	}
+
+	deployment, _ = client.GetDeployment(ctx, name)
+	spec := deployment.Spec.Template.Spec
+	if *deployment.Spec.Replicas != 1 || spec.Volumes[0].Secret == nil || spec.Volumes[0].Secret.SecretName != name+"-tls" {
+		t.Errorf("deployment replicas %d, volumes %v, want 1 replica mounting the tls secret", *deployment.Spec.Replicas, spec.Volumes)
+	}
+	if len(spec.Containers[0].VolumeMounts) != 3 || spec.Containers[0].Resources.Limits.Memory().String() != "256Mi" {
+		t.Errorf("container mounts %v, resources %v", spec.Containers[0].VolumeMounts, spec.Containers[0].Resources)
+	}
+	if deployment.Annotations[AnnotationState] != STATE_CONFIGURED {
+		t.Errorf("state = %s, want it kept", deployment.Annotations[AnnotationState])
+	}
+
+	secret, _ := client.k8sClientSet.CoreV1().Secrets("fabric").Get(ctx, name+"-tls", metav1.GetOptions{})
+	if len(secret.OwnerReferences) != 1 {
+		t.Errorf("tls secret owners %v, want the chaincode", secret.OwnerReferences)
+	}
+	service, err := client.k8sClientSet.CoreV1().Services("fabric").Get(ctx, name, metav1.GetOptions{})
+	if err != nil || service.Spec.Ports[0].Port != 9999 || service.Spec.Selector["app"] != name {
+		t.Errorf("service %v error = %v, want the chaincode port", service, err)
+	}
+	if probe := spec.Containers[0].ReadinessProbe; probe == nil || probe.TCPSocket == nil || probe.TCPSocket.Port.IntValue() != 9999 {
+		t.Errorf("readiness probe %v, want a tcp probe of the chaincode port", probe)
+	}
+
+	// the chaincode is running once the probe passes
+	deployment.Status.ReadyReplicas = 1
+	if _, err := client.k8sClientSet.AppsV1().Deployments("fabric").UpdateStatus(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReconcileChaincodeResource(ctx, name); err != nil {
+		t.Fatalf("ReconcileChaincodeResource() error = %v", err)
+	}
+	got, _ = client.GetChaincodeResource(ctx, name)
+	if got.Status.Phase != v1alpha1.PHASE_RUNNING || got.Status.StartedAt == nil || got.Status.ReadySince == nil {
+		t.Errorf("status = %+v, want running with the time it was started and became ready", got.Status)
+	}
+
+	// the chaincode is deleted with its deployment, it would be recreated otherwise
+	if err := client.DeleteChaincodeDeployment(ctx, name); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.getChaincodeResource(ctx, name); !apierrors.IsNotFound(err) {
+		t.Errorf("chaincode is not deleted with the deployment: %v", err)
+	}
+}
+
+func TestK8sClient_ReconcileChaincodeResource_failed(t *testing.T) {
+	ctx := context.Background()
+	client := newResourceClient()
+
+	cc := &v1alpha1.Chaincode{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycc"},
+		Spec: v1alpha1.ChaincodeSpec{
+			Image: "mycc:1.0",
+			TLS:   &v1alpha1.TLSReference{Secret: "mycc-tls"},
+		},
+	}
+	if err := client.ApplyChaincodeResource(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+
+	// the tls secret is missing, the error is reported in the status
+	if err := client.ReconcileChaincodeResource(ctx, "mycc"); err == nil {
+		t.Errorf("ReconcileChaincodeResource() without the tls secret succeeded")
+	}
+	got, _ := client.GetChaincodeResource(ctx, "mycc")
+	if got.Status.Phase != v1alpha1.PHASE_FAILED || got.Status.LastError == "" {
+		t.Errorf("status = %+v, want failed with the error", got.Status)
+	}
+	if _, err := client.GetDeployment(ctx, "mycc"); err == nil {
+		t.Errorf("deployment is created without the tls secret")
+	}
+}
+
+func TestK8sClient_ReconcileChaincodeResource_rolledBack(t *testing.T) {
+	ctx := context.Background()
+	client := newResourceClient()
+
+	cc := &v1alpha1.Chaincode{
+		ObjectMeta: metav1.ObjectMeta{Name: "mycc-1-1"},
+		Spec: v1alpha1.ChaincodeSpec{
+			Image: "mycc:1.1",
+			Env:   []string{"CORE_PEER_TLS_ENABLED=false"},
+			Port:  9999,
+		},
+	}
+	if err := client.ApplyChaincodeResource(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReconcileChaincodeResource(ctx, cc.Name); err != nil {
+		t.Fatal(err)
+	}
+
+	// the version is not ready in time, it is run with the image of the previous version
+	cc.Annotations = map[string]string{AnnotationRolledBack: "mycc-1-0"}
+	cc.Spec.Image = "mycc:1.0"
+	if err := client.ApplyChaincodeResource(ctx, cc); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ReconcileChaincodeResource(ctx, cc.Name); err != nil {
+		t.Fatalf("ReconcileChaincodeResource() error = %v", err)
+	}
+	deployment, _ := client.GetDeployment(ctx, cc.Name)
+	if *deployment.Spec.Replicas != 1 || deployment.Spec.Template.Spec.Containers[0].Image != "mycc:1.0" {
+		t.Errorf("deployment replicas %d, image %s, want the previous image", *deployment.Spec.Replicas,
+			deployment.Spec.Template.Spec.Containers[0].Image)
+	}
+	got, _ := client.GetChaincodeResource(ctx, cc.Name)
+	if got.Status.Phase != v1alpha1.PHASE_STARTING || got.Status.LastError != "not ready in time, rolled back to the image of mycc-1-0" {
+		t.Errorf("status = %+v, want starting with the previous image", got.Status)
+	}
+}
+
+func TestK8sClient_ListTLSSecrets(t *testing.T) {
+	ctx := context.Background()
+	client := newResourceClient()
+
+	if err := client.CreateTLSSecret(ctx, "mycc-1-0", map[string]string{"client.key": "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateTLSSecret(ctx, "mycc-1-1", map[string]string{"client.key": "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.ApplyDockerConfigSecret(ctx, "registry", []byte("{}")); err != nil {
+		t.Fatal(err)
+	}
+	// the secret owned by its chaincode is deleted with it
+	secrets := client.k8sClientSet.CoreV1().Secrets("fabric")
+	owned, _ := secrets.Get(ctx, TLSSecretName("mycc-1-1"), metav1.GetOptions{})
+	controller := true
+	owned.OwnerReferences = []metav1.OwnerReference{{Kind: v1alpha1.Kind, Name: "mycc-1-1", Controller: &controller}}
+	if _, err := secrets.Update(ctx, owned, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := client.ListTLSSecrets(ctx)
+	if err != nil || len(got) != 1 || got[0].Name != TLSSecretName("mycc-1-0") {
+		t.Fatalf("ListTLSSecrets() = %v, %v, want the secret of mycc-1-0", got, err)
+	}
+
+	if err := client.DeleteTLSSecret(ctx, "mycc-1-0"); err != nil {
+		t.Errorf("DeleteTLSSecret() error = %v", err)
+	}
+	if err := client.DeleteTLSSecret(ctx, "mycc-1-0"); err != nil {
+		t.Errorf("DeleteTLSSecret() of deleted secret error = %v", err)
+	}
+	if got, _ := client.ListTLSSecrets(ctx); len(got) != 0 {
+		t.Errorf("ListTLSSecrets() after delete = %v, want none", got)
+	}
+}
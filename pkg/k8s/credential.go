@@ -0,0 +1,112 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/marmotedu/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+const (
+	// PullerCredentialAudience is the audience of the service account token projected into the puller.
+	PullerCredentialAudience = "peitho"
+	// PullerCredentialPath is where the puller reads its service account token.
+	PullerCredentialPath = "/var/run/secrets/peitho/token"
+
+	pullerCredentialVolume = "peitho-credential"
+	// the kubelet rotates the token before it expires, it is invalid once the pod is deleted
+	pullerCredentialExpiration = 600
+	// podNameExtra is the pod a service account token is bound to.
+	podNameExtra = "authentication.kubernetes.io/pod-name"
+)
+
+// ErrCredentialRejected the puller credential is not a token bound to a chaincode pod running the image.
+var ErrCredentialRejected = errors.New("puller credential rejected")
+
+// pullerCredential return the projected service account token volume of the puller and its mount.
+func pullerCredential() (v1.Volume, v1.VolumeMount) {
+	expiration := int64(pullerCredentialExpiration)
+	volume := v1.Volume{
+		Name: pullerCredentialVolume,
+		VolumeSource: v1.VolumeSource{
+			Projected: &v1.ProjectedVolumeSource{
+				Sources: []v1.VolumeProjection{
+					{
+						ServiceAccountToken: &v1.ServiceAccountTokenProjection{
+							Audience:          PullerCredentialAudience,
+							ExpirationSeconds: &expiration,
+							Path:              "token",
+						},
+					},
+				},
+			},
+		},
+	}
+	mount := v1.VolumeMount{Name: pullerCredentialVolume, MountPath: "/var/run/secrets/peitho", ReadOnly: true}
+
+	return volume, mount
+}
+
+// ReviewPullerCredential check credential is a service account token bound to a pod of peitho
+// in the namespace, which runs image.
+func (k8s *K8sClient) ReviewPullerCredential(ctx context.Context, credential string, image string) error {
+	review, err := k8s.k8sClientSet.AuthenticationV1().TokenReviews().Create(ctx, &authenticationv1.TokenReview{
+		Spec: authenticationv1.TokenReviewSpec{
+			Token:     credential,
+			Audiences: []string{PullerCredentialAudience},
+		},
+	}, metav1.CreateOptions{})
+	if err != nil {
+		log.Errorf("review puller credential failed: %v", err)
+
+		return err
+	}
+	if !review.Status.Authenticated {
+		log.Warnf("puller credential is not authenticated: %s", review.Status.Error)
+
+		return ErrCredentialRejected
+	}
+
+	// the pod must be in the namespace, the token is issued for a service account of it
+	if !strings.HasPrefix(review.Status.User.Username, fmt.Sprintf("system:serviceaccount:%s:", k8s.namespace)) {
+		log.Warnf("puller credential of %s is not in namespace %s", review.Status.User.Username, k8s.namespace)
+
+		return ErrCredentialRejected
+	}
+	podNames := review.Status.User.Extra[podNameExtra]
+	if len(podNames) != 1 {
+		log.Warnf("puller credential of %s is not bound to a pod", review.Status.User.Username)
+
+		return ErrCredentialRejected
+	}
+
+	pod, err := k8s.k8sClientSet.CoreV1().Pods(k8s.namespace).Get(ctx, podNames[0], metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get pod %s failed: %v", podNames[0], err)
+
+		return ErrCredentialRejected
+	}
+	if pod.Labels[LabelManagedBy] != ManagedBy {
+		log.Warnf("pod %s is not managed by peitho", pod.Name)
+
+		return ErrCredentialRejected
+	}
+	for _, container := range pod.Spec.Containers {
+		if container.Image == image {
+			return nil
+		}
+	}
+	log.Warnf("pod %s does not run %s", pod.Name, image)
+
+	return ErrCredentialRejected
+}
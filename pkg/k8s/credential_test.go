@@ -0,0 +1,108 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	"github.com/marmotedu/errors"
+	authenticationv1 "k8s.io/api/authentication/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+// reviewedClient return a client, whose token reviews authenticate the tokens in users.
+func reviewedClient(users map[string]authenticationv1.UserInfo, objects ...runtime.Object) *K8sClient {
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("create", "tokenreviews", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		review := action.(clienttesting.CreateAction).GetObject().(*authenticationv1.TokenReview)
+		user, ok := users[review.Spec.Token]
+		if len(review.Spec.Audiences) != 1 || review.Spec.Audiences[0] != PullerCredentialAudience {
+			ok = false
+		}
+		review.Status = authenticationv1.TokenReviewStatus{Authenticated: ok, User: user}
+
+		return true, review, nil
+	})
+
+	return &K8sClient{k8sClientSet: client, namespace: "fabric"}
+}
+
+func podUser(namespace string, pod string) authenticationv1.UserInfo {
+	return authenticationv1.UserInfo{
+		Username: "system:serviceaccount:" + namespace + ":default",
+		Extra:    map[string]authenticationv1.ExtraValue{podNameExtra: {pod}},
+	}
+}
+
+func TestK8sClient_ReviewPullerCredential(t *testing.T) {
+	ctx := context.Background()
+	image := "dev-peer0-org1-mycc-1.0"
+	pod := func(name string, labels map[string]string) *v1.Pod {
+		return &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fabric", Labels: labels},
+			Spec:       v1.PodSpec{Containers: []v1.Container{{Name: "chaincode", Image: image}}},
+		}
+	}
+	client := reviewedClient(
+		map[string]authenticationv1.UserInfo{
+			"chaincode": podUser("fabric", "dev-peer0-org1-mycc-1-0-abc"),
+			"other":     podUser("other", "dev-peer0-org1-mycc-1-0-abc"),
+			"unmanaged": podUser("fabric", "couchdb0-abc"),
+			"unbound":   {Username: "system:serviceaccount:fabric:default"},
+		},
+		pod("dev-peer0-org1-mycc-1-0-abc", map[string]string{LabelManagedBy: ManagedBy}),
+		pod("couchdb0-abc", nil),
+	)
+
+	if err := client.ReviewPullerCredential(ctx, "chaincode", image); err != nil {
+		t.Errorf("ReviewPullerCredential() error = %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		credential string
+		image      string
+	}{
+		{name: "not authenticated", credential: "forged", image: image},
+		{name: "other image", credential: "chaincode", image: "dev-peer0-org1-othercc-1.0"},
+		{name: "other namespace", credential: "other", image: image},
+		{name: "not bound to a pod", credential: "unbound", image: image},
+		{name: "pod not managed by peitho", credential: "unmanaged", image: image},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := client.ReviewPullerCredential(ctx, tt.credential, tt.image); !errors.Is(err, ErrCredentialRejected) {
+				t.Errorf("ReviewPullerCredential() error = %v, want %v", err, ErrCredentialRejected)
+			}
+		})
+	}
+}
+
+func TestK8sClient_CreateChaincodeDeploymentWithPuller_credential(t *testing.T) {
+	ctx := context.Background()
+	client := &K8sClient{k8sClientSet: fake.NewSimpleClientset(), namespace: "fabric"}
+	name := "dev-peer0-org1-mycc-1-0"
+
+	err := client.CreateChaincodeDeploymentWithPuller(ctx, name, "mycc", nil, nil, "puller", nil, nil, nil, nil, nil)
+	if err != nil {
+		t.Fatalf("CreateChaincodeDeploymentWithPuller() error = %v", err)
+	}
+
+	deployment, _ := client.k8sClientSet.AppsV1().Deployments("fabric").Get(ctx, name, metav1.GetOptions{})
+	volumes := deployment.Spec.Template.Spec.Volumes
+	if len(volumes) != 1 || volumes[0].Projected == nil ||
+		volumes[0].Projected.Sources[0].ServiceAccountToken.Audience != PullerCredentialAudience {
+		t.Errorf("volumes = %v, want the projected service account token", volumes)
+	}
+	mounts := deployment.Spec.Template.Spec.InitContainers[0].VolumeMounts
+	if len(mounts) != 1 || mounts[0].MountPath+"/token" != PullerCredentialPath {
+		t.Errorf("puller mounts = %v, want the credential at %s", mounts, PullerCredentialPath)
+	}
+}
@@ -0,0 +1,411 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/tools/cache"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// AnnotationAppliedHash is the hash of the fields peitho last applied to a chaincode deployment or tls configmap,
+// the live object not matching it is edited by hand.
+const AnnotationAppliedHash = "peitho.io/applied-hash"
+
+// STATE_REMOVED the deployment or configmap is deleted by peitho, it is not recreated by the drift detector.
+const STATE_REMOVED = "removed"
+
+// The reasons of the drift events.
+const (
+	REASON_DRIFTED        = "Drifted"
+	REASON_DRIFT_RESTORED = "DriftRestored"
+	REASON_DRIFT_FAILED   = "DriftRestoreFailed"
+)
+
+// configMapSuffix is the suffix of the tls configmap of a chaincode deployment.
+const configMapSuffix = "-configmap"
+
+// managedDeployment is what peitho applies to the pods of a chaincode deployment, the replicas are left out
+// for the sweeper and the peer, so are the fields defaulted by the api server.
+type managedDeployment struct {
+	InitContainers []managedContainer `json:"initContainers,omitempty"`
+	Containers     []managedContainer `json:"containers,omitempty"`
+	Volumes        []managedVolume    `json:"volumes,omitempty"`
+	PullSecrets    []string           `json:"pullSecrets,omitempty"`
+	HostAliases    []v1.HostAlias     `json:"hostAliases,omitempty"`
+	Affinity       *v1.Affinity       `json:"affinity,omitempty"`
+}
+
+type managedContainer struct {
+	Name    string           `json:"name"`
+	Image   string           `json:"image"`
+	Command []string         `json:"command,omitempty"`
+	Env     []v1.EnvVar      `json:"env,omitempty"`
+	Mounts  []v1.VolumeMount `json:"mounts,omitempty"`
+}
+
+type managedVolume struct {
+	Name      string         `json:"name"`
+	ConfigMap string         `json:"configMap,omitempty"`
+	Secret    string         `json:"secret,omitempty"`
+	HostPath  string         `json:"hostPath,omitempty"`
+	Items     []v1.KeyToPath `json:"items,omitempty"`
+}
+
+func managedContainers(containers []v1.Container) []managedContainer {
+	var result []managedContainer
+	for _, c := range containers {
+		result = append(result, managedContainer{
+			Name:    c.Name,
+			Image:   c.Image,
+			Command: c.Command,
+			Env:     c.Env,
+			Mounts:  c.VolumeMounts,
+		})
+	}
+
+	return result
+}
+
+// deploymentHash return the hash of the fields peitho applies to the chaincode deployment.
+func deploymentHash(deployment *appsv1.Deployment) string {
+	spec := deployment.Spec.Template.Spec
+	managed := managedDeployment{
+		InitContainers: managedContainers(spec.InitContainers),
+		Containers:     managedContainers(spec.Containers),
+		HostAliases:    spec.HostAliases,
+		Affinity:       spec.Affinity,
+	}
+	for _, volume := range spec.Volumes {
+		mv := managedVolume{Name: volume.Name}
+		switch {
+		case volume.ConfigMap != nil:
+			mv.ConfigMap, mv.Items = volume.ConfigMap.Name, volume.ConfigMap.Items
+		case volume.Secret != nil:
+			mv.Secret, mv.Items = volume.Secret.SecretName, volume.Secret.Items
+		case volume.HostPath != nil:
+			mv.HostPath = volume.HostPath.Path
+		}
+		managed.Volumes = append(managed.Volumes, mv)
+	}
+	for _, secret := range spec.ImagePullSecrets {
+		managed.PullSecrets = append(managed.PullSecrets, secret.Name)
+	}
+
+	hash, _ := objectHash(managed)
+
+	return hash
+}
+
+// configMapHash return the hash of the tls files in the configmap.
+func configMapHash(configMap *v1.ConfigMap) string {
+	hash, _ := objectHash(configMap.Data)
+
+	return hash
+}
+
+// stampDeployment record the hash of what is applied to the deployment.
+func stampDeployment(deployment *appsv1.Deployment) {
+	deployment.Annotations = merge(deployment.Annotations, map[string]string{
+		AnnotationAppliedHash: deploymentHash(deployment),
+	})
+}
+
+// stampConfigMap record the hash of what is applied to the configmap.
+func stampConfigMap(configMap *v1.ConfigMap) {
+	configMap.Annotations = merge(configMap.Annotations, map[string]string{
+		AnnotationAppliedHash: configMapHash(configMap),
+	})
+}
+
+// driftDetector keep the last copies of the watched objects matching what peitho applied,
+// the drifted ones are restored from them and the deleted ones recreated.
+type driftDetector struct {
+	k8s        *K8sClient
+	reportOnly bool
+
+	lock        sync.Mutex
+	deployments map[string]*appsv1.Deployment
+	configMaps  map[string]*v1.ConfigMap
+	// reported is the hash of the drifted object last reported, by kind and name
+	reported map[string]string
+}
+
+func newDriftDetector(k8s *K8sClient, reportOnly bool) *driftDetector {
+	return &driftDetector{
+		k8s:         k8s,
+		reportOnly:  reportOnly,
+		deployments: make(map[string]*appsv1.Deployment),
+		configMaps:  make(map[string]*v1.ConfigMap),
+		reported:    make(map[string]string),
+	}
+}
+
+// DetectDrift watch the chaincode deployments and their tls configmaps until ctx is done, the ones edited or
+// deleted by hand are restored to what peitho last applied, or only reported in report only mode.
+// The deployments reconciled from chaincode resources are left to the chaincode controller.
+func (k8s *K8sClient) DetectDrift(ctx context.Context, opt *options.DriftOption) error {
+	if !opt.Enable {
+		return nil
+	}
+	log.Infof("starting drift detector, report only: %v", opt.ReportOnly)
+
+	detector := newDriftDetector(k8s, opt.ReportOnly)
+	factory := informers.NewSharedInformerFactoryWithOptions(
+		k8s.k8sClientSet,
+		time.Duration(opt.Resync)*time.Second,
+		informers.WithNamespace(k8s.namespace),
+		informers.WithTweakListOptions(func(options *metav1.ListOptions) {
+			options.LabelSelector = labels.SelectorFromSet(OwnerLabels(nil)).String()
+		}),
+	)
+	factory.Apps().V1().Deployments().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			k8s.recorder.observe(obj.(*appsv1.Deployment))
+			detector.deploymentChanged(ctx, obj.(*appsv1.Deployment))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			k8s.recorder.observe(obj.(*appsv1.Deployment))
+			detector.deploymentChanged(ctx, obj.(*appsv1.Deployment))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if deployment, ok := deletedObject(obj).(*appsv1.Deployment); ok {
+				detector.deploymentDeleted(ctx, deployment)
+			}
+		},
+	})
+	factory.Core().V1().ConfigMaps().Informer().AddEventHandler(cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			detector.configMapChanged(ctx, obj.(*v1.ConfigMap))
+		},
+		UpdateFunc: func(_, obj interface{}) {
+			detector.configMapChanged(ctx, obj.(*v1.ConfigMap))
+		},
+		DeleteFunc: func(obj interface{}) {
+			if configMap, ok := deletedObject(obj).(*v1.ConfigMap); ok {
+				detector.configMapDeleted(ctx, configMap)
+			}
+		},
+	})
+
+	factory.Start(ctx.Done())
+	for informer, synced := range factory.WaitForCacheSync(ctx.Done()) {
+		if !synced && ctx.Err() == nil {
+			return errors.Errorf("sync %v failed", informer)
+		}
+	}
+
+	<-ctx.Done()
+	log.Info("drift detector stopped")
+
+	return nil
+}
+
+// deletedObject return the object of a delete event, the final state may be unknown when the watch is missed.
+func deletedObject(obj interface{}) interface{} {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		return tombstone.Obj
+	}
+
+	return obj
+}
+
+func (d *driftDetector) deploymentChanged(ctx context.Context, live *appsv1.Deployment) {
+	applied := live.Annotations[AnnotationAppliedHash]
+	if metav1.GetControllerOf(live) != nil || live.DeletionTimestamp != nil {
+		return
+	}
+
+	hash := deploymentHash(live)
+	d.lock.Lock()
+	last := d.deployments[live.Name]
+	if applied != "" && applied == hash {
+		d.deployments[live.Name] = live.DeepCopy()
+		delete(d.reported, "deployment/"+live.Name)
+		d.lock.Unlock()
+
+		return
+	}
+	d.lock.Unlock()
+
+	// the deployments created before the drift detector have no hash
+	if (applied == "" && last == nil) || !d.report("deployment/"+live.Name, hash) {
+		return
+	}
+
+	log.Warnf("deployment %s drifted from what peitho applied", live.Name)
+	d.k8s.recorder.Eventf(live.Name, v1.EventTypeWarning, REASON_DRIFTED, "deployment drifted from what peitho applied")
+	if d.reportOnly {
+		return
+	}
+	if last == nil {
+		log.Warnf("deployment %s can not be restored, it is not seen as peitho applied it", live.Name)
+
+		return
+	}
+
+	deployment := live.DeepCopy()
+	spec, applySpec := &deployment.Spec.Template.Spec, last.Spec.Template.Spec
+	spec.InitContainers = applySpec.InitContainers
+	spec.Containers = applySpec.Containers
+	spec.Volumes = applySpec.Volumes
+	spec.ImagePullSecrets = applySpec.ImagePullSecrets
+	spec.HostAliases = applySpec.HostAliases
+	spec.Affinity = applySpec.Affinity
+	deployment.Annotations = merge(deployment.Annotations, map[string]string{
+		AnnotationAppliedHash: last.Annotations[AnnotationAppliedHash],
+	})
+
+	_, err := d.k8s.k8sClientSet.AppsV1().Deployments(d.k8s.namespace).Update(ctx, deployment, metav1.UpdateOptions{})
+	d.restored("deployment/"+live.Name, "deployment "+live.Name, live.Name, err)
+}
+
+func (d *driftDetector) deploymentDeleted(ctx context.Context, live *appsv1.Deployment) {
+	d.lock.Lock()
+	last := d.deployments[live.Name]
+	delete(d.deployments, live.Name)
+	delete(d.reported, "deployment/"+live.Name)
+	d.lock.Unlock()
+
+	if last == nil || live.Annotations[AnnotationState] == STATE_REMOVED || metav1.GetControllerOf(live) != nil {
+		return
+	}
+
+	log.Warnf("deployment %s is deleted by hand", live.Name)
+	d.k8s.recorder.Eventf(live.Name, v1.EventTypeWarning, REASON_DRIFTED, "deployment is deleted by hand")
+	if d.reportOnly {
+		return
+	}
+
+	deployment := last.DeepCopy()
+	deployment.ObjectMeta = metav1.ObjectMeta{
+		Name:        last.Name,
+		Labels:      last.Labels,
+		Annotations: last.Annotations,
+	}
+	deployment.Status = appsv1.DeploymentStatus{}
+
+	created, err := d.k8s.k8sClientSet.AppsV1().Deployments(d.k8s.namespace).Create(ctx, deployment, metav1.CreateOptions{})
+	d.k8s.recorder.observe(created)
+	d.restored("deployment/"+live.Name, "deployment "+live.Name, live.Name, err)
+}
+
+func (d *driftDetector) configMapChanged(ctx context.Context, live *v1.ConfigMap) {
+	applied := live.Annotations[AnnotationAppliedHash]
+	if !strings.HasSuffix(live.Name, configMapSuffix) || live.DeletionTimestamp != nil {
+		return
+	}
+
+	hash := configMapHash(live)
+	d.lock.Lock()
+	last := d.configMaps[live.Name]
+	if applied != "" && applied == hash {
+		d.configMaps[live.Name] = live.DeepCopy()
+		delete(d.reported, "configmap/"+live.Name)
+		d.lock.Unlock()
+
+		return
+	}
+	d.lock.Unlock()
+
+	if (applied == "" && last == nil) || !d.report("configmap/"+live.Name, hash) {
+		return
+	}
+
+	deployment := strings.TrimSuffix(live.Name, configMapSuffix)
+	log.Warnf("tls configmap %s drifted from what peitho applied", live.Name)
+	d.k8s.recorder.Eventf(deployment, v1.EventTypeWarning, REASON_DRIFTED, "tls configmap %s drifted from what peitho applied", live.Name)
+	if d.reportOnly {
+		return
+	}
+	if last == nil {
+		log.Warnf("tls configmap %s can not be restored, it is not seen as peitho applied it", live.Name)
+
+		return
+	}
+
+	configMap := live.DeepCopy()
+	configMap.Data = last.Data
+	configMap.Annotations = merge(configMap.Annotations, map[string]string{
+		AnnotationAppliedHash: last.Annotations[AnnotationAppliedHash],
+	})
+
+	_, err := d.k8s.k8sClientSet.CoreV1().ConfigMaps(d.k8s.namespace).Update(ctx, configMap, metav1.UpdateOptions{})
+	d.restored("configmap/"+live.Name, "tls configmap "+live.Name, deployment, err)
+}
+
+func (d *driftDetector) configMapDeleted(ctx context.Context, live *v1.ConfigMap) {
+	d.lock.Lock()
+	last := d.configMaps[live.Name]
+	delete(d.configMaps, live.Name)
+	delete(d.reported, "configmap/"+live.Name)
+	d.lock.Unlock()
+
+	if last == nil || live.Annotations[AnnotationState] == STATE_REMOVED {
+		return
+	}
+
+	deployment := strings.TrimSuffix(live.Name, configMapSuffix)
+	log.Warnf("tls configmap %s is deleted by hand", live.Name)
+	d.k8s.recorder.Eventf(deployment, v1.EventTypeWarning, REASON_DRIFTED, "tls configmap %s is deleted by hand", live.Name)
+	if d.reportOnly {
+		return
+	}
+
+	configMap := &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        last.Name,
+			Labels:      last.Labels,
+			Annotations: last.Annotations,
+		},
+		Data: last.Data,
+	}
+
+	_, err := d.k8s.k8sClientSet.CoreV1().ConfigMaps(d.k8s.namespace).Create(ctx, configMap, metav1.CreateOptions{})
+	d.restored("configmap/"+live.Name, "tls configmap "+live.Name, deployment, err)
+}
+
+// report return whether the drift to the hash is not reported yet, the status updates of a drifted
+// deployment and the resyncs do not report it again.
+func (d *driftDetector) report(key string, hash string) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.reported[key] == hash {
+		return false
+	}
+	d.reported[key] = hash
+
+	return true
+}
+
+// restored log and record the correction of the object on the events of the deployment,
+// a failed one is retried on the next change or resync.
+func (d *driftDetector) restored(key string, object string, deployment string, err error) {
+	if err != nil {
+		log.Errorf("restore %s failed: %v", object, err)
+		d.k8s.recorder.Eventf(deployment, v1.EventTypeWarning, REASON_DRIFT_FAILED, "restore %s failed: %v", object, err)
+		d.lock.Lock()
+		delete(d.reported, key)
+		d.lock.Unlock()
+
+		return
+	}
+
+	log.Infof("restored %s to what peitho applied", object)
+	d.k8s.recorder.Eventf(deployment, v1.EventTypeNormal, REASON_DRIFT_RESTORED, "restored %s to what peitho applied", object)
+}
@@ -0,0 +1,173 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+const driftDeployment = "dev-peer0-org1-mycc-1-0"
+
+// startDrift create the chaincode deployment with its tls configmap as the peer does, and start the drift
+// detector watching them.
+func startDrift(t *testing.T, reportOnly bool) (*K8sClient, *record.FakeRecorder) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	recorder := record.NewFakeRecorder(10)
+	clientSet := fake.NewSimpleClientset()
+	client := &K8sClient{
+		k8sClientSet: clientSet,
+		recorder:     NewEventRecorder(recorder, "fabric"),
+		namespace:    "fabric",
+	}
+
+	env := []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0", "CORE_PEER_TLS_ENABLED=true"}
+	labels := ChaincodeLabels("dev-peer0.org1-mycc-1.0", env)
+	err := client.CreateChaincodeDeployment(ctx, driftDeployment, "mycc:1.0", env, nil, nil, nil, labels, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := client.CreateConfigMap(ctx, driftDeployment, map[string]string{"client.key": "key"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := client.UpdateDeployment(ctx, driftDeployment); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		opt := &options.DriftOption{Enable: true, ReportOnly: reportOnly}
+		if err := client.DetectDrift(ctx, opt); err != nil {
+			t.Errorf("DetectDrift() error = %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-done
+	})
+
+	// the objects are listed before they are edited by hand
+	eventually(t, func() bool {
+		watches := 0
+		for _, action := range clientSet.Actions() {
+			if action.GetVerb() == "watch" {
+				watches++
+			}
+		}
+
+		return watches == 2
+	})
+	time.Sleep(100 * time.Millisecond)
+
+	return client, recorder
+}
+
+func eventually(t *testing.T, condition func() bool) {
+	t.Helper()
+
+	for i := 0; i < 50; i++ {
+		if condition() {
+			return
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	t.Fatalf("condition is not met in 5s")
+}
+
+func TestK8sClient_DetectDrift(t *testing.T) {
+	ctx := context.Background()
+	client, recorder := startDrift(t, false)
+	deployments := client.k8sClientSet.AppsV1().Deployments("fabric")
+	configMaps := client.k8sClientSet.CoreV1().ConfigMaps("fabric")
+
+	// the image and the tls mount are edited by hand, the replicas are not managed
+	deployment, _ := deployments.Get(ctx, driftDeployment, metav1.GetOptions{})
+	deployment.Spec.Template.Spec.Containers[0].Image = "mycc:hacked"
+	deployment.Spec.Template.Spec.Containers[0].VolumeMounts = nil
+	replicas := int32(3)
+	deployment.Spec.Replicas = &replicas
+	if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		deployment, _ = deployments.Get(ctx, driftDeployment, metav1.GetOptions{})
+
+		return deployment.Spec.Template.Spec.Containers[0].Image == "mycc:1.0"
+	})
+	if len(deployment.Spec.Template.Spec.Containers[0].VolumeMounts) != 3 || *deployment.Spec.Replicas != 3 {
+		t.Errorf("mounts %v, replicas %d, want the mounts restored and the replicas kept",
+			deployment.Spec.Template.Spec.Containers[0].VolumeMounts, *deployment.Spec.Replicas)
+	}
+	if event := <-recorder.Events; event != "Warning Drifted deployment drifted from what peitho applied" {
+		t.Errorf("event = %q", event)
+	}
+	if event := <-recorder.Events; !strings.HasPrefix(event, "Normal DriftRestored") {
+		t.Errorf("event = %q", event)
+	}
+
+	// the tls configmap is deleted by hand
+	if err := configMaps.Delete(ctx, driftDeployment+"-configmap", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	eventually(t, func() bool {
+		configMap, err := configMaps.Get(ctx, driftDeployment+"-configmap", metav1.GetOptions{})
+
+		return err == nil && configMap.Data["client.key"] == "key"
+	})
+
+	// the deployment is deleted by peitho, it is not recreated
+	if err := client.DeleteChaincodeDeployment(ctx, driftDeployment); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if _, err := deployments.Get(ctx, driftDeployment, metav1.GetOptions{}); err == nil {
+		t.Errorf("deployment deleted by peitho is recreated")
+	}
+}
+
+func TestK8sClient_DetectDrift_reportOnly(t *testing.T) {
+	ctx := context.Background()
+	client, recorder := startDrift(t, true)
+	deployments := client.k8sClientSet.AppsV1().Deployments("fabric")
+
+	deployment, _ := deployments.Get(ctx, driftDeployment, metav1.GetOptions{})
+	deployment.Spec.Template.Spec.Containers[0].Image = "mycc:hacked"
+	if _, err := deployments.Update(ctx, deployment, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case event := <-recorder.Events:
+		if event != "Warning Drifted deployment drifted from what peitho applied" {
+			t.Errorf("event = %q", event)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("drift is not reported")
+	}
+	deployment, _ = deployments.Get(ctx, driftDeployment, metav1.GetOptions{})
+	if deployment.Spec.Template.Spec.Containers[0].Image != "mycc:hacked" {
+		t.Errorf("deployment is repaired in report only mode")
+	}
+
+	// the deleted deployment is only reported too
+	if err := deployments.Delete(ctx, driftDeployment, metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	if _, err := deployments.Get(ctx, driftDeployment, metav1.GetOptions{}); err == nil {
+		t.Errorf("deployment is recreated in report only mode")
+	}
+}
@@ -0,0 +1,126 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"os"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// election is the lease and timing of the leader election.
+type election struct {
+	lease         string
+	identity      string
+	leaseDuration time.Duration
+	renewDeadline time.Duration
+	retryPeriod   time.Duration
+}
+
+// Lead run the singleton workers while this replica holds the lease, until ctx is done.
+// When the lease is lost, run is stopped and the replica campaigns again.
+func (k8s *K8sClient) Lead(ctx context.Context, opt *options.LeaderElectionOption, run func(ctx context.Context)) error {
+	if !opt.Enable {
+		run(ctx)
+
+		return nil
+	}
+
+	identity := opt.Identity
+	if identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			log.Errorf("get hostname failed: %v", err)
+
+			return err
+		}
+		identity = hostname
+	}
+
+	return k8s.lead(ctx, election{
+		lease:         opt.Lease,
+		identity:      identity,
+		leaseDuration: time.Duration(opt.LeaseDuration) * time.Second,
+		renewDeadline: time.Duration(opt.RenewDeadline) * time.Second,
+		retryPeriod:   time.Duration(opt.RetryPeriod) * time.Second,
+	}, run)
+}
+
+func (k8s *K8sClient) lead(ctx context.Context, e election, run func(ctx context.Context)) error {
+	lock := &resourcelock.LeaseLock{
+		LeaseMeta: metav1.ObjectMeta{
+			Name:      e.lease,
+			Namespace: k8s.namespace,
+			Labels:    OwnerLabels(nil),
+		},
+		Client:     k8s.k8sClientSet.CoordinationV1(),
+		LockConfig: resourcelock.ResourceLockConfig{Identity: e.identity},
+	}
+
+	for {
+		// the elector starts leading in its own goroutine, run is called here so it is waited for
+		leading := make(chan context.Context, 1)
+		elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+			Lock:            lock,
+			LeaseDuration:   e.leaseDuration,
+			RenewDeadline:   e.renewDeadline,
+			RetryPeriod:     e.retryPeriod,
+			ReleaseOnCancel: true,
+			Name:            e.lease,
+			Callbacks: leaderelection.LeaderCallbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					leading <- ctx
+				},
+				OnStoppedLeading: func() {},
+				OnNewLeader: func(identity string) {
+					log.Infof("lease %s is held by %s", e.lease, identity)
+				},
+			},
+		})
+		if err != nil {
+			log.Errorf("create leader elector failed: %v", err)
+
+			return err
+		}
+
+		// the lease is released on cancel, so the elector is only cancelled after the workers stopped
+		electCtx, cancelElect := context.WithCancel(context.Background())
+		finished := make(chan struct{})
+		go func() {
+			elector.Run(electCtx)
+			close(finished)
+		}()
+
+		select {
+		case leaderCtx := <-leading:
+			log.Infof("%s is leading %s", e.identity, e.lease)
+			runCtx, cancelRun := context.WithCancel(ctx)
+			go func() {
+				<-leaderCtx.Done()
+				cancelRun()
+			}()
+			run(runCtx)
+			// disabled workers return at once, the lease is held anyway instead of campaigning again
+			<-runCtx.Done()
+			cancelRun()
+		case <-ctx.Done():
+		case <-finished:
+		}
+		cancelElect()
+		<-finished
+
+		if ctx.Err() != nil {
+			return nil
+		}
+		log.Infof("%s lost the lease %s", e.identity, e.lease)
+	}
+}
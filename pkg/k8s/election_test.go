@@ -0,0 +1,98 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func TestK8sClient_lead(t *testing.T) {
+	client := &K8sClient{k8sClientSet: fake.NewSimpleClientset(), namespace: "fabric"}
+	e := election{lease: "peitho", leaseDuration: time.Second, renewDeadline: 500 * time.Millisecond, retryPeriod: 100 * time.Millisecond}
+
+	var active, leaders int32
+	started := make(chan string, 2)
+	worker := func(identity string) func(ctx context.Context) {
+		return func(ctx context.Context) {
+			if atomic.AddInt32(&active, 1) > 1 {
+				t.Errorf("%s runs the workers with another leader", identity)
+			}
+			atomic.AddInt32(&leaders, 1)
+			started <- identity
+			<-ctx.Done()
+			atomic.AddInt32(&active, -1)
+		}
+	}
+
+	ctxs := make(map[string]context.CancelFunc)
+	stopped := make(map[string]chan error)
+	for _, identity := range []string{"peitho-0", "peitho-1"} {
+		ctx, cancel := context.WithCancel(context.Background())
+		ctxs[identity] = cancel
+		stopped[identity] = make(chan error, 1)
+
+		replica := e
+		replica.identity = identity
+		go func(identity string, stopped chan error) {
+			stopped <- client.lead(ctx, replica, worker(identity))
+		}(identity, stopped[identity])
+	}
+
+	// one replica leads, the other one takes over when it is stopped and releases the lease
+	leader := <-started
+	select {
+	case other := <-started:
+		t.Fatalf("%s leads with %s", other, leader)
+	case <-time.After(300 * time.Millisecond):
+	}
+
+	ctxs[leader]()
+	if err := <-stopped[leader]; err != nil {
+		t.Errorf("lead() of %s error = %v", leader, err)
+	}
+
+	select {
+	case next := <-started:
+		if next == leader {
+			t.Errorf("%s leads again after it is stopped", next)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("no replica takes over the lease from %s", leader)
+	}
+
+	for identity, cancel := range ctxs {
+		cancel()
+		if identity != leader {
+			<-stopped[identity]
+		}
+	}
+	if atomic.LoadInt32(&leaders) != 2 {
+		t.Errorf("led %d times, want 2", leaders)
+	}
+}
+
+func TestK8sClient_Lead_disabled(t *testing.T) {
+	client := &K8sClient{k8sClientSet: fake.NewSimpleClientset(), namespace: "fabric"}
+
+	// every replica runs the workers
+	var once sync.Once
+	ran := false
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := client.Lead(ctx, &options.LeaderElectionOption{Enable: false}, func(ctx context.Context) {
+		once.Do(func() { ran = true })
+	})
+	if err != nil || !ran {
+		t.Errorf("Lead() = %v, ran %v, want the workers run without election", err, ran)
+	}
+}
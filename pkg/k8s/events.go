@@ -0,0 +1,110 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"sync"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// The reasons of the lifecycle events of the chaincode deployments.
+const (
+	REASON_CREATED           = "Created"
+	REASON_CREATE_FAILED     = "CreateFailed"
+	REASON_IMAGE_MISSING     = "ImageMissing"
+	REASON_IMAGE_REFUSED     = "ImageRefused"
+	REASON_TLS_MOUNTED       = "TLSMounted"
+	REASON_TLS_FAILED        = "TLSMountFailed"
+	REASON_STARTED           = "Started"
+	REASON_READINESS_TIMEOUT = "ReadinessTimeout"
+	REASON_REMOVED           = "Removed"
+	REASON_SWEPT             = "Swept"
+	REASON_SWEEP_MATCHED     = "SweepMatched"
+	REASON_SWEEP_FAILED      = "SweepFailed"
+	REASON_RECONCILE_FAILED  = "ReconcileFailed"
+	REASON_HANDED_OFF        = "HandedOff"
+	REASON_RETIRED           = "Retired"
+	REASON_ROLLED_BACK       = "RolledBack"
+)
+
+// EventRecorder record the lifecycle events on the chaincode deployments, so kubectl describe tells
+// the story without the logs of peitho. The events are aggregated and written in the background,
+// a nil recorder records nothing.
+type EventRecorder struct {
+	recorder  record.EventRecorder
+	namespace string
+
+	lock sync.RWMutex
+	// uids of the deployments seen in the responses of the api, the events are recorded on the name only without it
+	uids map[string]types.UID
+}
+
+// NewEventRecorder return a recorder of the events on the deployments in the namespace.
+func NewEventRecorder(recorder record.EventRecorder, namespace string) *EventRecorder {
+	return &EventRecorder{recorder: recorder, namespace: namespace, uids: make(map[string]types.UID)}
+}
+
+// newEventRecorder return a recorder writing the events of peitho to the namespace.
+func newEventRecorder(client kubernetes.Interface, namespace string) *EventRecorder {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events(namespace)})
+
+	return NewEventRecorder(broadcaster.NewRecorder(scheme.Scheme, v1.EventSource{Component: ManagedBy}), namespace)
+}
+
+// Eventf record an event on the chaincode deployment of the name, it may not exist yet or any more.
+func (r *EventRecorder) Eventf(name string, eventType string, reason string, messageFmt string, args ...interface{}) {
+	if r == nil {
+		return
+	}
+
+	r.recorder.Eventf(r.reference(name), eventType, reason, messageFmt, args...)
+}
+
+// observe remember the uid of the deployment returned by the api.
+func (r *EventRecorder) observe(deployment *appsv1.Deployment) {
+	if r == nil || deployment == nil || deployment.UID == "" {
+		return
+	}
+
+	r.lock.Lock()
+	r.uids[deployment.Name] = deployment.UID
+	r.lock.Unlock()
+}
+
+// forget drop the uid of the deleted deployment.
+func (r *EventRecorder) forget(name string) {
+	if r == nil {
+		return
+	}
+
+	r.lock.Lock()
+	delete(r.uids, name)
+	r.lock.Unlock()
+}
+
+// reference return the reference of the deployment with its uid, kubectl describe only shows the events
+// matching it. The deployment not seen yet or deleted already is referred to by its name.
+func (r *EventRecorder) reference(name string) runtime.Object {
+	r.lock.RLock()
+	uid := r.uids[name]
+	r.lock.RUnlock()
+
+	return &v1.ObjectReference{
+		Kind:       "Deployment",
+		APIVersion: "apps/v1",
+		Namespace:  r.namespace,
+		Name:       name,
+		UID:        uid,
+	}
+}
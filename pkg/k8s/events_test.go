@@ -0,0 +1,85 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"testing"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+	"k8s.io/client-go/tools/record"
+)
+
+func TestEventRecorder_Eventf(t *testing.T) {
+	recorder := record.NewFakeRecorder(1)
+	events := NewEventRecorder(recorder, "fabric")
+
+	events.Eventf("dev-peer0-org1-mycc", v1.EventTypeWarning, REASON_IMAGE_MISSING, "%s not exists", "mycc:1.0")
+	if event := <-recorder.Events; event != "Warning ImageMissing mycc:1.0 not exists" {
+		t.Errorf("event = %q", event)
+	}
+
+	// a nil recorder records nothing
+	var none *EventRecorder
+	none.Eventf("dev-peer0-org1-mycc", v1.EventTypeNormal, REASON_STARTED, "started")
+}
+
+func TestEventRecorder_Eventf_reference(t *testing.T) {
+	ctx := context.Background()
+	clientSet := fake.NewSimpleClientset()
+	clientSet.PrependReactor("create", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		deployment := action.(clienttesting.CreateAction).GetObject().(*appsv1.Deployment)
+		deployment.UID = types.UID(deployment.Name + "-uid")
+
+		return false, nil, nil
+	})
+	k8s := &K8sClient{k8sClientSet: clientSet, namespace: "fabric", recorder: newEventRecorder(clientSet, "fabric")}
+	if err := k8s.CreateChaincodeDeployment(ctx, "dev-peer0-org1-mycc", "mycc", nil, nil, nil, nil, nil, nil); err != nil {
+		t.Fatalf("CreateChaincodeDeployment() error = %v", err)
+	}
+	gets := 0
+	clientSet.PrependReactor("get", "deployments", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		gets++
+
+		return false, nil, nil
+	})
+
+	// the created deployment is referred to with its uid, the deployment not seen by its name
+	k8s.recorder.Eventf("dev-peer0-org1-mycc", v1.EventTypeNormal, REASON_STARTED, "started")
+	k8s.recorder.Eventf("dev-peer0-org1-othercc", v1.EventTypeNormal, REASON_REMOVED, "removed")
+
+	involved := make(map[string]v1.ObjectReference)
+	eventually(t, func() bool {
+		list, _ := clientSet.CoreV1().Events("fabric").List(ctx, metav1.ListOptions{})
+		for _, event := range list.Items {
+			involved[event.InvolvedObject.Name] = event.InvolvedObject
+		}
+
+		return len(involved) == 2
+	})
+	if ref := involved["dev-peer0-org1-mycc"]; ref.UID != "dev-peer0-org1-mycc-uid" || ref.Kind != "Deployment" || ref.Namespace != "fabric" {
+		t.Errorf("involved object = %+v, want the deployment with its uid", ref)
+	}
+	if ref := involved["dev-peer0-org1-othercc"]; ref.UID != "" || ref.Kind != "Deployment" {
+		t.Errorf("involved object = %+v, want the deployment by name", ref)
+	}
+	if gets != 0 {
+		t.Errorf("gets = %d, want the events recorded without getting the deployments", gets)
+	}
+
+	// the deleted deployment is referred to by its name
+	if err := k8s.DeleteChaincodeDeployment(ctx, "dev-peer0-org1-mycc"); err != nil {
+		t.Fatalf("DeleteChaincodeDeployment() error = %v", err)
+	}
+	if ref := k8s.recorder.reference("dev-peer0-org1-mycc").(*v1.ObjectReference); ref.UID != "" {
+		t.Errorf("reference = %+v, want the deployment by name", ref)
+	}
+}
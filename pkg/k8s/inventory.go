@@ -0,0 +1,161 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// The inventory of the chaincode containers is kept in the annotations of their deployments,
+// so it survives restarts of peitho and is shared by its replicas.
+const (
+	// AnnotationContainerID is the container id the peer created the chaincode container as.
+	AnnotationContainerID = "peitho.io/container-id"
+	// AnnotationChaincodeID is the chaincode id passed by the peer, name:version or label:hash.
+	AnnotationChaincodeID = "peitho.io/chaincode-id"
+	// AnnotationPeerID is the peer the chaincode container is launched for.
+	AnnotationPeerID = "peitho.io/peer-id"
+	// AnnotationImageMode is the image mode the deployment is created in.
+	AnnotationImageMode = "peitho.io/image-mode"
+	// AnnotationCreated is when peitho created the chaincode container.
+	AnnotationCreated = "peitho.io/created"
+	// AnnotationState is the lifecycle state of the chaincode container.
+	AnnotationState = "peitho.io/state"
+)
+
+const (
+	// STATE_CREATED the deployment is created, it waits for the tls configmap of the peer.
+	STATE_CREATED = "created"
+	// STATE_CONFIGURED the tls configmap is uploaded and the deployment scaled up.
+	STATE_CONFIGURED = "configured"
+	// STATE_RUNNING the deployment became available when the peer started the container.
+	STATE_RUNNING = "running"
+	// STATE_STOPPED the deployment is scaled to zero by the sweeper.
+	STATE_STOPPED = "stopped"
+)
+
+// Chaincode is the inventory entry of a chaincode container.
+type Chaincode struct {
+	// ContainerID is empty for the deployments created before the inventory
+	ContainerID string    `json:"containerID"`
+	Deployment  string    `json:"deployment"`
+	ChaincodeID string    `json:"chaincodeID"`
+	PeerID      string    `json:"peerID"`
+	Image       string    `json:"image"`
+	Digest      string    `json:"digest"`
+	Mode        string    `json:"mode"`
+	Created     time.Time `json:"created"`
+	State       string    `json:"state"`
+	Available   bool      `json:"available"`
+}
+
+// InventoryAnnotations return the inventory annotations of the chaincode container the peer creates.
+func InventoryAnnotations(containerID string, env []string, mode string, now time.Time) map[string]string {
+	ccid, peer := chaincodeIdentity(containerID, env)
+	result := map[string]string{
+		AnnotationContainerID: containerID,
+		AnnotationImageMode:   mode,
+		AnnotationCreated:     now.UTC().Format(time.RFC3339),
+		AnnotationState:       STATE_CREATED,
+	}
+	if ccid != "" {
+		result[AnnotationChaincodeID] = ccid
+	}
+	if peer != "" {
+		result[AnnotationPeerID] = peer
+	}
+
+	return result
+}
+
+// ChaincodeOf return the inventory entry recorded on the deployment.
+func ChaincodeOf(deployment *appsv1.Deployment) Chaincode {
+	annotations := deployment.Annotations
+	chaincode := Chaincode{
+		ContainerID: annotations[AnnotationContainerID],
+		Deployment:  deployment.Name,
+		ChaincodeID: annotations[AnnotationChaincodeID],
+		PeerID:      annotations[AnnotationPeerID],
+		Image:       annotations[AnnotationImage],
+		Digest:      annotations[AnnotationImageDigest],
+		Mode:        annotations[AnnotationImageMode],
+		Created:     deployment.CreationTimestamp.Time,
+		State:       annotations[AnnotationState],
+		Available:   deployment.Status.AvailableReplicas > 0,
+	}
+	if created, err := time.Parse(time.RFC3339, annotations[AnnotationCreated]); err == nil {
+		chaincode.Created = created
+	}
+
+	// the deployments created before the inventory are described by their spec
+	if containers := deployment.Spec.Template.Spec.Containers; len(containers) > 0 {
+		if chaincode.Image == "" {
+			chaincode.Image = containers[0].Image
+		}
+		if chaincode.ChaincodeID == "" {
+			for _, e := range containers[0].Env {
+				if e.Name == "CORE_CHAINCODE_ID_NAME" {
+					chaincode.ChaincodeID = e.Value
+				}
+			}
+		}
+	}
+	if chaincode.PeerID == "" {
+		chaincode.PeerID = deployment.Labels[LabelPeerID]
+	}
+
+	return chaincode
+}
+
+// ListChaincodes list the inventory of the chaincode containers, ordered by deployment name.
+func (k8s *K8sClient) ListChaincodes(ctx context.Context) ([]Chaincode, error) {
+	deployments, err := k8s.ListChaincodeDeployments(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	chaincodes := make([]Chaincode, 0, len(deployments))
+	for i := range deployments {
+		chaincodes = append(chaincodes, ChaincodeOf(&deployments[i]))
+	}
+	sort.Slice(chaincodes, func(i, j int) bool {
+		return chaincodes[i].Deployment < chaincodes[j].Deployment
+	})
+
+	return chaincodes, nil
+}
+
+// GetChaincode return the inventory entry of the chaincode deployment.
+func (k8s *K8sClient) GetChaincode(ctx context.Context, name string) (*Chaincode, error) {
+	deployment, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get chaincode deployment %s failed: %v", name, err)
+
+		return nil, err
+	}
+	chaincode := ChaincodeOf(deployment)
+
+	return &chaincode, nil
+}
+
+// podAnnotations return the annotations of the pod template, the state is only kept on the deployment,
+// it changes without rolling the pods.
+func podAnnotations(annotations map[string]string) map[string]string {
+	if _, ok := annotations[AnnotationState]; !ok {
+		return annotations
+	}
+
+	result := merge(annotations, nil)
+	delete(result, AnnotationState)
+
+	return result
+}
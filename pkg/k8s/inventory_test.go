@@ -0,0 +1,119 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestInventoryAnnotations(t *testing.T) {
+	now := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+	containerID := "dev-peer0.org1.example.com-mycc-1.0"
+
+	got := InventoryAnnotations(containerID, []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0"}, "registry", now)
+	want := map[string]string{
+		AnnotationContainerID: containerID,
+		AnnotationChaincodeID: "mycc:1.0",
+		AnnotationPeerID:      "peer0.org1.example.com",
+		AnnotationImageMode:   "registry",
+		AnnotationCreated:     "2021-06-01T08:00:00Z",
+		AnnotationState:       STATE_CREATED,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("InventoryAnnotations() = %v, want %v", got, want)
+	}
+}
+
+func TestK8sClient_inventory(t *testing.T) {
+	ctx := context.Background()
+	client := &K8sClient{k8sClientSet: fake.NewSimpleClientset(), namespace: "fabric"}
+	created := time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+	// a container created by the peer, its deployment name is hashed
+	containerID := "dev-peer0.org1.example.com-mycc_1.0-0e3a8d47dcd7e0c46d3a4a8a5bdbb8ea0fe1f7b3fd2d3d7b64e6cdf7b1d6bd4d"
+	env := []string{
+		"CORE_CHAINCODE_ID_NAME=mycc_1.0:0e3a8d47dcd7e0c46d3a4a8a5bdbb8ea0fe1f7b3fd2d3d7b64e6cdf7b1d6bd4d",
+		"CORE_PEER_TLS_ENABLED=true",
+	}
+	annotations := InventoryAnnotations(containerID, env, "registry", created)
+	annotations[AnnotationImage] = "harbor.example.com/org1/mycc:1.0"
+	annotations[AnnotationImageDigest] = "sha256:8600907bbe3d1af9b498775f343359db7b2f4540fb3958bf7878b3ca0d7e3f79"
+	err := client.CreateChaincodeDeployment(
+		ctx,
+		"chaincode-dev-peer0--0123456789abcdef0123456789abcdef",
+		"harbor.example.com/org1/mycc@sha256:8600907bbe3d1af9b498775f343359db7b2f4540fb3958bf7878b3ca0d7e3f79",
+		env,
+		nil,
+		nil,
+		annotations,
+		ChaincodeLabels(containerID, env),
+		nil,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a deployment created before the inventory
+	legacy := chaincodeDeployment(
+		"dev-peer1-org1-mycc-1-0",
+		[]v1.EnvVar{{Name: "CORE_CHAINCODE_ID_NAME", Value: "mycc:1.0"}},
+		map[string]string{LabelManagedBy: ManagedBy, LabelPeerID: "peer1-org1"},
+	)
+	legacy.CreationTimestamp = metav1.NewTime(created)
+	if _, err := client.k8sClientSet.AppsV1().Deployments("fabric").Create(ctx, legacy, metav1.CreateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the state changes on the deployment only
+	if err := client.AnnotateDeployment(ctx, "chaincode-dev-peer0--0123456789abcdef0123456789abcdef", map[string]string{
+		AnnotationState: STATE_RUNNING,
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	chaincodes, err := client.ListChaincodes(ctx)
+	if err != nil {
+		t.Fatalf("ListChaincodes() error = %v", err)
+	}
+	want := []Chaincode{
+		{
+			ContainerID: containerID,
+			Deployment:  "chaincode-dev-peer0--0123456789abcdef0123456789abcdef",
+			ChaincodeID: "mycc_1.0:0e3a8d47dcd7e0c46d3a4a8a5bdbb8ea0fe1f7b3fd2d3d7b64e6cdf7b1d6bd4d",
+			PeerID:      "peer0.org1.example.com",
+			Image:       "harbor.example.com/org1/mycc:1.0",
+			Digest:      "sha256:8600907bbe3d1af9b498775f343359db7b2f4540fb3958bf7878b3ca0d7e3f79",
+			Mode:        "registry",
+			Created:     created,
+			State:       STATE_RUNNING,
+		},
+		{
+			Deployment:  "dev-peer1-org1-mycc-1-0",
+			ChaincodeID: "mycc:1.0",
+			PeerID:      "peer1-org1",
+			Created:     created,
+		},
+	}
+	if !reflect.DeepEqual(chaincodes, want) {
+		t.Errorf("ListChaincodes() = %+v, want %+v", chaincodes, want)
+	}
+
+	deployment, _ := client.GetDeployment(ctx, "chaincode-dev-peer0--0123456789abcdef0123456789abcdef")
+	if state, ok := deployment.Spec.Template.Annotations[AnnotationState]; ok {
+		t.Errorf("pod template annotated with state %s, want the state on the deployment only", state)
+	}
+
+	if _, err := client.GetChaincode(ctx, "dev-peer2-org1-mycc-1-0"); !apierrors.IsNotFound(err) {
+		t.Errorf("GetChaincode() of a missing deployment error = %v, want not found", err)
+	}
+}
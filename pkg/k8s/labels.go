@@ -0,0 +1,131 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"regexp"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+const (
+	// LabelManagedBy marks the resources owned by peitho.
+	LabelManagedBy = "app.kubernetes.io/managed-by"
+	// LabelPeerID is the peer the chaincode is launched for.
+	LabelPeerID = "peitho.io/peer-id"
+	// LabelChaincodeName is the name of the chaincode.
+	LabelChaincodeName = "peitho.io/chaincode-name"
+	// LabelChaincodeVersion is the version of the chaincode.
+	LabelChaincodeVersion = "peitho.io/chaincode-version"
+
+	ManagedBy = "peitho"
+)
+
+var (
+	packageHash  = regexp.MustCompile(`^[0-9a-f]{64}$`)
+	invalidLabel = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+)
+
+// ManagedSelector select the resources owned by peitho.
+func ManagedSelector() string {
+	return labels.SelectorFromSet(labels.Set{LabelManagedBy: ManagedBy}).String()
+}
+
+// ChaincodeLabels return the ownership labels of the chaincode container the peer launches.
+// The container is named <network id>-<peer id>-<chaincode id> by the peer and
+// the chaincode id is passed as CORE_CHAINCODE_ID_NAME, either name:version or label:hash of the package.
+func ChaincodeLabels(containerName string, env []string) map[string]string {
+	result := map[string]string{LabelManagedBy: ManagedBy}
+
+	ccid, peer := chaincodeIdentity(containerName, env)
+	if ccid == "" {
+		return result
+	}
+
+	name, version := ccid, ""
+	if i := strings.LastIndex(ccid, ":"); i >= 0 {
+		name, version = ccid[:i], ccid[i+1:]
+	}
+	// the package label is named after the chaincode and its version, like mycc_1.0
+	if packageHash.MatchString(version) {
+		version = ""
+		if i := strings.LastIndex(name, "_"); i > 0 {
+			name, version = name[:i], name[i+1:]
+		}
+	}
+	setLabel(result, LabelChaincodeName, name)
+	setLabel(result, LabelChaincodeVersion, version)
+	setLabel(result, LabelPeerID, peer)
+
+	return result
+}
+
+// chaincodeIdentity return the chaincode id passed as CORE_CHAINCODE_ID_NAME and
+// the peer id parsed from the container name, they are empty if unknown.
+func chaincodeIdentity(containerName string, env []string) (string, string) {
+	ccid := ""
+	for _, e := range env {
+		if strings.HasPrefix(e, "CORE_CHAINCODE_ID_NAME=") {
+			ccid = strings.TrimPrefix(e, "CORE_CHAINCODE_ID_NAME=")
+		}
+	}
+	if ccid == "" {
+		return "", ""
+	}
+
+	// the deployment name of the container replaces dots, compare both forms
+	normalize := func(s string) string {
+		return strings.NewReplacer(":", "-", ".", "-").Replace(strings.ToLower(s))
+	}
+	suffix := "-" + normalize(ccid)
+	if !strings.HasSuffix(normalize(containerName), suffix) {
+		return ccid, ""
+	}
+	peer := containerName[:len(containerName)-len(suffix)]
+	i := strings.Index(peer, "-")
+	if i < 0 {
+		return ccid, ""
+	}
+
+	return ccid, peer[i+1:]
+}
+
+// setLabel set the value made valid as a label value, empty values are left out.
+func setLabel(result map[string]string, key string, value string) {
+	value = invalidLabel.ReplaceAllString(value, "-")
+	if len(value) > 63 {
+		value = value[:63]
+	}
+	value = strings.Trim(value, "-_.")
+	if value != "" {
+		result[key] = value
+	}
+}
+
+// OwnerLabels return the ownership labels of the labels, the labels peitho sets on a chaincode deployment.
+func OwnerLabels(from map[string]string) map[string]string {
+	result := map[string]string{LabelManagedBy: ManagedBy}
+	for _, key := range []string{LabelPeerID, LabelChaincodeName, LabelChaincodeVersion} {
+		if value, ok := from[key]; ok {
+			result[key] = value
+		}
+	}
+
+	return result
+}
+
+// merge return the labels with the extra labels added.
+func merge(base map[string]string, extra map[string]string) map[string]string {
+	result := make(map[string]string, len(base)+len(extra))
+	for k, v := range base {
+		result[k] = v
+	}
+	for k, v := range extra {
+		result[k] = v
+	}
+
+	return result
+}
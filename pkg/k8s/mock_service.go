@@ -13,6 +13,10 @@ import (
 	reflect "reflect"
 
 	gomock "github.com/golang/mock/gomock"
+	v1alpha1 "github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
+	options "github.com/tianrandailove/peitho/pkg/options"
+	v1 "k8s.io/api/apps/v1"
+	v10 "k8s.io/api/core/v1"
 )
 
 // MockK8sService is a mock of K8sService interface.
@@ -21,10 +25,6 @@ type MockK8sService struct {
 	recorder *MockK8sServiceMockRecorder
 }
 
-func (m *MockK8sService) CreateChaincodeDeploymentWithPuller(ctx context.Context, name string, image string, env []string, cmd []string, pullerImag string, pullerCMD []string) error {
-	return nil
-}
-
 // MockK8sServiceMockRecorder is the mock recorder for MockK8sService.
 type MockK8sServiceMockRecorder struct {
 	mock *MockK8sService
@@ -42,18 +42,89 @@ func (m *MockK8sService) EXPECT() *MockK8sServiceMockRecorder {
 	return m.recorder
 }
 
+// AdoptChaincodeResources mocks base method.
+func (m *MockK8sService) AdoptChaincodeResources(arg0 context.Context) (int, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AdoptChaincodeResources", arg0)
+	ret0, _ := ret[0].(int)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// AdoptChaincodeResources indicates an expected call of AdoptChaincodeResources.
+func (mr *MockK8sServiceMockRecorder) AdoptChaincodeResources(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AdoptChaincodeResources", reflect.TypeOf((*MockK8sService)(nil).AdoptChaincodeResources), arg0)
+}
+
+// AnnotateDeployment mocks base method.
+func (m *MockK8sService) AnnotateDeployment(arg0 context.Context, arg1 string, arg2 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "AnnotateDeployment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// AnnotateDeployment indicates an expected call of AnnotateDeployment.
+func (mr *MockK8sServiceMockRecorder) AnnotateDeployment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "AnnotateDeployment", reflect.TypeOf((*MockK8sService)(nil).AnnotateDeployment), arg0, arg1, arg2)
+}
+
+// ApplyChaincodeResource mocks base method.
+func (m *MockK8sService) ApplyChaincodeResource(arg0 context.Context, arg1 *v1alpha1.Chaincode) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyChaincodeResource", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ApplyChaincodeResource indicates an expected call of ApplyChaincodeResource.
+func (mr *MockK8sServiceMockRecorder) ApplyChaincodeResource(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyChaincodeResource", reflect.TypeOf((*MockK8sService)(nil).ApplyChaincodeResource), arg0, arg1)
+}
+
+// ApplyDockerConfigSecret mocks base method.
+func (m *MockK8sService) ApplyDockerConfigSecret(arg0 context.Context, arg1 string, arg2 []byte) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ApplyDockerConfigSecret", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ApplyDockerConfigSecret indicates an expected call of ApplyDockerConfigSecret.
+func (mr *MockK8sServiceMockRecorder) ApplyDockerConfigSecret(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ApplyDockerConfigSecret", reflect.TypeOf((*MockK8sService)(nil).ApplyDockerConfigSecret), arg0, arg1, arg2)
+}
+
 // CreateChaincodeDeployment mocks base method.
-func (m *MockK8sService) CreateChaincodeDeployment(arg0 context.Context, arg1, arg2 string, arg3, arg4 []string) error {
+func (m *MockK8sService) CreateChaincodeDeployment(arg0 context.Context, arg1, arg2 string, arg3, arg4, arg5 []string, arg6, arg7 map[string]string, arg8 []string) error {
 	m.ctrl.T.Helper()
-	ret := m.ctrl.Call(m, "CreateChaincodeDeployment", arg0, arg1, arg2, arg3, arg4)
+	ret := m.ctrl.Call(m, "CreateChaincodeDeployment", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8)
 	ret0, _ := ret[0].(error)
 	return ret0
 }
 
 // CreateChaincodeDeployment indicates an expected call of CreateChaincodeDeployment.
-func (mr *MockK8sServiceMockRecorder) CreateChaincodeDeployment(arg0, arg1, arg2, arg3, arg4 interface{}) *gomock.Call {
+func (mr *MockK8sServiceMockRecorder) CreateChaincodeDeployment(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8 interface{}) *gomock.Call {
 	mr.mock.ctrl.T.Helper()
-	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChaincodeDeployment", reflect.TypeOf((*MockK8sService)(nil).CreateChaincodeDeployment), arg0, arg1, arg2, arg3, arg4)
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChaincodeDeployment", reflect.TypeOf((*MockK8sService)(nil).CreateChaincodeDeployment), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8)
+}
+
+// CreateChaincodeDeploymentWithPuller mocks base method.
+func (m *MockK8sService) CreateChaincodeDeploymentWithPuller(arg0 context.Context, arg1, arg2 string, arg3, arg4 []string, arg5 string, arg6 []string, arg7 []HostPathMount, arg8, arg9 map[string]string, arg10 []string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateChaincodeDeploymentWithPuller", arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateChaincodeDeploymentWithPuller indicates an expected call of CreateChaincodeDeploymentWithPuller.
+func (mr *MockK8sServiceMockRecorder) CreateChaincodeDeploymentWithPuller(arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateChaincodeDeploymentWithPuller", reflect.TypeOf((*MockK8sService)(nil).CreateChaincodeDeploymentWithPuller), arg0, arg1, arg2, arg3, arg4, arg5, arg6, arg7, arg8, arg9, arg10)
 }
 
 // CreateConfigMap mocks base method.
@@ -70,6 +141,20 @@ func (mr *MockK8sServiceMockRecorder) CreateConfigMap(arg0, arg1, arg2 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateConfigMap", reflect.TypeOf((*MockK8sService)(nil).CreateConfigMap), arg0, arg1, arg2)
 }
 
+// CreateTLSSecret mocks base method.
+func (m *MockK8sService) CreateTLSSecret(arg0 context.Context, arg1 string, arg2 map[string]string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "CreateTLSSecret", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// CreateTLSSecret indicates an expected call of CreateTLSSecret.
+func (mr *MockK8sServiceMockRecorder) CreateTLSSecret(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "CreateTLSSecret", reflect.TypeOf((*MockK8sService)(nil).CreateTLSSecret), arg0, arg1, arg2)
+}
+
 // DeleteChaincodeDeployment mocks base method.
 func (m *MockK8sService) DeleteChaincodeDeployment(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -98,6 +183,212 @@ func (mr *MockK8sServiceMockRecorder) DeleteConfigMapDeployment(arg0, arg1 inter
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteConfigMapDeployment", reflect.TypeOf((*MockK8sService)(nil).DeleteConfigMapDeployment), arg0, arg1)
 }
 
+// DeleteTLSSecret mocks base method.
+func (m *MockK8sService) DeleteTLSSecret(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DeleteTLSSecret", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DeleteTLSSecret indicates an expected call of DeleteTLSSecret.
+func (mr *MockK8sServiceMockRecorder) DeleteTLSSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DeleteTLSSecret", reflect.TypeOf((*MockK8sService)(nil).DeleteTLSSecret), arg0, arg1)
+}
+
+// DetectDrift mocks base method.
+func (m *MockK8sService) DetectDrift(arg0 context.Context, arg1 *options.DriftOption) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "DetectDrift", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// DetectDrift indicates an expected call of DetectDrift.
+func (mr *MockK8sServiceMockRecorder) DetectDrift(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "DetectDrift", reflect.TypeOf((*MockK8sService)(nil).DetectDrift), arg0, arg1)
+}
+
+// EventRecorder mocks base method.
+func (m *MockK8sService) EventRecorder() *EventRecorder {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "EventRecorder")
+	ret0, _ := ret[0].(*EventRecorder)
+	return ret0
+}
+
+// EventRecorder indicates an expected call of EventRecorder.
+func (mr *MockK8sServiceMockRecorder) EventRecorder() *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "EventRecorder", reflect.TypeOf((*MockK8sService)(nil).EventRecorder))
+}
+
+// GetChaincode mocks base method.
+func (m *MockK8sService) GetChaincode(arg0 context.Context, arg1 string) (*Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChaincode", arg0, arg1)
+	ret0, _ := ret[0].(*Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChaincode indicates an expected call of GetChaincode.
+func (mr *MockK8sServiceMockRecorder) GetChaincode(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChaincode", reflect.TypeOf((*MockK8sService)(nil).GetChaincode), arg0, arg1)
+}
+
+// GetChaincodeResource mocks base method.
+func (m *MockK8sService) GetChaincodeResource(arg0 context.Context, arg1 string) (*v1alpha1.Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetChaincodeResource", arg0, arg1)
+	ret0, _ := ret[0].(*v1alpha1.Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetChaincodeResource indicates an expected call of GetChaincodeResource.
+func (mr *MockK8sServiceMockRecorder) GetChaincodeResource(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetChaincodeResource", reflect.TypeOf((*MockK8sService)(nil).GetChaincodeResource), arg0, arg1)
+}
+
+// GetDeployment mocks base method.
+func (m *MockK8sService) GetDeployment(arg0 context.Context, arg1 string) (*v1.Deployment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDeployment", arg0, arg1)
+	ret0, _ := ret[0].(*v1.Deployment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDeployment indicates an expected call of GetDeployment.
+func (mr *MockK8sServiceMockRecorder) GetDeployment(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDeployment", reflect.TypeOf((*MockK8sService)(nil).GetDeployment), arg0, arg1)
+}
+
+// GetDockerConfigSecret mocks base method.
+func (m *MockK8sService) GetDockerConfigSecret(arg0 context.Context, arg1 string) ([]byte, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "GetDockerConfigSecret", arg0, arg1)
+	ret0, _ := ret[0].([]byte)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// GetDockerConfigSecret indicates an expected call of GetDockerConfigSecret.
+func (mr *MockK8sServiceMockRecorder) GetDockerConfigSecret(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "GetDockerConfigSecret", reflect.TypeOf((*MockK8sService)(nil).GetDockerConfigSecret), arg0, arg1)
+}
+
+// Lead mocks base method.
+func (m *MockK8sService) Lead(arg0 context.Context, arg1 *options.LeaderElectionOption, arg2 func(context.Context)) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "Lead", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// Lead indicates an expected call of Lead.
+func (mr *MockK8sServiceMockRecorder) Lead(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Lead", reflect.TypeOf((*MockK8sService)(nil).Lead), arg0, arg1, arg2)
+}
+
+// ListChaincodeConfigMaps mocks base method.
+func (m *MockK8sService) ListChaincodeConfigMaps(arg0 context.Context, arg1 map[string]string) ([]v10.ConfigMap, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChaincodeConfigMaps", arg0, arg1)
+	ret0, _ := ret[0].([]v10.ConfigMap)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChaincodeConfigMaps indicates an expected call of ListChaincodeConfigMaps.
+func (mr *MockK8sServiceMockRecorder) ListChaincodeConfigMaps(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChaincodeConfigMaps", reflect.TypeOf((*MockK8sService)(nil).ListChaincodeConfigMaps), arg0, arg1)
+}
+
+// ListChaincodeDeployments mocks base method.
+func (m *MockK8sService) ListChaincodeDeployments(arg0 context.Context, arg1 map[string]string) ([]v1.Deployment, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChaincodeDeployments", arg0, arg1)
+	ret0, _ := ret[0].([]v1.Deployment)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChaincodeDeployments indicates an expected call of ListChaincodeDeployments.
+func (mr *MockK8sServiceMockRecorder) ListChaincodeDeployments(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChaincodeDeployments", reflect.TypeOf((*MockK8sService)(nil).ListChaincodeDeployments), arg0, arg1)
+}
+
+// ListChaincodePods mocks base method.
+func (m *MockK8sService) ListChaincodePods(arg0 context.Context, arg1 string) ([]v10.Pod, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChaincodePods", arg0, arg1)
+	ret0, _ := ret[0].([]v10.Pod)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChaincodePods indicates an expected call of ListChaincodePods.
+func (mr *MockK8sServiceMockRecorder) ListChaincodePods(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChaincodePods", reflect.TypeOf((*MockK8sService)(nil).ListChaincodePods), arg0, arg1)
+}
+
+// ListChaincodeResources mocks base method.
+func (m *MockK8sService) ListChaincodeResources(arg0 context.Context) ([]v1alpha1.Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChaincodeResources", arg0)
+	ret0, _ := ret[0].([]v1alpha1.Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChaincodeResources indicates an expected call of ListChaincodeResources.
+func (mr *MockK8sServiceMockRecorder) ListChaincodeResources(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChaincodeResources", reflect.TypeOf((*MockK8sService)(nil).ListChaincodeResources), arg0)
+}
+
+// ListChaincodes mocks base method.
+func (m *MockK8sService) ListChaincodes(arg0 context.Context) ([]Chaincode, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListChaincodes", arg0)
+	ret0, _ := ret[0].([]Chaincode)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListChaincodes indicates an expected call of ListChaincodes.
+func (mr *MockK8sServiceMockRecorder) ListChaincodes(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListChaincodes", reflect.TypeOf((*MockK8sService)(nil).ListChaincodes), arg0)
+}
+
+// ListTLSSecrets mocks base method.
+func (m *MockK8sService) ListTLSSecrets(arg0 context.Context) ([]v10.Secret, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ListTLSSecrets", arg0)
+	ret0, _ := ret[0].([]v10.Secret)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// ListTLSSecrets indicates an expected call of ListTLSSecrets.
+func (mr *MockK8sServiceMockRecorder) ListTLSSecrets(arg0 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ListTLSSecrets", reflect.TypeOf((*MockK8sService)(nil).ListTLSSecrets), arg0)
+}
+
 // QueryDeploymentStatus mocks base method.
 func (m *MockK8sService) QueryDeploymentStatus(arg0 context.Context, arg1 string) (bool, error) {
 	m.ctrl.T.Helper()
@@ -113,6 +404,48 @@ func (mr *MockK8sServiceMockRecorder) QueryDeploymentStatus(arg0, arg1 interface
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "QueryDeploymentStatus", reflect.TypeOf((*MockK8sService)(nil).QueryDeploymentStatus), arg0, arg1)
 }
 
+// ReconcileChaincodeResource mocks base method.
+func (m *MockK8sService) ReconcileChaincodeResource(arg0 context.Context, arg1 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReconcileChaincodeResource", arg0, arg1)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReconcileChaincodeResource indicates an expected call of ReconcileChaincodeResource.
+func (mr *MockK8sServiceMockRecorder) ReconcileChaincodeResource(arg0, arg1 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReconcileChaincodeResource", reflect.TypeOf((*MockK8sService)(nil).ReconcileChaincodeResource), arg0, arg1)
+}
+
+// ReviewPullerCredential mocks base method.
+func (m *MockK8sService) ReviewPullerCredential(arg0 context.Context, arg1, arg2 string) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ReviewPullerCredential", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ReviewPullerCredential indicates an expected call of ReviewPullerCredential.
+func (mr *MockK8sServiceMockRecorder) ReviewPullerCredential(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ReviewPullerCredential", reflect.TypeOf((*MockK8sService)(nil).ReviewPullerCredential), arg0, arg1, arg2)
+}
+
+// ScaleDeployment mocks base method.
+func (m *MockK8sService) ScaleDeployment(arg0 context.Context, arg1 string, arg2 int32) error {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "ScaleDeployment", arg0, arg1, arg2)
+	ret0, _ := ret[0].(error)
+	return ret0
+}
+
+// ScaleDeployment indicates an expected call of ScaleDeployment.
+func (mr *MockK8sServiceMockRecorder) ScaleDeployment(arg0, arg1, arg2 interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "ScaleDeployment", reflect.TypeOf((*MockK8sService)(nil).ScaleDeployment), arg0, arg1, arg2)
+}
+
 // UpdateDeployment mocks base method.
 func (m *MockK8sService) UpdateDeployment(arg0 context.Context, arg1 string) error {
 	m.ctrl.T.Helper()
@@ -126,14 +459,3 @@ func (mr *MockK8sServiceMockRecorder) UpdateDeployment(arg0, arg1 interface{}) *
 	mr.mock.ctrl.T.Helper()
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "UpdateDeployment", reflect.TypeOf((*MockK8sService)(nil).UpdateDeployment), arg0, arg1)
 }
-func (mr *MockK8sServiceMockRecorder) CreateChaincodeDeploymentWithPuller(
-	ctx context.Context,
-	name string,
-	image string,
-	env []string,
-	cmd []string,
-	pullerImag string,
-	pullerCMD []string,
-) error {
-	return nil
-}
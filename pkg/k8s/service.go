@@ -6,15 +6,23 @@ package k8s
 
 //go:generate mockgen -self_package=github.com/tianrandailove/peitho/pkg/k8s -destination mock_service.go -package k8s github.com/tianrandailove/peitho/pkg/k8s K8sService
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
 	"strings"
 
 	appsv1 "k8s.io/api/apps/v1"
 	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 
+	"github.com/tianrandailove/peitho/pkg/apis/peitho/v1alpha1"
 	"github.com/tianrandailove/peitho/pkg/log"
 	"github.com/tianrandailove/peitho/pkg/options"
 )
@@ -34,14 +42,44 @@ const (
 	ChaincodePrefix = "chaincode"
 )
 
+const (
+	// AnnotationImage is the image reference the deployment is created from.
+	AnnotationImage = "peitho.io/image"
+	// AnnotationImageDigest is the manifest digest the deployment image is pinned to.
+	AnnotationImageDigest = "peitho.io/image-digest"
+	// AnnotationSweepRule is the sweeper rule matched by the deployment.
+	AnnotationSweepRule = "peitho.io/sweep-rule"
+	// AnnotationSweepReason is why the sweeper rule matched the deployment.
+	AnnotationSweepReason = "peitho.io/sweep-reason"
+)
+
+// HostPathMount defines a node directory mounted into the puller container.
+type HostPathMount struct {
+	Name      string
+	HostPath  string
+	MountPath string
+}
+
 type K8sClient struct {
-	k8sClientSet *kubernetes.Clientset
+	k8sClientSet kubernetes.Interface
+	dynamic      dynamic.Interface
+	recorder     *EventRecorder
 	namespace    string
 	dns          []string
 }
 
 type K8sService interface {
-	CreateChaincodeDeployment(ctx context.Context, name string, image string, env []string, cmd []string) error
+	CreateChaincodeDeployment(
+		ctx context.Context,
+		name string,
+		image string,
+		env []string,
+		cmd []string,
+		pullSecrets []string,
+		annotations map[string]string,
+		labels map[string]string,
+		archs []string,
+	) error
 	CreateChaincodeDeploymentWithPuller(
 		ctx context.Context,
 		name string,
@@ -50,13 +88,38 @@ type K8sService interface {
 		cmd []string,
 		pullerImag string,
 		pullerCMD []string,
+		mounts []HostPathMount,
+		annotations map[string]string,
+		labels map[string]string,
+		archs []string,
 	) error
 	UpdateDeployment(ctx context.Context, name string) error
 	CreateConfigMap(ctx context.Context, name string, data map[string]string) error
 	DeleteChaincodeDeployment(ctx context.Context, name string) error
 	DeleteConfigMapDeployment(ctx context.Context, name string) error
 	QueryDeploymentStatus(ctx context.Context, name string) (bool, error)
-	ListDeploymentByPrefix(ctx context.Context, prefix string) ([]appsv1.Deployment, error)
+	ListChaincodeDeployments(ctx context.Context, selector map[string]string) ([]appsv1.Deployment, error)
+	GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error)
+	GetDockerConfigSecret(ctx context.Context, name string) ([]byte, error)
+	ApplyDockerConfigSecret(ctx context.Context, name string, data []byte) error
+	ListChaincodePods(ctx context.Context, name string) ([]v1.Pod, error)
+	ScaleDeployment(ctx context.Context, name string, replicas int32) error
+	AnnotateDeployment(ctx context.Context, name string, annotations map[string]string) error
+	AdoptChaincodeResources(ctx context.Context) (int, error)
+	ListChaincodeConfigMaps(ctx context.Context, selector map[string]string) ([]v1.ConfigMap, error)
+	Lead(ctx context.Context, opt *options.LeaderElectionOption, run func(ctx context.Context)) error
+	ListChaincodes(ctx context.Context) ([]Chaincode, error)
+	GetChaincode(ctx context.Context, name string) (*Chaincode, error)
+	ApplyChaincodeResource(ctx context.Context, cc *v1alpha1.Chaincode) error
+	GetChaincodeResource(ctx context.Context, name string) (*v1alpha1.Chaincode, error)
+	ListChaincodeResources(ctx context.Context) ([]v1alpha1.Chaincode, error)
+	ReconcileChaincodeResource(ctx context.Context, name string) error
+	DetectDrift(ctx context.Context, opt *options.DriftOption) error
+	CreateTLSSecret(ctx context.Context, name string, data map[string]string) error
+	ListTLSSecrets(ctx context.Context) ([]v1.Secret, error)
+	DeleteTLSSecret(ctx context.Context, name string) error
+	ReviewPullerCredential(ctx context.Context, credential string, image string) error
+	EventRecorder() *EventRecorder
 }
 
 // NewK8sClient new k8sclient from opt.
@@ -75,10 +138,19 @@ func newK8sClient(opt *options.K8sOption) (*K8sClient, error) {
 		return nil, err
 	}
 
+	dynamicClient, err := dynamic.NewForConfig(config)
+	if err != nil {
+		log.Errorf("init kubernates dynamic client failed: %v", err)
+
+		return nil, err
+	}
+
 	log.Infof("init kubernates client suceess ...")
 
 	return &K8sClient{
 		k8sClientSet: client,
+		dynamic:      dynamicClient,
+		recorder:     newEventRecorder(client, opt.Namespace),
 		namespace:    opt.Namespace,
 		dns:          opt.DNS,
 	}, nil
@@ -89,43 +161,27 @@ func NewK8sService(opt *options.K8sOption) (K8sService, error) {
 	return newK8sClient(opt)
 }
 
+// EventRecorder return the recorder of the events on the chaincode deployments.
+func (k8s *K8sClient) EventRecorder() *EventRecorder {
+	return k8s.recorder
+}
+
 func (k8s *K8sClient) CreateChaincodeDeployment(
 	ctx context.Context,
 	name string,
 	image string,
 	env []string,
 	cmd []string,
+	pullSecrets []string,
+	annotations map[string]string,
+	labels map[string]string,
+	archs []string,
 ) error {
-	// replicas
-	replicas := int32(0)
-
-	// build environment variables
-	envs := make([]v1.EnvVar, 0, len(env))
-	if len(env) > 0 {
-		for _, s := range env {
-			array := strings.Split(s, "=")
-			envs = append(envs, v1.EnvVar{
-				Name:  array[0],
-				Value: array[1],
-			})
-
-			if array[0] == "CORE_PEER_TLS_ENABLED" && array[1] == "false" {
-				replicas = 1
-			}
-		}
-	}
+	// build environment variables, the replicas wait for the tls configmap if tls is enabled
+	envs, replicas := envVars(env)
 
 	// dns
-	var hostAlias []v1.HostAlias
-	if len(k8s.dns) > 0 {
-		for _, s := range k8s.dns {
-			strs := strings.Split(s, ":")
-			hostAlias = append(hostAlias, v1.HostAlias{
-				IP:        strs[0],
-				Hostnames: []string{strs[1]},
-			})
-		}
-	}
+	hostAlias := k8s.hostAliases()
 
 	deployment := &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
@@ -133,7 +189,9 @@ func (k8s *K8sClient) CreateChaincodeDeployment(
 			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Strategy: appsv1.DeploymentStrategy{
@@ -145,8 +203,9 @@ func (k8s *K8sClient) CreateChaincodeDeployment(
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:   name,
-					Labels: map[string]string{"app": name},
+					Name:        name,
+					Labels:      merge(labels, map[string]string{"app": name}),
+					Annotations: podAnnotations(annotations),
 				},
 				Spec: v1.PodSpec{
 					Containers: []v1.Container{
@@ -158,19 +217,24 @@ func (k8s *K8sClient) CreateChaincodeDeployment(
 							Command:         cmd,
 						},
 					},
-					HostAliases: hostAlias,
+					HostAliases:      hostAlias,
+					ImagePullSecrets: imagePullSecrets(pullSecrets),
+					Affinity:         nodeAffinity(archs),
 				},
 			},
 		},
 	}
 
+	stampDeployment(deployment)
+
 	opts := metav1.CreateOptions{}
-	_, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Create(ctx, deployment, opts)
+	created, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Create(ctx, deployment, opts)
 	if err != nil {
 		log.Errorf("create deployment: %v", err)
 
 		return err
 	}
+	k8s.recorder.observe(created)
 
 	return nil
 }
@@ -183,37 +247,38 @@ func (k8s *K8sClient) CreateChaincodeDeploymentWithPuller(
 	cmd []string,
 	pullerImag string,
 	pullerCMD []string,
+	mounts []HostPathMount,
+	annotations map[string]string,
+	labels map[string]string,
+	archs []string,
 ) error {
-	// replicas
-	replicas := int32(0)
-
-	// build environment variables
-	envs := make([]v1.EnvVar, 0, len(env))
-	if len(env) > 0 {
-		for _, s := range env {
-			array := strings.Split(s, "=")
-			envs = append(envs, v1.EnvVar{
-				Name:  array[0],
-				Value: array[1],
-			})
-
-			if array[0] == "CORE_PEER_TLS_ENABLED" && array[1] == "false" {
-				replicas = 1
-			}
-		}
-	}
+	// build environment variables, the replicas wait for the tls configmap if tls is enabled
+	envs, replicas := envVars(env)
 
 	// dns
-	var hostAlias []v1.HostAlias
-	if len(k8s.dns) > 0 {
-		for _, s := range k8s.dns {
-			strs := strings.Split(s, ":")
-			hostAlias = append(hostAlias, v1.HostAlias{
-				IP:        strs[0],
-				Hostnames: []string{strs[1]},
-			})
-		}
+	hostAlias := k8s.hostAliases()
+
+	// runtime socket and storage
+	volumes := make([]v1.Volume, 0, len(mounts))
+	volumeMounts := make([]v1.VolumeMount, 0, len(mounts))
+	for _, m := range mounts {
+		volumes = append(volumes, v1.Volume{
+			Name: m.Name,
+			VolumeSource: v1.VolumeSource{
+				HostPath: &v1.HostPathVolumeSource{
+					Path: m.HostPath,
+				},
+			},
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      m.Name,
+			MountPath: m.MountPath,
+		})
 	}
+	// the puller exchanges its service account token for a download token
+	credential, credentialMount := pullerCredential()
+	volumes = append(volumes, credential)
+	volumeMounts = append(volumeMounts, credentialMount)
 
 	deployment := &appsv1.Deployment{
 		TypeMeta: metav1.TypeMeta{
@@ -221,7 +286,9 @@ func (k8s *K8sClient) CreateChaincodeDeploymentWithPuller(
 			APIVersion: "apps/v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name,
+			Name:        name,
+			Labels:      labels,
+			Annotations: annotations,
 		},
 		Spec: appsv1.DeploymentSpec{
 			Strategy: appsv1.DeploymentStrategy{
@@ -233,32 +300,19 @@ func (k8s *K8sClient) CreateChaincodeDeploymentWithPuller(
 			},
 			Template: v1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Name:   name,
-					Labels: map[string]string{"app": name},
+					Name:        name,
+					Labels:      merge(labels, map[string]string{"app": name}),
+					Annotations: podAnnotations(annotations),
 				},
 				Spec: v1.PodSpec{
-					Volumes: []v1.Volume{
-						{
-							Name: "docker",
-							VolumeSource: v1.VolumeSource{
-								HostPath: &v1.HostPathVolumeSource{
-									Path: "/var/run/",
-								},
-							},
-						},
-					},
+					Volumes: volumes,
 					InitContainers: []v1.Container{
 						{
 							Name:            "puller",
 							Image:           pullerImag,
 							ImagePullPolicy: v1.PullAlways,
 							Command:         pullerCMD,
-							VolumeMounts: []v1.VolumeMount{
-								{
-									Name:      "docker",
-									MountPath: "/host/var/run/",
-								},
-							},
+							VolumeMounts:    volumeMounts,
 						},
 					},
 					Containers: []v1.Container{
@@ -271,18 +325,22 @@ func (k8s *K8sClient) CreateChaincodeDeploymentWithPuller(
 						},
 					},
 					HostAliases: hostAlias,
+					Affinity:    nodeAffinity(archs),
 				},
 			},
 		},
 	}
 
+	stampDeployment(deployment)
+
 	opts := metav1.CreateOptions{}
-	_, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Create(ctx, deployment, opts)
+	created, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Create(ctx, deployment, opts)
 	if err != nil {
 		log.Errorf("create deployment: %v", err)
 
 		return err
 	}
+	k8s.recorder.observe(created)
 
 	return nil
 }
@@ -300,60 +358,7 @@ func (k8s *K8sClient) UpdateDeployment(ctx context.Context, name string) error {
 	replicas := int32(1)
 	deployment.Spec.Replicas = &replicas
 
-	items := []v1.KeyToPath{
-		{
-			Key:  "client.key",
-			Path: "client.key",
-		},
-		{
-			Key:  "client.crt",
-			Path: "client.crt",
-		},
-		{
-			Key:  "peer.crt",
-			Path: "peer.crt",
-		},
-	}
-
-	volumeMounts := []v1.VolumeMount{
-		{
-			Name:      name + "-config",
-			MountPath: TLSClientKeyPath,
-			SubPath:   "client.key",
-		},
-		{
-			Name:      name + "-config",
-			MountPath: TLSClientCertPath,
-			SubPath:   "client.crt",
-		},
-		{
-			Name:      name + "-config",
-			MountPath: TLSClientRootCertPath,
-			SubPath:   "peer.crt",
-		},
-	}
-
-	if ctx.Value("version") == "v2.0.0" {
-		items = append(items, v1.KeyToPath{
-			Key:  "client_pem.key",
-			Path: "client_pem.key",
-		})
-		items = append(items, v1.KeyToPath{
-			Key:  "client_pem.crt",
-			Path: "client_pem.crt",
-		})
-
-		volumeMounts = append(volumeMounts, v1.VolumeMount{
-			Name:      name + "-config",
-			MountPath: TLSClientKeyFile,
-			SubPath:   "client_pem.key",
-		})
-		volumeMounts = append(volumeMounts, v1.VolumeMount{
-			Name:      name + "-config",
-			MountPath: TLSClientCertFile,
-			SubPath:   "client_pem.crt",
-		})
-	}
+	items, volumeMounts := tlsMounts(name+"-config", ctx.Value("version") == "v2.0.0")
 
 	// append volumes
 	deployment.Spec.Template.Spec.Volumes = append(deployment.Spec.Template.Spec.Volumes, v1.Volume{
@@ -375,9 +380,10 @@ func (k8s *K8sClient) UpdateDeployment(ctx context.Context, name string) error {
 	)
 
 	deployment.ResourceVersion = ""
+	stampDeployment(deployment)
 
 	// update deployment
-	_, err = k8s.k8sClientSet.AppsV1().
+	updated, err := k8s.k8sClientSet.AppsV1().
 		Deployments(k8s.namespace).
 		Update(context.Background(), deployment, metav1.UpdateOptions{})
 	if err != nil {
@@ -385,25 +391,35 @@ func (k8s *K8sClient) UpdateDeployment(ctx context.Context, name string) error {
 
 		return err
 	}
+	k8s.recorder.observe(updated)
 
 	return nil
 }
 
 func (k8s *K8sClient) CreateConfigMap(ctx context.Context, name string, data map[string]string) error {
+	// the configmap is owned like the chaincode deployment
+	labels := OwnerLabels(nil)
+	deployment, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		labels = OwnerLabels(deployment.Labels)
+	}
+
 	tlsConfigMap := &v1.ConfigMap{
 		TypeMeta: metav1.TypeMeta{
 			Kind:       "ConfigMap",
 			APIVersion: "v1",
 		},
 		ObjectMeta: metav1.ObjectMeta{
-			Name: name + "-configmap",
+			Name:   name + "-configmap",
+			Labels: labels,
 		},
 		Data: data,
 	}
+	stampConfigMap(tlsConfigMap)
 
 	opts := metav1.CreateOptions{}
 
-	_, err := k8s.k8sClientSet.CoreV1().ConfigMaps(k8s.namespace).Create(ctx, tlsConfigMap, opts)
+	_, err = k8s.k8sClientSet.CoreV1().ConfigMaps(k8s.namespace).Create(ctx, tlsConfigMap, opts)
 	if err != nil {
 		log.Errorf("create tlsConfigMap failed: %v", err)
 
@@ -414,22 +430,46 @@ func (k8s *K8sClient) CreateConfigMap(ctx context.Context, name string, data map
 }
 
 func (k8s *K8sClient) DeleteChaincodeDeployment(ctx context.Context, name string) error {
-	err := k8s.k8sClientSet.AppsV1().
+	// the deployment reconciled from a chaincode resource is deleted with it, it would be recreated otherwise
+	deployment, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err == nil {
+		if owner := metav1.GetControllerOf(deployment); owner != nil && owner.Kind == v1alpha1.Kind {
+			_ = k8s.deleteChaincodeResource(ctx, owner.Name)
+		} else {
+			// the drift detector does not recreate the deployment deleted by peitho
+			_ = k8s.AnnotateDeployment(ctx, name, map[string]string{AnnotationState: STATE_REMOVED})
+		}
+	}
+
+	err = k8s.k8sClientSet.AppsV1().
 		Deployments(k8s.namespace).
-		Delete(context.Background(), name, metav1.DeleteOptions{})
-	if err != nil {
+		Delete(ctx, name, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
 		log.Errorf("delete chaincode deployment failed: %v", err)
+
+		return err
 	}
+	k8s.recorder.forget(name)
 
 	return nil
 }
 
 func (k8s *K8sClient) DeleteConfigMapDeployment(ctx context.Context, name string) error {
+	// the drift detector does not recreate the configmap deleted by peitho
+	patch, _ := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": map[string]string{AnnotationState: STATE_REMOVED}},
+	})
+	_, _ = k8s.k8sClientSet.CoreV1().
+		ConfigMaps(k8s.namespace).
+		Patch(ctx, name+configMapSuffix, types.MergePatchType, patch, metav1.PatchOptions{})
+
 	err := k8s.k8sClientSet.CoreV1().
 		ConfigMaps(k8s.namespace).
-		Delete(context.Background(), name+"-configmap", metav1.DeleteOptions{})
-	if err != nil {
+		Delete(ctx, name+configMapSuffix, metav1.DeleteOptions{})
+	if err != nil && !apierrors.IsNotFound(err) {
 		log.Errorf("delete tls configmap failed: %v", err)
+
+		return err
 	}
 
 	return nil
@@ -450,13 +490,341 @@ func (k8s *K8sClient) QueryDeploymentStatus(ctx context.Context, name string) (b
 	return false, err
 }
 
-func (k8s *K8sClient) ListDeploymentByPrefix(ctx context.Context, prefix string) ([]appsv1.Deployment, error) {
-	deployments, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).List(ctx, metav1.ListOptions{})
+// ListChaincodeDeployments list the chaincode deployments owned by peitho and matching the selector.
+func (k8s *K8sClient) ListChaincodeDeployments(ctx context.Context, selector map[string]string) ([]appsv1.Deployment, error) {
+	deployments, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(merge(selector, OwnerLabels(nil))).String(),
+	})
 	if err != nil {
 		log.Errorf("list deployments failed: %v", err)
 
 		return nil, err
 	}
+	for i := range deployments.Items {
+		k8s.recorder.observe(&deployments.Items[i])
+	}
 
 	return deployments.Items, nil
 }
+
+// ListChaincodeConfigMaps list the chaincode configmaps owned by peitho and matching the selector.
+func (k8s *K8sClient) ListChaincodeConfigMaps(ctx context.Context, selector map[string]string) ([]v1.ConfigMap, error) {
+	configMaps, err := k8s.k8sClientSet.CoreV1().ConfigMaps(k8s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(merge(selector, OwnerLabels(nil))).String(),
+	})
+	if err != nil {
+		log.Errorf("list configmaps failed: %v", err)
+
+		return nil, err
+	}
+
+	return configMaps.Items, nil
+}
+
+func (k8s *K8sClient) GetDeployment(ctx context.Context, name string) (*appsv1.Deployment, error) {
+	deployment, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get deployment %s failed: %v", name, err)
+
+		return nil, err
+	}
+	k8s.recorder.observe(deployment)
+
+	return deployment, nil
+}
+
+func (k8s *K8sClient) GetDockerConfigSecret(ctx context.Context, name string) ([]byte, error) {
+	secret, err := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace).Get(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get secret %s failed: %v", name, err)
+
+		return nil, err
+	}
+
+	if secret.Type != v1.SecretTypeDockerConfigJson {
+		return nil, fmt.Errorf("secret %s is %s, not %s", name, secret.Type, v1.SecretTypeDockerConfigJson)
+	}
+
+	return secret.Data[v1.DockerConfigJsonKey], nil
+}
+
+// ApplyDockerConfigSecret create or update the dockerconfigjson secret.
+func (k8s *K8sClient) ApplyDockerConfigSecret(ctx context.Context, name string, data []byte) error {
+	secrets := k8s.k8sClientSet.CoreV1().Secrets(k8s.namespace)
+
+	secret, err := secrets.Get(ctx, name, metav1.GetOptions{})
+	if apierrors.IsNotFound(err) {
+		secret = &v1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:   name,
+				Labels: OwnerLabels(nil),
+			},
+			Type: v1.SecretTypeDockerConfigJson,
+			Data: map[string][]byte{v1.DockerConfigJsonKey: data},
+		}
+		if _, err := secrets.Create(ctx, secret, metav1.CreateOptions{}); err != nil {
+			log.Errorf("create secret %s failed: %v", name, err)
+
+			return err
+		}
+
+		return nil
+	}
+	if err != nil {
+		log.Errorf("get secret %s failed: %v", name, err)
+
+		return err
+	}
+
+	if bytes.Equal(secret.Data[v1.DockerConfigJsonKey], data) && secret.Labels[LabelManagedBy] == ManagedBy {
+		return nil
+	}
+
+	secret.Labels = merge(secret.Labels, OwnerLabels(nil))
+	secret.Data = map[string][]byte{v1.DockerConfigJsonKey: data}
+	if _, err := secrets.Update(ctx, secret, metav1.UpdateOptions{}); err != nil {
+		log.Errorf("update secret %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// ListChaincodePods list the pods of the chaincode deployment.
+func (k8s *K8sClient) ListChaincodePods(ctx context.Context, name string) ([]v1.Pod, error) {
+	pods, err := k8s.k8sClientSet.CoreV1().Pods(k8s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "app=" + name,
+	})
+	if err != nil {
+		log.Errorf("list pods of %s failed: %v", name, err)
+
+		return nil, err
+	}
+
+	return pods.Items, nil
+}
+
+// ScaleDeployment set the replicas of the deployment.
+func (k8s *K8sClient) ScaleDeployment(ctx context.Context, name string, replicas int32) error {
+	deployments := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace)
+
+	scale, err := deployments.GetScale(ctx, name, metav1.GetOptions{})
+	if err != nil {
+		log.Errorf("get scale of %s failed: %v", name, err)
+
+		return err
+	}
+
+	scale.Spec.Replicas = replicas
+	if _, err := deployments.UpdateScale(ctx, name, scale, metav1.UpdateOptions{}); err != nil {
+		log.Errorf("scale %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// AnnotateDeployment merge the annotations into the deployment.
+func (k8s *K8sClient) AnnotateDeployment(ctx context.Context, name string, annotations map[string]string) error {
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{"annotations": annotations},
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = k8s.k8sClientSet.AppsV1().
+		Deployments(k8s.namespace).
+		Patch(ctx, name, types.MergePatchType, patch, metav1.PatchOptions{})
+	if err != nil {
+		log.Errorf("annotate %s failed: %v", name, err)
+
+		return err
+	}
+
+	return nil
+}
+
+// AdoptChaincodeResources label the chaincode deployments created before the ownership labels and
+// their configmaps, the deployments are recognized by the chaincode id passed by the peer.
+func (k8s *K8sClient) AdoptChaincodeResources(ctx context.Context) (int, error) {
+	deployments, err := k8s.k8sClientSet.AppsV1().Deployments(k8s.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "!" + LabelManagedBy,
+	})
+	if err != nil {
+		log.Errorf("list deployments failed: %v", err)
+
+		return 0, err
+	}
+
+	adopted := 0
+	for _, deployment := range deployments.Items {
+		containers := deployment.Spec.Template.Spec.Containers
+		if len(containers) == 0 || deployment.Spec.Template.Labels["app"] != deployment.Name {
+			continue
+		}
+		env := make([]string, 0, len(containers[0].Env))
+		for _, e := range containers[0].Env {
+			env = append(env, e.Name+"="+e.Value)
+		}
+		owner := ChaincodeLabels(deployment.Name, env)
+		if _, ok := owner[LabelChaincodeName]; !ok {
+			continue
+		}
+
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{"labels": owner},
+		})
+		_, err := k8s.k8sClientSet.AppsV1().
+			Deployments(k8s.namespace).
+			Patch(ctx, deployment.Name, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			log.Errorf("adopt deployment %s failed: %v", deployment.Name, err)
+
+			return adopted, err
+		}
+		_, err = k8s.k8sClientSet.CoreV1().
+			ConfigMaps(k8s.namespace).
+			Patch(ctx, deployment.Name+"-configmap", types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			log.Errorf("adopt configmap of %s failed: %v", deployment.Name, err)
+
+			return adopted, err
+		}
+
+		log.Infof("adopted chaincode deployment %s", deployment.Name)
+		adopted++
+	}
+
+	return adopted, nil
+}
+
+// tlsMounts return the files of the tls configmap or secret and their mounts into the chaincode container,
+// fabric 2 passes the pem key and certificate too.
+func tlsMounts(volume string, pem bool) ([]v1.KeyToPath, []v1.VolumeMount) {
+	items := []v1.KeyToPath{
+		{
+			Key:  "client.key",
+			Path: "client.key",
+		},
+		{
+			Key:  "client.crt",
+			Path: "client.crt",
+		},
+		{
+			Key:  "peer.crt",
+			Path: "peer.crt",
+		},
+	}
+
+	volumeMounts := []v1.VolumeMount{
+		{
+			Name:      volume,
+			MountPath: TLSClientKeyPath,
+			SubPath:   "client.key",
+		},
+		{
+			Name:      volume,
+			MountPath: TLSClientCertPath,
+			SubPath:   "client.crt",
+		},
+		{
+			Name:      volume,
+			MountPath: TLSClientRootCertPath,
+			SubPath:   "peer.crt",
+		},
+	}
+
+	if pem {
+		items = append(items, v1.KeyToPath{
+			Key:  "client_pem.key",
+			Path: "client_pem.key",
+		})
+		items = append(items, v1.KeyToPath{
+			Key:  "client_pem.crt",
+			Path: "client_pem.crt",
+		})
+
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      volume,
+			MountPath: TLSClientKeyFile,
+			SubPath:   "client_pem.key",
+		})
+		volumeMounts = append(volumeMounts, v1.VolumeMount{
+			Name:      volume,
+			MountPath: TLSClientCertFile,
+			SubPath:   "client_pem.crt",
+		})
+	}
+
+	return items, volumeMounts
+}
+
+// envVars return the environment variables of the chaincode container and
+// its replicas before the tls configmap is uploaded, 1 if tls is disabled.
+func envVars(env []string) ([]v1.EnvVar, int32) {
+	replicas := int32(0)
+
+	envs := make([]v1.EnvVar, 0, len(env))
+	for _, s := range env {
+		array := strings.Split(s, "=")
+		envs = append(envs, v1.EnvVar{
+			Name:  array[0],
+			Value: array[1],
+		})
+
+		if array[0] == "CORE_PEER_TLS_ENABLED" && array[1] == "false" {
+			replicas = 1
+		}
+	}
+
+	return envs, replicas
+}
+
+// hostAliases return the host aliases resolving the peers.
+func (k8s *K8sClient) hostAliases() []v1.HostAlias {
+	var hostAlias []v1.HostAlias
+	for _, s := range k8s.dns {
+		strs := strings.Split(s, ":")
+		hostAlias = append(hostAlias, v1.HostAlias{
+			IP:        strs[0],
+			Hostnames: []string{strs[1]},
+		})
+	}
+
+	return hostAlias
+}
+
+func imagePullSecrets(names []string) []v1.LocalObjectReference {
+	var refs []v1.LocalObjectReference
+	for _, name := range names {
+		if name != "" {
+			refs = append(refs, v1.LocalObjectReference{Name: name})
+		}
+	}
+
+	return refs
+}
+
+// nodeAffinity schedule the pods to the nodes of the architectures, nil allows every node.
+func nodeAffinity(archs []string) *v1.Affinity {
+	if len(archs) == 0 {
+		return nil
+	}
+
+	return &v1.Affinity{
+		NodeAffinity: &v1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &v1.NodeSelector{
+				NodeSelectorTerms: []v1.NodeSelectorTerm{{
+					MatchExpressions: []v1.NodeSelectorRequirement{{
+						Key:      v1.LabelArchStable,
+						Operator: v1.NodeSelectorOpIn,
+						Values:   archs,
+					}},
+				}},
+			},
+		},
+	}
+}
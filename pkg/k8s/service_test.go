@@ -0,0 +1,159 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package k8s
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/kubernetes/fake"
+	clienttesting "k8s.io/client-go/testing"
+)
+
+func TestChaincodeLabels(t *testing.T) {
+	hash := "0e3a8d47dcd7e0c46d3a4a8a5bdbb8ea0fe1f7b3fd2d3d7b64e6cdf7b1d6bd4d"
+
+	tests := []struct {
+		name      string
+		container string
+		env       []string
+		want      map[string]string
+	}{
+		{
+			name:      "fabric 1.4",
+			container: "dev-peer0.org1.example.com-mycc-1.0",
+			env:       []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0", "CORE_PEER_TLS_ENABLED=true"},
+			want: map[string]string{
+				LabelManagedBy:        ManagedBy,
+				LabelPeerID:           "peer0.org1.example.com",
+				LabelChaincodeName:    "mycc",
+				LabelChaincodeVersion: "1.0",
+			},
+		},
+		{
+			name:      "fabric 2 package",
+			container: "dev-peer0.org1.example.com-mycc_1.0-" + hash,
+			env:       []string{"CORE_CHAINCODE_ID_NAME=mycc_1.0:" + hash},
+			want: map[string]string{
+				LabelManagedBy:        ManagedBy,
+				LabelPeerID:           "peer0.org1.example.com",
+				LabelChaincodeName:    "mycc",
+				LabelChaincodeVersion: "1.0",
+			},
+		},
+		{
+			name:      "deployment name",
+			container: "dev-peer0-org1-example-com-mycc-1-0",
+			env:       []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0"},
+			want: map[string]string{
+				LabelManagedBy:        ManagedBy,
+				LabelPeerID:           "peer0-org1-example-com",
+				LabelChaincodeName:    "mycc",
+				LabelChaincodeVersion: "1.0",
+			},
+		},
+		{
+			name:      "hashed deployment name",
+			container: "chaincode-dev-peer0--0123456789abcdef0123456789abcdef",
+			env:       []string{"CORE_CHAINCODE_ID_NAME=mycc:1.0+build/7"},
+			want: map[string]string{
+				LabelManagedBy:        ManagedBy,
+				LabelChaincodeName:    "mycc",
+				LabelChaincodeVersion: "1.0-build-7",
+			},
+		},
+		{name: "no chaincode", container: "couchdb0", want: map[string]string{LabelManagedBy: ManagedBy}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ChaincodeLabels(tt.container, tt.env); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ChaincodeLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func chaincodeDeployment(name string, env []v1.EnvVar, labels map[string]string) *appsv1.Deployment {
+	return &appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "fabric", Labels: labels},
+		Spec: appsv1.DeploymentSpec{
+			Template: v1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"app": name}},
+				Spec:       v1.PodSpec{Containers: []v1.Container{{Name: name, Env: env}}},
+			},
+		},
+	}
+}
+
+func TestK8sClient_AdoptChaincodeResources(t *testing.T) {
+	ctx := context.Background()
+	owned := ChaincodeLabels("dev-peer0-org1-mycc-2-0", []string{"CORE_CHAINCODE_ID_NAME=mycc:2.0"})
+	objects := []runtime.Object{
+		chaincodeDeployment("dev-peer0-org1-mycc-1-0", []v1.EnvVar{{Name: "CORE_CHAINCODE_ID_NAME", Value: "mycc:1.0"}}, nil),
+		&v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: "dev-peer0-org1-mycc-1-0-configmap", Namespace: "fabric"}},
+		// the peers and couchdb are never adopted
+		chaincodeDeployment("peer0-org1", []v1.EnvVar{{Name: "CORE_PEER_ID", Value: "peer0.org1"}}, nil),
+		chaincodeDeployment("couchdb0", nil, map[string]string{"app": "couchdb0"}),
+		chaincodeDeployment("dev-peer0-org1-mycc-2-0", []v1.EnvVar{{Name: "CORE_CHAINCODE_ID_NAME", Value: "mycc:2.0"}}, owned),
+	}
+	client := &K8sClient{k8sClientSet: fake.NewSimpleClientset(objects...), namespace: "fabric"}
+
+	adopted, err := client.AdoptChaincodeResources(ctx)
+	if err != nil || adopted != 1 {
+		t.Fatalf("AdoptChaincodeResources() = %d, %v, want 1", adopted, err)
+	}
+
+	deployments, err := client.ListChaincodeDeployments(ctx, nil)
+	if err != nil || len(deployments) != 2 {
+		t.Fatalf("ListChaincodeDeployments() = %d, %v, want the chaincode deployments", len(deployments), err)
+	}
+	deployments, _ = client.ListChaincodeDeployments(ctx, map[string]string{LabelChaincodeVersion: "1.0"})
+	if len(deployments) != 1 || deployments[0].Labels[LabelPeerID] != "peer0-org1" {
+		t.Errorf("ListChaincodeDeployments() of version 1.0 = %v", deployments)
+	}
+
+	configMap, _ := client.k8sClientSet.CoreV1().ConfigMaps("fabric").Get(ctx, "dev-peer0-org1-mycc-1-0-configmap", metav1.GetOptions{})
+	if configMap.Labels[LabelManagedBy] != ManagedBy || configMap.Labels[LabelChaincodeName] != "mycc" {
+		t.Errorf("configmap labels = %v, want the labels of the deployment", configMap.Labels)
+	}
+
+	// adopted once
+	if adopted, err := client.AdoptChaincodeResources(ctx); err != nil || adopted != 0 {
+		t.Errorf("AdoptChaincodeResources() again = %d, %v, want 0", adopted, err)
+	}
+}
+
+func TestK8sClient_DeleteChaincodeDeployment_error(t *testing.T) {
+	ctx := context.Background()
+	clientset := fake.NewSimpleClientset()
+	client := &K8sClient{k8sClientSet: clientset, namespace: "fabric"}
+
+	// deleting what is gone already succeeds
+	if err := client.DeleteChaincodeDeployment(ctx, "gone"); err != nil {
+		t.Errorf("DeleteChaincodeDeployment() of missing deployment error = %v", err)
+	}
+	if err := client.DeleteConfigMapDeployment(ctx, "gone"); err != nil {
+		t.Errorf("DeleteConfigMapDeployment() of missing configmap error = %v", err)
+	}
+
+	forbidden := apierrors.NewForbidden(schema.GroupResource{Resource: "deployments"}, "mycc", errors.New("denied"))
+	clientset.PrependReactor("delete", "*", func(action clienttesting.Action) (bool, runtime.Object, error) {
+		return true, nil, forbidden
+	})
+	if err := client.DeleteChaincodeDeployment(ctx, "mycc"); !apierrors.IsForbidden(err) {
+		t.Errorf("DeleteChaincodeDeployment() error = %v, want %v", err, forbidden)
+	}
+	if err := client.DeleteConfigMapDeployment(ctx, "mycc"); !apierrors.IsForbidden(err) {
+		t.Errorf("DeleteConfigMapDeployment() error = %v, want %v", err, forbidden)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"time"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// Actor is a long running component, it returns after its context is done and it has stopped.
+type Actor func(ctx context.Context) error
+
+type actor struct {
+	name string
+	run  Actor
+}
+
+// Group run actors until the context is done or one of them fails, then stops them one by one
+// in the reverse order they are added, so the actors added first outlive the ones depending on them.
+type Group struct {
+	timeout time.Duration
+	actors  []actor
+}
+
+// NewGroup create a group waiting at most timeout for each actor to stop.
+func NewGroup(timeout time.Duration) *Group {
+	return &Group{timeout: timeout}
+}
+
+// Add register the actor, an actor returning nil before it is stopped just finishes.
+func (g *Group) Add(name string, run Actor) {
+	g.actors = append(g.actors, actor{name: name, run: run})
+}
+
+// Run start every actor and block until all of them are stopped, it return the first error of them.
+func (g *Group) Run(ctx context.Context) error {
+	n := len(g.actors)
+	errs := make([]error, n)
+	done := make([]chan struct{}, n)
+	cancels := make([]context.CancelFunc, n)
+	exited := make(chan int, n)
+
+	for i := range g.actors {
+		// the actors are not stopped by ctx, but in order after it
+		actorCtx, cancel := context.WithCancel(context.Background())
+		cancels[i] = cancel
+		done[i] = make(chan struct{})
+
+		go func(i int, ctx context.Context) {
+			errs[i] = g.actors[i].run(ctx)
+			close(done[i])
+			exited <- i
+		}(i, actorCtx)
+	}
+
+	var err error
+wait:
+	for {
+		select {
+		case <-ctx.Done():
+			log.Info("shutting down")
+
+			break wait
+		case i := <-exited:
+			if errs[i] != nil {
+				log.Errorf("%s failed: %v", g.actors[i].name, errs[i])
+				err = errs[i]
+
+				break wait
+			}
+			log.Infof("%s finished", g.actors[i].name)
+		}
+	}
+
+	for i := n - 1; i >= 0; i-- {
+		cancels[i]()
+
+		select {
+		case <-done[i]:
+			if errs[i] != nil && err == nil {
+				err = errs[i]
+			}
+			log.Infof("%s stopped", g.actors[i].name)
+		case <-time.After(g.timeout):
+			log.Errorf("stop %s timed out after %s", g.actors[i].name, g.timeout)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,116 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/marmotedu/errors"
+)
+
+// recorder record the order the actors are stopped in.
+type recorder struct {
+	lock    sync.Mutex
+	stopped []string
+}
+
+func (r *recorder) actor(name string, running *sync.WaitGroup) Actor {
+	running.Add(1)
+
+	return func(ctx context.Context) error {
+		running.Done()
+		<-ctx.Done()
+		// a slow actor, the next one must not be stopped before it returns
+		time.Sleep(10 * time.Millisecond)
+
+		r.lock.Lock()
+		defer r.lock.Unlock()
+		r.stopped = append(r.stopped, name)
+
+		return nil
+	}
+}
+
+func TestGroup_Run(t *testing.T) {
+	r := &recorder{}
+	running := &sync.WaitGroup{}
+
+	group := NewGroup(time.Second)
+	group.Add("sweeper", r.actor("sweeper", running))
+	group.Add("base image keeper", r.actor("base image keeper", running))
+	// an actor with nothing to do finishes without stopping the others
+	group.Add("disabled", func(ctx context.Context) error { return nil })
+	group.Add("server", r.actor("server", running))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		running.Wait()
+		cancel()
+	}()
+
+	if err := group.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{"server", "base image keeper", "sweeper"}
+	if !reflect.DeepEqual(r.stopped, want) {
+		t.Errorf("stopped %v, want %v", r.stopped, want)
+	}
+}
+
+func TestGroup_Run_failed(t *testing.T) {
+	r := &recorder{}
+	running := &sync.WaitGroup{}
+	errListen := errors.New("address already in use")
+
+	group := NewGroup(time.Second)
+	group.Add("sweeper", r.actor("sweeper", running))
+	group.Add("server", func(ctx context.Context) error {
+		running.Wait()
+
+		return errListen
+	})
+
+	// the failed actor stops the others without a signal
+	if err := group.Run(context.Background()); !errors.Is(err, errListen) {
+		t.Errorf("Run() error = %v, want %v", err, errListen)
+	}
+	if !reflect.DeepEqual(r.stopped, []string{"sweeper"}) {
+		t.Errorf("stopped %v, want the sweeper", r.stopped)
+	}
+}
+
+func TestGroup_Run_timeout(t *testing.T) {
+	r := &recorder{}
+	running := &sync.WaitGroup{}
+	stuck := make(chan struct{})
+	defer close(stuck)
+
+	group := NewGroup(50 * time.Millisecond)
+	group.Add("sweeper", r.actor("sweeper", running))
+	group.Add("stuck", func(ctx context.Context) error {
+		<-stuck
+
+		return nil
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	start := time.Now()
+	if err := group.Run(ctx); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Run() took %s, want the stuck actor to be given up", elapsed)
+	}
+	if !reflect.DeepEqual(r.stopped, []string{"sweeper"}) {
+		t.Errorf("stopped %v, want the sweeper", r.stopped)
+	}
+}
@@ -0,0 +1,128 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+// Tracker count the in-flight requests to drain before the server is closed.
+type Tracker struct {
+	lock   sync.Mutex
+	active int
+	idle   chan struct{}
+}
+
+// NewTracker create an idle tracker.
+func NewTracker() *Tracker {
+	idle := make(chan struct{})
+	close(idle)
+
+	return &Tracker{idle: idle}
+}
+
+// Begin track a request, the returned function ends it.
+func (t *Tracker) Begin() func() {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	if t.active == 0 {
+		t.idle = make(chan struct{})
+	}
+	t.active++
+
+	var once sync.Once
+
+	return func() {
+		once.Do(func() {
+			t.lock.Lock()
+			defer t.lock.Unlock()
+
+			t.active--
+			if t.active == 0 {
+				close(t.idle)
+			}
+		})
+	}
+}
+
+// Active return the count of in-flight requests.
+func (t *Tracker) Active() int {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	return t.active
+}
+
+// Wait block until no request is in flight or ctx is done.
+func (t *Tracker) Wait(ctx context.Context) error {
+	for {
+		t.lock.Lock()
+		idle := t.idle
+		t.lock.Unlock()
+
+		select {
+		case <-idle:
+			// a request may begin between the close and this check
+			if t.Active() == 0 {
+				return nil
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// Serve return the actor serving srv on the listener. When it is stopped the listener is closed,
+// the tracked requests are drained within drain, then the remaining connections are closed.
+func Serve(listener net.Listener, srv *http.Server, tracker *Tracker, drain time.Duration) Actor {
+	return func(ctx context.Context) error {
+		served := make(chan error, 1)
+		go func() {
+			served <- srv.Serve(listener)
+		}()
+
+		select {
+		case err := <-served:
+			return err
+		case <-ctx.Done():
+		}
+
+		drainCtx, cancel := context.WithTimeout(context.Background(), drain)
+		defer cancel()
+
+		// stop accepting, shutdown waits for the idle connections in the background
+		shutdown := make(chan error, 1)
+		go func() {
+			shutdown <- srv.Shutdown(drainCtx)
+		}()
+
+		if err := tracker.Wait(drainCtx); err != nil {
+			log.Errorf("drain requests failed: %v, %d requests are aborted", err, tracker.Active())
+		}
+
+		// long polling requests, like wait, are not drained
+		if err := srv.Close(); err != nil {
+			log.Errorf("close server failed: %v", err)
+		}
+
+		if err := <-shutdown; err != nil && !errors.Is(err, context.DeadlineExceeded) && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		if err := <-served; err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+
+		return nil
+	}
+}
@@ -0,0 +1,154 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package lifecycle
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// newServer serve /build, tracked and completed when release is closed, and /wait, polling until the client leaves.
+func newServer(t *testing.T, tracker *Tracker, release chan struct{}) (net.Listener, *http.Server, chan struct{}) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	building := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/build", func(w http.ResponseWriter, r *http.Request) {
+		done := tracker.Begin()
+		defer done()
+
+		close(building)
+		<-release
+		_, _ = w.Write([]byte("built"))
+	})
+	mux.HandleFunc("/wait", func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+
+	return listener, &http.Server{Handler: mux}, building
+}
+
+func TestServe(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+	listener, srv, building := newServer(t, tracker, release)
+	url := "http://" + listener.Addr().String()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- Serve(listener, srv, tracker, 10*time.Second)(ctx)
+	}()
+
+	built := make(chan string, 1)
+	go func() {
+		resp, err := http.Post(url+"/build", "application/x-tar", nil)
+		if err != nil {
+			built <- err.Error()
+
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := ioutil.ReadAll(resp.Body)
+		built <- string(body)
+	}()
+	<-building
+
+	waited := make(chan error, 1)
+	go func() {
+		resp, err := http.Post(url+"/wait", "application/json", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+		waited <- err
+	}()
+
+	// the server is stopped while building, it drains the build
+	cancel()
+	select {
+	case err := <-stopped:
+		t.Fatalf("Serve() returned %v before the build is drained", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(release)
+	if body := <-built; body != "built" {
+		t.Errorf("build response = %s, want the build to complete", body)
+	}
+
+	// then the polling wait is closed
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() is not stopped after the build is drained")
+	}
+	if err := <-waited; err == nil {
+		t.Errorf("wait request is not closed")
+	}
+}
+
+func TestServe_drainTimeout(t *testing.T) {
+	tracker := NewTracker()
+	release := make(chan struct{})
+	defer close(release)
+	listener, srv, building := newServer(t, tracker, release)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- Serve(listener, srv, tracker, 100*time.Millisecond)(ctx)
+	}()
+
+	go func() {
+		resp, err := http.Post("http://"+listener.Addr().String()+"/build", "application/x-tar", nil)
+		if err == nil {
+			resp.Body.Close()
+		}
+	}()
+	<-building
+
+	// the build never completes, it is aborted after the drain timeout
+	cancel()
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Errorf("Serve() error = %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() is not stopped after the drain timeout")
+	}
+}
+
+func TestTracker_Wait(t *testing.T) {
+	tracker := NewTracker()
+	if err := tracker.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() of an idle tracker error = %v", err)
+	}
+
+	first, second := tracker.Begin(), tracker.Begin()
+	first()
+	first()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := tracker.Wait(ctx); err == nil || tracker.Active() != 1 {
+		t.Errorf("Wait() with a request in flight error = %v, active %d", err, tracker.Active())
+	}
+
+	second()
+	if err := tracker.Wait(context.Background()); err != nil {
+		t.Errorf("Wait() after the requests end error = %v", err)
+	}
+}
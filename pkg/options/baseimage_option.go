@@ -0,0 +1,72 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// BaseImageOption defines the builder and runtime images kept on the docker host, like fabric-ccenv and fabric-baseos.
+type BaseImageOption struct {
+	// Images are pinned by appending @sha256:..., the manifest digest or the image id
+	Images []string `json:"images"   mapstructure:"images"`
+	// Bundle is a docker save tar loaded when an image is missing, for air-gapped environments
+	Bundle   string `json:"bundle"   mapstructure:"bundle"`
+	Interval int    `json:"interval" mapstructure:"interval"`
+}
+
+// NewBaseImageOption create a `zero` value instance.
+func NewBaseImageOption() *BaseImageOption {
+	return &BaseImageOption{
+		Images:   []string{},
+		Bundle:   "",
+		Interval: 3600,
+	}
+}
+
+// Validate validate option value.
+func (o *BaseImageOption) Validate() []error {
+	errs := []error{}
+
+	if o.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("baseimage interval must be greater than zero"))
+	}
+
+	if o.Bundle != "" {
+		if _, err := os.Stat(o.Bundle); err != nil {
+			errs = append(errs, fmt.Errorf("baseimage bundle %s not exists", o.Bundle))
+		}
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *BaseImageOption) AddFlags(fs *pflag.FlagSet) {
+	fs.StringSliceVar(
+		&(o.Images),
+		"baseimage.images",
+		o.Images,
+		"builder and runtime images to pre-pull, pin one by appending @sha256:<manifest digest or image id>",
+	)
+	fs.StringVar(
+		&(o.Bundle),
+		"baseimage.bundle",
+		o.Bundle,
+		"docker save tar of the base images, loaded if they are missing",
+	)
+	fs.IntVar(&(o.Interval), "baseimage.interval", o.Interval, "seconds between refreshing the base images")
+}
+
+// String to json string.
+func (o *BaseImageOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
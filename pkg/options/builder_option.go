@@ -0,0 +1,74 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	BUILDER_DOCKER     = "docker"
+	BUILDER_DAEMONLESS = "daemonless"
+)
+
+// BuilderOption defines how chaincode images are built.
+type BuilderOption struct {
+	// Backend is docker to build with the docker daemon, or daemonless to assemble the image from the
+	// runtime image and the chaincode package without it
+	Backend string `json:"backend" mapstructure:"backend"`
+	// Mirror replaces docker hub when the daemonless backend fetches the runtime images, like a harbor
+	// proxy cache project xxx.xxx.xxx.xxx:xxxx/dockerhub
+	Mirror string `json:"mirror"  mapstructure:"mirror"`
+}
+
+// NewBuilderOption create a `zero` value instance.
+func NewBuilderOption() *BuilderOption {
+	return &BuilderOption{
+		Backend: BUILDER_DOCKER,
+		Mirror:  "",
+	}
+}
+
+// Validate validate option value.
+func (o *BuilderOption) Validate() []error {
+	errs := []error{}
+
+	if o.Backend != BUILDER_DOCKER && o.Backend != BUILDER_DAEMONLESS {
+		errs = append(errs, fmt.Errorf("builder backend must be docker or daemonless"))
+	}
+
+	if strings.Contains(o.Mirror, "://") {
+		errs = append(errs, fmt.Errorf("builder mirror %s must not have a scheme", o.Mirror))
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *BuilderOption) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&(o.Backend),
+		"builder.backend",
+		o.Backend,
+		"docker to build chaincode images with the docker daemon, or daemonless to assemble them without it",
+	)
+	fs.StringVar(
+		&(o.Mirror),
+		"builder.mirror",
+		o.Mirror,
+		"registry mirror of docker hub the daemonless backend fetches the runtime images from",
+	)
+}
+
+// String to json string.
+func (o *BuilderOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
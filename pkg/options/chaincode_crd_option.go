@@ -0,0 +1,71 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// ChaincodeCRDOption defines whether the chaincode containers are managed as Chaincode resources,
+// the CRD of deployments/peitho-chaincode-crd.yaml must be installed.
+type ChaincodeCRDOption struct {
+	Enable bool `json:"enable"            mapstructure:"enable"`
+	// Interval is the seconds between the reconciles of the controller
+	Interval int `json:"interval"          mapstructure:"interval"`
+	// ReadinessTimeout is the seconds a new version of a server mode chaincode has to become ready once
+	// started, the time waiting for its tls secret does not count, it is rolled back to the image of the
+	// previous version otherwise
+	ReadinessTimeout int `json:"readiness-timeout" mapstructure:"readiness-timeout"`
+}
+
+// NewChaincodeCRDOption create a `zero` value instance.
+func NewChaincodeCRDOption() *ChaincodeCRDOption {
+	return &ChaincodeCRDOption{
+		Enable:           false,
+		Interval:         30,
+		ReadinessTimeout: 300,
+	}
+}
+
+// Validate validate option value.
+func (o *ChaincodeCRDOption) Validate() []error {
+	errs := []error{}
+
+	if o.Enable && o.Interval <= 0 {
+		errs = append(errs, fmt.Errorf("chaincode-crd interval must be positive"))
+	}
+	if o.Enable && o.ReadinessTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("chaincode-crd readiness-timeout must be positive"))
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *ChaincodeCRDOption) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&(o.Enable),
+		"chaincode-crd.enable",
+		o.Enable,
+		"create a Chaincode resource for each chaincode container, the controller reconciles it into the deployment",
+	)
+	fs.IntVar(&(o.Interval), "chaincode-crd.interval", o.Interval, "seconds between the reconciles of the controller")
+	fs.IntVar(
+		&(o.ReadinessTimeout),
+		"chaincode-crd.readiness-timeout",
+		o.ReadinessTimeout,
+		"seconds a new version of a server mode chaincode has to become ready once started before it is rolled back",
+	)
+}
+
+// String to json string.
+func (o *ChaincodeCRDOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
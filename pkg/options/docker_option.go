@@ -7,6 +7,7 @@ package options
 import (
 	"encoding/json"
 	"fmt"
+	"strings"
 
 	"github.com/spf13/pflag"
 )
@@ -15,6 +16,11 @@ import (
 type DockerOption struct {
 	Endpoint string   `json:"endpoint" mapstructure:"endpoint"`
 	Registry Registry `json:"registry" mapstructure:"registry"`
+	// Registries are additional registries tried after Registry in priority order
+	Registries []Registry `json:"registries" mapstructure:"registries"`
+	// Platforms are the os/arch[/variant] chaincode images are built for, the first one is the primary platform
+	// chaincode is compiled for. more than one platform is published as a manifest list in registry mode
+	Platforms []string `json:"platforms" mapstructure:"platforms"`
 }
 
 // Registry defines options for docker registry.
@@ -24,13 +30,30 @@ type Registry struct {
 	Email         string `json:"email"          mapstructure:"email"`
 	Serveraddress string `json:"server-address" mapstructure:"server-address"`
 	Project       string `json:"project"        mapstructure:"project"`
+	// ConfigFile is a docker config.json holding per registry credentials
+	ConfigFile string `json:"config-file" mapstructure:"config-file"`
+	// Secret is a kubernetes.io/dockerconfigjson secret holding per registry credentials,
+	// it is referenced as imagePullSecrets by chaincode deployments
+	Secret string `json:"secret" mapstructure:"secret"`
+	// RefreshInterval is the seconds between reloading credentials
+	RefreshInterval int `json:"refresh-interval" mapstructure:"refresh-interval"`
+	// Priority orders the registries, the lower the earlier
+	Priority int `json:"priority" mapstructure:"priority"`
+	// Mirror registries receive a replica of every pushed image
+	Mirror bool `json:"mirror" mapstructure:"mirror"`
+	// Insecure registries are served over plain http
+	Insecure bool `json:"insecure" mapstructure:"insecure"`
+	// Projects select the project by the MSP ID of the peer, Project is the default
+	Projects map[string]string `json:"projects" mapstructure:"projects"`
 }
 
 // NewDockerOption create a `zero` value instance.
 func NewDockerOption() *DockerOption {
 	return &DockerOption{
 		Endpoint: "",
-		Registry: Registry{},
+		Registry: Registry{
+			RefreshInterval: 60,
+		},
 	}
 }
 
@@ -46,6 +69,31 @@ func (o *DockerOption) Validate() []error {
 		errs = append(errs, fmt.Errorf("registry project cannot be empty"))
 	}
 
+	mirrorsOnly := o.Registry.Serveraddress == "" || o.Registry.Mirror
+	for i, registry := range o.Registries {
+		mirrorsOnly = mirrorsOnly && registry.Mirror
+		if registry.Serveraddress == "" {
+			errs = append(errs, fmt.Errorf("server address of registries[%d] cannot be empty", i))
+		}
+		if registry.Project == "" {
+			errs = append(errs, fmt.Errorf("project of registries[%d] cannot be empty", i))
+		}
+	}
+
+	for _, platform := range o.Platforms {
+		if parts := strings.Split(platform, "/"); len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+			errs = append(errs, fmt.Errorf("platform %s is not os/arch[/variant]", platform))
+		}
+	}
+
+	if mirrorsOnly && len(o.Registries) > 0 {
+		errs = append(errs, fmt.Errorf("registries must not all be mirrors, a push must be accepted by one of the others"))
+	}
+
+	if o.Registry.RefreshInterval <= 0 {
+		errs = append(errs, fmt.Errorf("registry refresh interval must be positive"))
+	}
+
 	return errs
 }
 
@@ -72,6 +120,43 @@ func (o *DockerOption) AddFlags(fs *pflag.FlagSet) {
 		o.Registry.Password,
 		"docker registry auth password",
 	)
+	fs.StringVar(
+		&(o.Registry.ConfigFile),
+		"docker.registry.config-file",
+		o.Registry.ConfigFile,
+		"docker config.json holding per registry credentials, it takes precedence over username and password",
+	)
+	fs.StringVar(
+		&(o.Registry.Secret),
+		"docker.registry.secret",
+		o.Registry.Secret,
+		"kubernetes.io/dockerconfigjson secret holding per registry credentials, "+
+			"chaincode deployments reference it as imagePullSecrets",
+	)
+	fs.BoolVar(
+		&(o.Registry.Insecure),
+		"docker.registry.insecure",
+		o.Registry.Insecure,
+		"docker registry is served over plain http",
+	)
+	fs.StringToStringVar(
+		&(o.Registry.Projects),
+		"docker.registry.projects",
+		o.Registry.Projects,
+		"docker registry project of each MSP ID, like Org1MSP=org1",
+	)
+	fs.StringSliceVar(
+		&(o.Platforms),
+		"docker.platforms",
+		o.Platforms,
+		"os/arch[/variant] chaincode images are built for, like linux/amd64,linux/arm64, the first one is the primary platform",
+	)
+	fs.IntVar(
+		&(o.Registry.RefreshInterval),
+		"docker.registry.refresh-interval",
+		o.Registry.RefreshInterval,
+		"seconds between reloading registry credentials",
+	)
 }
 
 // String to json string.
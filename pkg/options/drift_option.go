@@ -0,0 +1,61 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// DriftOption defines whether the chaincode deployments and their tls configmaps edited or deleted by hand
+// are detected, and restored to what peitho last applied.
+type DriftOption struct {
+	Enable bool `json:"enable"      mapstructure:"enable"`
+	// ReportOnly log and record the drift without repairing it
+	ReportOnly bool `json:"report-only" mapstructure:"report-only"`
+	// Resync is the seconds between the full checks of the watched objects
+	Resync int `json:"resync"      mapstructure:"resync"`
+}
+
+// NewDriftOption create a `zero` value instance.
+func NewDriftOption() *DriftOption {
+	return &DriftOption{
+		Enable:     false,
+		ReportOnly: false,
+		Resync:     300,
+	}
+}
+
+// Validate validate option value.
+func (o *DriftOption) Validate() []error {
+	errs := []error{}
+
+	if o.Enable && o.Resync < 0 {
+		errs = append(errs, fmt.Errorf("drift resync must not be negative"))
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *DriftOption) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&(o.Enable),
+		"drift.enable",
+		o.Enable,
+		"watch the chaincode deployments and tls configmaps, restore the ones edited or deleted by hand",
+	)
+	fs.BoolVar(&(o.ReportOnly), "drift.report-only", o.ReportOnly, "only log and record the drift, do not repair it")
+	fs.IntVar(&(o.Resync), "drift.resync", o.Resync, "seconds between the full checks of the watched objects, 0 disables it")
+}
+
+// String to json string.
+func (o *DriftOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
@@ -0,0 +1,87 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+// LeaderElectionOption defines the lease electing the replica which runs the singleton workers, like the sweeper.
+type LeaderElectionOption struct {
+	Enable bool `json:"enable"         mapstructure:"enable"`
+	// Lease is the name of the coordination.k8s.io Lease in the namespace
+	Lease string `json:"lease"          mapstructure:"lease"`
+	// Identity is the holder of the lease, it defaults to the hostname, which is the pod name
+	Identity      string `json:"identity"       mapstructure:"identity"`
+	LeaseDuration int    `json:"lease-duration" mapstructure:"lease-duration"`
+	RenewDeadline int    `json:"renew-deadline" mapstructure:"renew-deadline"`
+	RetryPeriod   int    `json:"retry-period"   mapstructure:"retry-period"`
+}
+
+// NewLeaderElectionOption create a `zero` value instance.
+func NewLeaderElectionOption() *LeaderElectionOption {
+	return &LeaderElectionOption{
+		Enable:        false,
+		Lease:         "peitho",
+		Identity:      "",
+		LeaseDuration: 15,
+		RenewDeadline: 10,
+		RetryPeriod:   2,
+	}
+}
+
+// Validate validate option value.
+func (o *LeaderElectionOption) Validate() []error {
+	errs := []error{}
+
+	if !o.Enable {
+		return errs
+	}
+
+	if o.Lease == "" {
+		errs = append(errs, fmt.Errorf("leader-election lease must not be empty"))
+	}
+
+	if o.RetryPeriod <= 0 || o.RenewDeadline <= o.RetryPeriod || o.LeaseDuration <= o.RenewDeadline {
+		errs = append(errs, fmt.Errorf("leader-election needs lease-duration > renew-deadline > retry-period > 0"))
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *LeaderElectionOption) AddFlags(fs *pflag.FlagSet) {
+	fs.BoolVar(
+		&(o.Enable),
+		"leader-election.enable",
+		o.Enable,
+		"run the singleton workers, like the sweeper, only on the replica holding the lease",
+	)
+	fs.StringVar(&(o.Lease), "leader-election.lease", o.Lease, "name of the lease in the namespace")
+	fs.StringVar(&(o.Identity), "leader-election.identity", o.Identity, "holder identity of the lease, the hostname if empty")
+	fs.IntVar(
+		&(o.LeaseDuration),
+		"leader-election.lease-duration",
+		o.LeaseDuration,
+		"seconds the other replicas wait before taking over a lease not renewed",
+	)
+	fs.IntVar(
+		&(o.RenewDeadline),
+		"leader-election.renew-deadline",
+		o.RenewDeadline,
+		"seconds the leader retries renewing before giving up the lease",
+	)
+	fs.IntVar(&(o.RetryPeriod), "leader-election.retry-period", o.RetryPeriod, "seconds between the lease actions")
+}
+
+// String to json string.
+func (o *LeaderElectionOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
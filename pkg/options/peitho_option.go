@@ -9,18 +9,41 @@ import (
 	"fmt"
 
 	"github.com/spf13/pflag"
+
+	"github.com/tianrandailove/peitho/pkg/compress"
 )
 
 const (
 	IMAGE_MODE_REGISTRY = "registry"
 	IMAGE_MODE_DELIVERY = "delivery"
+	IMAGE_MODE_EMBEDDED = "embedded"
 )
 
+const (
+	RUNTIME_DOCKER     = "docker"
+	RUNTIME_CONTAINERD = "containerd"
+	// RUNTIME_CONTAINERS_STORAGE is the containers-storage of CRI-O and podman nodes, written with skopeo.
+	RUNTIME_CONTAINERS_STORAGE = "containers-storage"
+)
+
+// IsSupportedRuntime check the container runtime is supported by puller.
+func IsSupportedRuntime(runtime string) bool {
+	return runtime == RUNTIME_DOCKER || runtime == RUNTIME_CONTAINERD || runtime == RUNTIME_CONTAINERS_STORAGE
+}
+
 // PeithoOption defines options for peitho.
 type PeithoOption struct {
 	ImageMode           string `json:"imageMode"           mapstructure:"imageMode"`
 	PullerAccessAddress string `json:"pullerAccessAddress" mapstructure:"pullerAccessAddress"`
 	PullerImage         string `json:"pullerImage"         mapstructure:"pullerImage"`
+	ArtifactDir         string `json:"artifactDir"         mapstructure:"artifactDir"`
+	RegistryAddress     string `json:"registryAddress"     mapstructure:"registryAddress"`
+	Runtime             string `json:"runtime"             mapstructure:"runtime"`
+	Compression         string `json:"compression"         mapstructure:"compression"`
+	CompressionLevel    int    `json:"compressionLevel"    mapstructure:"compressionLevel"`
+	DownloadSecret      string `json:"downloadSecret"      mapstructure:"downloadSecret"`
+	DownloadTokenTTL    int    `json:"downloadTokenTTL"    mapstructure:"downloadTokenTTL"`
+	ShutdownTimeout     int    `json:"shutdownTimeout"     mapstructure:"shutdownTimeout"`
 }
 
 // NewPeithoOption create a `zero` value instance.
@@ -28,6 +51,14 @@ func NewPeithoOption() *PeithoOption {
 	return &PeithoOption{
 		ImageMode:           IMAGE_MODE_REGISTRY,
 		PullerAccessAddress: "",
+		ArtifactDir:         "artifacts",
+		RegistryAddress:     "",
+		Runtime:             RUNTIME_DOCKER,
+		Compression:         compress.NONE,
+		CompressionLevel:    0,
+		DownloadSecret:      "",
+		DownloadTokenTTL:    3600,
+		ShutdownTimeout:     60,
 	}
 }
 
@@ -35,8 +66,16 @@ func NewPeithoOption() *PeithoOption {
 func (o *PeithoOption) Validate() []error {
 	errs := []error{}
 
-	if IMAGE_MODE_DELIVERY != o.ImageMode && IMAGE_MODE_REGISTRY != o.ImageMode {
-		errs = append(errs, fmt.Errorf("imageMode must be registry or deivery"))
+	if IMAGE_MODE_DELIVERY != o.ImageMode && IMAGE_MODE_REGISTRY != o.ImageMode && IMAGE_MODE_EMBEDDED != o.ImageMode {
+		errs = append(errs, fmt.Errorf("imageMode must be registry, delivery or embedded"))
+	}
+
+	if o.ArtifactDir == "" {
+		errs = append(errs, fmt.Errorf("artifactDir must not be empty"))
+	}
+
+	if o.ImageMode == IMAGE_MODE_EMBEDDED && o.RegistryAddress == "" {
+		errs = append(errs, fmt.Errorf("registryAddress must not be empty"))
 	}
 
 	if o.ImageMode == IMAGE_MODE_DELIVERY && o.PullerAccessAddress == "" {
@@ -47,6 +86,26 @@ func (o *PeithoOption) Validate() []error {
 		errs = append(errs, fmt.Errorf("pullerImage must not be empty"))
 	}
 
+	if o.ImageMode == IMAGE_MODE_DELIVERY && o.DownloadSecret == "" {
+		errs = append(errs, fmt.Errorf("downloadSecret must not be empty, it is shared by the replicas and restarts"))
+	}
+
+	if o.ImageMode == IMAGE_MODE_DELIVERY && !IsSupportedRuntime(o.Runtime) {
+		errs = append(errs, fmt.Errorf("runtime must be docker, containerd or containers-storage"))
+	}
+
+	if o.DownloadTokenTTL <= 0 {
+		errs = append(errs, fmt.Errorf("downloadTokenTTL must be greater than zero"))
+	}
+
+	if o.ShutdownTimeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdownTimeout must be greater than zero"))
+	}
+
+	if !compress.Supported(o.Compression) {
+		errs = append(errs, fmt.Errorf("compression must be none, gzip or zstd"))
+	}
+
 	return errs
 }
 
@@ -56,7 +115,21 @@ func (o *PeithoOption) AddFlags(fs *pflag.FlagSet) {
 		&(o.ImageMode),
 		"imageMode",
 		o.ImageMode,
-		"how to delivery chaincode image, if choose registry mode, then pull image from registry, else from peitho",
+		"how to delivery chaincode image: registry, delivery or embedded, "+
+			"registry mode pulls image from registry, delivery mode from peitho by puller, "+
+			"embedded mode from the registry api served by peitho",
+	)
+	fs.StringVar(
+		&(o.ArtifactDir),
+		"artifactDir",
+		o.ArtifactDir,
+		"directory to store the built image artifacts for delivery and embedded mode",
+	)
+	fs.StringVar(
+		&(o.RegistryAddress),
+		"registryAddress",
+		o.RegistryAddress,
+		"host:port of peitho that nodes pull chaincode image from in embedded mode",
 	)
 	fs.StringVar(
 		&(o.PullerAccessAddress),
@@ -65,6 +138,42 @@ func (o *PeithoOption) AddFlags(fs *pflag.FlagSet) {
 		"puller access the url for pulling image",
 	)
 	fs.StringVar(&(o.PullerImage), "pullerImage", o.PullerImage, "the pullerImage for chancode initcontainer")
+	fs.StringVar(
+		&(o.Runtime),
+		"runtime",
+		o.Runtime,
+		"container runtime of the nodes, puller loads delivered image into it, docker, containerd or containers-storage",
+	)
+	fs.StringVar(
+		&(o.Compression),
+		"compression",
+		o.Compression,
+		"preferred encoding for delivering image tar to puller, support none, gzip and zstd",
+	)
+	fs.IntVar(
+		&(o.CompressionLevel),
+		"compressionLevel",
+		o.CompressionLevel,
+		"compression level of the chosen encoding, 0 means the encoding's default level",
+	)
+	fs.StringVar(
+		&(o.DownloadSecret),
+		"downloadSecret",
+		o.DownloadSecret,
+		"secret for signing image tar download token, required in delivery mode and shared by every replica",
+	)
+	fs.IntVar(
+		&(o.DownloadTokenTTL),
+		"downloadTokenTTL",
+		o.DownloadTokenTTL,
+		"lifetime in seconds of the image tar download token the puller exchanges its service account token for",
+	)
+	fs.IntVar(
+		&(o.ShutdownTimeout),
+		"shutdownTimeout",
+		o.ShutdownTimeout,
+		"seconds to drain in-flight build and upload requests on shutdown",
+	)
 }
 
 // String to json string.
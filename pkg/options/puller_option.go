@@ -13,26 +13,59 @@ import (
 
 // PullerOption defines options for docker cluster.
 type PullerOption struct {
-	DockerEndpoint string `json:"dockerEndpoint" mapstructure:"dockerEndpoint"`
-	Image          string `json:"image"          mapstructure:"image"`
-	PullAddress    string `json:"pullAddress"    mapstructure:"pullAddress"`
+	DockerEndpoint  string `json:"dockerEndpoint"  mapstructure:"dockerEndpoint"`
+	Runtime         string `json:"runtime"         mapstructure:"runtime"`
+	RuntimeEndpoint string `json:"runtimeEndpoint" mapstructure:"runtimeEndpoint"`
+	Namespace       string `json:"namespace"       mapstructure:"namespace"`
+	LoadCommand     string `json:"loadCommand"     mapstructure:"loadCommand"`
+	ExistsCommand   string `json:"existsCommand"   mapstructure:"existsCommand"`
+	Image           string `json:"image"           mapstructure:"image"`
+	PullAddress     string `json:"pullAddress"     mapstructure:"pullAddress"`
+	Credential      string `json:"credential"      mapstructure:"credential"`
 }
 
 // NewPullerOption create a `zero` value instance.
 func NewPullerOption() *PullerOption {
 	return &PullerOption{
-		DockerEndpoint: "",
-		Image:          "",
-		PullAddress:    "",
+		DockerEndpoint:  "",
+		Runtime:         RUNTIME_DOCKER,
+		RuntimeEndpoint: "",
+		Namespace:       "k8s.io",
+		LoadCommand:     "skopeo copy docker-archive:{archive} containers-storage:{image}",
+		ExistsCommand:   "skopeo inspect --raw containers-storage:{image}",
+		Image:           "",
+		PullAddress:     "",
+		Credential:      "/var/run/secrets/peitho/token",
 	}
 }
 
+// Endpoint return the runtime endpoint, fallback to docker endpoint.
+func (o *PullerOption) Endpoint() string {
+	if o.RuntimeEndpoint != "" {
+		return o.RuntimeEndpoint
+	}
+
+	return o.DockerEndpoint
+}
+
 // Validate validate option value.
 func (o *PullerOption) Validate() []error {
 	errs := []error{}
 
-	if o.DockerEndpoint == "" {
-		errs = append(errs, fmt.Errorf("docker endpoint can not be empty"))
+	if !IsSupportedRuntime(o.Runtime) {
+		errs = append(errs, fmt.Errorf("runtime must be docker, containerd or containers-storage"))
+	}
+
+	if o.Runtime != RUNTIME_CONTAINERS_STORAGE && o.Endpoint() == "" {
+		errs = append(errs, fmt.Errorf("runtime endpoint can not be empty"))
+	}
+
+	if o.Runtime == RUNTIME_CONTAINERD && o.Namespace == "" {
+		errs = append(errs, fmt.Errorf("containerd namespace can not be empty"))
+	}
+
+	if o.Runtime == RUNTIME_CONTAINERS_STORAGE && (o.LoadCommand == "" || o.ExistsCommand == "") {
+		errs = append(errs, fmt.Errorf("load and exists command can not be empty"))
 	}
 
 	if o.Image == "" {
@@ -43,14 +76,49 @@ func (o *PullerOption) Validate() []error {
 		errs = append(errs, fmt.Errorf("pullAddress cannot be empty"))
 	}
 
+	if o.Credential == "" {
+		errs = append(errs, fmt.Errorf("credential cannot be empty"))
+	}
+
 	return errs
 }
 
 // AddFlags bind command flag.
 func (o *PullerOption) AddFlags(fs *pflag.FlagSet) {
 	fs.StringVar(&(o.DockerEndpoint), "docker.endpoint", o.DockerEndpoint, "The endpoint for accessing docker server.")
+	fs.StringVar(
+		&(o.Runtime),
+		"runtime",
+		o.Runtime,
+		"the container runtime to load image into, docker, containerd or containers-storage",
+	)
+	fs.StringVar(
+		&(o.RuntimeEndpoint),
+		"runtime.endpoint",
+		o.RuntimeEndpoint,
+		"The endpoint for accessing container runtime, fallback to docker.endpoint.",
+	)
+	fs.StringVar(&(o.Namespace), "containerd.namespace", o.Namespace, "the containerd namespace used by kubelet")
+	fs.StringVar(
+		&(o.LoadCommand),
+		"storage.load-command",
+		o.LoadCommand,
+		"the command to load image archive into containers-storage, {archive} and {image} will be replaced",
+	)
+	fs.StringVar(
+		&(o.ExistsCommand),
+		"storage.exists-command",
+		o.ExistsCommand,
+		"the command succeeds if image exists in containers-storage, {image} will be replaced",
+	)
 	fs.StringVar(&(o.Image), "image", o.Image, "the image name")
 	fs.StringVar(&(o.PullAddress), "pullAddress", o.PullAddress, "the url to download the image")
+	fs.StringVar(
+		&(o.Credential),
+		"credential",
+		o.Credential,
+		"the service account token file of the pod, exchanged for a short-lived image download token",
+	)
 }
 
 // String to json string.
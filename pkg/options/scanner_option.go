@@ -0,0 +1,69 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/spf13/pflag"
+)
+
+const (
+	SCAN_POLICY_ENFORCE = "enforce"
+	SCAN_POLICY_WARN    = "warn"
+)
+
+// ScannerOption defines the local scanner run on the SBOM of chaincode images before deployment.
+type ScannerOption struct {
+	// Command scans the SBOM, {sbom} and {image} are replaced, a non-zero exit reports findings
+	Command string `json:"command" mapstructure:"command"`
+	// Policy is enforce to refuse the deployment on findings, or warn to log them
+	Policy  string `json:"policy"  mapstructure:"policy"`
+	Timeout int    `json:"timeout" mapstructure:"timeout"`
+}
+
+// NewScannerOption create a `zero` value instance.
+func NewScannerOption() *ScannerOption {
+	return &ScannerOption{
+		Command: "",
+		Policy:  SCAN_POLICY_ENFORCE,
+		Timeout: 300,
+	}
+}
+
+// Validate validate option value.
+func (o *ScannerOption) Validate() []error {
+	errs := []error{}
+
+	if o.Policy != SCAN_POLICY_ENFORCE && o.Policy != SCAN_POLICY_WARN {
+		errs = append(errs, fmt.Errorf("scanner policy must be enforce or warn"))
+	}
+
+	if o.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("scanner timeout must be greater than zero"))
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *ScannerOption) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(
+		&(o.Command),
+		"scanner.command",
+		o.Command,
+		"the command to scan the SBOM of chaincode images before deployment, {sbom} and {image} will be replaced",
+	)
+	fs.StringVar(&(o.Policy), "scanner.policy", o.Policy, "enforce to refuse images with findings, or warn to log them")
+	fs.IntVar(&(o.Timeout), "scanner.timeout", o.Timeout, "seconds to wait for the scanner")
+}
+
+// String to json string.
+func (o *ScannerOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
@@ -0,0 +1,68 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package options
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/spf13/pflag"
+)
+
+// SigningOption defines options for signing and verifying chaincode images.
+type SigningOption struct {
+	// Key is a cosign or PEM encoded ECDSA private key file, images are signed after build if set
+	Key string `json:"key"        mapstructure:"key"`
+	// Password decrypts a cosign encrypted key, COSIGN_PASSWORD is used if empty
+	Password string `json:"-"          mapstructure:"password"`
+	// PublicKey verifies images before deployment, it defaults to the public part of Key
+	PublicKey string `json:"public-key" mapstructure:"public-key"`
+}
+
+// NewSigningOption create a `zero` value instance.
+func NewSigningOption() *SigningOption {
+	return &SigningOption{}
+}
+
+// Validate validate option value.
+func (o *SigningOption) Validate() []error {
+	errs := []error{}
+
+	for _, file := range []string{o.Key, o.PublicKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, fmt.Errorf("signing key %s not exists", file))
+		}
+	}
+
+	return errs
+}
+
+// AddFlags bind command flag.
+func (o *SigningOption) AddFlags(fs *pflag.FlagSet) {
+	fs.StringVar(&(o.Key), "signing.key", o.Key, "cosign or PEM encoded ECDSA private key to sign chaincode images")
+	fs.StringVar(
+		&(o.Password),
+		"signing.password",
+		o.Password,
+		"password of the cosign encrypted private key, COSIGN_PASSWORD is used if empty",
+	)
+	fs.StringVar(
+		&(o.PublicKey),
+		"signing.public-key",
+		o.PublicKey,
+		"PEM encoded public key to verify chaincode images before deployment",
+	)
+}
+
+// String to json string.
+func (o *SigningOption) String() string {
+	data, _ := json.Marshal(o)
+
+	return string(data)
+}
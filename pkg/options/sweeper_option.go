@@ -6,10 +6,47 @@ import (
 	"github.com/spf13/pflag"
 )
 
+const (
+	SWEEP_ACTION_DELETE   = "delete"
+	SWEEP_ACTION_SCALE    = "scale"
+	SWEEP_ACTION_ANNOTATE = "annotate"
+)
+
+// SweeperRule define when a chaincode deployment is swept and what is done to it
+type SweeperRule struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// Action is delete, scale (to zero replicas) or annotate (only mark the deployment)
+	Action string `json:"action" mapstructure:"action"`
+	// After is the seconds the condition has to last
+	After int `json:"after" mapstructure:"after"`
+	// Restarts is the restart count of a crash looping container
+	Restarts int `json:"restarts" mapstructure:"restarts"`
+}
+
+// OrphanOption define the reconciliation of chaincode resources left behind
+type OrphanOption struct {
+	Enable bool `json:"enable" mapstructure:"enable"`
+	// Grace is the seconds a deployment may stay at zero replicas or without peer
+	Grace int `json:"grace" mapstructure:"grace"`
+}
+
 // SweeperOption define opotion for chaincode sweeper
 type SweeperOption struct {
 	Enable   bool `json:"enable" mapstructure:"enable"`
 	Interval int  `json:"interval" mapstructure:"interval"`
+	// DryRun logs the decisions without acting on them
+	DryRun bool `json:"dry-run" mapstructure:"dry-run"`
+	// Unavailable sweeps deployments unavailable for longer than After
+	Unavailable SweeperRule `json:"unavailable" mapstructure:"unavailable"`
+	// CrashLoop sweeps deployments with a container in CrashLoopBackOff restarted Restarts times
+	CrashLoop SweeperRule `json:"crash-loop" mapstructure:"crash-loop"`
+	// ImagePull sweeps deployments with a pod unable to pull its image for longer than After
+	ImagePull SweeperRule `json:"image-pull" mapstructure:"image-pull"`
+	// PeerGone sweeps deployments whose peer is unreachable for longer than After
+	PeerGone SweeperRule `json:"peer-gone" mapstructure:"peer-gone"`
+	// Orphan deletes configmaps and tls secrets without deployment, and deployments stuck at zero replicas
+	// or whose peer is unreachable
+	Orphan OrphanOption `json:"orphan" mapstructure:"orphan"`
 }
 
 // NewSweeperOption create a zero value instance
@@ -17,6 +54,31 @@ func NewSweeperOption() *SweeperOption {
 	return &SweeperOption{
 		Enable:   true,
 		Interval: 60,
+		DryRun:   false,
+		Unavailable: SweeperRule{
+			Enable: true,
+			Action: SWEEP_ACTION_DELETE,
+			After:  600,
+		},
+		CrashLoop: SweeperRule{
+			Enable:   true,
+			Action:   SWEEP_ACTION_DELETE,
+			Restarts: 5,
+		},
+		ImagePull: SweeperRule{
+			Enable: true,
+			Action: SWEEP_ACTION_DELETE,
+			After:  600,
+		},
+		PeerGone: SweeperRule{
+			Enable: false,
+			Action: SWEEP_ACTION_SCALE,
+			After:  1800,
+		},
+		Orphan: OrphanOption{
+			Enable: false,
+			Grace:  1800,
+		},
 	}
 }
 
@@ -28,6 +90,29 @@ func (o *SweeperOption) Validate() []error {
 		errs = append(errs, fmt.Errorf("Interval cannot be zero"))
 	}
 
+	rules := map[string]SweeperRule{
+		"unavailable": o.Unavailable,
+		"crash-loop":  o.CrashLoop,
+		"image-pull":  o.ImagePull,
+		"peer-gone":   o.PeerGone,
+	}
+	for name, rule := range rules {
+		if rule.Action != SWEEP_ACTION_DELETE && rule.Action != SWEEP_ACTION_SCALE && rule.Action != SWEEP_ACTION_ANNOTATE {
+			errs = append(errs, fmt.Errorf("sweeper %s action must be delete, scale or annotate", name))
+		}
+		if rule.After < 0 {
+			errs = append(errs, fmt.Errorf("sweeper %s after cannot be negative", name))
+		}
+	}
+
+	if o.Orphan.Grace <= 0 {
+		errs = append(errs, fmt.Errorf("sweeper orphan grace must be greater than zero"))
+	}
+
+	if o.CrashLoop.Restarts <= 0 {
+		errs = append(errs, fmt.Errorf("sweeper crash-loop restarts must be greater than zero"))
+	}
+
 	return errs
 }
 
@@ -40,6 +125,34 @@ func (o *SweeperOption) AddFlags(fs *pflag.FlagSet) {
 		"enable to sweep that restarting chaincode deployment",
 	)
 	fs.IntVar(&(o.Interval), "sweeper.interval", o.Interval, "interval for sweeping")
+	fs.BoolVar(&(o.DryRun), "sweeper.dry-run", o.DryRun, "log the sweeping decisions without acting on them")
+
+	o.Unavailable.addFlags(fs, "unavailable", "deployments unavailable for longer than after seconds")
+	o.CrashLoop.addFlags(fs, "crash-loop", "deployments with a container in CrashLoopBackOff restarted restarts times")
+	o.ImagePull.addFlags(fs, "image-pull", "deployments unable to pull the image for longer than after seconds")
+	o.PeerGone.addFlags(fs, "peer-gone", "deployments whose peer is unreachable for longer than after seconds")
+
+	fs.BoolVar(
+		&(o.Orphan.Enable),
+		"sweeper.orphan.enable",
+		o.Orphan.Enable,
+		"enable to delete configmaps and tls secrets without deployment, and deployments stuck at zero replicas or without peer",
+	)
+	fs.IntVar(
+		&(o.Orphan.Grace),
+		"sweeper.orphan.grace",
+		o.Orphan.Grace,
+		"seconds a deployment may stay at zero replicas or without peer",
+	)
+}
+
+func (r *SweeperRule) addFlags(fs *pflag.FlagSet, name string, usage string) {
+	fs.BoolVar(&(r.Enable), "sweeper."+name+".enable", r.Enable, "enable to sweep "+usage)
+	fs.StringVar(&(r.Action), "sweeper."+name+".action", r.Action, "delete, scale or annotate "+usage)
+	fs.IntVar(&(r.After), "sweeper."+name+".after", r.After, "seconds before sweeping "+usage)
+	if name == "crash-loop" {
+		fs.IntVar(&(r.Restarts), "sweeper."+name+".restarts", r.Restarts, "restart count before sweeping "+usage)
+	}
 }
 
 // String to json string.
@@ -0,0 +1,78 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// the go linker wraps the module info of the binary between these sentinels.
+var (
+	modInfoStart = []byte("\x30\x77\xaf\x0c\x92\x74\x08\x02\x41\xe1\xc1\x07\xe6\xd6\x18\xe6")
+	modInfoEnd   = []byte("\xf9\x32\x43\x31\x86\x18\x20\x72\x00\x82\x42\x10\x41\x16\xd8\xf2")
+)
+
+// findModInfo return the module info embedded in the go binary.
+func findModInfo(data []byte) string {
+	start := bytes.Index(data, modInfoStart)
+	if start < 0 {
+		return ""
+	}
+	start += len(modInfoStart)
+
+	end := bytes.Index(data[start:], modInfoEnd)
+	if end < 0 {
+		return ""
+	}
+
+	return string(data[start : start+end])
+}
+
+// goModules list the main module and the dependencies of the module info, replacements are honored.
+func goModules(modinfo string, location string) []Component {
+	var components []Component
+
+	for _, line := range strings.Split(modinfo, "\n") {
+		fields := strings.Split(line, "\t")
+		if len(fields) < 3 {
+			continue
+		}
+
+		switch fields[0] {
+		case "mod":
+			components = append(components, goModule("application", fields[1], fields[2], location))
+		case "dep":
+			components = append(components, goModule("library", fields[1], fields[2], location))
+		case "=>":
+			// replace the module of the previous line
+			if len(components) > 0 {
+				components[len(components)-1] = goModule(
+					components[len(components)-1].Type,
+					fields[1],
+					fields[2],
+					location,
+				)
+			}
+		}
+	}
+
+	return components
+}
+
+func goModule(componentType string, path string, version string, location string) Component {
+	component := Component{
+		Type:       componentType,
+		Name:       path,
+		Version:    version,
+		Properties: []Property{{Name: "peitho:location", Value: location}},
+	}
+	if version != "" && version != "(devel)" {
+		component.PURL = fmt.Sprintf("pkg:golang/%s@%s", path, version)
+	}
+
+	return component
+}
@@ -0,0 +1,104 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	apkDatabase  = "lib/apk/db/installed"
+	dpkgDatabase = "var/lib/dpkg/status"
+	osRelease    = "etc/os-release"
+)
+
+// osID return the ID of the distribution from os-release.
+func osID(data []byte) string {
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.HasPrefix(line, "ID=") {
+			return strings.Trim(strings.TrimPrefix(line, "ID="), `"'`)
+		}
+	}
+
+	return ""
+}
+
+// stanzas split the package database into records of fields, records are separated by a blank line.
+func stanzas(data []byte, separator string) []map[string]string {
+	var records []map[string]string
+
+	record := make(map[string]string)
+	for _, line := range strings.Split(string(data)+"\n", "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(record) > 0 {
+				records = append(records, record)
+				record = make(map[string]string)
+			}
+
+			continue
+		}
+		// continuation lines of multi-line fields
+		if strings.HasPrefix(line, " ") {
+			continue
+		}
+		kv := strings.SplitN(line, separator, 2)
+		if len(kv) == 2 {
+			record[kv[0]] = strings.TrimSpace(kv[1])
+		}
+	}
+
+	return records
+}
+
+// apkPackages list the packages of the alpine apk database.
+func apkPackages(data []byte, distro string) []Component {
+	if distro == "" {
+		distro = "alpine"
+	}
+
+	var components []Component
+	for _, record := range stanzas(data, ":") {
+		if record["P"] == "" {
+			continue
+		}
+		components = append(components, Component{
+			Type:    "library",
+			Name:    record["P"],
+			Version: record["V"],
+			PURL:    fmt.Sprintf("pkg:apk/%s/%s@%s?arch=%s", distro, record["P"], record["V"], record["A"]),
+		})
+	}
+
+	return components
+}
+
+// dpkgPackages list the installed packages of the dpkg status database.
+func dpkgPackages(data []byte, distro string) []Component {
+	if distro == "" {
+		distro = "debian"
+	}
+
+	var components []Component
+	for _, record := range stanzas(data, ": ") {
+		if record["Package"] == "" || !strings.HasSuffix(record["Status"], " installed") {
+			continue
+		}
+		components = append(components, Component{
+			Type:    "library",
+			Name:    record["Package"],
+			Version: record["Version"],
+			PURL: fmt.Sprintf(
+				"pkg:deb/%s/%s@%s?arch=%s",
+				distro,
+				record["Package"],
+				record["Version"],
+				record["Architecture"],
+			),
+		})
+	}
+
+	return components
+}
@@ -0,0 +1,233 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	// MediaType is the media type of the SBOM document.
+	MediaType = "application/vnd.cyclonedx+json"
+
+	elfMagic = "\x7fELF"
+	// whiteoutPrefix marks a file deleted by an upper layer
+	whiteoutPrefix = ".wh."
+	// whiteoutOpaque marks a directory whose lower content is hidden
+	whiteoutOpaque = ".wh..wh..opq"
+)
+
+// BOM is a CycloneDX document.
+type BOM struct {
+	BOMFormat   string      `json:"bomFormat"`
+	SpecVersion string      `json:"specVersion"`
+	Version     int         `json:"version"`
+	Metadata    Metadata    `json:"metadata"`
+	Components  []Component `json:"components"`
+}
+
+// Metadata describe the image the BOM is generated for.
+type Metadata struct {
+	Timestamp string     `json:"timestamp"`
+	Tools     []Tool     `json:"tools"`
+	Component *Component `json:"component,omitempty"`
+}
+
+type Tool struct {
+	Name string `json:"name"`
+}
+
+// Component is a package found in the image.
+type Component struct {
+	Type       string     `json:"type"`
+	Name       string     `json:"name"`
+	Version    string     `json:"version,omitempty"`
+	PURL       string     `json:"purl,omitempty"`
+	Properties []Property `json:"properties,omitempty"`
+}
+
+type Property struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// layer is what a layer contributes to the image file system.
+type layer struct {
+	files     map[string][]byte
+	whiteouts []string
+}
+
+// interesting report whether the content of the file is needed to find packages.
+func interesting(name string) bool {
+	switch name {
+	case apkDatabase, dpkgDatabase, osRelease:
+		return true
+	}
+
+	return false
+}
+
+// Generate inspect the layers of the image in docker save format and list its go modules and OS packages.
+func Generate(image string, content io.Reader) (*BOM, error) {
+	layers := make(map[string]*layer)
+	var order []string
+
+	tr := tar.NewReader(content)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if header.Name == "manifest.json" {
+			manifests := []struct {
+				Layers []string `json:"Layers"`
+			}{}
+			if err := json.NewDecoder(tr).Decode(&manifests); err != nil {
+				return nil, err
+			}
+			if len(manifests) > 0 {
+				order = manifests[0].Layers
+			}
+
+			continue
+		}
+
+		// configs and OCI manifests are not tars, they are skipped by readLayer
+		if l, ok := readLayer(tr); ok {
+			layers[header.Name] = l
+		}
+	}
+
+	// apply the layers in order, upper layers override and delete the lower files
+	files := make(map[string][]byte)
+	for _, name := range order {
+		l, ok := layers[name]
+		if !ok {
+			continue
+		}
+		for _, whiteout := range l.whiteouts {
+			for file := range files {
+				if file == whiteout || strings.HasPrefix(file, whiteout+"/") {
+					delete(files, file)
+				}
+			}
+		}
+		for file, data := range l.files {
+			files[file] = data
+		}
+	}
+
+	return build(image, files), nil
+}
+
+// readLayer collect the package databases and go binaries of the layer tar.
+func readLayer(content io.Reader) (*layer, bool) {
+	l := &layer{files: make(map[string][]byte)}
+
+	tr := tar.NewReader(content)
+	for i := 0; ; i++ {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return l, true
+		}
+		if err != nil {
+			// not a layer, or a broken one
+			return l, i > 0
+		}
+
+		name := path.Clean(strings.TrimPrefix(header.Name, "./"))
+		dir, base := path.Split(name)
+		if base == whiteoutOpaque {
+			l.whiteouts = append(l.whiteouts, path.Clean(dir))
+
+			continue
+		}
+		if strings.HasPrefix(base, whiteoutPrefix) {
+			l.whiteouts = append(l.whiteouts, path.Join(dir, strings.TrimPrefix(base, whiteoutPrefix)))
+
+			continue
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		if interesting(name) {
+			data, err := ioutil.ReadAll(tr)
+			if err != nil {
+				return l, false
+			}
+			l.files[name] = data
+
+			continue
+		}
+
+		// go binaries are ELF executables carrying the module info
+		if header.Mode&0o111 == 0 || header.Size < int64(len(elfMagic)) {
+			continue
+		}
+		magic := make([]byte, len(elfMagic))
+		if _, err := io.ReadFull(tr, magic); err != nil || string(magic) != elfMagic {
+			continue
+		}
+		data, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return l, false
+		}
+		if modinfo := findModInfo(data); modinfo != "" {
+			l.files[name] = []byte(modinfo)
+		}
+	}
+}
+
+// build list the components of the image file system.
+func build(image string, files map[string][]byte) *BOM {
+	bom := &BOM{
+		BOMFormat:   "CycloneDX",
+		SpecVersion: "1.4",
+		Version:     1,
+		Metadata: Metadata{
+			Timestamp: time.Now().UTC().Format(time.RFC3339),
+			Tools:     []Tool{{Name: "peitho"}},
+			Component: &Component{Type: "container", Name: image},
+		},
+		Components: []Component{},
+	}
+
+	distro := osID(files[osRelease])
+
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		switch name {
+		case osRelease:
+		case apkDatabase:
+			bom.Components = append(bom.Components, apkPackages(files[name], distro)...)
+		case dpkgDatabase:
+			bom.Components = append(bom.Components, dpkgPackages(files[name], distro)...)
+		default:
+			bom.Components = append(bom.Components, goModules(string(files[name]), "/"+name)...)
+		}
+	}
+
+	return bom
+}
@@ -0,0 +1,148 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"archive/tar"
+	"bytes"
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+type file struct {
+	name string
+	mode int64
+	data []byte
+}
+
+func tarOf(t *testing.T, files ...file) []byte {
+	buf := &bytes.Buffer{}
+	tw := tar.NewWriter(buf)
+	for _, f := range files {
+		if err := tw.WriteHeader(&tar.Header{
+			Name:     f.name,
+			Mode:     f.mode,
+			Size:     int64(len(f.data)),
+			Typeflag: tar.TypeReg,
+		}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write(f.data); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tw.Close()
+
+	return buf.Bytes()
+}
+
+func TestGenerate(t *testing.T) {
+	modinfo := "path\texample.com/mycc\n" +
+		"mod\texample.com/mycc\t(devel)\t\n" +
+		"dep\tgithub.com/hyperledger/fabric-chaincode-go\tv0.0.0-20210603161043-af0e3898842a\th1:abc\n" +
+		"dep\tgithub.com/golang/protobuf\tv1.3.2\th1:def\n" +
+		"=>\tgithub.com/golang/protobuf\tv1.5.2\th1:ghi\n"
+	binary := append([]byte(elfMagic+"...."), modInfoStart...)
+	binary = append(binary, modinfo...)
+	binary = append(binary, modInfoEnd...)
+
+	base := tarOf(t,
+		file{name: "etc/os-release", mode: 0o644, data: []byte("NAME=\"Alpine Linux\"\nID=alpine\n")},
+		file{name: "lib/apk/db/installed", mode: 0o644, data: []byte(
+			"C:Q1\nP:musl\nV:1.2.2-r3\nA:x86_64\n\nP:busybox\nV:1.33.1-r3\nA:x86_64\n",
+		)},
+		file{name: "usr/bin/old", mode: 0o755, data: binary},
+	)
+	upper := tarOf(t,
+		file{name: "usr/bin/.wh.old", mode: 0o644},
+		file{name: "usr/local/bin/chaincode", mode: 0o755, data: binary},
+		file{name: "usr/local/bin/script", mode: 0o755, data: []byte("#!/bin/sh\n")},
+	)
+	manifest, _ := json.Marshal([]map[string]interface{}{
+		{"Config": "config.json", "RepoTags": []string{"mycc:latest"}, "Layers": []string{"base/layer.tar", "upper/layer.tar"}},
+	})
+	// the layers are listed in manifest.json, which may come after them
+	image := tarOf(t,
+		file{name: "upper/layer.tar", mode: 0o644, data: upper},
+		file{name: "base/layer.tar", mode: 0o644, data: base},
+		file{name: "config.json", mode: 0o644, data: []byte("{}")},
+		file{name: "manifest.json", mode: 0o644, data: manifest},
+	)
+
+	bom, err := Generate("mycc:latest", bytes.NewReader(image))
+	if err != nil {
+		t.Fatalf("Generate() error = %v", err)
+	}
+
+	purls := make(map[string]bool)
+	for _, component := range bom.Components {
+		purls[component.PURL] = true
+		for _, property := range component.Properties {
+			if property.Value == "/usr/bin/old" {
+				t.Errorf("Generate() lists %s of a deleted binary", component.Name)
+			}
+		}
+	}
+
+	for _, purl := range []string{
+		"pkg:apk/alpine/musl@1.2.2-r3?arch=x86_64",
+		"pkg:apk/alpine/busybox@1.33.1-r3?arch=x86_64",
+		"pkg:golang/github.com/hyperledger/fabric-chaincode-go@v0.0.0-20210603161043-af0e3898842a",
+		"pkg:golang/github.com/golang/protobuf@v1.5.2",
+	} {
+		if !purls[purl] {
+			t.Errorf("Generate() misses %s, got %v", purl, purls)
+		}
+	}
+	if purls["pkg:golang/github.com/golang/protobuf@v1.3.2"] {
+		t.Errorf("Generate() lists the replaced module")
+	}
+	if len(bom.Components) != 5 {
+		t.Errorf("Generate() got %d components, want 5", len(bom.Components))
+	}
+}
+
+func Test_dpkgPackages(t *testing.T) {
+	status := "Package: libc6\nStatus: install ok installed\nArchitecture: amd64\nVersion: 2.31-13\n" +
+		"Description: GNU C Library\n multi-line description\n\n" +
+		"Package: removed\nStatus: deinstall ok config-files\nVersion: 1.0\n"
+
+	components := dpkgPackages([]byte(status), "")
+	if len(components) != 1 || components[0].PURL != "pkg:deb/debian/libc6@2.31-13?arch=amd64" {
+		t.Errorf("dpkgPackages() = %v", components)
+	}
+}
+
+func TestScanner(t *testing.T) {
+	tests := []struct {
+		name    string
+		option  *options.ScannerOption
+		wantErr error
+	}{
+		{name: "disabled", option: &options.ScannerOption{}},
+		{name: "pass", option: &options.ScannerOption{Command: "true {sbom}", Policy: options.SCAN_POLICY_ENFORCE, Timeout: 10}},
+		{
+			name:    "blocked",
+			option:  &options.ScannerOption{Command: "false {sbom}", Policy: options.SCAN_POLICY_ENFORCE, Timeout: 10},
+			wantErr: ErrBlocked,
+		},
+		{name: "warn", option: &options.ScannerOption{Command: "false {sbom}", Policy: options.SCAN_POLICY_WARN, Timeout: 10}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NewScanner(tt.option).Scan(context.Background(), "mycc:latest", []byte("{}")); err != tt.wantErr {
+				t.Errorf("Scan() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	missing := NewScanner(&options.ScannerOption{Command: "/nonexistent/scanner", Policy: options.SCAN_POLICY_WARN, Timeout: 10})
+	if err := missing.Scan(context.Background(), "mycc:latest", []byte("{}")); err == nil || err == ErrBlocked {
+		t.Errorf("Scan() with a missing scanner error = %v, want the run error", err)
+	}
+}
@@ -0,0 +1,112 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sbom
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+var ErrBlocked = errors.New("image is blocked by the scanner policy")
+
+// Scanner check the SBOM of a chaincode image before it is deployed.
+type Scanner interface {
+	// Enabled report whether images are scanned
+	Enabled() bool
+	// Scan return ErrBlocked if the image must not be deployed
+	Scan(ctx context.Context, image string, bom []byte) error
+}
+
+// NewScanner new scanner from option, images are not scanned if no command is configured.
+func NewScanner(option *options.ScannerOption) Scanner {
+	if option.Command == "" {
+		return nopScanner{}
+	}
+
+	return &commandScanner{
+		command: option.Command,
+		policy:  option.Policy,
+		timeout: time.Duration(option.Timeout) * time.Second,
+	}
+}
+
+type nopScanner struct{}
+
+func (nopScanner) Enabled() bool {
+	return false
+}
+
+func (nopScanner) Scan(ctx context.Context, image string, bom []byte) error {
+	return nil
+}
+
+// commandScanner run a local scanner, like grype or trivy, which exits non-zero on findings.
+type commandScanner struct {
+	command string
+	policy  string
+	timeout time.Duration
+}
+
+func (c *commandScanner) Enabled() bool {
+	return true
+}
+
+func (c *commandScanner) Scan(ctx context.Context, image string, bom []byte) error {
+	file, err := ioutil.TempFile("", "peitho-sbom-*.json")
+	if err != nil {
+		log.Errorf("create sbom file failed: %v", err)
+
+		return err
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := file.Write(bom); err != nil {
+		file.Close()
+		log.Errorf("write sbom file failed: %v", err)
+
+		return err
+	}
+	file.Close()
+
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	args := strings.Fields(strings.NewReplacer("{sbom}", file.Name(), "{image}", image).Replace(c.command))
+	log.Infof("scan %s: %s", image, strings.Join(args, " "))
+
+	// #nosec G204
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	output, err := cmd.CombinedOutput()
+	log.Infof("%s", output)
+
+	exitErr := &exec.ExitError{}
+	if err != nil && (!errors.As(err, &exitErr) || ctx.Err() != nil) {
+		// the scanner did not run to the end, the image is not checked
+		log.Errorf("scan %s failed: %v", image, err)
+
+		return err
+	}
+	if err != nil {
+		if c.policy == options.SCAN_POLICY_WARN {
+			log.Warnf("scanner reported findings in %s, deploy it by the warn policy", image)
+
+			return nil
+		}
+		log.Errorf("scanner reported findings in %s: %v", image, err)
+
+		return ErrBlocked
+	}
+
+	return nil
+}
@@ -0,0 +1,132 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+
+	"github.com/marmotedu/errors"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	cosignPrivateKeyPEMType   = "ENCRYPTED COSIGN PRIVATE KEY"
+	sigstorePrivateKeyPEMType = "ENCRYPTED SIGSTORE PRIVATE KEY"
+)
+
+// encryptedKey is the content of a cosign encrypted private key.
+type encryptedKey struct {
+	KDF struct {
+		Name   string `json:"name"`
+		Params struct {
+			N int `json:"N"`
+			R int `json:"r"`
+			P int `json:"p"`
+		} `json:"params"`
+		Salt []byte `json:"salt"`
+	} `json:"kdf"`
+	Cipher struct {
+		Name  string `json:"name"`
+		Nonce []byte `json:"nonce"`
+	} `json:"cipher"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// LoadPrivateKey load an ECDSA private key from a cosign encrypted key, a PKCS#8 or an EC PEM file.
+func LoadPrivateKey(path string, password string) (*ecdsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("%s is not PEM encoded", path)
+	}
+
+	der := block.Bytes
+	switch block.Type {
+	case cosignPrivateKeyPEMType, sigstorePrivateKeyPEMType:
+		if der, err = decrypt(block.Bytes, password); err != nil {
+			return nil, errors.Errorf("decrypt %s failed: %v", path, err)
+		}
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(der)
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.Errorf("%s is not an ECDSA key", path)
+	}
+
+	return ecdsaKey, nil
+}
+
+// LoadPublicKey load an ECDSA public key from a PEM file.
+func LoadPublicKey(path string) (*ecdsa.PublicKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.Errorf("%s is not PEM encoded", path)
+	}
+
+	key, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	ecdsaKey, ok := key.(*ecdsa.PublicKey)
+	if !ok {
+		return nil, errors.Errorf("%s is not an ECDSA key", path)
+	}
+
+	return ecdsaKey, nil
+}
+
+// decrypt open the scrypt and nacl/secretbox sealed key.
+func decrypt(data []byte, password string) ([]byte, error) {
+	key := encryptedKey{}
+	if err := json.Unmarshal(data, &key); err != nil {
+		return nil, err
+	}
+
+	if key.KDF.Name != "scrypt" || key.Cipher.Name != "nacl/secretbox" {
+		return nil, errors.Errorf("unsupported encryption %s/%s", key.KDF.Name, key.Cipher.Name)
+	}
+	if len(key.Cipher.Nonce) != 24 {
+		return nil, errors.New("invalid nonce")
+	}
+
+	secret, err := scrypt.Key([]byte(password), key.KDF.Salt, key.KDF.Params.N, key.KDF.Params.R, key.KDF.Params.P, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	var nonce [24]byte
+	var boxKey [32]byte
+	copy(nonce[:], key.Cipher.Nonce)
+	copy(boxKey[:], secret)
+
+	plain, ok := secretbox.Open(nil, key.Ciphertext, &nonce, &boxKey)
+	if !ok {
+		return nil, errors.New("wrong password")
+	}
+
+	return plain, nil
+}
@@ -0,0 +1,258 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/marmotedu/errors"
+	digest "github.com/opencontainers/go-digest"
+	specs "github.com/opencontainers/image-spec/specs-go"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+const (
+	// SimpleSigningMediaType is the media type of the cosign signature payload layer.
+	SimpleSigningMediaType = "application/vnd.dev.cosign.simplesigning.v1+json"
+	// SignatureAnnotation holds the base64 signature of the payload layer.
+	SignatureAnnotation = "dev.cosignproject.cosign/signature"
+
+	signatureType = "cosign container image signature"
+)
+
+var (
+	ErrUnsigned         = errors.New("image is not signed")
+	ErrInvalidSignature = errors.New("image signature is invalid")
+)
+
+// payload is the cosign simple signing payload.
+type payload struct {
+	Critical struct {
+		Identity struct {
+			DockerReference string `json:"docker-reference"`
+		} `json:"identity"`
+		Image struct {
+			DockerManifestDigest string `json:"docker-manifest-digest"`
+		} `json:"image"`
+		Type string `json:"type"`
+	} `json:"critical"`
+	Optional map[string]interface{} `json:"optional"`
+}
+
+// Signature is a signed payload.
+type Signature struct {
+	Payload []byte
+	// Signature is the base64 encoded ASN.1 ECDSA signature of the payload sha256
+	Signature string
+}
+
+// Signer sign and verify chaincode images with cosign compatible signatures.
+type Signer struct {
+	key *ecdsa.PrivateKey
+	pub *ecdsa.PublicKey
+}
+
+// NewSigner new signer from option, signing and verifying are disabled if no key is configured.
+func NewSigner(option *options.SigningOption) (*Signer, error) {
+	signer := &Signer{}
+
+	if option.Key != "" {
+		password := option.Password
+		if password == "" {
+			password = os.Getenv("COSIGN_PASSWORD")
+		}
+
+		key, err := LoadPrivateKey(option.Key, password)
+		if err != nil {
+			log.Errorf("load signing key failed: %v", err)
+
+			return nil, err
+		}
+		signer.key = key
+		signer.pub = &key.PublicKey
+	}
+
+	if option.PublicKey != "" {
+		pub, err := LoadPublicKey(option.PublicKey)
+		if err != nil {
+			log.Errorf("load verifying key failed: %v", err)
+
+			return nil, err
+		}
+		signer.pub = pub
+	}
+
+	if signer.pub == nil {
+		log.Warn("signing key is not configured, chaincode images are not signed nor verified")
+	}
+
+	return signer, nil
+}
+
+// CanSign report whether images are signed after build.
+func (s *Signer) CanSign() bool {
+	return s != nil && s.key != nil
+}
+
+// Enabled report whether images are verified before deployment.
+func (s *Signer) Enabled() bool {
+	return s != nil && s.pub != nil
+}
+
+// Tag return the tag cosign stores the signatures of the manifest digest under.
+func Tag(dgst digest.Digest) string {
+	return fmt.Sprintf("%s-%s.sig", dgst.Algorithm(), dgst.Encoded())
+}
+
+// Sign sign the manifest digest of the image in the repository.
+func (s *Signer) Sign(repo string, dgst digest.Digest) (Signature, error) {
+	if !s.CanSign() {
+		return Signature{}, errors.New("signing key is not configured")
+	}
+
+	p := payload{}
+	p.Critical.Identity.DockerReference = repo
+	p.Critical.Image.DockerManifestDigest = dgst.String()
+	p.Critical.Type = signatureType
+
+	data, err := json.Marshal(p)
+	if err != nil {
+		return Signature{}, err
+	}
+
+	hash := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return Signature{}, err
+	}
+
+	return Signature{Payload: data, Signature: base64.StdEncoding.EncodeToString(sig)}, nil
+}
+
+// Verify check the signature is made by the key for the manifest digest of the image in the repository.
+func (s *Signer) Verify(sig Signature, repo string, dgst digest.Digest) error {
+	raw, err := base64.StdEncoding.DecodeString(sig.Signature)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	hash := sha256.Sum256(sig.Payload)
+	if !ecdsa.VerifyASN1(s.pub, hash[:], raw) {
+		return ErrInvalidSignature
+	}
+
+	p := payload{}
+	if err := json.Unmarshal(sig.Payload, &p); err != nil {
+		return ErrInvalidSignature
+	}
+
+	if p.Critical.Type != signatureType ||
+		p.Critical.Identity.DockerReference != repo ||
+		p.Critical.Image.DockerManifestDigest != dgst.String() {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// Manifest build the cosign signature image, return its manifest, config and payload layer.
+func (sig Signature) Manifest() ([]byte, []byte, error) {
+	layer := ocispec.Descriptor{
+		MediaType:   SimpleSigningMediaType,
+		Digest:      digest.FromBytes(sig.Payload),
+		Size:        int64(len(sig.Payload)),
+		Annotations: map[string]string{SignatureAnnotation: sig.Signature},
+	}
+
+	config, err := json.Marshal(ocispec.Image{
+		RootFS: ocispec.RootFS{Type: "layers", DiffIDs: []digest.Digest{layer.Digest}},
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	manifest, err := json.Marshal(struct {
+		MediaType string `json:"mediaType"`
+		ocispec.Manifest
+	}{ocispec.MediaTypeImageManifest, ocispec.Manifest{
+		Versioned: specs.Versioned{SchemaVersion: 2},
+		Config: ocispec.Descriptor{
+			MediaType: ocispec.MediaTypeImageConfig,
+			Digest:    digest.FromBytes(config),
+			Size:      int64(len(config)),
+		},
+		Layers: []ocispec.Descriptor{layer},
+	}})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return manifest, config, nil
+}
+
+// VerifyManifest verify the signature layers of the cosign signature manifest, one valid signature is enough.
+func (s *Signer) VerifyManifest(
+	manifest ocispec.Manifest,
+	blob func(dgst digest.Digest) ([]byte, error),
+	repo string,
+	dgst digest.Digest,
+) error {
+	for _, layer := range manifest.Layers {
+		sig, ok := layer.Annotations[SignatureAnnotation]
+		if layer.MediaType != SimpleSigningMediaType || !ok {
+			continue
+		}
+
+		data, err := blob(layer.Digest)
+		if err != nil || digest.FromBytes(data) != layer.Digest {
+			continue
+		}
+
+		if err := s.Verify(Signature{Payload: data, Signature: sig}, repo, dgst); err == nil {
+			return nil
+		}
+	}
+
+	return ErrInvalidSignature
+}
+
+// SignBlob sign the sha256 of the data, the signature is compatible with `cosign verify-blob`.
+func (s *Signer) SignBlob(data []byte) (string, error) {
+	if !s.CanSign() {
+		return "", errors.New("signing key is not configured")
+	}
+
+	hash := sha256.Sum256(data)
+	sig, err := ecdsa.SignASN1(rand.Reader, s.key, hash[:])
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(sig), nil
+}
+
+// VerifyBlob check the base64 signature is made by the key for the data.
+func (s *Signer) VerifyBlob(data []byte, sig string) error {
+	raw, err := base64.StdEncoding.DecodeString(sig)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	hash := sha256.Sum256(data)
+	if !ecdsa.VerifyASN1(s.pub, hash[:], raw) {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
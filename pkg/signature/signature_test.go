@@ -0,0 +1,160 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package signature
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	digest "github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/scrypt"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+// writeKeys write a cosign encrypted private key and its public key, return their paths.
+func writeKeys(t *testing.T, password string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKCS8PrivateKey(key)
+	pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+
+	sealed := encryptedKey{}
+	sealed.KDF.Name = "scrypt"
+	sealed.KDF.Params.N, sealed.KDF.Params.R, sealed.KDF.Params.P = 1024, 8, 1
+	sealed.KDF.Salt = []byte("0123456789abcdef0123456789abcdef")
+	sealed.Cipher.Name = "nacl/secretbox"
+	sealed.Cipher.Nonce = []byte("0123456789abcdef01234567")
+
+	secret, _ := scrypt.Key([]byte(password), sealed.KDF.Salt, 1024, 8, 1, 32)
+	var nonce [24]byte
+	var boxKey [32]byte
+	copy(nonce[:], sealed.Cipher.Nonce)
+	copy(boxKey[:], secret)
+	sealed.Ciphertext = secretbox.Seal(nil, der, &nonce, &boxKey)
+	data, _ := json.Marshal(sealed)
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "cosign.key")
+	pubPath := filepath.Join(dir, "cosign.pub")
+	if err := ioutil.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: cosignPrivateKeyPEMType, Bytes: data}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(pubPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return keyPath, pubPath
+}
+
+func TestNewSigner(t *testing.T) {
+	keyPath, pubPath := writeKeys(t, "secret")
+
+	if _, err := NewSigner(&options.SigningOption{Key: keyPath, Password: "wrong"}); err == nil {
+		t.Errorf("NewSigner() with wrong password should fail")
+	}
+
+	signer, err := NewSigner(&options.SigningOption{Key: keyPath, Password: "secret"})
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	if !signer.CanSign() || !signer.Enabled() {
+		t.Errorf("NewSigner() with private key should sign and verify")
+	}
+
+	verifier, err := NewSigner(&options.SigningOption{PublicKey: pubPath})
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+	if verifier.CanSign() || !verifier.Enabled() {
+		t.Errorf("NewSigner() with public key should only verify")
+	}
+
+	disabled, _ := NewSigner(&options.SigningOption{})
+	if disabled.Enabled() {
+		t.Errorf("NewSigner() without keys should be disabled")
+	}
+}
+
+func TestSigner_Verify(t *testing.T) {
+	keyPath, pubPath := writeKeys(t, "secret")
+	signer, _ := NewSigner(&options.SigningOption{Key: keyPath, Password: "secret"})
+	verifier, _ := NewSigner(&options.SigningOption{PublicKey: pubPath})
+
+	repo := "registry.example.com/chaincode/mycc"
+	dgst := digest.FromString("manifest")
+
+	sig, err := signer.Sign(repo, dgst)
+	if err != nil {
+		t.Fatalf("Sign() error = %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		repo    string
+		dgst    digest.Digest
+		wantErr bool
+	}{
+		{name: "valid", repo: repo, dgst: dgst},
+		{name: "other repository", repo: "registry.example.com/chaincode/other", dgst: dgst, wantErr: true},
+		{name: "other digest", repo: repo, dgst: digest.FromString("other"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verifier.Verify(sig, tt.repo, tt.dgst); (err != nil) != tt.wantErr {
+				t.Errorf("Verify() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	tampered := sig
+	tampered.Payload = append([]byte{}, sig.Payload...)
+	tampered.Payload[len(tampered.Payload)-2] = ' '
+	if err := verifier.Verify(tampered, repo, dgst); err != ErrInvalidSignature {
+		t.Errorf("Verify() tampered payload error = %v", err)
+	}
+}
+
+func TestSigner_VerifyManifest(t *testing.T) {
+	keyPath, _ := writeKeys(t, "secret")
+	signer, _ := NewSigner(&options.SigningOption{Key: keyPath, Password: "secret"})
+
+	repo := "registry.example.com/chaincode/mycc"
+	dgst := digest.FromString("manifest")
+	sig, _ := signer.Sign(repo, dgst)
+
+	data, _, err := sig.Manifest()
+	if err != nil {
+		t.Fatalf("Manifest() error = %v", err)
+	}
+	manifest := ocispec.Manifest{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		t.Fatal(err)
+	}
+
+	blob := func(d digest.Digest) ([]byte, error) {
+		return sig.Payload, nil
+	}
+	if err := signer.VerifyManifest(manifest, blob, repo, dgst); err != nil {
+		t.Errorf("VerifyManifest() error = %v", err)
+	}
+	if err := signer.VerifyManifest(manifest, blob, repo, digest.FromString("other")); err == nil {
+		t.Errorf("VerifyManifest() for other digest should fail")
+	}
+	if Tag(dgst) != "sha256-"+dgst.Encoded()+".sig" {
+		t.Errorf("Tag() = %s", Tag(dgst))
+	}
+}
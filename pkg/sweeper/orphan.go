@@ -0,0 +1,150 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sweeper
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/log"
+)
+
+const (
+	ORPHAN_ZERO_REPLICAS = "orphan-zero-replicas"
+	ORPHAN_PEER_GONE     = "orphan-peer-gone"
+
+	// REASON_ORPHAN is the reason of the events recorded for the deleted orphans.
+	REASON_ORPHAN = "OrphanDeleted"
+
+	configMapSuffix = "-configmap"
+	tlsSecretSuffix = "-tls"
+)
+
+// reconcile delete the chaincode resources without counterpart: configmaps and tls secrets without deployment,
+// deployments stuck at zero replicas and deployments whose peer is gone for longer than the grace.
+// Deployments the sweeper rules have acted on are left to them.
+func (ps *PeithoSweeper) reconcile(ctx context.Context, now time.Time) {
+	// configmaps and secrets are listed first, the deployment of them is always created before
+	configMaps, err := ps.k8s.ListChaincodeConfigMaps(ctx, nil)
+	if err != nil {
+		log.Errorf("list chaincode configmap failed: %v", err)
+
+		return
+	}
+	secrets, err := ps.k8s.ListTLSSecrets(ctx)
+	if err != nil {
+		log.Errorf("list tls secret failed: %v", err)
+
+		return
+	}
+	ds, err := ps.k8s.ListChaincodeDeployments(ctx, nil)
+	if err != nil {
+		log.Errorf("list chaincode deployment failed: %v", err)
+
+		return
+	}
+
+	exists := make(map[string]bool, len(ds))
+	for i := range ds {
+		deployment := &ds[i]
+		exists[deployment.Name] = true
+
+		if _, ok := deployment.Annotations[k8s.AnnotationSweepRule]; ok {
+			continue
+		}
+		if reason := ps.orphan(deployment, now); reason != "" {
+			ps.deleteOrphan(ctx, "Deployment", deployment.Name, reason)
+		}
+	}
+
+	for _, configMap := range configMaps {
+		if !strings.HasSuffix(configMap.Name, configMapSuffix) {
+			continue
+		}
+		if name := strings.TrimSuffix(configMap.Name, configMapSuffix); !exists[name] {
+			ps.deleteOrphan(ctx, "ConfigMap", name, "its chaincode deployment does not exist")
+		}
+	}
+
+	for _, secret := range secrets {
+		if name := strings.TrimSuffix(secret.Name, tlsSecretSuffix); !exists[name] {
+			ps.deleteOrphan(ctx, "Secret", name, "its chaincode deployment does not exist")
+		}
+	}
+}
+
+// orphan return why the deployment is an orphan, or an empty string.
+func (ps *PeithoSweeper) orphan(deployment *appsv1.Deployment, now time.Time) string {
+	grace := seconds(ps.option.Orphan.Grace)
+
+	if deployment.Spec.Replicas != nil && *deployment.Spec.Replicas == 0 {
+		since := ps.observe(ORPHAN_ZERO_REPLICAS, deployment.Name, now)
+		if now.Sub(since) >= grace {
+			return fmt.Sprintf("scaled to zero replicas since %s", since.Format(time.RFC3339))
+		}
+	} else {
+		ps.forget(ORPHAN_ZERO_REPLICAS, deployment.Name)
+	}
+
+	address := peerAddress(deployment)
+	if address == "" {
+		return ""
+	}
+	if err := ps.dial(resolve(deployment, address)); err != nil {
+		since := ps.observe(ORPHAN_PEER_GONE, deployment.Name, now)
+		if now.Sub(since) >= grace {
+			return fmt.Sprintf("peer %s %s gone since %s: %v",
+				deployment.Labels[k8s.LabelPeerID], address, since.Format(time.RFC3339), err)
+		}
+
+		return ""
+	}
+	ps.forget(ORPHAN_PEER_GONE, deployment.Name)
+
+	return ""
+}
+
+// deleteOrphan delete the deployment with its configmap and tls secret, or the configmap or tls secret of the
+// chaincode name, and record an event of it on the deployment.
+func (ps *PeithoSweeper) deleteOrphan(ctx context.Context, kind string, name string, reason string) {
+	if ps.option.DryRun {
+		log.Infof("dry run: %s of %s is an orphan (%s), would delete it", kind, name, reason)
+
+		return
+	}
+
+	log.Infof("to delete orphan %s of %s: %s", kind, name, reason)
+	var err error
+	switch kind {
+	case "Deployment":
+		err = ps.k8s.DeleteChaincodeDeployment(ctx, name)
+		if err == nil {
+			// delete configmap and secret if exists
+			// ignore err, they are deleted as orphans next time
+			_ = ps.k8s.DeleteConfigMapDeployment(ctx, name)
+			_ = ps.k8s.DeleteTLSSecret(ctx, name)
+			ps.forget(ORPHAN_ZERO_REPLICAS, name)
+			ps.forget(ORPHAN_PEER_GONE, name)
+		}
+	case "ConfigMap":
+		err = ps.k8s.DeleteConfigMapDeployment(ctx, name)
+	case "Secret":
+		err = ps.k8s.DeleteTLSSecret(ctx, name)
+	}
+	if err != nil {
+		log.Errorf("failed to delete %s of %s, cause by: %v", kind, name, err)
+		ps.events.Eventf(name, v1.EventTypeWarning, k8s.REASON_SWEEP_FAILED, "delete orphan %s failed: %v", kind, err)
+
+		return
+	}
+
+	ps.events.Eventf(name, v1.EventTypeNormal, REASON_ORPHAN, "deleted orphan %s: %s", kind, reason)
+}
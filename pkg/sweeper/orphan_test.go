@@ -0,0 +1,151 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sweeper
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func configMap(name string) v1.ConfigMap {
+	return v1.ConfigMap{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+func secret(name string) v1.Secret {
+	return v1.Secret{ObjectMeta: metav1.ObjectMeta{Name: name}}
+}
+
+// events return the events recorded so far.
+func events(recorder *record.FakeRecorder) []string {
+	var result []string
+	for {
+		select {
+		case event := <-recorder.Events:
+			result = append(result, event)
+		default:
+			return result
+		}
+	}
+}
+
+func TestPeithoSweeper_reconcile(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	recorder := record.NewFakeRecorder(10)
+	ps.events = k8s.NewEventRecorder(recorder, "fabric")
+
+	// scaled down by the sweeper, it is left to the sweeper rules
+	swept := deployment("swept", 0, 0)
+	swept.Annotations = map[string]string{k8s.AnnotationSweepRule: RULE_PEER_GONE}
+
+	k8sSrv.EXPECT().ListChaincodeConfigMaps(ctx, nil).
+		Return([]v1.ConfigMap{configMap("running-configmap"), configMap("removed-configmap")}, nil).Times(2)
+	k8sSrv.EXPECT().ListTLSSecrets(ctx).Return(nil, nil).Times(2)
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).
+		Return([]appsv1.Deployment{deployment("running", 1, 0), deployment("pending", 0, 0), swept}, nil).Times(2)
+
+	// the configmap of the removed deployment is deleted at once
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "removed").Return(nil).Times(2)
+	ps.reconcile(ctx, start)
+
+	// the deployment waiting for its tls configmap is deleted after the grace
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "pending").Return(nil)
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "pending").Return(nil)
+	k8sSrv.EXPECT().DeleteTLSSecret(ctx, "pending").Return(nil)
+	ps.reconcile(ctx, start.Add(30*time.Minute))
+
+	want := []string{
+		"Normal OrphanDeleted deleted orphan ConfigMap: its chaincode deployment does not exist",
+		"Normal OrphanDeleted deleted orphan Deployment: scaled to zero replicas since 2021-06-01T08:00:00Z",
+		"Normal OrphanDeleted deleted orphan ConfigMap: its chaincode deployment does not exist",
+	}
+	if got := events(recorder); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestPeithoSweeper_reconcile_tlsSecret(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	recorder := record.NewFakeRecorder(10)
+	ps.events = k8s.NewEventRecorder(recorder, "fabric")
+
+	// the tls secret of the removed deployment is deleted at once, the failure is reported
+	k8sSrv.EXPECT().ListChaincodeConfigMaps(ctx, nil).Return(nil, nil).Times(2)
+	k8sSrv.EXPECT().ListTLSSecrets(ctx).Return([]v1.Secret{secret("running-tls"), secret("removed-tls")}, nil).Times(2)
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("running", 1, 0)}, nil).Times(2)
+	gomock.InOrder(
+		k8sSrv.EXPECT().DeleteTLSSecret(ctx, "removed").Return(errors.New("forbidden")),
+		k8sSrv.EXPECT().DeleteTLSSecret(ctx, "removed").Return(nil),
+	)
+
+	ps.reconcile(ctx, start)
+	ps.reconcile(ctx, start.Add(time.Minute))
+
+	want := []string{
+		"Warning SweepFailed delete orphan Secret failed: forbidden",
+		"Normal OrphanDeleted deleted orphan Secret: its chaincode deployment does not exist",
+	}
+	if got := events(recorder); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestPeithoSweeper_reconcile_peerGone(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	recorder := record.NewFakeRecorder(10)
+	ps.events = k8s.NewEventRecorder(recorder, "fabric")
+	ps.dial = func(string) error { return errors.New("no such host") }
+
+	mycc := deployment("mycc", 1, 0)
+	mycc.Labels = map[string]string{k8s.LabelPeerID: "peer0-org1-example-com"}
+	k8sSrv.EXPECT().ListChaincodeConfigMaps(ctx, nil).Return(nil, nil).Times(3)
+	k8sSrv.EXPECT().ListTLSSecrets(ctx).Return(nil, nil).Times(3)
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{mycc}, nil).Times(3)
+
+	ps.reconcile(ctx, start)
+	ps.reconcile(ctx, start.Add(20*time.Minute))
+
+	// the deployment whose peer is unreachable is deleted after the grace
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "mycc").Return(nil)
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "mycc").Return(nil)
+	k8sSrv.EXPECT().DeleteTLSSecret(ctx, "mycc").Return(nil)
+	ps.reconcile(ctx, start.Add(40*time.Minute))
+
+	want := []string{
+		"Normal OrphanDeleted deleted orphan Deployment: peer peer0-org1-example-com peer0.org1.example.com:7052 gone since 2021-06-01T08:00:00Z: no such host",
+	}
+	if got := events(recorder); !reflect.DeepEqual(got, want) {
+		t.Errorf("events = %q, want %q", got, want)
+	}
+}
+
+func TestPeithoSweeper_reconcile_dryRun(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.DryRun = true
+	ps, k8sSrv := newSweeper(t, option)
+
+	// the decisions are logged, nothing is deleted
+	k8sSrv.EXPECT().ListChaincodeConfigMaps(ctx, nil).Return([]v1.ConfigMap{configMap("removed-configmap")}, nil).Times(2)
+	k8sSrv.EXPECT().ListTLSSecrets(ctx).Return([]v1.Secret{secret("removed-tls")}, nil).Times(2)
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("pending", 0, 0)}, nil).Times(2)
+
+	ps.reconcile(ctx, start)
+	ps.reconcile(ctx, start.Add(time.Hour))
+}
@@ -0,0 +1,202 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sweeper
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+const (
+	RULE_UNAVAILABLE = "unavailable"
+	RULE_CRASH_LOOP  = "crash-loop"
+	RULE_IMAGE_PULL  = "image-pull"
+	RULE_PEER_GONE   = "peer-gone"
+)
+
+// target is a chaincode deployment with its pods, as seen by one sweep.
+type target struct {
+	deployment *appsv1.Deployment
+	pods       []v1.Pod
+	now        time.Time
+}
+
+// rule is a cleanup rule, match returns why the deployment is swept or an empty string.
+type rule struct {
+	name   string
+	option options.SweeperRule
+	match  func(t *target) string
+}
+
+// rules return the enabled rules of the option, in the order they are evaluated.
+func (ps *PeithoSweeper) rules(option *options.SweeperOption) []rule {
+	all := []rule{
+		{name: RULE_CRASH_LOOP, option: option.CrashLoop, match: ps.crashLoop},
+		{name: RULE_IMAGE_PULL, option: option.ImagePull, match: ps.imagePull},
+		{name: RULE_PEER_GONE, option: option.PeerGone, match: ps.peerGone},
+		{name: RULE_UNAVAILABLE, option: option.Unavailable, match: ps.unavailable},
+	}
+
+	var rules []rule
+	for _, r := range all {
+		if r.option.Enable {
+			rules = append(rules, r)
+		}
+	}
+
+	return rules
+}
+
+// unavailable match the deployment observed unavailable for longer than After.
+// Scaled down deployments and deployments still being rolled out are left to the chaincode start.
+func (ps *PeithoSweeper) unavailable(t *target) string {
+	d := t.deployment
+	if d.Status.UnavailableReplicas == 0 || d.Spec.Replicas == nil || *d.Spec.Replicas == 0 || rollingOut(d) {
+		ps.forget(RULE_UNAVAILABLE, d.Name)
+
+		return ""
+	}
+
+	since := ps.observe(RULE_UNAVAILABLE, d.Name, t.now)
+	if t.now.Sub(since) < seconds(ps.option.Unavailable.After) {
+		return ""
+	}
+
+	return fmt.Sprintf("%d replicas unavailable since %s", d.Status.UnavailableReplicas, since.Format(time.RFC3339))
+}
+
+// rollingOut report whether the deployment controller has not observed the latest spec or is still rolling
+// it out. A rollout past its progress deadline is over, the deployment is unavailable.
+func rollingOut(d *appsv1.Deployment) bool {
+	if d.Status.ObservedGeneration < d.Generation {
+		return true
+	}
+
+	for _, condition := range d.Status.Conditions {
+		if condition.Type == appsv1.DeploymentProgressing {
+			return condition.Reason != "NewReplicaSetAvailable" && condition.Reason != "ProgressDeadlineExceeded"
+		}
+	}
+
+	return false
+}
+
+// crashLoop match the deployment with a container in CrashLoopBackOff restarted at least Restarts times.
+func (ps *PeithoSweeper) crashLoop(t *target) string {
+	for _, pod := range t.pods {
+		if t.now.Sub(pod.CreationTimestamp.Time) < seconds(ps.option.CrashLoop.After) {
+			continue
+		}
+		for _, status := range containerStatuses(&pod) {
+			if waiting(status, "CrashLoopBackOff") && int(status.RestartCount) >= ps.option.CrashLoop.Restarts {
+				return fmt.Sprintf("container %s of pod %s restarted %d times", status.Name, pod.Name, status.RestartCount)
+			}
+		}
+	}
+
+	return ""
+}
+
+// imagePull match the deployment with a pod unable to pull its image for longer than After.
+func (ps *PeithoSweeper) imagePull(t *target) string {
+	for _, pod := range t.pods {
+		age := t.now.Sub(pod.CreationTimestamp.Time)
+		if age < seconds(ps.option.ImagePull.After) {
+			continue
+		}
+		for _, status := range containerStatuses(&pod) {
+			if waiting(status, "ImagePullBackOff") || waiting(status, "ErrImagePull") {
+				return fmt.Sprintf("container %s of pod %s cannot pull %s for %s", status.Name, pod.Name, status.Image, age.Truncate(time.Second))
+			}
+		}
+	}
+
+	return ""
+}
+
+// peerGone match the deployment whose peer has been unreachable for longer than After.
+func (ps *PeithoSweeper) peerGone(t *target) string {
+	d := t.deployment
+	address := peerAddress(d)
+	if address == "" {
+		return ""
+	}
+
+	if err := ps.dial(resolve(d, address)); err != nil {
+		since := ps.observe(RULE_PEER_GONE, d.Name, t.now)
+		if t.now.Sub(since) < seconds(ps.option.PeerGone.After) {
+			return ""
+		}
+
+		return fmt.Sprintf("peer %s unreachable since %s: %v", address, since.Format(time.RFC3339), err)
+	}
+	ps.forget(RULE_PEER_GONE, d.Name)
+
+	return ""
+}
+
+// peerAddress return the peer address given to the chaincode by -peer.address or CORE_PEER_ADDRESS.
+func peerAddress(d *appsv1.Deployment) string {
+	containers := d.Spec.Template.Spec.Containers
+	if len(containers) == 0 {
+		return ""
+	}
+
+	args := append(append([]string{}, containers[0].Command...), containers[0].Args...)
+	for _, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			if strings.HasPrefix(field, "-peer.address=") {
+				return strings.TrimPrefix(field, "-peer.address=")
+			}
+		}
+	}
+	for _, env := range containers[0].Env {
+		if env.Name == "CORE_PEER_ADDRESS" {
+			return env.Value
+		}
+	}
+
+	return ""
+}
+
+// resolve replace the peer host with the host alias of the chaincode pod, as the chaincode dials it.
+func resolve(d *appsv1.Deployment, address string) string {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return address
+	}
+
+	for _, alias := range d.Spec.Template.Spec.HostAliases {
+		for _, name := range alias.Hostnames {
+			if name == host {
+				return net.JoinHostPort(alias.IP, port)
+			}
+		}
+	}
+
+	return address
+}
+
+func containerStatuses(pod *v1.Pod) []v1.ContainerStatus {
+	statuses := make([]v1.ContainerStatus, 0, len(pod.Status.InitContainerStatuses)+len(pod.Status.ContainerStatuses))
+	statuses = append(statuses, pod.Status.InitContainerStatuses...)
+
+	return append(statuses, pod.Status.ContainerStatuses...)
+}
+
+func waiting(status v1.ContainerStatus, reason string) bool {
+	return status.State.Waiting != nil && status.State.Waiting.Reason == reason
+}
+
+func seconds(n int) time.Duration {
+	return time.Duration(n) * time.Second
+}
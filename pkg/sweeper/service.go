@@ -5,76 +5,251 @@ import (
 	"github.com/tianrandailove/peitho/pkg/k8s"
 	"github.com/tianrandailove/peitho/pkg/log"
 	"github.com/tianrandailove/peitho/pkg/options"
+	"net"
+	"strings"
+	"sync"
 	"time"
+
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
 )
 
 type SweepService interface {
-	Start()
+	Start(ctx context.Context)
 	Stop()
 }
 
 type PeithoSweeper struct {
 	enable   bool
 	interval int
+	option   *options.SweeperOption
 	k8s      k8s.K8sService
+	events   *k8s.EventRecorder
 	ch       chan struct{}
+	stop     sync.Once
+	ruleset  []rule
+	// dial check the peer address is reachable
+	dial func(address string) error
+
+	lock sync.Mutex
+	// since is when a condition of a rule is first observed, by rule and deployment
+	since map[string]time.Time
 }
 
 func NewPeithoSweeper(k8s k8s.K8sService, option *options.SweeperOption) (*PeithoSweeper, error) {
-	return &PeithoSweeper{
+	ps := &PeithoSweeper{
 		enable:   option.Enable,
 		interval: option.Interval,
+		option:   option,
 		k8s:      k8s,
+		events:   k8s.EventRecorder(),
 		ch:       make(chan struct{}),
-	}, nil
+		dial:     dialPeer,
+		since:    make(map[string]time.Time),
+	}
+	ps.ruleset = ps.rules(option)
+
+	return ps, nil
 }
 
-func (ps *PeithoSweeper) Start() {
-	if !ps.enable {
+// Start sweep every interval until ctx is done or it is stopped.
+func (ps *PeithoSweeper) Start(ctx context.Context) {
+	if !ps.enable && !ps.option.Orphan.Enable {
 		log.Info("needen't to start sweeper")
 
 		return
 	}
-	log.Info("starting sweeper")
+	log.Infof("starting sweeper, dry run: %v", ps.option.DryRun)
 
 	ticker := time.NewTicker(time.Duration(ps.interval) * time.Second)
 	defer ticker.Stop()
 
-	ctx := context.Background()
-
 	for {
 		select {
 		case <-ticker.C:
-			ds, err := ps.k8s.ListDeploymentByPrefix(ctx, k8s.ChaincodePrefix)
-			if err != nil {
-				log.Errorf("list chaincode deployment failed: %v", err)
+			now := time.Now()
+			if ps.enable {
+				ps.sweep(ctx, now)
+			}
+			if ps.option.Orphan.Enable {
+				ps.reconcile(ctx, now)
+			}
+		case <-ctx.Done():
+			log.Info("sweeper stopped")
+
+			return
+		case <-ps.ch:
+			log.Info("sweeper stopped")
+
+			return
+		}
+	}
+}
+
+// Stop stop the sweeper, it can be called more than once.
+func (ps *PeithoSweeper) Stop() {
+	ps.stop.Do(func() {
+		close(ps.ch)
+	})
+}
 
+// sweep evaluate the rules on every chaincode deployment in order until one acts on it, a matching rule which
+// has nothing to do, like an annotation made already, does not mask the later rules.
+func (ps *PeithoSweeper) sweep(ctx context.Context, now time.Time) {
+	ds, err := ps.k8s.ListChaincodeDeployments(ctx, nil)
+	if err != nil {
+		log.Errorf("list chaincode deployment failed: %v", err)
+
+		return
+	}
+
+	exists := make(map[string]bool, len(ds))
+	for i := range ds {
+		deployment := &ds[i]
+		exists[deployment.Name] = true
+
+		pods, err := ps.k8s.ListChaincodePods(ctx, deployment.Name)
+		if err != nil {
+			log.Errorf("list pods of %s failed: %v", deployment.Name, err)
+
+			continue
+		}
+
+		t := &target{deployment: deployment, pods: pods, now: now}
+		for _, r := range ps.ruleset {
+			reason := r.match(t)
+			if reason == "" {
 				continue
 			}
-			for _, deployment := range ds {
-				// chaincode unavailable
-				// to delete it
-				if deployment.Status.UnavailableReplicas > 0 {
-					log.Infof("to delete %s", deployment.Name)
-					err := ps.k8s.DeleteChaincodeDeployment(ctx, deployment.Name)
-					if err != nil {
-						log.Errorf("failed to delete %s, cause by: %v", deployment.Name, err)
-					} else {
-						log.Infof("delete %s success", deployment.Name)
-					}
-					// delete configmap if exists
-					// ignore err
-					_ = ps.k8s.DeleteConfigMapDeployment(ctx, deployment.Name)
-				}
 
+			if ps.act(ctx, deployment, r, reason) {
 				time.Sleep(time.Second)
+
+				break
 			}
-		case <-ps.ch:
-			break
 		}
 	}
+
+	ps.prune(exists)
 }
 
-func (ps *PeithoSweeper) Stop() {
-	ps.ch <- struct{}{}
+// act apply the action of the rule, it return whether the deployment is changed.
+func (ps *PeithoSweeper) act(ctx context.Context, deployment *appsv1.Deployment, r rule, reason string) bool {
+	if ps.option.DryRun {
+		log.Infof("dry run: %s matches rule %s (%s), would %s it", deployment.Name, r.name, reason, r.option.Action)
+		ps.events.Eventf(deployment.Name, v1.EventTypeNormal, k8s.REASON_SWEEP_MATCHED,
+			"dry run: matches rule %s (%s), would %s it", r.name, reason, r.option.Action)
+
+		return false
+	}
+
+	switch r.option.Action {
+	case options.SWEEP_ACTION_DELETE:
+		log.Infof("to delete %s, rule %s: %s", deployment.Name, r.name, reason)
+		err := ps.k8s.DeleteChaincodeDeployment(ctx, deployment.Name)
+		if err != nil {
+			log.Errorf("failed to delete %s, cause by: %v", deployment.Name, err)
+			ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEEP_FAILED,
+				"delete by rule %s (%s) failed: %v", r.name, reason, err)
+		} else {
+			log.Infof("delete %s success", deployment.Name)
+			ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEPT,
+				"deleted by rule %s: %s", r.name, reason)
+		}
+		// delete configmap if exists
+		// ignore err
+		_ = ps.k8s.DeleteConfigMapDeployment(ctx, deployment.Name)
+		ps.forget(r.name, deployment.Name)
+	case options.SWEEP_ACTION_SCALE:
+		log.Infof("to scale %s to zero, rule %s: %s", deployment.Name, r.name, reason)
+		if err := ps.annotate(ctx, deployment, r, reason); err != nil {
+			return false
+		}
+		if err := ps.k8s.ScaleDeployment(ctx, deployment.Name, 0); err != nil {
+			log.Errorf("failed to scale %s, cause by: %v", deployment.Name, err)
+			ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEEP_FAILED,
+				"scale by rule %s (%s) failed: %v", r.name, reason, err)
+
+			return false
+		}
+		ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEPT,
+			"scaled to zero by rule %s: %s", r.name, reason)
+		ps.forget(r.name, deployment.Name)
+	case options.SWEEP_ACTION_ANNOTATE:
+		if deployment.Annotations[k8s.AnnotationSweepRule] == r.name {
+			return false
+		}
+		log.Infof("to annotate %s, rule %s: %s", deployment.Name, r.name, reason)
+		if err := ps.annotate(ctx, deployment, r, reason); err != nil {
+			return false
+		}
+		ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEEP_MATCHED,
+			"matches rule %s: %s", r.name, reason)
+	}
+
+	return true
+}
+
+// annotate record the matched rule on the deployment.
+func (ps *PeithoSweeper) annotate(ctx context.Context, deployment *appsv1.Deployment, r rule, reason string) error {
+	annotations := map[string]string{
+		k8s.AnnotationSweepRule:   r.name,
+		k8s.AnnotationSweepReason: reason,
+	}
+	// the inventory records the chaincode scaled to zero as stopped
+	if r.option.Action == options.SWEEP_ACTION_SCALE {
+		annotations[k8s.AnnotationState] = k8s.STATE_STOPPED
+	}
+	err := ps.k8s.AnnotateDeployment(ctx, deployment.Name, annotations)
+	if err != nil {
+		log.Errorf("failed to annotate %s, cause by: %v", deployment.Name, err)
+		ps.events.Eventf(deployment.Name, v1.EventTypeWarning, k8s.REASON_SWEEP_FAILED,
+			"annotate by rule %s (%s) failed: %v", r.name, reason, err)
+	}
+
+	return err
+}
+
+// observe return when the condition of the rule is first observed on the deployment.
+func (ps *PeithoSweeper) observe(rule string, name string, now time.Time) time.Time {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	key := rule + "/" + name
+	since, ok := ps.since[key]
+	if !ok {
+		since = now
+		ps.since[key] = since
+	}
+
+	return since
+}
+
+// forget clear the condition of the rule observed on the deployment.
+func (ps *PeithoSweeper) forget(rule string, name string) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	delete(ps.since, rule+"/"+name)
+}
+
+// prune clear the conditions observed on the deployments gone.
+func (ps *PeithoSweeper) prune(exists map[string]bool) {
+	ps.lock.Lock()
+	defer ps.lock.Unlock()
+
+	for key := range ps.since {
+		if !exists[key[strings.Index(key, "/")+1:]] {
+			delete(ps.since, key)
+		}
+	}
+}
+
+func dialPeer(address string) error {
+	conn, err := net.DialTimeout("tcp", address, 5*time.Second)
+	if err != nil {
+		return err
+	}
+
+	return conn.Close()
 }
@@ -0,0 +1,317 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package sweeper
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang/mock/gomock"
+	"github.com/marmotedu/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/record"
+
+	"github.com/tianrandailove/peitho/pkg/k8s"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+var start = time.Date(2021, 6, 1, 8, 0, 0, 0, time.UTC)
+
+func deployment(name string, replicas int32, unavailable int32) appsv1.Deployment {
+	return appsv1.Deployment{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec: appsv1.DeploymentSpec{
+			Replicas: &replicas,
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Containers: []v1.Container{{
+						Name:    name,
+						Command: []string{"/bin/sh", "-c", "cd /usr/local/src; ./chaincode -peer.address=peer0.org1.example.com:7052"},
+					}},
+					HostAliases: []v1.HostAlias{{IP: "10.0.0.1", Hostnames: []string{"peer0.org1.example.com"}}},
+				},
+			},
+		},
+		Status: appsv1.DeploymentStatus{UnavailableReplicas: unavailable},
+	}
+}
+
+func pod(name string, created time.Time, reason string, restarts int32) v1.Pod {
+	return v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, CreationTimestamp: metav1.NewTime(created)},
+		Status: v1.PodStatus{
+			ContainerStatuses: []v1.ContainerStatus{{
+				Name:         "chaincode",
+				Image:        "mycc:latest",
+				RestartCount: restarts,
+				State:        v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: reason}},
+			}},
+		},
+	}
+}
+
+func newSweeper(t *testing.T, option *options.SweeperOption) (*PeithoSweeper, *k8s.MockK8sService) {
+	ctrl := gomock.NewController(t)
+	t.Cleanup(ctrl.Finish)
+
+	k8sSrv := k8s.NewMockK8sService(ctrl)
+	k8sSrv.EXPECT().EventRecorder().Return(nil)
+	ps, _ := NewPeithoSweeper(k8sSrv, option)
+	ps.dial = func(string) error { return nil }
+
+	return ps, k8sSrv
+}
+
+func TestPeithoSweeper_unavailable(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+
+	// starting, scaled down and slow chaincode are left alone until the rule lasts 600 seconds
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).
+		Return([]appsv1.Deployment{deployment("slow", 1, 1), deployment("stopped", 0, 0)}, nil).Times(3)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, gomock.Any()).Return(nil, nil).AnyTimes()
+
+	ps.sweep(ctx, start)
+	ps.sweep(ctx, start.Add(5*time.Minute))
+
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "slow").Return(nil)
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "slow").Return(nil)
+	ps.sweep(ctx, start.Add(10*time.Minute))
+}
+
+func TestPeithoSweeper_available(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	k8sSrv.EXPECT().ListChaincodePods(ctx, gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// the deployment becomes available in between, it is observed unavailable again from the last sweep
+	gomock.InOrder(
+		k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("mycc", 1, 1)}, nil),
+		k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("mycc", 1, 0)}, nil),
+		k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("mycc", 1, 1)}, nil).Times(2),
+	)
+
+	ps.sweep(ctx, start)
+	ps.sweep(ctx, start.Add(5*time.Minute))
+	ps.sweep(ctx, start.Add(10*time.Minute))
+	ps.sweep(ctx, start.Add(15*time.Minute))
+}
+
+func TestPeithoSweeper_rollingOut(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	k8sSrv.EXPECT().ListChaincodePods(ctx, gomock.Any()).Return(nil, nil).AnyTimes()
+
+	// the new spec is not observed yet, or its replica set is still rolled out
+	updated := deployment("updated", 1, 1)
+	updated.Generation = 2
+	updated.Status.ObservedGeneration = 1
+	rolling := deployment("rolling", 1, 1)
+	rolling.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ReplicaSetUpdated"}}
+	stuck := deployment("stuck", 1, 1)
+	stuck.Status.Conditions = []appsv1.DeploymentCondition{{Type: appsv1.DeploymentProgressing, Reason: "ProgressDeadlineExceeded"}}
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{updated, rolling, stuck}, nil).Times(2)
+
+	ps.sweep(ctx, start)
+
+	// the rollout past its deadline is unavailable
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "stuck").Return(nil)
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "stuck").Return(nil)
+	ps.sweep(ctx, start.Add(10*time.Minute))
+}
+
+func TestPeithoSweeper_deleteFailed(t *testing.T) {
+	ctx := context.Background()
+	ps, k8sSrv := newSweeper(t, options.NewSweeperOption())
+	recorder := record.NewFakeRecorder(10)
+	ps.events = k8s.NewEventRecorder(recorder, "fabric")
+	k8sSrv.EXPECT().ListChaincodePods(ctx, gomock.Any()).Return(nil, nil).AnyTimes()
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("slow", 1, 1)}, nil).Times(2)
+
+	ps.sweep(ctx, start)
+
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "slow").Return(errors.New("forbidden"))
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "slow").Return(nil)
+	ps.sweep(ctx, start.Add(10*time.Minute))
+
+	want := "Warning SweepFailed delete by rule unavailable (1 replicas unavailable since 2021-06-01T08:00:00Z) failed: forbidden"
+	select {
+	case event := <-recorder.Events:
+		if event != want {
+			t.Errorf("event = %q, want %q", event, want)
+		}
+	default:
+		t.Errorf("no event is recorded on the deployment failed to delete")
+	}
+}
+
+func TestPeithoSweeper_annotated(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.ImagePull.Action = options.SWEEP_ACTION_ANNOTATE
+	ps, k8sSrv := newSweeper(t, option)
+
+	// the image pull rule annotated the deployment already, the unavailable rule still acts on it
+	annotated := deployment("annotated", 1, 1)
+	annotated.Annotations = map[string]string{k8s.AnnotationSweepRule: RULE_IMAGE_PULL}
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{annotated}, nil).Times(2)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "annotated").
+		Return([]v1.Pod{pod("annotated-1", start.Add(-time.Hour), "ImagePullBackOff", 0)}, nil).Times(2)
+
+	ps.sweep(ctx, start)
+
+	k8sSrv.EXPECT().DeleteChaincodeDeployment(ctx, "annotated").Return(nil)
+	k8sSrv.EXPECT().DeleteConfigMapDeployment(ctx, "annotated").Return(nil)
+	ps.sweep(ctx, start.Add(10*time.Minute))
+}
+
+func TestPeithoSweeper_crashLoop(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.CrashLoop.Action = options.SWEEP_ACTION_SCALE
+	ps, k8sSrv := newSweeper(t, option)
+	recorder := record.NewFakeRecorder(10)
+	ps.events = k8s.NewEventRecorder(recorder, "fabric")
+
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).
+		Return([]appsv1.Deployment{deployment("flaky", 1, 1), deployment("broken", 1, 1)}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "flaky").Return([]v1.Pod{pod("flaky-1", start, "CrashLoopBackOff", 2)}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "broken").Return([]v1.Pod{pod("broken-1", start, "CrashLoopBackOff", 5)}, nil)
+
+	gomock.InOrder(
+		k8sSrv.EXPECT().AnnotateDeployment(ctx, "broken", map[string]string{
+			k8s.AnnotationSweepRule:   RULE_CRASH_LOOP,
+			k8s.AnnotationSweepReason: "container chaincode of pod broken-1 restarted 5 times",
+			k8s.AnnotationState:       k8s.STATE_STOPPED,
+		}).Return(nil),
+		k8sSrv.EXPECT().ScaleDeployment(ctx, "broken", int32(0)).Return(nil),
+	)
+
+	ps.sweep(ctx, start.Add(time.Minute))
+
+	// the crash looping chaincode tells why it is stopped
+	want := "Warning Swept scaled to zero by rule crash-loop: container chaincode of pod broken-1 restarted 5 times"
+	select {
+	case event := <-recorder.Events:
+		if event != want {
+			t.Errorf("event = %q, want %q", event, want)
+		}
+	default:
+		t.Errorf("no event is recorded on the swept deployment")
+	}
+}
+
+func TestPeithoSweeper_imagePull(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.ImagePull.Action = options.SWEEP_ACTION_ANNOTATE
+	ps, k8sSrv := newSweeper(t, option)
+
+	annotated := deployment("annotated", 1, 1)
+	annotated.Annotations = map[string]string{k8s.AnnotationSweepRule: RULE_IMAGE_PULL}
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).
+		Return([]appsv1.Deployment{deployment("pulling", 1, 1), deployment("missing", 1, 1), annotated}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "pulling").
+		Return([]v1.Pod{pod("pulling-1", start.Add(-5*time.Minute), "ErrImagePull", 0)}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "missing").
+		Return([]v1.Pod{pod("missing-1", start.Add(-time.Hour), "ImagePullBackOff", 0)}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "annotated").
+		Return([]v1.Pod{pod("annotated-1", start.Add(-time.Hour), "ImagePullBackOff", 0)}, nil)
+
+	// only annotated once, the deployment is kept
+	k8sSrv.EXPECT().AnnotateDeployment(ctx, "missing", gomock.Any()).Return(nil)
+
+	ps.sweep(ctx, start)
+}
+
+func TestPeithoSweeper_peerGone(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.PeerGone.Enable = true
+	ps, k8sSrv := newSweeper(t, option)
+
+	dialed := ""
+	ps.dial = func(address string) error {
+		dialed = address
+
+		return errors.New("connection refused")
+	}
+
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).
+		Return([]appsv1.Deployment{deployment("mycc", 1, 0)}, nil).Times(2)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "mycc").Return(nil, nil).Times(2)
+
+	ps.sweep(ctx, start)
+	if dialed != "10.0.0.1:7052" {
+		t.Errorf("dialed %s, want the host alias of the peer", dialed)
+	}
+
+	k8sSrv.EXPECT().AnnotateDeployment(ctx, "mycc", gomock.Any()).Return(nil)
+	k8sSrv.EXPECT().ScaleDeployment(ctx, "mycc", int32(0)).Return(nil)
+	ps.sweep(ctx, start.Add(time.Hour))
+}
+
+func TestPeithoSweeper_dryRun(t *testing.T) {
+	ctx := context.Background()
+	option := options.NewSweeperOption()
+	option.DryRun = true
+	ps, k8sSrv := newSweeper(t, option)
+
+	// the decision is logged, nothing is deleted
+	k8sSrv.EXPECT().ListChaincodeDeployments(ctx, nil).Return([]appsv1.Deployment{deployment("mycc", 1, 1)}, nil)
+	k8sSrv.EXPECT().ListChaincodePods(ctx, "mycc").Return([]v1.Pod{pod("mycc-1", start, "CrashLoopBackOff", 10)}, nil)
+
+	ps.sweep(ctx, start)
+}
+
+func TestSweeperOption_Validate(t *testing.T) {
+	option := options.NewSweeperOption()
+	if errs := option.Validate(); len(errs) != 0 {
+		t.Errorf("Validate() of the default option = %v", errs)
+	}
+
+	option.PeerGone.Action = "restart"
+	if errs := option.Validate(); len(errs) != 1 {
+		t.Errorf("Validate() of an unknown action = %v, want 1 error", errs)
+	}
+}
+
+func TestPeithoSweeper_Start(t *testing.T) {
+	option := options.NewSweeperOption()
+	option.Interval = 3600
+
+	// stopped more than once, Start returns
+	ps, _ := newSweeper(t, option)
+	stopped := make(chan struct{})
+	go func() {
+		ps.Start(context.Background())
+		close(stopped)
+	}()
+	ps.Stop()
+	ps.Stop()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Start() does not return after Stop()")
+	}
+
+	// the context is done, Start returns
+	ps, _ = newSweeper(t, option)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped = make(chan struct{})
+	go func() {
+		ps.Start(ctx)
+		close(stopped)
+	}()
+	cancel()
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Start() does not return after the context is done")
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/log"
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid download token")
+	ErrExpiredToken = errors.New("download token expired")
+	ErrNoSecret     = errors.New("download secret must be configured in delivery mode")
+)
+
+// Signer mint and verify tokens bound to an image.
+type Signer struct {
+	secret []byte
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewSigner new signer from option. The secret must be shared by the replicas of peitho in delivery mode,
+// a token issued by one of them is verified by any other. It is random out of delivery mode, where no token
+// is given out.
+func NewSigner(option *options.PeithoOption) (*Signer, error) {
+	secret := []byte(option.DownloadSecret)
+	if len(secret) == 0 {
+		if option.ImageMode == options.IMAGE_MODE_DELIVERY {
+			log.Errorf("download secret is not configured")
+
+			return nil, ErrNoSecret
+		}
+		log.Warn("download secret is not configured, generate a random one")
+
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			log.Errorf("generate download secret failed: %v", err)
+
+			return nil, err
+		}
+	}
+
+	return &Signer{
+		secret: secret,
+		ttl:    time.Duration(option.DownloadTokenTTL) * time.Second,
+		now:    time.Now,
+	}, nil
+}
+
+// Sign mint a token for image which expires after ttl.
+func (s *Signer) Sign(image string) string {
+	expiry := strconv.FormatInt(s.now().Add(s.ttl).Unix(), 10)
+
+	return fmt.Sprintf("%s.%s", expiry, s.mac(image, expiry))
+}
+
+// Verify check the signature, expiry and image binding of token.
+func (s *Signer) Verify(token string, image string) error {
+	parts := strings.SplitN(token, ".", 2)
+	if len(parts) != 2 {
+		return ErrInvalidToken
+	}
+
+	if !hmac.Equal([]byte(parts[1]), []byte(s.mac(image, parts[0]))) {
+		return ErrInvalidToken
+	}
+
+	expiry, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	if s.now().Unix() > expiry {
+		return ErrExpiredToken
+	}
+
+	return nil
+}
+
+func (s *Signer) mac(image string, expiry string) string {
+	hasher := hmac.New(sha256.New, s.secret)
+	hasher.Write([]byte(image))
+	hasher.Write([]byte{'\n'})
+	hasher.Write([]byte(expiry))
+
+	return base64.RawURLEncoding.EncodeToString(hasher.Sum(nil))
+}
@@ -0,0 +1,77 @@
+// Copyright 2021 Ke Fan <litesky@foxmail.com>. All rights reserved.
+// Use of this source code is governed by a MIT style
+// license that can be found in the LICENSE file.
+
+package token
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/marmotedu/errors"
+
+	"github.com/tianrandailove/peitho/pkg/options"
+)
+
+func TestSigner(t *testing.T) {
+	signer, err := NewSigner(&options.PeithoOption{DownloadSecret: "secret", DownloadTokenTTL: 60})
+	if err != nil {
+		t.Fatalf("NewSigner() error = %v", err)
+	}
+
+	token := signer.Sign("dev-peer0-org1-mycc-1.0")
+
+	if err := signer.Verify(token, "dev-peer0-org1-mycc-1.0"); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+
+	if err := signer.Verify(token, "dev-peer0-org1-othercc-1.0"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with other image error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	other, _ := NewSigner(&options.PeithoOption{DownloadSecret: "other", DownloadTokenTTL: 60})
+	if err := other.Verify(token, "dev-peer0-org1-mycc-1.0"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Verify() with other secret error = %v, want %v", err, ErrInvalidToken)
+	}
+
+	expired, _ := NewSigner(&options.PeithoOption{DownloadSecret: "secret", DownloadTokenTTL: -60})
+	if err := signer.Verify(expired.Sign("dev-peer0-org1-mycc-1.0"), "dev-peer0-org1-mycc-1.0"); !errors.Is(
+		err,
+		ErrExpiredToken,
+	) {
+		t.Errorf("Verify() expired token error = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestSigner_replicas(t *testing.T) {
+	option := &options.PeithoOption{DownloadSecret: "secret", DownloadTokenTTL: 60}
+	issuer, _ := NewSigner(option)
+	token := issuer.Sign("dev-peer0-org1-mycc-1.0")
+
+	// the puller downloads from another replica than the one it got the token from
+	replica, _ := NewSigner(option)
+	if err := replica.Verify(token, "dev-peer0-org1-mycc-1.0"); err != nil {
+		t.Errorf("Verify() on other replica error = %v", err)
+	}
+
+	replica.now = func() time.Time {
+		return time.Now().Add(time.Hour)
+	}
+	if err := replica.Verify(token, "dev-peer0-org1-mycc-1.0"); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify() after ttl error = %v, want %v", err, ErrExpiredToken)
+	}
+
+	// every token expires, there is no expiry meaning never
+	forged := fmt.Sprintf("0.%s", issuer.mac("dev-peer0-org1-mycc-1.0", "0"))
+	if err := issuer.Verify(forged, "dev-peer0-org1-mycc-1.0"); !errors.Is(err, ErrExpiredToken) {
+		t.Errorf("Verify() token without expiry error = %v, want %v", err, ErrExpiredToken)
+	}
+}
+
+func TestNewSigner_delivery(t *testing.T) {
+	option := &options.PeithoOption{ImageMode: options.IMAGE_MODE_DELIVERY, DownloadTokenTTL: 60}
+	if _, err := NewSigner(option); !errors.Is(err, ErrNoSecret) {
+		t.Errorf("NewSigner() without secret in delivery mode error = %v, want %v", err, ErrNoSecret)
+	}
+}